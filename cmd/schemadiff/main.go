@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pg/dts/internal/config"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/service"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Exit codes
+const (
+	exitMatch = 0 // Source and target tables match
+	exitDiff  = 1 // Differences found
+	exitError = 2 // The comparison failed
+)
+
+// schemadiff compares the structure of a task's source tables with their target tables and prints
+// the differences and the statements making the target match the source. The task is read from the
+// metadata database configured as for the server.
+func main() {
+	taskID := flag.String("task", "", "ID of the task whose tables are compared")
+	asJSON := flag.Bool("json", false, "Print the diff as JSON")
+
+	cfg, _, err := config.LoadWithFlags("configs/config.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		config.PrintUsage()
+		os.Exit(exitError)
+	}
+	repository.SetBookkeepingSchema(cfg.Target.BookkeepingSchema)
+	if *taskID == "" {
+		fmt.Fprintln(os.Stderr, "Missing -task")
+		config.PrintUsage()
+		os.Exit(exitError)
+	}
+
+	db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to metadata database: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	diff, err := service.NewMigrationService(db).DiffSchema(*taskID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to compare schema: %v\n", err)
+		os.Exit(exitError)
+	}
+	if diff == nil {
+		fmt.Fprintln(os.Stderr, "Schema diff requires the postgresql sink")
+		os.Exit(exitError)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode diff: %v\n", err)
+			os.Exit(exitError)
+		}
+	} else {
+		printDiff(diff)
+	}
+
+	if !diff.Empty() {
+		os.Exit(exitDiff)
+	}
+	os.Exit(exitMatch)
+}
+
+// printDiff prints the differences of each table followed by its statements
+func printDiff(diff *model.SchemaDiff) {
+	for _, table := range diff.Tables {
+		fmt.Printf("%s: %s.%s -> %s.%s\n", table.Database, table.SourceSchema, table.SourceTable, table.TargetSchema, table.TargetTable)
+		for _, change := range table.Changes {
+			line := fmt.Sprintf("  %s %s %s", change.Kind, change.Object, change.Name)
+			if change.Field != "" {
+				line += " " + change.Field
+			}
+			if change.Source != "" || change.Target != "" {
+				line += fmt.Sprintf(": source %q, target %q", change.Source, change.Target)
+			}
+			fmt.Println(line)
+		}
+		for _, stmt := range table.Statements {
+			fmt.Printf("  %s;\n", stmt)
+		}
+	}
+	for _, table := range diff.Skipped {
+		fmt.Printf("%s: skipped, columns are transformed\n", table)
+	}
+	fmt.Printf("%d tables compared, %d differ\n", diff.Compared, len(diff.Tables))
+}
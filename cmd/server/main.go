@@ -11,6 +11,7 @@ import (
 	"github.com/pg/dts/internal/config"
 	"github.com/pg/dts/internal/logger"
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
 	"github.com/pg/dts/internal/service"
 	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
@@ -47,6 +48,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
+	repository.SetBookkeepingSchema(cfg.Target.BookkeepingSchema)
 
 	log := logger.GetLogger()
 	log.WithFields(logrus.Fields{
@@ -86,6 +88,12 @@ func main() {
 		}
 		log.Info("Updated migration_tasks table schema")
 	}
+	if err := migrator.AutoMigrate(&model.FullSyncChunk{}); err != nil {
+		log.WithError(err).Fatal("Failed to migrate full_sync_chunks table")
+	}
+	if err := migrator.AutoMigrate(&model.SchemaStatement{}); err != nil {
+		log.WithError(err).Fatal("Failed to migrate schema_statements table")
+	}
 	log.Info("Database schema initialized")
 
 	// Create service
@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pg/dts/internal/logger"
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
 	"github.com/pg/dts/internal/repository"
 	"github.com/pg/dts/internal/service"
+	"github.com/pg/dts/internal/wal"
 )
 
 // TaskHandler handles tasks (according to the new API specification)
@@ -23,11 +26,23 @@ func NewTaskHandler(svc *service.MigrationService) *TaskHandler {
 
 // CreateTaskRequest represents a create task request
 type CreateTaskRequest struct {
-	TaskID      string       `json:"task_id" binding:"required"`
-	DatabaseType string      `json:"database_type" binding:"required"` // postgresql, mysql, etc.
-	Source      DBConnection `json:"source" binding:"required"`
-	Dest        DBConnection `json:"dest" binding:"required"`
-	Tables      []string     `json:"tables,omitempty"` // Optional, if not specified, sync all tables
+	TaskID       string                           `json:"task_id" binding:"required"`
+	DatabaseType string                           `json:"database_type" binding:"required"` // postgresql, mysql, etc.
+	Source       DBConnection                     `json:"source" binding:"required"`
+	Dest         DBConnection                     `json:"dest" binding:"required"`
+	Tables       []string                         `json:"tables,omitempty"`       // Optional, [schema.]table names, if not specified, sync all selected tables
+	Selection    *model.TableSelection            `json:"selection,omitempty"`    // Optional, schema and table patterns selecting the tables when none are listed
+	Fallback     bool                             `json:"fallback,omitempty"`     // Optional, stream target changes back to source after switchover until finalized
+	TwoPhase     bool                             `json:"two_phase,omitempty"`    // Optional, stage prepared source transactions as prepared transactions on the dest
+	Archive      *model.ArchiveConfig             `json:"archive,omitempty"`      // Optional, archive every decoded change to local files
+	Sink         *model.SinkConfig                `json:"sink,omitempty"`         // Optional, where changes are delivered, defaults to the dest database
+	Partitioning map[string]model.PartitionConfig `json:"partitioning,omitempty"` // Optional, partition dest tables differently from the source
+	FullSync     *model.FullSyncConfig            `json:"full_sync,omitempty"`    // Optional, full sync parallelism and chunk size
+	Throttle     *model.ThrottleConfig            `json:"throttle,omitempty"`     // Optional, initial rate limits, adjustable with PATCH /throttle
+	Transform    map[string]model.TableTransform  `json:"transform,omitempty"`    // Optional, rename, drop, cast, add and filter columns by source table
+	Masking      *model.MaskingConfig             `json:"masking,omitempty"`      // Optional, anonymize columns on the dest, e.g. for staging copies
+	NameMapping  *model.NameMapping               `json:"name_mapping,omitempty"` // Optional, rename databases, schemas and tables on the dest
+	DDL          *model.DDLConfig                 `json:"ddl,omitempty"`          // Optional, whether failed schema statements fail the task
 }
 
 // DBConnection represents database connection information
@@ -39,6 +54,18 @@ type DBConnection struct {
 	Database string `json:"database,omitempty"` // Optional, defaults to username
 }
 
+// toDBConfig converts connection information to internal database configuration
+func (d DBConnection) toDBConfig() model.DBConfig {
+	return model.DBConfig{
+		Host:     d.Domin, // Note: API specification uses "domin" instead of "domain"
+		Port:     parseInt(d.Port, 5432),
+		User:     d.Username,
+		Password: d.Password,
+		DBName:   getStringOrDefault(d.Database, "postgres"),
+		SSLMode:  "disable",
+	}
+}
+
 // CreateTaskResponse represents a create task response
 type CreateTaskResponse struct {
 	State   string `json:"state"`   // OK, ERROR
@@ -68,25 +95,18 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 	}).Info("Creating migration task")
 
 	// Convert request format to internal format
-	sourceDB := model.DBConfig{
-		Host:     req.Source.Domin, // Note: API specification uses "domin" instead of "domain"
-		Port:     parseInt(req.Source.Port, 5432),
-		User:     req.Source.Username,
-		Password: req.Source.Password,
-		DBName:   getStringOrDefault(req.Source.Database, "postgres"),
-		SSLMode:  "disable",
-	}
+	sourceDB := req.Source.toDBConfig()
+	targetDB := req.Dest.toDBConfig()
 
-	targetDB := model.DBConfig{
-		Host:     req.Dest.Domin, // Note: API specification uses "domin" instead of "domain"
-		Port:     parseInt(req.Dest.Port, 5432),
-		User:     req.Dest.Username,
-		Password: req.Dest.Password,
-		DBName:   getStringOrDefault(req.Dest.Database, "postgres"),
-		SSLMode:  "disable",
+	// If no tables specified, get all selected tables from source database
+	selector, err := naming.NewSelector(req.Selection)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, CreateTaskResponse{
+			State:   "ERROR",
+			Message: "Invalid selection: " + err.Error(),
+		})
+		return
 	}
-
-	// If no tables specified, get all tables from source database
 	tables := req.Tables
 	if len(tables) == 0 {
 		log.Info("No tables specified, fetching all tables from source database")
@@ -102,8 +122,8 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		}
 		defer sourceRepo.Close()
 
-		// Get all tables (from public schema)
-		allTables, err := sourceRepo.GetAllTables("public")
+		// Get the selected tables of every non-system schema
+		allTables, err := sourceRepo.DiscoverTables(selector)
 		if err != nil {
 			log.WithError(err).Error("Failed to get tables from source database")
 			c.JSON(http.StatusInternalServerError, CreateTaskResponse{
@@ -133,6 +153,18 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		TargetDB:     targetDB,
 		Tables:       tables,
 		TableSuffix:  "", // Default no suffix
+		Fallback:     req.Fallback,
+		TwoPhase:     req.TwoPhase,
+		Archive:      req.Archive,
+		Sink:         req.Sink,
+		Partitioning: req.Partitioning,
+		FullSync:     req.FullSync,
+		Throttle:     req.Throttle,
+		Transform:    req.Transform,
+		Masking:      req.Masking,
+		NameMapping:  req.NameMapping,
+		Selection:    req.Selection,
+		DDL:          req.DDL,
 	}
 
 	task, err := h.service.CreateTaskWithID(req.TaskID, createReq)
@@ -157,9 +189,12 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 type GetTaskStatusResponse struct {
 	State    string `json:"state"`    // OK, ERROR
 	Message  string `json:"message"`  // Error description
-	Stage    string `json:"stage"`    // none, syncing, waiting, switching, finished
+	Stage    string `json:"stage"`    // none, syncing, waiting, switching, fallback, finished
+	Progress int    `json:"progress"` // Data copied 0-100, tables weighted by estimated rows
 	Duration int64  `json:"duration"` // Time from switchover start to completion, in ms, -1 means meaningless
 	Delay    int64  `json:"delay"`    // Synchronization delay, in ms, -1 means meaningless
+
+	Estimate *model.Estimate `json:"estimate,omitempty"` // Remaining full sync time and incremental sync catch-up prediction
 }
 
 // GetTaskStatus queries synchronization task status
@@ -194,29 +229,37 @@ func (h *TaskHandler) GetTaskStatus(c *gin.Context) {
 	// Calculate delay (synchronization delay)
 	// TODO: Implement actual delay calculation (needs to get from WAL replication)
 	delay := int64(-1)
-	if stage == "syncing" || stage == "waiting" || stage == "switching" {
+	if stage == "syncing" || stage == "waiting" || stage == "switching" || stage == "fallback" {
 		// Need to get delay from WAL replication status
 		// Temporarily return -1
 		delay = -1
 	}
 
+	estimate, err := h.service.EstimateTask(taskID)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("task_id", taskID).Warn("Failed to estimate task")
+	}
+
 	c.JSON(http.StatusOK, GetTaskStatusResponse{
 		State:    "OK",
 		Message:  "",
 		Stage:    stage,
+		Progress: task.Progress,
 		Duration: duration,
 		Delay:    delay,
+		Estimate: estimate,
 	})
 }
 
 // SwitchTaskResponse represents a switch task response
 type SwitchTaskResponse struct {
-	State   string `json:"state"`   // OK, ERROR
-	Message string `json:"message"` // Error description
+	State      string            `json:"state"`                 // OK, ERROR
+	Message    string            `json:"message"`               // Error description
+	SchemaDiff *model.SchemaDiff `json:"schema_diff,omitempty"` // Differences between the source and target tables
 }
 
 // SwitchTask performs switchover
-// POST /dts/api/tasks/{task_id}/switch
+// POST /dts/api/tasks/{task_id}/switch?force=true
 func (h *TaskHandler) SwitchTask(c *gin.Context) {
 	taskID := c.Param("task_id")
 
@@ -239,8 +282,17 @@ func (h *TaskHandler) SwitchTask(c *gin.Context) {
 		return
 	}
 
-	// Trigger switchover flow (Waiting -> Validating)
-	if err := h.service.TriggerSwitchover(c.Request.Context(), taskID); err != nil {
+	// Trigger switchover flow (Waiting -> Validating), refused on schema drift unless forced
+	diff, err := h.service.TriggerSwitchover(c.Request.Context(), taskID, c.Query("force") == "true")
+	if errors.Is(err, service.ErrSchemaDrift) {
+		c.JSON(http.StatusConflict, SwitchTaskResponse{
+			State:      "ERROR",
+			Message:    "Switchover refused: " + err.Error() + ", retry with force=true to switch anyway",
+			SchemaDiff: diff,
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, SwitchTaskResponse{
 			State:   "ERROR",
 			Message: "Failed to trigger switchover: " + err.Error(),
@@ -249,8 +301,295 @@ func (h *TaskHandler) SwitchTask(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, SwitchTaskResponse{
+		State:      "OK",
+		Message:    "Switchover triggered successfully",
+		SchemaDiff: diff,
+	})
+}
+
+// FinalizeTask ends the fallback period after switchover
+// POST /dts/api/tasks/{task_id}/finalize
+func (h *TaskHandler) FinalizeTask(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	task, err := h.service.GetTask(taskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, SwitchTaskResponse{
+			State:   "ERROR",
+			Message: "Task not found: " + err.Error(),
+		})
+		return
+	}
+
+	// Finalize is only allowed while reverse replication is running (Fallback -> Completed)
+	if task.State != string(model.StateFallback) {
+		c.JSON(http.StatusBadRequest, SwitchTaskResponse{
+			State:   "ERROR",
+			Message: fmt.Sprintf("Task must be in 'fallback' state to finalize. Current state: %s", task.State),
+		})
+		return
+	}
+
+	if err := h.service.FinalizeTask(taskID); err != nil {
+		c.JSON(http.StatusInternalServerError, SwitchTaskResponse{
+			State:   "ERROR",
+			Message: "Failed to finalize task: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SwitchTaskResponse{
+		State:   "OK",
+		Message: "Task finalized successfully",
+	})
+}
+
+// ReplayArchiveRequest represents an archive replay request
+type ReplayArchiveRequest struct {
+	Stream     string        `json:"stream,omitempty"`      // forward (default) or reverse
+	FromLSN    string        `json:"from_lsn,omitempty"`    // e.g. 0/16B3748, empty means from the beginning
+	ToLSN      string        `json:"to_lsn,omitempty"`      // empty means to the end of the archive
+	Dest       *DBConnection `json:"dest,omitempty"`        // Optional, defaults to the task target (forward) or source (reverse)
+	OnConflict string        `json:"on_conflict,omitempty"` // error (default) or ignore
+}
+
+// ReplayStatusResponse represents an archive replay status response
+type ReplayStatusResponse struct {
+	State   string                `json:"state"`   // OK, ERROR
+	Message string                `json:"message"` // Error description
+	Replay  *service.ReplayStatus `json:"replay,omitempty"`
+}
+
+// ReplayArchive replays a range of the task's change stream archive into a target database
+// POST /dts/api/tasks/{task_id}/replay
+func (h *TaskHandler) ReplayArchive(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	var req ReplayArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, SwitchTaskResponse{
+			State:   "ERROR",
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	replayReq := &service.ReplayRequest{
+		Stream:     req.Stream,
+		FromLSN:    req.FromLSN,
+		ToLSN:      req.ToLSN,
+		OnConflict: req.OnConflict,
+	}
+	if req.Dest != nil {
+		targetDB := req.Dest.toDBConfig()
+		replayReq.TargetDB = &targetDB
+	}
+
+	if err := h.service.ReplayArchive(taskID, replayReq); err != nil {
+		c.JSON(http.StatusInternalServerError, SwitchTaskResponse{
+			State:   "ERROR",
+			Message: "Failed to start replay: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SwitchTaskResponse{
+		State:   "OK",
+		Message: "Replay started successfully",
+	})
+}
+
+// GetReplayStatus queries the status of the task's latest archive replay
+// GET /dts/api/tasks/{task_id}/replay
+func (h *TaskHandler) GetReplayStatus(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	status, ok := h.service.GetReplayStatus(taskID)
+	if !ok {
+		c.JSON(http.StatusNotFound, ReplayStatusResponse{
+			State:   "ERROR",
+			Message: "No replay found for task " + taskID,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReplayStatusResponse{
+		State:  "OK",
+		Replay: &status,
+	})
+}
+
+// ProgressResponse represents a progress response
+type ProgressResponse struct {
+	State    string                `json:"state"`   // OK, ERROR
+	Message  string                `json:"message"` // Error description
+	Progress *service.TaskProgress `json:"progress,omitempty"`
+}
+
+// GetProgress queries the overall progress and the per-table full sync progress of a task
+// GET /dts/api/tasks/{task_id}/progress
+func (h *TaskHandler) GetProgress(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	progress, err := h.service.GetProgress(taskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ProgressResponse{
+			State:   "ERROR",
+			Message: "Failed to get progress: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ProgressResponse{
+		State:    "OK",
+		Progress: progress,
+	})
+}
+
+// SchemaStatementsResponse represents a schema statement list response
+type SchemaStatementsResponse struct {
+	State      string                  `json:"state"`   // OK, ERROR
+	Message    string                  `json:"message"` // Error description
+	Statements []model.SchemaStatement `json:"statements"`
+}
+
+// ListSchemaStatements lists the DDL statements run on the dest and their outcome
+// GET /dts/api/tasks/{task_id}/schema/statements?section=post-data&status=failed
+func (h *TaskHandler) ListSchemaStatements(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	section, status := c.Query("section"), c.Query("status")
+	switch section {
+	case "", model.SectionPreData, model.SectionPostData:
+	default:
+		c.JSON(http.StatusBadRequest, SchemaStatementsResponse{
+			State:   "ERROR",
+			Message: "Invalid section: " + section,
+		})
+		return
+	}
+
+	statements, err := h.service.ListSchemaStatements(taskID, section, status)
+	if err != nil {
+		c.JSON(http.StatusNotFound, SchemaStatementsResponse{
+			State:   "ERROR",
+			Message: "Failed to list schema statements: " + err.Error(),
+		})
+		return
+	}
+	if statements == nil {
+		statements = []model.SchemaStatement{}
+	}
+
+	c.JSON(http.StatusOK, SchemaStatementsResponse{
+		State:      "OK",
+		Statements: statements,
+	})
+}
+
+// SchemaDiffResponse represents a schema diff response
+type SchemaDiffResponse struct {
+	State      string            `json:"state"`   // OK, ERROR
+	Message    string            `json:"message"` // Error description
+	SchemaDiff *model.SchemaDiff `json:"schema_diff,omitempty"`
+}
+
+// GetSchemaDiff compares the structure of the task's source tables with their dest tables
+// GET /dts/api/tasks/{task_id}/schema/diff
+func (h *TaskHandler) GetSchemaDiff(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	if _, err := h.service.GetTask(taskID); err != nil {
+		c.JSON(http.StatusNotFound, SchemaDiffResponse{
+			State:   "ERROR",
+			Message: "Task not found: " + err.Error(),
+		})
+		return
+	}
+
+	diff, err := h.service.DiffSchema(taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SchemaDiffResponse{
+			State:   "ERROR",
+			Message: "Failed to compare schema: " + err.Error(),
+		})
+		return
+	}
+	if diff == nil {
+		c.JSON(http.StatusBadRequest, SchemaDiffResponse{
+			State:   "ERROR",
+			Message: "Schema diff requires the postgresql sink",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SchemaDiffResponse{
+		State:      "OK",
+		SchemaDiff: diff,
+	})
+}
+
+// MarkersResponse represents a marker list response
+type MarkersResponse struct {
+	State   string       `json:"state"`   // OK, ERROR
+	Message string       `json:"message"` // Error description
+	Markers []wal.Marker `json:"markers"`
+}
+
+// ListMarkers lists the logical decoding markers applied by the task's replication stream
+// GET /dts/api/tasks/{task_id}/markers?stream=forward&prefix=app.
+func (h *TaskHandler) ListMarkers(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	markers, err := h.service.ListMarkers(taskID, c.Query("stream"), c.Query("prefix"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, MarkersResponse{
+			State:   "ERROR",
+			Message: "Failed to list markers: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, MarkersResponse{
 		State:   "OK",
-		Message: "Switchover triggered successfully",
+		Markers: markers,
+	})
+}
+
+// ThrottleResponse represents a throttle response
+type ThrottleResponse struct {
+	State    string                `json:"state"`   // OK, ERROR
+	Message  string                `json:"message"` // Error description
+	Throttle *model.ThrottleConfig `json:"throttle,omitempty"`
+}
+
+// UpdateThrottle changes the task's rate limits, taking effect immediately if the task is running
+// PATCH /dts/api/tasks/{task_id}/throttle
+func (h *TaskHandler) UpdateThrottle(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	var req service.ThrottleUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ThrottleResponse{
+			State:   "ERROR",
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	cfg, err := h.service.UpdateThrottle(taskID, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ThrottleResponse{
+			State:   "ERROR",
+			Message: "Failed to update throttle: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ThrottleResponse{
+		State:    "OK",
+		Message:  "Throttle updated successfully",
+		Throttle: cfg,
 	})
 }
 
@@ -361,7 +700,7 @@ func mapStateToStage(state string) string {
 	switch state {
 	case string(model.StateInit):
 		return "none"
-	case string(model.StateConnect), string(model.StateCreateTables), string(model.StateFullSync):
+	case string(model.StateConnect), string(model.StateCreateTables), string(model.StateFullSync), string(model.StateCreateIndexes):
 		return "syncing"
 	case string(model.StateIncSync):
 		return "syncing"
@@ -369,6 +708,8 @@ func mapStateToStage(state string) string {
 		return "waiting"
 	case string(model.StateValidating):
 		return "switching"
+	case string(model.StateFallback):
+		return "fallback"
 	case string(model.StateCompleted):
 		return "finished"
 	case string(model.StateFailed):
@@ -14,14 +14,22 @@ func SetupRoutes(router *gin.Engine, migrationService *service.MigrationService)
 		taskHandler := handler.NewTaskHandler(migrationService)
 		tasks := dts.Group("/tasks")
 		{
-			tasks.POST("", taskHandler.CreateTask)                      // Create and start data synchronization task
-			tasks.GET("/:task_id/status", taskHandler.GetTaskStatus)   // Query synchronization task status
-			tasks.POST("/:task_id/start", taskHandler.StartTask)        // Start task
-			tasks.POST("/:task_id/stop", taskHandler.StopTask)         // Stop task (task remains)
-			tasks.POST("/:task_id/pause", taskHandler.PauseTask)        // Pause task
-			tasks.POST("/:task_id/resume", taskHandler.ResumeTask)     // Resume task
-			tasks.POST("/:task_id/switch", taskHandler.SwitchTask)     // Switchover
-			tasks.DELETE("/:task_id", taskHandler.DeleteTask)          // Delete task
+			tasks.POST("", taskHandler.CreateTask)                                     // Create and start data synchronization task
+			tasks.GET("/:task_id/status", taskHandler.GetTaskStatus)                   // Query synchronization task status
+			tasks.GET("/:task_id/progress", taskHandler.GetProgress)                   // Query per-table full sync progress
+			tasks.POST("/:task_id/start", taskHandler.StartTask)                       // Start task
+			tasks.POST("/:task_id/stop", taskHandler.StopTask)                         // Stop task (task remains)
+			tasks.POST("/:task_id/pause", taskHandler.PauseTask)                       // Pause task
+			tasks.POST("/:task_id/resume", taskHandler.ResumeTask)                     // Resume task
+			tasks.POST("/:task_id/switch", taskHandler.SwitchTask)                     // Switchover
+			tasks.POST("/:task_id/finalize", taskHandler.FinalizeTask)                 // End fallback (reverse replication) after switchover
+			tasks.POST("/:task_id/replay", taskHandler.ReplayArchive)                  // Replay archived change stream into a target
+			tasks.GET("/:task_id/replay", taskHandler.GetReplayStatus)                 // Query archive replay status
+			tasks.GET("/:task_id/markers", taskHandler.ListMarkers)                    // List applied logical decoding markers
+			tasks.GET("/:task_id/schema/diff", taskHandler.GetSchemaDiff)              // Compare source and target table structure
+			tasks.GET("/:task_id/schema/statements", taskHandler.ListSchemaStatements) // List DDL statements run on the target and their outcome
+			tasks.PATCH("/:task_id/throttle", taskHandler.UpdateThrottle)              // Change rate limits at runtime
+			tasks.DELETE("/:task_id", taskHandler.DeleteTask)                          // Delete task
 		}
 	}
 }
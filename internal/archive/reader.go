@@ -0,0 +1,322 @@
+package archive
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pg/dts/internal/wal"
+)
+
+// Segment represents an archive segment file
+type Segment struct {
+	Path     string
+	Format   string
+	FirstLSN uint64
+	LastLSN  uint64 // Unknown (max uint64) for a partial segment
+	Partial  bool
+}
+
+// ReplayResult summarizes a replay
+type ReplayResult struct {
+	Segments int    // Segments read
+	Records  int64  // Records handled within the LSN range
+	LastLSN  uint64 // LSN of the last handled record
+}
+
+// ListSegments lists the segments in dir ordered by first LSN
+func ListSegments(dir string) ([]Segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+
+	var segments []Segment
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		segment, ok := parseSegmentName(entry.Name())
+		if !ok {
+			continue
+		}
+		segment.Path = filepath.Join(dir, entry.Name())
+		segments = append(segments, segment)
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].FirstLSN < segments[j].FirstLSN
+	})
+	return segments, nil
+}
+
+// parseSegmentName parses <first>-<last>.<format> and <first>.<format>.partial
+func parseSegmentName(name string) (Segment, bool) {
+	segment := Segment{LastLSN: ^uint64(0)}
+	if strings.HasSuffix(name, partialSuffix) {
+		segment.Partial = true
+		name = strings.TrimSuffix(name, partialSuffix)
+	}
+
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return segment, false
+	}
+	segment.Format = name[dot+1:]
+	if segment.Format != FormatJSONL && segment.Format != FormatBinary {
+		return segment, false
+	}
+
+	lsnRange := strings.SplitN(name[:dot], "-", 2)
+	first, err := strconv.ParseUint(lsnRange[0], 16, 64)
+	if err != nil {
+		return segment, false
+	}
+	segment.FirstLSN = first
+	if len(lsnRange) == 2 {
+		last, err := strconv.ParseUint(lsnRange[1], 16, 64)
+		if err != nil {
+			return segment, false
+		}
+		segment.LastLSN = last
+	}
+	return segment, true
+}
+
+// Replay feeds the records of dir within [fromLSN, toLSN] to handler in LSN order
+// Relation messages before fromLSN are also fed, so that the handler knows the table layout of
+// relations first seen earlier in the stream. Records of a transaction that began before fromLSN
+// are skipped up to the next BEGIN, so that no partial transaction is applied. A toLSN of 0 means
+// no upper bound
+func Replay(ctx context.Context, dir string, fromLSN, toLSN uint64, handler *wal.Handler) (*ReplayResult, error) {
+	if toLSN == 0 {
+		toLSN = ^uint64(0)
+	}
+	started := fromLSN == 0
+
+	segments, err := ListSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReplayResult{}
+	for _, segment := range segments {
+		if segment.FirstLSN > toLSN {
+			break
+		}
+		result.Segments++
+
+		err := readSegment(segment, func(rec Record) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if rec.LSN > toLSN {
+				return errStopSegment
+			}
+			_, relation := rec.Message.(*wal.RelationMessage)
+			if rec.LSN >= fromLSN && !started {
+				switch rec.Message.(type) {
+				case *wal.BeginMessage, *wal.BeginPrepareMessage:
+					started = true
+				}
+			}
+			if !started && !relation {
+				return nil
+			}
+			if err := handler.Handle(ctx, rec.Message); err != nil {
+				return fmt.Errorf("failed to apply record at %X: %w", rec.LSN, err)
+			}
+			if rec.LSN >= fromLSN {
+				result.Records++
+				result.LastLSN = rec.LSN
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// errStopSegment stops reading the remaining records of a segment
+var errStopSegment = errors.New("stop segment")
+
+// readSegment reads all records of a segment
+func readSegment(segment Segment, fn func(Record) error) error {
+	file, err := os.Open(segment.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive segment: %w", err)
+	}
+	defer file.Close()
+
+	if segment.Format == FormatBinary {
+		err = readBinary(file, segment.Partial, fn)
+	} else {
+		err = readJSONL(file, segment.Partial, fn)
+	}
+	if errors.Is(err, errStopSegment) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read archive segment %s: %w", filepath.Base(segment.Path), err)
+	}
+	return nil
+}
+
+// committedLength returns the size of a segment up to the end of its last commit record and the
+// LSN of that record, 0 if the segment holds no complete transaction
+func committedLength(segment Segment) (int64, uint64, error) {
+	file, err := os.Open(segment.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	// Gob reads exactly one record per Decode from a byte reader, so the count is the record end
+	counter := &countingReader{r: bufio.NewReader(file)}
+	var offset func() int64
+	var read func(fn func(Record) error) error
+	if segment.Format == FormatBinary {
+		offset = func() int64 { return counter.n }
+		read = func(fn func(Record) error) error { return readBinary(counter, true, fn) }
+	} else {
+		// Lines are counted as they are read, a scanner reads ahead
+		var n int64
+		offset = func() int64 { return n }
+		read = func(fn func(Record) error) error {
+			return readJSONLines(file, true, func(line []byte, rec Record) error {
+				n += int64(len(line)) + 1
+				return fn(rec)
+			})
+		}
+	}
+
+	// Whatever follows the last commit is cut, including a record that fails to decode
+	var size int64
+	var lastLSN uint64
+	read(func(rec Record) error {
+		if _, ok := rec.Message.(*wal.CommitMessage); ok {
+			size, lastLSN = offset(), rec.LSN
+		}
+		return nil
+	})
+	return size, lastLSN, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// readBinary reads a gob stream of records
+// A partial segment may end with a truncated record, which is ignored
+func readBinary(r io.Reader, partial bool, fn func(Record) error) error {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+	dec := gob.NewDecoder(r)
+	for {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF || (partial && err == io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONL reads JSON Lines records
+// A partial segment may end with a truncated line, which is ignored
+func readJSONL(r io.Reader, partial bool, fn func(Record) error) error {
+	return readJSONLines(r, partial, func(_ []byte, rec Record) error {
+		return fn(rec)
+	})
+}
+
+// readJSONLines reads JSON Lines records, passing each record with its line
+func readJSONLines(r io.Reader, partial bool, fn func([]byte, Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var line jsonRecord
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			if partial {
+				return nil
+			}
+			return fmt.Errorf("failed to decode record: %w", err)
+		}
+		msg, err := newMessage(line.Type)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(line.Message, msg); err != nil {
+			return fmt.Errorf("failed to decode %s record: %w", line.Type, err)
+		}
+		if err := fn(scanner.Bytes(), Record{LSN: line.LSN, Message: msg}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// newMessage returns an empty message of the given type
+func newMessage(msgType string) (wal.Message, error) {
+	switch msgType {
+	case "relation":
+		return &wal.RelationMessage{}, nil
+	case "insert":
+		return &wal.InsertMessage{}, nil
+	case "update":
+		return &wal.UpdateMessage{}, nil
+	case "delete":
+		return &wal.DeleteMessage{}, nil
+	case "truncate":
+		return &wal.TruncateMessage{}, nil
+	case "begin":
+		return &wal.BeginMessage{}, nil
+	case "commit":
+		return &wal.CommitMessage{}, nil
+	case "message":
+		return &wal.LogicalDecodingMessage{}, nil
+	case "begin_prepare":
+		return &wal.BeginPrepareMessage{}, nil
+	case "prepare":
+		return &wal.PrepareMessage{}, nil
+	case "commit_prepared":
+		return &wal.CommitPreparedMessage{}, nil
+	case "rollback_prepared":
+		return &wal.RollbackPreparedMessage{}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive record type: %s", msgType)
+	}
+}
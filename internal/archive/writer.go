@@ -0,0 +1,256 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/wal"
+)
+
+const (
+	// FormatJSONL writes one JSON record per line
+	FormatJSONL = "jsonl"
+	// FormatBinary writes a gob stream of records, more compact than JSON Lines
+	FormatBinary = "binary"
+
+	// DefaultSegmentSize is the segment size used when none is configured (64 MiB)
+	DefaultSegmentSize int64 = 64 << 20
+
+	// partialSuffix marks the segment that is still being written
+	partialSuffix = ".partial"
+)
+
+func init() {
+	// Register message types so they can be gob-encoded behind the wal.Message interface
+	gob.Register(&wal.RelationMessage{})
+	gob.Register(&wal.InsertMessage{})
+	gob.Register(&wal.UpdateMessage{})
+	gob.Register(&wal.DeleteMessage{})
+	gob.Register(&wal.TruncateMessage{})
+	gob.Register(&wal.BeginMessage{})
+	gob.Register(&wal.CommitMessage{})
+	gob.Register(&wal.LogicalDecodingMessage{})
+	gob.Register(&wal.BeginPrepareMessage{})
+	gob.Register(&wal.PrepareMessage{})
+	gob.Register(&wal.CommitPreparedMessage{})
+	gob.Register(&wal.RollbackPreparedMessage{})
+}
+
+// Record represents an archived change
+type Record struct {
+	LSN     uint64      // WAL position the message was received at
+	Message wal.Message // Decoded message
+}
+
+// jsonRecord is the JSON Lines representation of a record
+type jsonRecord struct {
+	LSN     uint64          `json:"lsn"`
+	Type    string          `json:"type"`
+	Message json.RawMessage `json:"message"`
+}
+
+// Writer writes decoded changes into rotating segment files
+// Segments only rotate at commit boundaries, so every segment holds whole transactions.
+// A finished segment is named <first LSN>-<last LSN>.<ext>, both as 16 hex digits
+type Writer struct {
+	dir         string
+	format      string
+	segmentSize int64
+
+	mu       sync.Mutex
+	file     *os.File
+	buf      *bufio.Writer
+	enc      *gob.Encoder
+	size     int64
+	firstLSN uint64
+	lastLSN  uint64
+}
+
+// NewWriter creates an archive writer in dir
+func NewWriter(dir string, cfg *model.ArchiveConfig) (*Writer, error) {
+	format := cfg.Format
+	if format == "" {
+		format = FormatJSONL
+	}
+	if format != FormatJSONL && format != FormatBinary {
+		return nil, fmt.Errorf("unsupported archive format: %s (supported: %s, %s)", format, FormatJSONL, FormatBinary)
+	}
+
+	segmentSize := cfg.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if err := recoverPartial(dir); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		dir:         dir,
+		format:      format,
+		segmentSize: segmentSize,
+	}, nil
+}
+
+// Write archives a decoded message received at lsn
+func (w *Writer) Write(lsn uint64, msg wal.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.openSegment(lsn); err != nil {
+			return err
+		}
+	}
+
+	if err := w.encode(Record{LSN: lsn, Message: msg}); err != nil {
+		return fmt.Errorf("failed to write archive record: %w", err)
+	}
+	w.lastLSN = lsn
+
+	// Flush and possibly rotate on transaction boundaries
+	if _, ok := msg.(*wal.CommitMessage); ok {
+		if err := w.buf.Flush(); err != nil {
+			return fmt.Errorf("failed to flush archive segment: %w", err)
+		}
+		if w.size >= w.segmentSize {
+			return w.closeSegment()
+		}
+	}
+
+	return nil
+}
+
+// Close finishes the current segment
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.closeSegment()
+}
+
+// encode writes a record in the configured format
+func (w *Writer) encode(rec Record) error {
+	if w.format == FormatBinary {
+		return w.enc.Encode(&rec)
+	}
+
+	payload, err := json.Marshal(rec.Message)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(jsonRecord{LSN: rec.LSN, Type: rec.Message.Type(), Message: payload})
+	if err != nil {
+		return err
+	}
+	_, err = w.buf.Write(append(line, '\n'))
+	return err
+}
+
+// openSegment opens a new partial segment starting at lsn
+func (w *Writer) openSegment(lsn uint64) error {
+	path := filepath.Join(w.dir, fmt.Sprintf("%016X.%s%s", lsn, w.format, partialSuffix))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open archive segment: %w", err)
+	}
+
+	w.file = file
+	w.size = 0
+	w.firstLSN = lsn
+	w.lastLSN = lsn
+	w.buf = bufio.NewWriter(&countingWriter{w: file, n: &w.size})
+	w.enc = gob.NewEncoder(w.buf)
+	return nil
+}
+
+// closeSegment flushes, syncs and renames the current segment to its final LSN range name
+func (w *Writer) closeSegment() error {
+	defer func() {
+		w.file = nil
+		w.buf = nil
+		w.enc = nil
+	}()
+
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to flush archive segment: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to sync archive segment: %w", err)
+	}
+	partialPath := w.file.Name()
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close archive segment: %w", err)
+	}
+
+	finalPath := filepath.Join(w.dir, segmentName(w.firstLSN, w.lastLSN, w.format))
+	if err := os.Rename(partialPath, finalPath); err != nil {
+		return fmt.Errorf("failed to finish archive segment: %w", err)
+	}
+	return nil
+}
+
+// recoverPartial finishes the partial segments left in dir by a writer that was not closed
+// A segment is cut after its last complete transaction and renamed to its LSN range, one holding no
+// complete transaction is removed. The stream resumes at the slot's confirmed position, so the
+// changes cut off are received and archived again.
+func recoverPartial(dir string) error {
+	segments, err := ListSegments(dir)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if !segment.Partial {
+			continue
+		}
+		size, lastLSN, err := committedLength(segment)
+		if err != nil {
+			return fmt.Errorf("failed to recover archive segment %s: %w", filepath.Base(segment.Path), err)
+		}
+		if size == 0 {
+			if err := os.Remove(segment.Path); err != nil {
+				return fmt.Errorf("failed to remove empty archive segment: %w", err)
+			}
+			continue
+		}
+		if err := os.Truncate(segment.Path, size); err != nil {
+			return fmt.Errorf("failed to truncate archive segment: %w", err)
+		}
+		finalPath := filepath.Join(dir, segmentName(segment.FirstLSN, lastLSN, segment.Format))
+		if err := os.Rename(segment.Path, finalPath); err != nil {
+			return fmt.Errorf("failed to finish archive segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// segmentName returns the file name of a finished segment
+func segmentName(firstLSN, lastLSN uint64, format string) string {
+	return fmt.Sprintf("%016X-%016X.%s", firstLSN, lastLSN, format)
+}
+
+// countingWriter counts bytes written to the underlying file
+type countingWriter struct {
+	w *os.File
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
@@ -15,6 +15,7 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Database DatabaseConfig `yaml:"database"` // Metadata database configuration
 	Log      LogConfig      `yaml:"log"`
+	Target   TargetConfig   `yaml:"target"`
 }
 
 // ServerConfig represents server configuration
@@ -40,6 +41,11 @@ type LogConfig struct {
 	Output string `yaml:"output"`
 }
 
+// TargetConfig represents what DTS keeps in target databases
+type TargetConfig struct {
+	BookkeepingSchema string `yaml:"bookkeeping_schema"` // Schema of the bookkeeping tables, default dts
+}
+
 // Load loads configuration file (compatible with old interface)
 func Load(configPath string) (*Config, error) {
 	cfg, _, err := LoadWithFlags(configPath)
@@ -175,6 +181,9 @@ func setDefaults(config *Config) {
 	if config.Log.Output == "" {
 		config.Log.Output = "stdout"
 	}
+	if config.Target.BookkeepingSchema == "" {
+		config.Target.BookkeepingSchema = "dts"
+	}
 }
 
 // applyFlags applies command line arguments (overrides config file)
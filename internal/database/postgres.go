@@ -88,6 +88,7 @@ func (pm *PostgresManager) GetAllDatabases() ([]DatabaseInfo, error) {
 
 // GetBusinessTablesInDatabase retrieves all business tables in current connected database
 // Business tables are defined as tables with oid > 16383 and relkind in ('r', 'p')
+// Partitions are not listed, they belong to their partitioned root table
 //
 // Returns:
 //   - []TableInfo: List of table information
@@ -119,6 +120,7 @@ func (pm *PostgresManager) GetBusinessTablesInDatabase() ([]TableInfo, error) {
 		WHERE
 			(c.relkind = 'r' OR c.relkind = 'p')
 			AND c.oid > 16383
+			AND NOT c.relispartition
 			AND n.nspname NOT IN ('pg_catalog', 'information_schema')
 		ORDER BY n.nspname, c.relname
 	`
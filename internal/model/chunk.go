@@ -0,0 +1,207 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Full sync chunk statuses
+const (
+	ChunkPending = "pending"
+	ChunkCopying = "copying"
+	ChunkDone    = "done"
+)
+
+// CopyChunk is a unit of full sync work: a whole table, or a primary key or ctid block range of one
+// Ranges are half-open, the first and last chunk of a table are unbounded below and above
+type CopyChunk struct {
+	SourceSchema   string `gorm:"type:varchar(255);not null" json:"source_schema"`
+	SourceTable    string `gorm:"type:varchar(255);not null" json:"source_table"`
+	TargetSchema   string `gorm:"type:varchar(255);not null" json:"target_schema"`
+	TargetTable    string `gorm:"type:varchar(255);not null" json:"target_table"`
+	KeyColumn      string `gorm:"type:varchar(255)" json:"key_column,omitempty"` // Integer primary key of key range chunks
+	Lower          *int64 `json:"lower,omitempty"`                               // Inclusive lower bound, key value or block number
+	Upper          *int64 `json:"upper,omitempty"`                               // Exclusive upper bound, key value or block number
+	ByBlocks       bool   `json:"by_blocks,omitempty"`                           // Range is a ctid block range
+	Subset         string `gorm:"type:text" json:"subset,omitempty"`             // WHERE predicate of a subset migration, evaluated on the source
+	EstimatedRows  int64  `json:"estimated_rows"`
+	EstimatedBytes int64  `json:"estimated_bytes"` // Share of pg_total_relation_size
+}
+
+// Ranged returns whether the chunk covers part of its table
+func (c *CopyChunk) Ranged() bool {
+	return c.KeyColumn != "" || c.ByBlocks
+}
+
+// String returns a readable description of the chunk
+func (c *CopyChunk) String() string {
+	name := c.SourceSchema + "." + c.SourceTable
+	if !c.Ranged() {
+		return name
+	}
+	bound := func(b *int64) string {
+		if b == nil {
+			return ""
+		}
+		return fmt.Sprint(*b)
+	}
+	column := c.KeyColumn
+	if c.ByBlocks {
+		column = "ctid block"
+	}
+	return fmt.Sprintf("%s [%s %s..%s)", name, column, bound(c.Lower), bound(c.Upper))
+}
+
+// Predicate returns the WHERE condition selecting the rows of the chunk, empty for whole tables
+func (c *CopyChunk) Predicate() string {
+	var conditions []string
+	if c.ByBlocks {
+		if c.Lower != nil {
+			conditions = append(conditions, fmt.Sprintf("ctid >= '(%d,0)'::tid", *c.Lower))
+		}
+		if c.Upper != nil {
+			conditions = append(conditions, fmt.Sprintf("ctid < '(%d,0)'::tid", *c.Upper))
+		}
+	} else if c.KeyColumn != "" {
+		column := `"` + strings.ReplaceAll(c.KeyColumn, `"`, `""`) + `"`
+		if c.Lower != nil {
+			conditions = append(conditions, fmt.Sprintf("%s >= %d", column, *c.Lower))
+		}
+		if c.Upper != nil {
+			conditions = append(conditions, fmt.Sprintf("%s < %d", column, *c.Upper))
+		}
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// FullSyncChunk records the progress of a full sync chunk
+// The copy plan of a task is persisted so that an interrupted full sync resumes where it stopped
+type FullSyncChunk struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	TaskID      string `gorm:"type:varchar(36);not null;index" json:"task_id"`
+	Seq         int    `gorm:"not null" json:"seq"` // Position in the copy plan
+	CopyChunk   `gorm:"embedded"`
+	Status      string     `gorm:"type:varchar(20);not null;default:'pending'" json:"status"` // pending, copying, done
+	Rows        int64      `gorm:"default:0" json:"rows"`                                     // Rows copied
+	Bytes       int64      `gorm:"default:0" json:"bytes"`                                    // Bytes read from the source
+	Cursor      string     `gorm:"type:text" json:"cursor,omitempty"`                         // Position of a chunk copied with batched INSERTs in JSON format
+	SnapshotLSN string     `gorm:"type:varchar(32)" json:"snapshot_lsn,omitempty"`            // WAL position of the snapshot the chunk is copied from when newer than the slot's
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// TableName specifies the table name
+func (*FullSyncChunk) TableName() string {
+	return "full_sync_chunks"
+}
+
+// TableProgress is the full sync progress of one source table, summed over its chunks
+// A partitioned table is reported per leaf partition, as leaves are copied separately
+type TableProgress struct {
+	SourceSchema   string     `json:"source_schema"`
+	SourceTable    string     `json:"source_table"`
+	TargetSchema   string     `json:"target_schema"`
+	TargetTable    string     `json:"target_table"`
+	Status         string     `json:"status"`          // pending, copying, done
+	EstimatedRows  int64      `json:"estimated_rows"`  // From pg_class.reltuples when the plan was made
+	EstimatedBytes int64      `json:"estimated_bytes"` // From pg_total_relation_size when the plan was made
+	Rows           int64      `json:"rows"`
+	Bytes          int64      `json:"bytes"`
+	Progress       int        `json:"progress"` // 0-100
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	RowsPerSec     float64    `json:"rows_per_sec"`
+	BytesPerSec    float64    `json:"bytes_per_sec"`
+
+	chunks int
+	done   int
+	copied int64 // Rows copied counted towards progress, capped at the estimate of each chunk
+}
+
+// SummarizeProgress sums chunk progress per table and returns the tables in plan order
+// with the overall progress (0-100), in which every table is weighted by its estimated rows
+func SummarizeProgress(chunks []FullSyncChunk, now time.Time) ([]TableProgress, int) {
+	var tables []TableProgress
+	index := make(map[string]int)
+	for i := range chunks {
+		chunk := &chunks[i]
+		key := chunk.SourceSchema + "." + chunk.SourceTable
+		pos, ok := index[key]
+		if !ok {
+			pos = len(tables)
+			index[key] = pos
+			tables = append(tables, TableProgress{
+				SourceSchema: chunk.SourceSchema, SourceTable: chunk.SourceTable,
+				TargetSchema: chunk.TargetSchema, TargetTable: chunk.TargetTable,
+			})
+		}
+		t := &tables[pos]
+		t.chunks++
+		t.EstimatedRows += chunk.EstimatedRows
+		t.EstimatedBytes += chunk.EstimatedBytes
+		t.Rows += chunk.Rows
+		t.Bytes += chunk.Bytes
+		if chunk.Status == ChunkDone {
+			t.done++
+			t.copied += chunk.EstimatedRows
+		} else {
+			t.copied += min(chunk.Rows, chunk.EstimatedRows)
+		}
+		if chunk.StartedAt != nil && (t.StartedAt == nil || chunk.StartedAt.Before(*t.StartedAt)) {
+			t.StartedAt = chunk.StartedAt
+		}
+		if chunk.CompletedAt != nil && (t.CompletedAt == nil || chunk.CompletedAt.After(*t.CompletedAt)) {
+			t.CompletedAt = chunk.CompletedAt
+		}
+	}
+
+	var estimated, copied int64
+	var chunkCount, doneCount int
+	for i := range tables {
+		t := &tables[i]
+		switch {
+		case t.done == t.chunks:
+			t.Status = ChunkDone
+			t.Progress = 100
+		case t.StartedAt != nil:
+			t.Status = ChunkCopying
+			t.CompletedAt = nil
+			t.Progress = percent(t.copied, t.EstimatedRows, 99)
+		default:
+			t.Status = ChunkPending
+		}
+		if t.StartedAt != nil {
+			end := now
+			if t.CompletedAt != nil {
+				end = *t.CompletedAt
+			}
+			if seconds := end.Sub(*t.StartedAt).Seconds(); seconds > 0 {
+				t.RowsPerSec = float64(t.Rows) / seconds
+				t.BytesPerSec = float64(t.Bytes) / seconds
+			}
+		}
+		estimated += t.EstimatedRows
+		copied += t.copied
+		chunkCount += t.chunks
+		doneCount += t.done
+	}
+
+	if doneCount == chunkCount {
+		return tables, 100
+	}
+	if estimated == 0 {
+		// Nothing to weigh by, count chunks instead
+		return tables, percent(int64(doneCount), int64(chunkCount), 99)
+	}
+	return tables, percent(copied, estimated, 99)
+}
+
+// percent returns part of whole as a percentage no higher than ceiling
+func percent(part, whole int64, ceiling int) int {
+	if whole <= 0 {
+		return 0
+	}
+	return min(int(part*100/whole), ceiling)
+}
@@ -0,0 +1,93 @@
+package model
+
+import "time"
+
+// Catch-up predictions of the incremental sync
+const (
+	CatchUpUnknown       = "unknown"        // Not enough samples, or the forward stream is not running yet
+	CatchUpCaughtUp      = "caught_up"      // The lag is below CaughtUpLagBytes
+	CatchUpCatchingUp    = "catching_up"    // Changes are applied faster than the source writes WAL
+	CatchUpFallingBehind = "falling_behind" // The source writes WAL at least as fast as changes are applied
+)
+
+// CaughtUpLagBytes is the replication lag below which the incremental sync counts as caught up
+const CaughtUpLagBytes = 16 * 1024 * 1024
+
+// WALPosition is a sample of the source WAL position and the position confirmed by the task's slot
+// Positions are LSNs as byte offsets
+type WALPosition struct {
+	At        time.Time
+	Current   int64  // pg_current_wal_lsn
+	Confirmed *int64 // confirmed_flush_lsn of the slot, nil until the forward stream applies changes
+}
+
+// Estimate predicts how long the migration still takes
+// Durations are in milliseconds, -1 means unknown
+type Estimate struct {
+	FullSyncRemainingMs int64      `json:"full_sync_remaining_ms"`
+	FullSyncETA         *time.Time `json:"full_sync_eta,omitempty"`
+	FullSyncBytesPerSec float64    `json:"full_sync_bytes_per_sec"` // Table size copied per second
+	WALBytesPerSec      float64    `json:"wal_bytes_per_sec"`       // WAL written by the source
+	ApplyBytesPerSec    float64    `json:"apply_bytes_per_sec"`     // WAL confirmed by the forward stream
+	LagBytes            int64      `json:"lag_bytes"`               // WAL not yet confirmed, -1 before the incremental sync starts
+	CatchUp             string     `json:"catch_up"`                // unknown, caught_up, catching_up, falling_behind
+	CatchUpMs           int64      `json:"catch_up_ms"`             // Time until caught up at the observed rates
+}
+
+// EstimateFullSync estimates the time left to copy the tables
+// Every table is weighted by its total size; the size copied so far divided by the time since the
+// first chunk started gives the throughput. Returns the remaining time and the throughput in
+// bytes per second (0 for plans without sizes), or false if nothing has been copied yet.
+func EstimateFullSync(tables []TableProgress, now time.Time) (time.Duration, float64, bool) {
+	// Plans made without sizes are weighted by rows instead
+	bySize := false
+	for i := range tables {
+		if tables[i].EstimatedBytes > 0 {
+			bySize = true
+			break
+		}
+	}
+
+	var total, copied float64
+	var started *time.Time
+	finished := true
+	for i := range tables {
+		t := &tables[i]
+		weight := float64(t.EstimatedRows)
+		if bySize {
+			weight = float64(t.EstimatedBytes)
+		}
+		fraction := 0.0
+		switch {
+		case t.Status == ChunkDone:
+			fraction = 1
+		case t.EstimatedRows > 0:
+			fraction = float64(t.copied) / float64(t.EstimatedRows)
+		}
+		if t.Status != ChunkDone {
+			finished = false
+		}
+		total += weight
+		copied += weight * fraction
+		if t.StartedAt != nil && (started == nil || t.StartedAt.Before(*started)) {
+			started = t.StartedAt
+		}
+	}
+
+	if finished {
+		return 0, 0, true
+	}
+	if started == nil || copied <= 0 {
+		return 0, 0, false
+	}
+	elapsed := now.Sub(*started).Seconds()
+	if elapsed <= 0 {
+		return 0, 0, false
+	}
+	rate := copied / elapsed
+	remaining := time.Duration((total - copied) / rate * float64(time.Second))
+	if !bySize {
+		return remaining, 0, true
+	}
+	return remaining, rate, true
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -16,7 +17,20 @@ type MigrationTask struct {
 	TargetDB     string     `gorm:"type:text;not null" json:"target_db"`                                   // Target database configuration in JSON format
 	Tables       string     `gorm:"type:text;not null" json:"tables"`                                      // Table list in JSON format
 	TableSuffix  string     `gorm:"type:varchar(100)" json:"table_suffix"`                                 // Target table suffix
+	Fallback     bool       `gorm:"default:false" json:"fallback"`                                         // Stream target changes back to source after switchover
+	TwoPhase     bool       `gorm:"default:false" json:"two_phase"`                                        // Stage prepared source transactions as prepared transactions on the target
+	Archive      string     `gorm:"type:text" json:"archive"`                                              // Change stream archive configuration in JSON format, empty means disabled
+	Sink         string     `gorm:"type:text" json:"sink"`                                                 // Change sink configuration in JSON format, empty means the PostgreSQL target
+	Partitioning string     `gorm:"type:text" json:"partitioning"`                                         // Target partitioning overrides in JSON format (table -> PartitionConfig)
+	FullSync     string     `gorm:"type:text" json:"full_sync"`                                            // Full sync configuration in JSON format, empty means defaults
+	Throttle     string     `gorm:"type:text" json:"throttle"`                                             // Rate limits in JSON format, empty means unlimited
+	Transform    string     `gorm:"type:text" json:"transform"`                                            // Column transformations in JSON format (table -> TableTransform)
+	Masking      string     `gorm:"type:text" json:"masking"`                                              // Column masking rules in JSON format
+	NameMapping  string     `gorm:"type:text" json:"name_mapping"`                                         // Source -> target name mapping in JSON format, empty means TableSuffix only
+	Selection    string     `gorm:"type:text" json:"selection"`                                            // Database, schema and table filters in JSON format, empty means everything
+	DDL          string     `gorm:"type:text" json:"ddl"`                                                  // Schema creation configuration in JSON format, empty means defaults
 	State        string     `gorm:"type:varchar(50);not null;default:'init'" json:"state"`
+	PausedFrom   string     `gorm:"type:varchar(50)" json:"paused_from,omitempty"` // State to resume in after a pause
 	Progress     int        `gorm:"default:0" json:"progress"` // Progress 0-100
 	ErrorMessage string     `gorm:"type:text" json:"error_message"`
 	CreatedAt    time.Time  `json:"created_at"`
@@ -88,6 +102,18 @@ func (m *MigrationTask) GetConnection(key string) (interface{}, bool) {
 	return conn, ok
 }
 
+// RemoveConnection removes a connection from the pool without closing it
+func (m *MigrationTask) RemoveConnection(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Connections == nil {
+		return nil, false
+	}
+	conn, ok := m.Connections[key]
+	delete(m.Connections, key)
+	return conn, ok
+}
+
 // CloseAllConnections closes all connections
 func (m *MigrationTask) CloseAllConnections() error {
 	m.mu.Lock()
@@ -109,6 +135,11 @@ func (m *MigrationTask) CloseAllConnections() error {
 			if err := sqlDB.Close(); err != nil {
 				errors = append(errors, fmt.Errorf("failed to close gorm.DB connection %s: %w", key, err))
 			}
+		case io.Closer:
+			// Replication streams and other runtime resources
+			if err := c.Close(); err != nil {
+				errors = append(errors, fmt.Errorf("failed to close %s: %w", key, err))
+			}
 		default:
 			// Unknown connection type, log warning but don't error
 			continue
@@ -159,6 +190,79 @@ func (d *DBConfig) ConnectionKey() string {
 	return ConnectionKey(d.Host, d.Port, d.DBName)
 }
 
+// ArchiveConfig represents change stream archive configuration
+type ArchiveConfig struct {
+	Dir         string `json:"dir"`          // Root directory, segments are written to <dir>/<task_id>/<stream>
+	Format      string `json:"format"`       // jsonl (default) or binary
+	SegmentSize int64  `json:"segment_size"` // Segment rotation size in bytes, default 64 MiB
+}
+
+// Sink types
+const (
+	SinkPostgreSQL = "postgresql" // Apply changes to the target database
+	SinkFile       = "file"       // Append change events to local files
+	SinkWebhook    = "webhook"    // POST batches of change events to an HTTP endpoint
+)
+
+// SinkConfig represents change sink configuration
+type SinkConfig struct {
+	Type   string `json:"type"`             // postgresql (default), file, webhook
+	Format string `json:"format,omitempty"` // Event format of the file and webhook sinks: dts (default) or debezium
+
+	// File sink
+	Dir string `json:"dir,omitempty"` // Events are appended to <dir>/<task_id>.jsonl
+
+	// Webhook sink
+	URL             string            `json:"url,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	BatchSize       int               `json:"batch_size,omitempty"`        // Events per request, default 100
+	FlushIntervalMs int               `json:"flush_interval_ms,omitempty"` // Maximum delay before a partial batch is sent, default 1000
+	MaxRetries      *int              `json:"max_retries,omitempty"`       // Retries of a failed request, default 3, 0 disables retries
+	RetryBackoffMs  int               `json:"retry_backoff_ms,omitempty"`  // Initial retry delay, doubled on every retry, default 500
+	TimeoutMs       int               `json:"timeout_ms,omitempty"`        // Request timeout, default 10000
+}
+
+// WritesDatabase returns whether the sink applies changes to the target database
+// Table creation, full sync and validation only apply to database sinks
+func (c *SinkConfig) WritesDatabase() bool {
+	return c.Type == "" || c.Type == SinkPostgreSQL
+}
+
+// FullSyncConfig represents full sync configuration
+type FullSyncConfig struct {
+	Parallelism int    `json:"parallelism,omitempty"` // Concurrent copy workers, default 4
+	ChunkRows   int64  `json:"chunk_rows,omitempty"`  // Estimated rows per chunk, larger tables are split, smaller ones packed together; default 1000000
+	Method      string `json:"method,omitempty"`      // copy or insert, default copy; insert is also used when a database does not run COPY
+
+	Subset            map[string]string `json:"subset,omitempty"`              // Source [schema.]table -> WHERE predicate, only matching rows are copied
+	FollowForeignKeys bool              `json:"follow_foreign_keys,omitempty"` // Also copy the rows of subset tables referenced by copied rows
+}
+
+// Full sync copy methods
+const (
+	CopyMethodCopy   = "copy"   // Rows are streamed with COPY TO on the source into COPY FROM on the target
+	CopyMethodInsert = "insert" // Rows are read with SELECT in batches and written with batched INSERTs
+)
+
+// ForeignKey is a foreign key from the columns of a table to the referenced columns of another
+type ForeignKey struct {
+	Schema     string
+	Table      string
+	Columns    []string
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+}
+
+// ThrottleConfig represents the rate limits of a task, 0 means unlimited
+type ThrottleConfig struct {
+	FullSyncRowsPerSec   int64 `json:"full_sync_rows_per_sec"`  // Rows read by full sync per second, across all workers
+	FullSyncBytesPerSec  int64 `json:"full_sync_bytes_per_sec"` // Bytes read by full sync per second, across all workers
+	ApplyRowsPerSec      int64 `json:"apply_rows_per_sec"`      // Row changes applied per second
+	ApplyBytesPerSec     int64 `json:"apply_bytes_per_sec"`     // Bytes of row changes applied per second
+	MaxSourceConnections int   `json:"max_source_connections"`  // Concurrent full sync worker connections to the source
+}
+
 // TableInfo represents table structure information
 type TableInfo struct {
 	Schema      string           `json:"schema"`
@@ -166,16 +270,20 @@ type TableInfo struct {
 	Columns     []ColumnInfo     `json:"columns"`
 	Indexes     []IndexInfo      `json:"indexes"`
 	Constraints []ConstraintInfo `json:"constraints"`
+	Sequences   []SequenceInfo   `json:"sequences"`
 	DDL         string           `json:"ddl"`
 }
 
 // ColumnInfo represents column information
 type ColumnInfo struct {
 	Name         string `json:"name"`
-	DataType     string `json:"data_type"`
+	DataType     string `json:"data_type"` // As printed by format_type, e.g. "character varying(64)"
 	IsNullable   bool   `json:"is_nullable"`
 	DefaultValue string `json:"default_value"`
 	IsPrimaryKey bool   `json:"is_primary_key"`
+	Identity     string `json:"identity,omitempty"`  // ALWAYS or BY DEFAULT for identity columns
+	Generated    string `json:"generated,omitempty"` // Expression of a stored generated column
+	Collation    string `json:"collation,omitempty"` // Collation when it differs from the type's default
 }
 
 // IndexInfo represents index information
@@ -189,7 +297,139 @@ type IndexInfo struct {
 // ConstraintInfo represents constraint information
 type ConstraintInfo struct {
 	Name       string   `json:"name"`
-	Type       string   `json:"type"` // PRIMARY KEY, FOREIGN KEY, UNIQUE, CHECK
+	Type       string   `json:"type"` // PRIMARY KEY, FOREIGN KEY, UNIQUE, CHECK, EXCLUDE
 	Columns    []string `json:"columns"`
-	Definition string   `json:"definition"`
+	Definition string   `json:"definition"`                // As printed by pg_get_constraintdef, e.g. "CHECK ((qty > 0))"
+	RefSchema  string   `json:"ref_schema,omitempty"`      // Referenced table of a foreign key
+	RefTable   string   `json:"ref_table,omitempty"`
+	RefColumns []string `json:"ref_columns,omitempty"`
+}
+
+// SequenceInfo represents a sequence owned by a table column, including identity sequences
+type SequenceInfo struct {
+	Schema    string `json:"schema"`
+	Name      string `json:"name"`
+	Column    string `json:"column"` // Owning column
+	DataType  string `json:"data_type"`
+	Start     int64  `json:"start"`
+	Increment int64  `json:"increment"`
+	MinValue  int64  `json:"min_value"`
+	MaxValue  int64  `json:"max_value"`
+	Cache     int64  `json:"cache"`
+	Cycle     bool   `json:"cycle"`
+}
+
+// PartitionInfo represents the partition hierarchy of a table
+type PartitionInfo struct {
+	Strategy string          `json:"strategy"` // range, list or hash, empty if the table is not partitioned
+	Key      string          `json:"key"`      // Partition key definition, e.g. RANGE (created_at)
+	Leaves   []PartitionLeaf `json:"leaves"`   // Leaf partitions at any level of the hierarchy
+}
+
+// IsPartitioned returns whether the table is a partitioned table
+func (p *PartitionInfo) IsPartitioned() bool {
+	return p.Strategy != ""
+}
+
+// SameLayout returns whether target is partitioned like p, with target leaves named by mapName
+func (p *PartitionInfo) SameLayout(target *PartitionInfo, mapName func(schema, name string) (string, string)) bool {
+	if p.Strategy != target.Strategy || p.Key != target.Key || len(p.Leaves) != len(target.Leaves) {
+		return false
+	}
+	bounds := make(map[string]string, len(target.Leaves))
+	for _, leaf := range target.Leaves {
+		bounds[leaf.Schema+"."+leaf.Name] = leaf.Bound
+	}
+	for _, leaf := range p.Leaves {
+		schema, name := mapName(leaf.Schema, leaf.Name)
+		bound, ok := bounds[schema+"."+name]
+		if !ok || bound != leaf.Bound {
+			return false
+		}
+	}
+	return true
+}
+
+// PartitionLeaf represents a leaf partition
+type PartitionLeaf struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Parent string `json:"parent"` // Direct parent table name
+	Bound  string `json:"bound"`  // Partition bound, e.g. FOR VALUES FROM ('2024-01-01') TO ('2025-01-01')
+}
+
+// PartitionConfig overrides the partitioning of a target table
+// An empty strategy creates a non-partitioned target for a partitioned source table
+type PartitionConfig struct {
+	Strategy   string           `json:"strategy"`             // range, list, hash or empty
+	Key        string           `json:"key,omitempty"`        // Partition key columns or expressions, e.g. created_at
+	Partitions []PartitionBound `json:"partitions,omitempty"` // Partitions to create, named like source tables before name mapping
+}
+
+// PartitionBound represents a partition of a target partitioning override
+type PartitionBound struct {
+	Name  string `json:"name"`
+	Bound string `json:"bound"` // e.g. FOR VALUES FROM ('2024-01-01') TO ('2025-01-01'), or DEFAULT
+}
+
+// TableTransform reshapes the rows of a source table on their way to the target
+// It is applied identically by full sync and by the change stream. Columns are named by their
+// source names; expressions use a subset of PostgreSQL expression syntax.
+type TableTransform struct {
+	Rename map[string]string `json:"rename,omitempty"` // Source column -> target column name
+	Drop   []string          `json:"drop,omitempty"`   // Source columns that are not copied
+	Cast   map[string]string `json:"cast,omitempty"`   // Source column -> target type, e.g. bigint or varchar(20)
+	Add    []DerivedColumn   `json:"add,omitempty"`    // Columns added on the target
+	Filter string            `json:"filter,omitempty"` // Predicate over the source columns, only matching rows are copied
+}
+
+// DerivedColumn is a target column computed from a constant or an expression
+type DerivedColumn struct {
+	Name  string  `json:"name"`
+	Type  string  `json:"type,omitempty"`  // Column type on the target, text if empty
+	Value *string `json:"value,omitempty"` // Constant value in text form, NULL if neither value nor expr is set
+	Expr  string  `json:"expr,omitempty"`  // Expression over the source columns, e.g. first_name || ' ' || last_name
+}
+
+// Column masking methods
+const (
+	MaskHash     = "hash"     // SHA-256 of the salted value, hex encoded
+	MaskTokenize = "tokenize" // HMAC-SHA256 of the value under the masking key, hex encoded
+	MaskRedact   = "redact"   // A fixed replacement value
+	MaskEmail    = "email"    // A fake email address derived from the value
+	MaskPhone    = "phone"    // A fake phone number derived from the value
+	MaskNull     = "null"     // NULL
+)
+
+// ValidationProfileMasked compares the unmasked columns of every table during validation
+const ValidationProfileMasked = "masked"
+
+// MaskingConfig declares how column values are anonymized on the target
+type MaskingConfig struct {
+	Key     string                         `json:"key,omitempty"`     // Secret of the keyed methods (tokenize, email, phone)
+	Profile string                         `json:"profile,omitempty"` // Validation profile, "masked" compares the unmasked columns
+	Tables  map[string]map[string]MaskRule `json:"tables"`            // Source table -> source column -> rule
+}
+
+// MaskRule is the masking of one column
+type MaskRule struct {
+	Method string  `json:"method"`          // hash, tokenize, redact, email, phone or null
+	Value  *string `json:"value,omitempty"` // Replacement of redact, "***" if not set
+}
+
+// NameMapping maps source database, schema and table names to target names
+// An explicit table pair wins over the rewrites, which win over prefix and suffix
+type NameMapping struct {
+	Databases map[string]string `json:"databases,omitempty"` // Source database -> target database
+	Schemas   map[string]string `json:"schemas,omitempty"`   // Source schema -> target schema
+	Tables    map[string]string `json:"tables,omitempty"`    // Source [schema.]table -> target [schema.]table
+	Rewrites  []NameRewrite     `json:"rewrites,omitempty"`  // Regular expression rewrites of table names, the first match applies
+	Prefix    string            `json:"prefix,omitempty"`    // Prepended to table names that are not mapped explicitly or rewritten
+	Suffix    string            `json:"suffix,omitempty"`    // Appended to table names that are not mapped explicitly or rewritten
+}
+
+// NameRewrite rewrites the table names matching a regular expression
+type NameRewrite struct {
+	Pattern string `json:"pattern"` // Regular expression matched against the whole table name
+	Replace string `json:"replace"` // Replacement, $1 etc. refer to the groups of the pattern
 }
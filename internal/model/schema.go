@@ -0,0 +1,154 @@
+package model
+
+import "time"
+
+// Schema sections
+const (
+	SectionPreData  = "pre-data"  // Types, tables, sequences and functions, created before full sync
+	SectionPostData = "post-data" // Indexes, constraints and triggers, created after full sync
+)
+
+// Schema statement statuses
+const (
+	StatementPending = "pending"
+	StatementRunning = "running"
+	StatementDone    = "done"
+	StatementIgnored = "ignored" // Failed because the object already exists
+	StatementFailed  = "failed"
+)
+
+// DDL error policies
+const (
+	DDLOnErrorFail     = "fail"     // A failed statement fails the task
+	DDLOnErrorContinue = "continue" // Failed statements are recorded and reported, the task goes on
+)
+
+// DDLConfig configures how the schema is created on the target
+type DDLConfig struct {
+	OnError string `json:"on_error,omitempty"` // fail (default) or continue
+}
+
+// SchemaStatement records a DDL statement run on the target and its outcome
+// Pre-data statements are recorded as the tables are created. Post-data statements are persisted
+// when the tables are created and run after full sync, so that the bulk load does not maintain
+// indexes and an interrupted build resumes.
+type SchemaStatement struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	TaskID      string     `gorm:"type:varchar(36);not null;index" json:"task_id"`
+	Seq         int        `gorm:"not null" json:"seq"`                        // Position in the dump
+	Section     string     `gorm:"type:varchar(20);not null" json:"section"`   // pre-data or post-data
+	Database    string     `gorm:"type:varchar(255);not null" json:"database"` // Target database the statement runs in
+	Phase       int        `gorm:"default:0" json:"phase"`                     // Statements of a phase run in parallel, phases in order
+	Statement   string     `gorm:"type:text;not null" json:"statement"`
+	Status      string     `gorm:"type:varchar(20);not null;default:'pending'" json:"status"` // pending, running, done, ignored, failed
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// TableName specifies the table name
+func (*SchemaStatement) TableName() string {
+	return "schema_statements"
+}
+
+// SectionProgress counts the statements of a schema section by status
+type SectionProgress struct {
+	Total    int `json:"total"`
+	Pending  int `json:"pending"`
+	Running  int `json:"running"`
+	Done     int `json:"done"`
+	Ignored  int `json:"ignored"`
+	Failed   int `json:"failed"`
+	Progress int `json:"progress"` // Finished (done, ignored or failed) statements 0-100
+}
+
+// SummarizeSection counts statements by status
+func SummarizeSection(statements []SchemaStatement) SectionProgress {
+	var p SectionProgress
+	for _, stmt := range statements {
+		p.Total++
+		switch stmt.Status {
+		case StatementRunning:
+			p.Running++
+		case StatementDone:
+			p.Done++
+		case StatementIgnored:
+			p.Ignored++
+		case StatementFailed:
+			p.Failed++
+		default:
+			p.Pending++
+		}
+	}
+	if p.Total > 0 {
+		p.Progress = (p.Done + p.Ignored + p.Failed) * 100 / p.Total
+	}
+	return p
+}
+
+// SchemaDDL is the DDL of a database schema, generated from the source catalog
+type SchemaDDL struct {
+	PreData  []string            `json:"pre_data"`          // Schemas, types, sequences, functions, tables and views in dependency order
+	PostData []PostDataStatement `json:"post_data"`         // Indexes, then constraints and triggers
+	Skipped  []string            `json:"skipped,omitempty"` // Views and functions using tables that are not migrated, as schema.name
+}
+
+// Post-data phases: statements of a phase run in parallel, phases in order
+// Indexes, including primary key, unique and exclusion constraints, are built first, then partition
+// indexes are attached to their parents, then foreign keys, checks and triggers, which may use them.
+const (
+	PhaseWithTables = iota // Run as the tables are created
+	PhaseIndexes
+	PhaseAttach
+	PhaseOther
+)
+
+// PostDataStatement is a post-data statement generated from the source catalog
+type PostDataStatement struct {
+	Table      string `json:"table"` // Source table the statement is on, as schema.table
+	Phase      int    `json:"phase"`
+	PrimaryKey bool   `json:"primary_key,omitempty"` // Adds the primary key of the table
+	Statement  string `json:"statement"`
+}
+
+// Schema diff change kinds
+const (
+	ChangeMissing = "missing" // Only on the source
+	ChangeExtra   = "extra"   // Only on the target
+	ChangeChanged = "changed" // On both, with a different definition
+)
+
+// SchemaDiff is the difference between the source and target structure of a task's tables
+type SchemaDiff struct {
+	CheckedAt  time.Time   `json:"checked_at"`
+	Compared   int         `json:"compared"`          // Tables compared
+	Skipped    []string    `json:"skipped,omitempty"` // Source tables not compared, those with column transformations or a partitioning override
+	Tables     []TableDiff `json:"tables"`            // Tables with differences
+	Statements []string    `json:"statements"`        // Statements making the target match the source, in order
+}
+
+// Empty reports whether the compared tables match
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Tables) == 0
+}
+
+// TableDiff is the difference between a source table and its target table
+type TableDiff struct {
+	Database     string         `json:"database"` // Source database
+	SourceSchema string         `json:"source_schema"`
+	SourceTable  string         `json:"source_table"`
+	TargetSchema string         `json:"target_schema"`
+	TargetTable  string         `json:"target_table"`
+	Changes      []SchemaChange `json:"changes"`
+	Statements   []string       `json:"statements"`
+}
+
+// SchemaChange is a difference in one object of a table
+type SchemaChange struct {
+	Object string `json:"object"`          // table, column, index, constraint or sequence
+	Name   string `json:"name"`            // Source name, the target name for extra objects
+	Kind   string `json:"kind"`            // missing, extra or changed
+	Field  string `json:"field,omitempty"` // Changed attribute, e.g. type, nullable, default
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// TableSelection selects the databases, schemas and tables a task migrates
+// Patterns are globs as matched by path.Match, e.g. "app_*" or "sales.order_?",
+// or regular expressions matched against the whole name when prefixed with "re:", e.g. "re:tenant_[0-9]+"
+type TableSelection struct {
+	Databases ObjectFilter `json:"databases"` // Database names, no include patterns means every database
+	Schemas   ObjectFilter `json:"schemas"`   // Schema names, no include patterns means every non-system schema
+	Tables    ObjectFilter `json:"tables"`    // Table names, patterns with a dot match schema.table, others the table name
+}
+
+// ObjectFilter includes and excludes objects by name
+type ObjectFilter struct {
+	Include []string `json:"include,omitempty"` // Objects to migrate, empty means all
+	Exclude []string `json:"exclude,omitempty"` // Objects to skip, wins over include
+}
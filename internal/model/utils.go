@@ -19,9 +19,11 @@ const (
 	StateConnect      StateType = "connect"
 	StateCreateTables StateType = "create_tables"
 	StateFullSync     StateType = "full_sync"
+	StateCreateIndexes StateType = "create_indexes"
 	StateIncSync      StateType = "inc_sync"
 	StateWaiting      StateType = "waiting"
 	StateValidating   StateType = "validating"
+	StateFallback     StateType = "fallback"
 	StateCompleted    StateType = "completed"
 	StateFailed       StateType = "failed"
 	StatePaused       StateType = "paused"
@@ -45,11 +47,13 @@ func (s StateType) CanTransition(target StateType) bool {
 		StateInit:       {StateConnect, StateFailed},
 		StateConnect:    {StateCreateTables, StateFailed, StatePaused},
 		StateCreateTables: {StateFullSync, StateFailed, StatePaused},
-		StateFullSync:   {StateIncSync, StateFailed, StatePaused},
+		StateFullSync:   {StateCreateIndexes, StateFailed, StatePaused},
+		StateCreateIndexes: {StateIncSync, StateFailed, StatePaused},
 		StateIncSync:    {StateWaiting, StateFailed, StatePaused},
 		StateWaiting:    {StateValidating, StateFailed, StatePaused},
-		StateValidating: {StateCompleted, StateFailed},
-		StatePaused:     {StateConnect, StateCreateTables, StateFullSync, StateIncSync, StateWaiting, StateFailed},
+		StateValidating: {StateCompleted, StateFallback, StateFailed},
+		StateFallback:   {StateCompleted, StateFailed},
+		StatePaused:     {StateConnect, StateCreateTables, StateFullSync, StateCreateIndexes, StateIncSync, StateWaiting, StateFailed},
 		// Terminal states cannot transition
 		StateCompleted: {},
 		StateFailed:    {},
@@ -77,9 +81,11 @@ func GetStateDisplayName(state StateType) string {
 		StateConnect:    "Connecting to databases",
 		StateCreateTables: "Creating target tables",
 		StateFullSync:   "Full data synchronization",
+		StateCreateIndexes: "Creating indexes and constraints",
 		StateIncSync:    "Incremental synchronization",
 		StateWaiting:    "Waiting for switchover",
 		StateValidating: "Validating data",
+		StateFallback:   "Reverse replicating for fallback",
 		StateCompleted:  "Completed",
 		StateFailed:     "Failed",
 		StatePaused:     "Paused",
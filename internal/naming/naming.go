@@ -0,0 +1,184 @@
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pg/dts/internal/model"
+)
+
+// maxNameLength is the length in bytes PostgreSQL truncates identifiers to
+const maxNameLength = 63
+
+// hashLength is the length of the hash that distinguishes shortened names
+const hashLength = 8
+
+// Mapper maps source database, schema and table names to target names
+type Mapper struct {
+	databases map[string]string
+	schemas   map[string]string
+	tables    map[string]qualifiedName // key: schema.table
+	rewrites  []rewrite
+	prefix    string
+	suffix    string
+
+	mu      sync.RWMutex
+	inverse map[string]qualifiedName // key: target schema.table, value: source name
+}
+
+// qualifiedName is a schema-qualified table name
+type qualifiedName struct {
+	schema string
+	table  string
+}
+
+// rewrite is a compiled regular expression rewrite of table names
+type rewrite struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+// New compiles a name mapping
+func New(cfg *model.NameMapping) (*Mapper, error) {
+	m := &Mapper{
+		databases: cfg.Databases,
+		schemas:   cfg.Schemas,
+		tables:    make(map[string]qualifiedName, len(cfg.Tables)),
+		prefix:    cfg.Prefix,
+		suffix:    cfg.Suffix,
+		inverse:   make(map[string]qualifiedName),
+	}
+	if len(cfg.Prefix)+len(cfg.Suffix) > maxNameLength-hashLength-1 {
+		return nil, fmt.Errorf("prefix and suffix are longer than %d bytes together", maxNameLength-hashLength-1)
+	}
+	for source, target := range cfg.Tables {
+		if source == "" || target == "" {
+			return nil, fmt.Errorf("invalid table mapping %q -> %q", source, target)
+		}
+		schema, table := Split(source)
+		targetSchema, targetTable := m.Schema(schema), target
+		if i := strings.IndexByte(target, '.'); i >= 0 {
+			targetSchema, targetTable = target[:i], target[i+1:]
+		}
+		m.tables[schema+"."+table] = qualifiedName{targetSchema, targetTable}
+		m.inverse[targetSchema+"."+targetTable] = qualifiedName{schema, table}
+	}
+	for _, r := range cfg.Rewrites {
+		pattern, err := regexp.Compile("^(?:" + r.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite pattern %q: %w", r.Pattern, err)
+		}
+		m.rewrites = append(m.rewrites, rewrite{pattern: pattern, replace: r.Replace})
+	}
+	return m, nil
+}
+
+// Split splits a table name into schema and table, unqualified names are in the public schema
+func Split(name string) (string, string) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "public", name
+}
+
+// Join returns the name of a table as Split parses it, tables in the public schema are unqualified
+func Join(schema, table string) string {
+	if schema == "public" {
+		return table
+	}
+	return schema + "." + table
+}
+
+// Database returns the target name of a source database
+func (m *Mapper) Database(name string) string {
+	if target, ok := m.databases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// Schema returns the target name of a source schema
+func (m *Mapper) Schema(name string) string {
+	if target, ok := m.schemas[name]; ok {
+		return target
+	}
+	return name
+}
+
+// Table returns the target schema and name of a source table
+func (m *Mapper) Table(schema, table string) (string, string) {
+	if target, ok := m.tables[schema+"."+table]; ok {
+		return target.schema, target.table
+	}
+	for _, r := range m.rewrites {
+		if r.pattern.MatchString(table) {
+			return m.Schema(schema), r.pattern.ReplaceAllString(table, r.replace)
+		}
+	}
+	return m.Schema(schema), m.affix(table)
+}
+
+// Object returns the target name of an index or constraint, which gets the prefix and suffix
+// so that it does not collide with the source object when both are in the same schema
+func (m *Mapper) Object(name string) string {
+	return m.affix(name)
+}
+
+// affix adds the prefix and suffix to a name
+// A result longer than PostgreSQL keeps shortens the name in between and appends a hash of it,
+// so that long names sharing a beginning do not truncate to the same target name.
+func (m *Mapper) affix(name string) string {
+	affixed := m.prefix + name + m.suffix
+	if len(affixed) <= maxNameLength {
+		return affixed
+	}
+	sum := sha256.Sum256([]byte(name))
+	keep := maxNameLength - len(m.prefix) - len(m.suffix) - hashLength - 1
+	for keep > 0 && !utf8.RuneStart(name[keep]) {
+		keep--
+	}
+	return m.prefix + name[:keep] + "_" + hex.EncodeToString(sum[:])[:hashLength] + m.suffix
+}
+
+// Identity reports whether every name maps to itself
+func (m *Mapper) Identity() bool {
+	return len(m.databases) == 0 && len(m.schemas) == 0 && len(m.tables) == 0 &&
+		len(m.rewrites) == 0 && m.prefix == "" && m.suffix == ""
+}
+
+// Register records the target name of a source table, so that Reverse can map it back
+func (m *Mapper) Register(schema, table string) {
+	targetSchema, targetTable := m.Table(schema, table)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inverse[targetSchema+"."+targetTable] = qualifiedName{schema, table}
+}
+
+// Reverse returns the source schema and name of a target table
+// Explicit pairs and registered tables are mapped back exactly, other names by removing
+// the prefix and suffix; rewritten and shortened names can only be mapped back once registered
+func (m *Mapper) Reverse(schema, table string) (string, string) {
+	m.mu.RLock()
+	source, ok := m.inverse[schema+"."+table]
+	m.mu.RUnlock()
+	if ok {
+		return source.schema, source.table
+	}
+
+	sourceSchema := schema
+	for from, to := range m.schemas {
+		if to == schema {
+			sourceSchema = from
+			break
+		}
+	}
+	if strings.HasPrefix(table, m.prefix) && strings.HasSuffix(table, m.suffix) && len(table) > len(m.prefix)+len(m.suffix) {
+		table = table[len(m.prefix) : len(table)-len(m.suffix)]
+	}
+	return sourceSchema, table
+}
@@ -0,0 +1,42 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pg/dts/internal/model"
+)
+
+func TestObjectLength(t *testing.T) {
+	m, err := New(&model.NameMapping{Prefix: "stage_", Suffix: "_v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Object("orders_pkey"); got != "stage_orders_pkey_v2" {
+		t.Errorf("Object = %q", got)
+	}
+
+	long := strings.Repeat("x", 60)
+	a, b := m.Object(long+"_a"), m.Object(long+"_b")
+	if len(a) > maxNameLength || len(b) > maxNameLength {
+		t.Errorf("Object is longer than %d bytes: %q, %q", maxNameLength, a, b)
+	}
+	if a == b {
+		t.Errorf("long names shortened to the same name %q", a)
+	}
+	if !strings.HasPrefix(a, "stage_") || !strings.HasSuffix(a, "_v2") {
+		t.Errorf("shortened name %q lost the prefix or suffix", a)
+	}
+	if _, table := m.Table("public", long+"_a"); table != a {
+		t.Errorf("Table = %q, want %q", table, a)
+	}
+
+	// Multibyte characters are not cut
+	if got := m.Object(strings.Repeat("é", 40)); !strings.HasPrefix(got, "stage_") || strings.ContainsRune(got, '�') || len(got) > maxNameLength {
+		t.Errorf("Object = %q", got)
+	}
+
+	if _, err := New(&model.NameMapping{Prefix: strings.Repeat("p", 50), Suffix: "_suffix"}); err == nil {
+		t.Error("New accepted a prefix and suffix leaving no room for the name")
+	}
+}
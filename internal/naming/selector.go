@@ -0,0 +1,133 @@
+package naming
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pg/dts/internal/model"
+)
+
+// regexPrefix marks a pattern as a regular expression instead of a glob
+const regexPrefix = "re:"
+
+// Selector decides which databases, schemas and tables a task migrates
+type Selector struct {
+	databases filter
+	schemas   filter
+	tables    filter
+}
+
+// filter is a compiled include/exclude filter
+type filter struct {
+	include []matcher
+	exclude []matcher
+}
+
+// matcher matches names against one pattern
+type matcher struct {
+	qualified bool // Matches schema.table instead of the table name
+	match     func(name string) bool
+}
+
+// NewSelector compiles a table selection, a nil selection selects everything
+func NewSelector(cfg *model.TableSelection) (*Selector, error) {
+	if cfg == nil {
+		return &Selector{}, nil
+	}
+	s := &Selector{}
+	var err error
+	if s.databases, err = compileFilter(cfg.Databases); err != nil {
+		return nil, err
+	}
+	if s.schemas, err = compileFilter(cfg.Schemas); err != nil {
+		return nil, err
+	}
+	if s.tables, err = compileFilter(cfg.Tables); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compileFilter compiles the patterns of a filter
+func compileFilter(cfg model.ObjectFilter) (filter, error) {
+	var f filter
+	for _, pattern := range cfg.Include {
+		m, err := compilePattern(pattern)
+		if err != nil {
+			return filter{}, err
+		}
+		f.include = append(f.include, m)
+	}
+	for _, pattern := range cfg.Exclude {
+		m, err := compilePattern(pattern)
+		if err != nil {
+			return filter{}, err
+		}
+		f.exclude = append(f.exclude, m)
+	}
+	return f, nil
+}
+
+// compilePattern compiles a glob or "re:" regular expression pattern
+func compilePattern(pattern string) (matcher, error) {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return matcher{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		return matcher{qualified: strings.Contains(expr, `\.`), match: re.MatchString}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return matcher{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return matcher{
+		qualified: strings.Contains(pattern, "."),
+		match: func(name string) bool {
+			ok, _ := path.Match(pattern, name)
+			return ok
+		},
+	}, nil
+}
+
+// Database reports whether a database is selected
+func (s *Selector) Database(name string) bool {
+	return s.databases.match(name, name)
+}
+
+// Schema reports whether the tables of a schema are selected
+func (s *Selector) Schema(name string) bool {
+	return s.schemas.match(name, name)
+}
+
+// Table reports whether a table is selected, the schema of the table must be selected too
+func (s *Selector) Table(schema, table string) bool {
+	return s.Schema(schema) && s.tables.match(table, schema+"."+table)
+}
+
+// match applies the filter to a name and its qualified form
+func (f *filter) match(name, qualified string) bool {
+	for _, m := range f.exclude {
+		if m.matches(name, qualified) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, m := range f.include {
+		if m.matches(name, qualified) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches matches the name, or the qualified name for qualified patterns
+func (m *matcher) matches(name, qualified string) bool {
+	if m.qualified {
+		return m.match(qualified)
+	}
+	return m.match(name)
+}
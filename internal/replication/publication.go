@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -46,22 +47,28 @@ func (pm *PublicationManager) Close() error {
 	return sqlDB.Close()
 }
 
-// CreatePublication creates a publication
+// CreatePublication creates a publication of tables given as quoted qualified names
 func (pm *PublicationManager) CreatePublication(pubName string, tables []string) error {
+	return pm.createPublication(pubName, tables, "")
+}
+
+// CreatePublicationViaRoot creates a publication with publish_via_partition_root
+// Changes of partitions are published as changes of their partitioned root table
+func (pm *PublicationManager) CreatePublicationViaRoot(pubName string, tables []string) error {
+	return pm.createPublication(pubName, tables, " WITH (publish_via_partition_root = true)")
+}
+
+// createPublication creates a publication with optional WITH clause
+func (pm *PublicationManager) createPublication(pubName string, tables []string, with string) error {
 	if len(tables) == 0 {
 		return fmt.Errorf("no tables specified")
 	}
 
-	// Build table list
-	tableList := make([]string, len(tables))
-	for i, table := range tables {
-		tableList[i] = fmt.Sprintf("'%s'", table)
-	}
-
 	query := fmt.Sprintf(
-		"CREATE PUBLICATION %s FOR TABLE %s",
-		pubName,
-		strings.Join(tableList, ", "),
+		"CREATE PUBLICATION %s FOR TABLE %s%s",
+		pgx.Identifier{pubName}.Sanitize(),
+		strings.Join(tables, ", "),
+		with,
 	)
 
 	err := pm.db.Exec(query).Error
@@ -74,7 +81,7 @@ func (pm *PublicationManager) CreatePublication(pubName string, tables []string)
 
 // DropPublication drops a publication
 func (pm *PublicationManager) DropPublication(pubName string) error {
-	query := fmt.Sprintf("DROP PUBLICATION IF EXISTS %s", pubName)
+	query := "DROP PUBLICATION IF EXISTS " + pgx.Identifier{pubName}.Sanitize()
 	err := pm.db.Exec(query).Error
 	if err != nil {
 		return fmt.Errorf("failed to drop publication: %w", err)
@@ -97,21 +104,16 @@ func (pm *PublicationManager) PublicationExists(pubName string) (bool, error) {
 	return exists, nil
 }
 
-// AddTables adds tables to publication
+// AddTables adds tables given as quoted qualified names to publication
 func (pm *PublicationManager) AddTables(pubName string, tables []string) error {
 	if len(tables) == 0 {
 		return fmt.Errorf("no tables specified")
 	}
 
-	tableList := make([]string, len(tables))
-	for i, table := range tables {
-		tableList[i] = fmt.Sprintf("'%s'", table)
-	}
-
 	query := fmt.Sprintf(
 		"ALTER PUBLICATION %s ADD TABLE %s",
-		pubName,
-		strings.Join(tableList, ", "),
+		pgx.Identifier{pubName}.Sanitize(),
+		strings.Join(tables, ", "),
 	)
 
 	err := pm.db.Exec(query).Error
@@ -0,0 +1,79 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pg/dts/internal/wal"
+)
+
+// Runner runs a subscriber's replication stream in the background
+// It is stored in the task connection pool and is closed together with the task connections
+type Runner struct {
+	subscriber *Subscriber
+	cancel     context.CancelFunc
+	done       chan struct{}
+
+	mu  sync.Mutex
+	err error // Error that stopped the stream, nil while running
+}
+
+// StartRunner starts replication for publicationName and processes the stream in a background goroutine
+// The stream is not bound to the caller's context, it runs until Close is called or it fails
+func StartRunner(subscriber *Subscriber, publicationName string) (*Runner, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if err := subscriber.StartReplication(ctx, publicationName); err != nil {
+		cancel()
+		subscriber.Close()
+		return nil, err
+	}
+
+	r := &Runner{
+		subscriber: subscriber,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.done)
+		err := subscriber.ProcessReplicationStream(ctx)
+		if ctx.Err() != nil {
+			// Stopped by Close, not a stream failure
+			return
+		}
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+	}()
+
+	return r, nil
+}
+
+// Err returns the error that stopped the stream or stopped applying its changes, nil while both run
+// A stream whose changes fail to apply keeps archiving them until it is closed
+func (r *Runner) Err() error {
+	r.mu.Lock()
+	err := r.err
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.subscriber.ApplyErr()
+}
+
+// Markers returns the markers applied by the stream, nil if markers are not recorded
+func (r *Runner) Markers() *wal.MarkerLog {
+	return r.subscriber.handler.Markers()
+}
+
+// Close stops the stream and closes the replication connection
+func (r *Runner) Close() error {
+	r.cancel()
+	<-r.done
+	if err := r.subscriber.Close(); err != nil {
+		return fmt.Errorf("failed to close subscriber: %w", err)
+	}
+	return nil
+}
@@ -1,8 +1,12 @@
 package replication
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -60,6 +64,22 @@ func (sm *SlotManager) CreateSlot(slotName, plugin string) error {
 	return nil
 }
 
+// CreateSlotTwoPhase creates a logical replication slot with two-phase decoding enabled
+// Prepared transactions are then decoded at PREPARE TRANSACTION instead of at COMMIT PREPARED
+func (sm *SlotManager) CreateSlotTwoPhase(slotName, plugin string) error {
+	if plugin == "" {
+		plugin = "pgoutput"
+	}
+
+	query := "SELECT pg_create_logical_replication_slot(?, ?, false, true)"
+	err := sm.db.Exec(query, slotName, plugin).Error
+	if err != nil {
+		return fmt.Errorf("failed to create replication slot: %w", err)
+	}
+
+	return nil
+}
+
 // DropSlot drops a replication slot
 func (sm *SlotManager) DropSlot(slotName string) error {
 	query := "SELECT pg_drop_replication_slot(?)"
@@ -70,6 +90,27 @@ func (sm *SlotManager) DropSlot(slotName string) error {
 	return nil
 }
 
+// DropSlotIfExists drops a replication slot unless it does not exist
+// A stream that was just closed releases its slot when its server process exits, which is waited
+// for up to wait.
+func (sm *SlotManager) DropSlotIfExists(slotName string, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	for {
+		var active []bool
+		err := sm.db.Raw("SELECT active FROM pg_replication_slots WHERE slot_name = ?", slotName).Scan(&active).Error
+		if err != nil {
+			return fmt.Errorf("failed to check slot activity: %w", err)
+		}
+		switch {
+		case len(active) == 0:
+			return nil
+		case !active[0] || time.Now().After(deadline):
+			return sm.DropSlot(slotName)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
 // SlotExists checks if replication slot exists
 func (sm *SlotManager) SlotExists(slotName string) (bool, error) {
 	var exists bool
@@ -84,3 +125,74 @@ func (sm *SlotManager) SlotExists(slotName string) (bool, error) {
 
 	return exists, nil
 }
+
+// SnapshotSlot is a logical replication slot created together with an exported snapshot
+// The snapshot sees exactly the data committed before the first change the slot decodes. Other
+// connections can import it while the replication connection that created the slot stays open and idle.
+type SnapshotSlot struct {
+	conn            *pgconn.PgConn
+	Name            string // Empty for a snapshot exported without a slot
+	Snapshot        string // Name to import with SET TRANSACTION SNAPSHOT
+	ConsistentPoint string // LSN from which the slot decodes changes, or that every transaction seen by a snapshot without slot committed before
+}
+
+// CreateSnapshotSlot creates a pgoutput slot on a replication connection and exports its snapshot
+// twoPhase enables two-phase decoding, which needs PostgreSQL 15 or later
+func CreateSnapshotSlot(ctx context.Context, replicationDSN, slotName string, twoPhase bool) (*SnapshotSlot, error) {
+	conn, err := pgconn.Connect(ctx, replicationDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	action := "EXPORT_SNAPSHOT"
+	if twoPhase {
+		action = "(SNAPSHOT 'export', TWO_PHASE true)"
+	}
+	result, err := pglogrepl.CreateReplicationSlot(ctx, conn, slotName, "pgoutput", pglogrepl.CreateReplicationSlotOptions{
+		Mode:           pglogrepl.LogicalReplication,
+		SnapshotAction: action,
+	})
+	if err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to create replication slot: %w", err)
+	}
+
+	return &SnapshotSlot{
+		conn:            conn,
+		Name:            result.SlotName,
+		Snapshot:        result.SnapshotName,
+		ConsistentPoint: result.ConsistentPoint,
+	}, nil
+}
+
+// ExportSnapshot exports a snapshot from a repeatable read transaction on a regular connection
+// The transaction stays open, and the snapshot importable, until the snapshot is closed. Its
+// ConsistentPoint is the WAL insert position taken with the snapshot, so a transaction seen by the
+// snapshot committed before it.
+func ExportSnapshot(ctx context.Context, dsn string) (*SnapshotSlot, error) {
+	conn, err := pgconn.Connect(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	results, err := conn.Exec(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY; SELECT pg_export_snapshot(), pg_current_wal_insert_lsn()").ReadAll()
+	if err == nil && (len(results) != 2 || len(results[1].Rows) != 1) {
+		err = fmt.Errorf("unexpected result")
+	}
+	if err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to export snapshot: %w", err)
+	}
+
+	row := results[1].Rows[0]
+	return &SnapshotSlot{
+		conn:            conn,
+		Snapshot:        string(row[0]),
+		ConsistentPoint: string(row[1]),
+	}, nil
+}
+
+// Close closes the connection, which ends the exported snapshot but keeps the slot
+func (s *SnapshotSlot) Close() error {
+	return s.conn.Close(context.Background())
+}
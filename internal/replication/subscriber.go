@@ -2,20 +2,61 @@ package replication
 
 import (
 	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/pg/dts/internal/archive"
 	"github.com/pg/dts/internal/wal"
 )
 
+// applyQueueSize bounds the received messages waiting to be handled
+const applyQueueSize = 1024
+
+// statusInterval is how often status updates are sent while the apply queue is full
+const statusInterval = 10 * time.Second
+
+// Failed messages are retried after applyRetryBackoff, doubled on every retry up to
+// maxApplyRetryBackoff; errors other than connection errors stop handling after maxApplyRetries
+const (
+	applyRetryBackoff    = 500 * time.Millisecond
+	maxApplyRetryBackoff = 30 * time.Second
+	maxApplyRetries      = 5
+)
+
+// queuedMessage is a received message waiting to be handled, a nil msg only advances the position
+type queuedMessage struct {
+	msg   wal.Message
+	start pglogrepl.LSN
+	end   pglogrepl.LSN
+}
+
 // Subscriber is a WAL subscriber
+// Messages are received and archived on the replication connection and handled by a separate
+// goroutine, so that a throttled or slow sink does not stop the status updates the server expects.
 type Subscriber struct {
 	conn     *pgconn.PgConn
 	decoder  *wal.Decoder
 	handler  *wal.Handler
 	slotName string
+	archive  *archive.Writer // Optional, every decoded message is archived before it is handled
+	twoPhase bool            // Decode prepared transactions at PREPARE TRANSACTION
+
+	received  pglogrepl.LSN // End of the last message received
+	confirmed pglogrepl.LSN // Position reported to the server as flushed, changes before it are delivered
+
+	mu       sync.Mutex
+	applied  pglogrepl.LSN // End of the last message handled
+	applyErr error         // Error that stopped handling messages after retries, they are still received and archived
 }
 
 // NewSubscriber creates a subscriber
@@ -33,23 +74,81 @@ func NewSubscriber(connString, slotName string) (*Subscriber, error) {
 	}, nil
 }
 
+// NewSubscriberWithHandler creates a subscriber that dispatches decoded messages to handler
+func NewSubscriberWithHandler(connString, slotName string, handler *wal.Handler) (*Subscriber, error) {
+	s, err := NewSubscriber(connString, slotName)
+	if err != nil {
+		return nil, err
+	}
+	s.handler = handler
+	return s, nil
+}
+
+// SetArchive sets the archive writer, messages are archived before they are handled
+// so changes that fail to apply are still captured on disk
+func (s *Subscriber) SetArchive(w *archive.Writer) {
+	s.archive = w
+}
+
+// SetTwoPhase enables decoding of prepared transactions (pgoutput two_phase, PostgreSQL 15+)
+// The slot must have been created with two-phase decoding enabled
+func (s *Subscriber) SetTwoPhase(enabled bool) {
+	s.twoPhase = enabled
+}
+
 // Close closes the connection
 func (s *Subscriber) Close() error {
+	if err := s.handler.Close(); err != nil {
+		return fmt.Errorf("failed to close sink: %w", err)
+	}
+	if s.archive != nil {
+		if err := s.archive.Close(); err != nil {
+			return err
+		}
+	}
 	if s.conn != nil {
 		return s.conn.Close(context.Background())
 	}
 	return nil
 }
 
+// ApplyErr returns the error that stopped handling messages, nil while they are handled
+func (s *Subscriber) ApplyErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applyErr
+}
+
+// appliedLSN returns the end of the last message handled
+func (s *Subscriber) appliedLSN() pglogrepl.LSN {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applied
+}
+
 // StartReplication starts replication
 func (s *Subscriber) StartReplication(ctx context.Context, publicationName string) error {
+	// The stream resumes after the slot's confirmed position, which is where flushing starts from
+	confirmed, err := s.confirmedFlushLSN(ctx)
+	if err != nil {
+		return err
+	}
+	s.received, s.applied, s.confirmed = confirmed, confirmed, confirmed
+
 	// Create replication stream
+	// Logical decoding messages (pg_logical_emit_message) carry fences and custom markers
 	pluginArgs := []string{
-		"proto_version", "1",
-		"publication_names", publicationName,
+		"proto_version '1'",
+		fmt.Sprintf("publication_names '%s'", publicationName),
+		"messages 'true'",
+	}
+	if s.twoPhase {
+		// Two-phase messages require protocol version 3
+		pluginArgs[0] = "proto_version '3'"
+		pluginArgs = append(pluginArgs, "two_phase 'on'")
 	}
 
-	err := pglogrepl.StartReplication(
+	err = pglogrepl.StartReplication(
 		ctx,
 		s.conn,
 		s.slotName,
@@ -64,8 +163,39 @@ func (s *Subscriber) StartReplication(ctx context.Context, publicationName strin
 	return nil
 }
 
+// confirmedFlushLSN returns the position up to which the slot's changes have been confirmed
+func (s *Subscriber) confirmedFlushLSN(ctx context.Context) (pglogrepl.LSN, error) {
+	result, err := s.conn.Exec(ctx, fmt.Sprintf(
+		"SELECT confirmed_flush_lsn FROM pg_replication_slots WHERE slot_name = '%s'", s.slotName)).ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read slot position: %w", err)
+	}
+	if len(result) == 0 || len(result[0].Rows) == 0 || result[0].Rows[0][0] == nil {
+		return 0, fmt.Errorf("replication slot %s does not exist", s.slotName)
+	}
+	lsn, err := pglogrepl.ParseLSN(string(result[0].Rows[0][0]))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse slot position: %w", err)
+	}
+	return lsn, nil
+}
+
 // ProcessReplicationStream processes replication stream
+// Received messages are handled by an apply goroutine through a bounded queue, which is stopped
+// and waited for before returning
 func (s *Subscriber) ProcessReplicationStream(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	queue := make(chan queuedMessage, applyQueueSize)
+	applying := make(chan struct{})
+	go func() {
+		defer close(applying)
+		s.applyMessages(ctx, queue)
+	}()
+	defer func() {
+		cancel()
+		<-applying
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -80,7 +210,7 @@ func (s *Subscriber) ProcessReplicationStream(ctx context.Context) error {
 			// Process message
 			switch v := msg.(type) {
 			case *pgproto3.CopyData:
-				if err := s.handleCopyData(ctx, v); err != nil {
+				if err := s.handleCopyData(ctx, v, queue); err != nil {
 					return err
 				}
 			case *pgproto3.NoticeResponse:
@@ -95,7 +225,11 @@ func (s *Subscriber) ProcessReplicationStream(ctx context.Context) error {
 }
 
 // handleCopyData handles replication data
-func (s *Subscriber) handleCopyData(ctx context.Context, msg *pgproto3.CopyData) error {
+// Every message is archived before it is queued for handling, whatever the outcome of handling
+// it. While a failed message is retried, later messages are still archived until the queue is
+// full; once handling stops they are only archived. The flushed position stays at the last
+// delivered change meanwhile, so that the slot keeps the changes that were not applied.
+func (s *Subscriber) handleCopyData(ctx context.Context, msg *pgproto3.CopyData, queue chan<- queuedMessage) error {
 	switch msg.Data[0] {
 	case pglogrepl.PrimaryKeepaliveMessageByteID:
 		// Handle keepalive message
@@ -104,19 +238,18 @@ func (s *Subscriber) handleCopyData(ctx context.Context, msg *pgproto3.CopyData)
 			return fmt.Errorf("failed to parse keepalive: %w", err)
 		}
 
-		if pkm.ServerWALEnd > pglogrepl.LSN(0) {
-			// Send acknowledgment
-			err = pglogrepl.SendStandbyStatusUpdate(
-				ctx,
-				s.conn,
-				pglogrepl.StandbyStatusUpdate{
-					WALWritePosition: pkm.ServerWALEnd,
-				},
-			)
-			if err != nil {
-				return fmt.Errorf("failed to send status update: %w", err)
+		if pkm.ServerWALEnd > s.received {
+			s.received = pkm.ServerWALEnd
+			// WAL up to the server's end has nothing left to apply once the queued messages are
+			// handled; a full queue advances the position with a later message
+			select {
+			case queue <- queuedMessage{start: pkm.ServerWALEnd, end: pkm.ServerWALEnd}:
+			default:
 			}
 		}
+		if err := s.sendStatus(ctx); err != nil {
+			return err
+		}
 
 	case pglogrepl.XLogDataByteID:
 		// Handle XLog data
@@ -125,35 +258,175 @@ func (s *Subscriber) handleCopyData(ctx context.Context, msg *pgproto3.CopyData)
 			return fmt.Errorf("failed to parse xlog data: %w", err)
 		}
 
-		// Parse logical replication message
-		logicalMsg, err := pglogrepl.Parse(xld.WALData)
+		// Decode logical replication message
+		decodedMsg, err := s.decoder.DecodeData(xld.WALData)
 		if err != nil {
-			return fmt.Errorf("failed to parse logical message: %w", err)
+			return fmt.Errorf("failed to decode message: %w", err)
 		}
+		end := xld.WALStart + pglogrepl.LSN(len(xld.WALData))
 
-		// Decode message
-		decodedMsg, err := s.decoder.Decode(logicalMsg)
-		if err != nil {
-			return fmt.Errorf("failed to decode message: %w", err)
+		if decodedMsg != nil && s.archive != nil {
+			if err := s.archive.Write(uint64(xld.WALStart), decodedMsg); err != nil {
+				return fmt.Errorf("failed to archive message: %w", err)
+			}
+		}
+		if end > s.received {
+			s.received = end
+		}
+
+		// nil means the message carries nothing to apply
+		if err := s.enqueue(ctx, queue, queuedMessage{msg: decodedMsg, start: xld.WALStart, end: end}); err != nil {
+			return err
+		}
+		if err := s.sendStatus(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enqueue queues a message for handling, sending status updates while the queue is full
+func (s *Subscriber) enqueue(ctx context.Context, queue chan<- queuedMessage, item queuedMessage) error {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case queue <- item:
+			return nil
+		case <-ticker.C:
+			if err := s.sendStatus(ctx); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	}
+}
 
-		// Handle message
-		if err := s.handler.Handle(ctx, decodedMsg); err != nil {
-			return fmt.Errorf("failed to handle message: %w", err)
+// applyMessages handles queued messages in order until ctx is done
+// With a retryable sink, a failed message is retried with backoff together with the messages of its
+// transaction handled before it, since the sink discards a transaction that fails. Connection
+// errors are retried until they clear; other errors stop handling after maxApplyRetries. Once
+// handling stops, the queue is drained without handling.
+func (s *Subscriber) applyMessages(ctx context.Context, queue <-chan queuedMessage) {
+	var txn []wal.Message // Messages of the current transaction already handled
+	for {
+		var item queuedMessage
+		select {
+		case item = <-queue:
+		case <-ctx.Done():
+			return
+		}
+		if s.ApplyErr() != nil {
+			continue
 		}
 
-		// Send acknowledgment
-		err = pglogrepl.SendStandbyStatusUpdate(
-			ctx,
-			s.conn,
-			pglogrepl.StandbyStatusUpdate{
-				WALWritePosition: xld.WALStart + pglogrepl.LSN(len(xld.WALData)),
-			},
-		)
+		if item.msg != nil {
+			if err := s.handler.Handle(ctx, item.msg); err != nil {
+				if s.handler.Retryable() {
+					err = s.retryApply(ctx, txn, item.msg, err)
+				}
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					s.mu.Lock()
+					s.applyErr = fmt.Errorf("failed to handle message at %s: %w", item.start, err)
+					s.mu.Unlock()
+					continue
+				}
+			}
+			switch item.msg.(type) {
+			case *wal.BeginMessage, *wal.BeginPrepareMessage:
+				txn = append(txn[:0], item.msg)
+			case *wal.CommitMessage, *wal.PrepareMessage:
+				txn = txn[:0]
+			default:
+				if len(txn) > 0 {
+					txn = append(txn, item.msg)
+				}
+			}
+		}
+		s.mu.Lock()
+		if item.end > s.applied {
+			s.applied = item.end
+		}
+		s.mu.Unlock()
+	}
+}
+
+// retryApply handles the transaction messages txn and then msg again after err, with backoff
+// It returns the last error once retries are exhausted or ctx is done, nil once msg is handled.
+func (s *Subscriber) retryApply(ctx context.Context, txn []wal.Message, msg wal.Message, err error) error {
+	backoff := applyRetryBackoff
+	for attempt := 1; ; attempt++ {
+		if !isConnectionError(err) && attempt > maxApplyRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxApplyRetryBackoff {
+			backoff = maxApplyRetryBackoff
+		}
+
+		err = nil
+		for _, m := range append(txn[:len(txn):len(txn)], msg) {
+			if err = s.handler.Handle(ctx, m); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			return nil
+		}
+	}
+}
+
+// isConnectionError reports whether err is a lost or refused connection, which clears without
+// anything changing on the target
+func isConnectionError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exception, 57P01-57P03 are shutdowns and startup
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) || pgconn.Timeout(err) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// sendStatus reports the received position as written and the delivered position as flushed
+// Handled changes are delivered, unless the sink delivers them later and still has some waiting.
+func (s *Subscriber) sendStatus(ctx context.Context) error {
+	// Read before the sink's state, so that no change handled later counts as delivered
+	applied := s.appliedLSN()
+	delivered, pending := s.handler.Delivered()
+	switch {
+	case !pending:
+		if applied > s.confirmed {
+			s.confirmed = applied
+		}
+	case delivered != "":
+		lsn, err := pglogrepl.ParseLSN(delivered)
 		if err != nil {
-			return fmt.Errorf("failed to send status update: %w", err)
+			return fmt.Errorf("failed to parse delivered position: %w", err)
+		}
+		if lsn > s.confirmed && lsn <= applied {
+			s.confirmed = lsn
 		}
 	}
 
+	err := pglogrepl.SendStandbyStatusUpdate(ctx, s.conn, pglogrepl.StandbyStatusUpdate{
+		WALWritePosition: s.received,
+		WALFlushPosition: s.confirmed,
+		WALApplyPosition: s.confirmed,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send status update: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,32 @@
+package repository
+
+import "github.com/jackc/pgx/v5"
+
+// DefaultBookkeepingSchema is the target schema of the tables DTS keeps on the target by default
+const DefaultBookkeepingSchema = "dts"
+
+// bookkeepingSchema holds the tables DTS keeps on the target, it is never migrated or compared
+var bookkeepingSchema = DefaultBookkeepingSchema
+
+// SetBookkeepingSchema sets the target schema of the bookkeeping tables, empty keeps the default
+// It is set once at startup, before any task runs.
+func SetBookkeepingSchema(schema string) {
+	if schema != "" {
+		bookkeepingSchema = schema
+	}
+}
+
+// BookkeepingSchema returns the target schema of the bookkeeping tables
+func BookkeepingSchema() string {
+	return bookkeepingSchema
+}
+
+// bookkeepingTable returns the qualified name of a bookkeeping table
+func bookkeepingTable(name string) string {
+	return pgx.Identifier{bookkeepingSchema, name}.Sanitize()
+}
+
+// createBookkeepingSchema returns the statement creating the bookkeeping schema
+func createBookkeepingSchema() string {
+	return "CREATE SCHEMA IF NOT EXISTS " + pgx.Identifier{bookkeepingSchema}.Sanitize()
+}
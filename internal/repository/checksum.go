@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// GetColumnNames returns the column names of a source table in attribute order
+func (r *SourceRepository) GetColumnNames(schema, tableName string) ([]string, error) {
+	return columnNames(r.db, schema, tableName)
+}
+
+// GetColumnNames returns the column names of a target table in attribute order
+func (r *TargetRepository) GetColumnNames(schema, tableName string) ([]string, error) {
+	return columnNames(r.db, schema, tableName)
+}
+
+// GetTableChecksum returns a checksum of the columns of the source rows matching predicate
+// An empty predicate checksums every row
+func (r *SourceRepository) GetTableChecksum(schema, tableName string, columns []string, predicate string) (string, error) {
+	return tableChecksum(r.db, schema, tableName, columns, predicate)
+}
+
+// GetTableChecksum returns a checksum of the columns of the target rows matching predicate
+// An empty predicate checksums every row
+func (r *TargetRepository) GetTableChecksum(schema, tableName string, columns []string, predicate string) (string, error) {
+	return tableChecksum(r.db, schema, tableName, columns, predicate)
+}
+
+// columnNames returns the column names of a table in attribute order
+func columnNames(db *gorm.DB, schema, tableName string) ([]string, error) {
+	var columns []string
+	err := db.Raw(`
+		SELECT a.attname
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = ? AND c.relname = ? AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, schema, tableName).Scan(&columns).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns of %s.%s: %w", schema, tableName, err)
+	}
+	return columns, nil
+}
+
+// tableChecksum hashes the text form of every row restricted to columns, independent of row order
+// Both sides must list corresponding columns in the same order and with the same types
+func tableChecksum(db *gorm.DB, schema, tableName string, columns []string, predicate string) (string, error) {
+	if len(columns) == 0 {
+		return "", nil
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = pgx.Identifier{col}.Sanitize()
+	}
+	// Summing the first 64 bits of each row hash streams, an ordered aggregate of the hashes
+	// would build a single value and fail on the 1GB limit of large tables
+	query := fmt.Sprintf(`
+		SELECT coalesce(sum(('x' || substr(md5(ROW(%s)::text), 1, 16))::bit(64)::bigint), 0)::text
+		FROM %s`, strings.Join(quoted, ", "), pgx.Identifier{schema, tableName}.Sanitize())
+	if predicate != "" {
+		query += " WHERE " + predicate
+	}
+
+	var checksum string
+	if err := db.Raw(query).Scan(&checksum).Error; err != nil {
+		return "", fmt.Errorf("failed to get checksum of %s.%s: %w", schema, tableName, err)
+	}
+	return checksum, nil
+}
+
+// RowChecksum sums a hash of rows read with COPY TO, independent of row order
+// Rows hashed on both sides must list corresponding columns in the same order and with the same types
+type RowChecksum struct {
+	sum uint64
+	buf bytes.Buffer
+}
+
+// Add hashes a row in PostgreSQL text format, nil values are NULL
+func (c *RowChecksum) Add(values []*string) {
+	c.buf.Reset()
+	encodeCopyText(&c.buf, values)
+	h := md5.Sum(c.buf.Bytes())
+	c.sum += binary.BigEndian.Uint64(h[:8])
+}
+
+// String returns the checksum
+func (c *RowChecksum) String() string {
+	return strconv.FormatUint(c.sum, 16)
+}
@@ -0,0 +1,341 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pg/dts/internal/model"
+)
+
+// SplitTable splits a table into chunks of about chunkRows estimated rows
+// Tables with a single integer primary key are split into key ranges, others into ctid block ranges
+// on PostgreSQL 14 and later
+func (csm *CopyStreamManager) SplitTable(ctx context.Context, chunk model.CopyChunk, chunkRows int64) ([]model.CopyChunk, error) {
+	rows, blocks, size, err := csm.estimate(ctx, chunk.SourceSchema, chunk.SourceTable)
+	if err != nil {
+		return nil, err
+	}
+	chunk.EstimatedRows = rows
+	chunk.EstimatedBytes = size
+
+	count := (rows + chunkRows - 1) / chunkRows
+	if count <= 1 {
+		return []model.CopyChunk{chunk}, nil
+	}
+
+	keyColumn, minKey, maxKey, err := csm.integerKeyRange(ctx, chunk.SourceSchema, chunk.SourceTable)
+	if err != nil {
+		return nil, err
+	}
+
+	lower, upper, byBlocks := minKey, maxKey+1, false
+	// Key ranges that do not fit in int64 arithmetic are split by blocks
+	if keyColumn == "" || maxKey == math.MaxInt64 || maxKey-minKey < 0 {
+		// Before PostgreSQL 14 every ctid range reads the whole table
+		var version int
+		if err := csm.withConn(func(conn *pgx.Conn) error {
+			return conn.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get server version: %w", err)
+		}
+		if version < 140000 {
+			return []model.CopyChunk{chunk}, nil
+		}
+		lower, upper, byBlocks = 0, blocks, true
+	}
+	if upper-lower < count {
+		count = upper - lower
+	}
+	if count <= 1 {
+		return []model.CopyChunk{chunk}, nil
+	}
+
+	step := (upper - lower + count - 1) / count
+	var chunks []model.CopyChunk
+	for i := int64(0); i < count; i++ {
+		part := chunk
+		part.KeyColumn = keyColumn
+		part.ByBlocks = byBlocks
+		part.EstimatedRows = rows / count
+		part.EstimatedBytes = size / count
+		// Rows outside the range seen now (new keys, appended blocks) belong to the first or last chunk
+		if i > 0 {
+			from := lower + i*step
+			part.Lower = &from
+		}
+		if i < count-1 {
+			to := lower + (i+1)*step
+			part.Upper = &to
+		}
+		chunks = append(chunks, part)
+		if lower+(i+1)*step >= upper {
+			break
+		}
+	}
+	// The loop may stop early when step rounding covers the range in fewer chunks
+	chunks[len(chunks)-1].Upper = nil
+	return chunks, nil
+}
+
+// estimate returns the planner row estimate, heap block count and total size (with TOAST and indexes) of a table
+func (csm *CopyStreamManager) estimate(ctx context.Context, schema, table string) (int64, int64, int64, error) {
+	var rows float64
+	var blocks, size int64
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		return conn.QueryRow(ctx, `
+			SELECT c.reltuples::float8,
+			       pg_relation_size(c.oid) / current_setting('block_size')::bigint,
+			       pg_total_relation_size(c.oid)
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname = $2`, schema, table).Scan(&rows, &blocks, &size)
+	})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to estimate size of %s.%s: %w", schema, table, err)
+	}
+	// Never analyzed tables report -1 (0 before PostgreSQL 14), assume densely filled blocks
+	if rows <= 0 && blocks > 0 {
+		rows = float64(blocks) * 100
+	}
+	return int64(rows), blocks, size, nil
+}
+
+// integerKeyRange returns the single integer primary key column of a table and its value range
+// Returns an empty column if the table has no such key or is empty
+func (csm *CopyStreamManager) integerKeyRange(ctx context.Context, schema, table string) (string, int64, int64, error) {
+	var column string
+	var minKey, maxKey *int64
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		err := conn.QueryRow(ctx, `
+			SELECT a.attname
+			FROM pg_index i
+			JOIN pg_class c ON c.oid = i.indrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+			WHERE n.nspname = $1 AND c.relname = $2 AND i.indisprimary AND i.indnkeyatts = 1
+			  AND a.atttypid IN ('int2'::regtype, 'int4'::regtype, 'int8'::regtype)`, schema, table).Scan(&column)
+		if err == pgx.ErrNoRows {
+			column = ""
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf("SELECT min(%[1]s)::bigint, max(%[1]s)::bigint FROM %[2]s",
+			pgx.Identifier{column}.Sanitize(), pgx.Identifier{schema, table}.Sanitize())
+		return conn.QueryRow(ctx, query).Scan(&minKey, &maxKey)
+	})
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("failed to get key range of %s.%s: %w", schema, table, err)
+	}
+	if column == "" || minKey == nil || maxKey == nil {
+		return "", 0, 0, nil
+	}
+	return column, *minKey, *maxKey, nil
+}
+
+// ExportSnapshot starts a repeatable read transaction and exports its snapshot
+// The snapshot can be imported by other connections until the transaction ends
+func (csm *CopyStreamManager) ExportSnapshot(ctx context.Context) (string, error) {
+	var snapshot string
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+			return err
+		}
+		return conn.QueryRow(ctx, "SELECT pg_export_snapshot()").Scan(&snapshot)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to export snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// ImportSnapshot starts a repeatable read transaction that sees the exported snapshot
+func (csm *CopyStreamManager) ImportSnapshot(ctx context.Context, snapshot string) error {
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+			return err
+		}
+		_, err := conn.Exec(ctx, "SET TRANSACTION SNAPSHOT "+quoteLiteral(snapshot))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import snapshot: %w", err)
+	}
+	return nil
+}
+
+// EndTransaction commits the current transaction
+func (csm *CopyStreamManager) EndTransaction(ctx context.Context) error {
+	return csm.withConn(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "COMMIT")
+		return err
+	})
+}
+
+// BeginTransaction starts a read write transaction
+func (csm *CopyStreamManager) BeginTransaction(ctx context.Context) error {
+	return csm.withConn(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "BEGIN")
+		return err
+	})
+}
+
+// RollbackTransaction rolls back the current transaction
+func (csm *CopyStreamManager) RollbackTransaction(ctx context.Context) error {
+	return csm.withConn(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "ROLLBACK")
+		return err
+	})
+}
+
+// copiedChunks records on the target the full sync chunks whose rows are committed there
+// A chunk is recorded in the transaction that copies its rows, so it is either recorded with all
+// of its rows or has left none behind. A chunk copied with batched INSERTs in key order is also
+// recorded with every batch, with the key of the batch's last row.
+const copiedChunks = "copied_chunks"
+
+// CopiedChunk is the record of a chunk on the target
+type CopiedChunk struct {
+	Rows    int64
+	Done    bool
+	LastKey []string // Key of the last row committed by a chunk not done
+}
+
+// EnsureCopiedChunks creates the table recording copied chunks
+// The table is kept in the bookkeeping schema, out of the migrated schemas
+func (csm *CopyStreamManager) EnsureCopiedChunks(ctx context.Context) error {
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, createBookkeepingSchema()); err != nil {
+			return err
+		}
+		_, err := conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS "+bookkeepingTable(copiedChunks)+" (task_id text NOT NULL, chunk_id bigint NOT NULL, rows bigint NOT NULL, done boolean NOT NULL DEFAULT true, last_key text[], PRIMARY KEY (task_id, chunk_id))")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create copied chunk log: %w", err)
+	}
+	return nil
+}
+
+// RecordChunk records a chunk as copied in the current transaction
+func (csm *CopyStreamManager) RecordChunk(ctx context.Context, taskID string, id uint, rows int64) error {
+	return csm.recordChunk(ctx, taskID, id, CopiedChunk{Rows: rows, Done: true})
+}
+
+// RecordBatch records the position of a chunk copied with batched INSERTs in the current transaction
+func (csm *CopyStreamManager) RecordBatch(ctx context.Context, taskID string, id uint, cursor *CopyCursor) error {
+	return csm.recordChunk(ctx, taskID, id, CopiedChunk{Rows: cursor.Rows, LastKey: cursor.LastKey})
+}
+
+// recordChunk records a chunk in the current transaction, replacing its previous record
+func (csm *CopyStreamManager) recordChunk(ctx context.Context, taskID string, id uint, record CopiedChunk) error {
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "INSERT INTO "+bookkeepingTable(copiedChunks)+` (task_id, chunk_id, rows, done, last_key) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (task_id, chunk_id) DO UPDATE SET rows = EXCLUDED.rows, done = EXCLUDED.done, last_key = EXCLUDED.last_key`,
+			taskID, int64(id), record.Rows, record.Done, record.LastKey)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record copied chunk: %w", err)
+	}
+	return nil
+}
+
+// CopiedChunks returns the records of the chunks of a task
+func (csm *CopyStreamManager) CopiedChunks(ctx context.Context, taskID string) (map[uint]CopiedChunk, error) {
+	copied := make(map[uint]CopiedChunk)
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		rows, err := conn.Query(ctx, "SELECT chunk_id, rows, done, last_key FROM "+bookkeepingTable(copiedChunks)+" WHERE task_id = $1", taskID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			var record CopiedChunk
+			if err := rows.Scan(&id, &record.Rows, &record.Done, &record.LastKey); err != nil {
+				return err
+			}
+			copied[uint(id)] = record
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list copied chunks: %w", err)
+	}
+	return copied, nil
+}
+
+// ClearCopiedChunks deletes the copied chunk records of a task
+func (csm *CopyStreamManager) ClearCopiedChunks(ctx context.Context, taskID string) error {
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "DELETE FROM "+bookkeepingTable(copiedChunks)+" WHERE task_id = $1", taskID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear copied chunks: %w", err)
+	}
+	return nil
+}
+
+// EmptyTarget truncates a target table and deletes the copied chunk records of the chunks copied into it
+// Both happen in one transaction, so no record is left for rows the table no longer has
+func (csm *CopyStreamManager) EmptyTarget(ctx context.Context, taskID, schema, table string, chunkIDs []uint) error {
+	ids := make([]int64, len(chunkIDs))
+	for i, id := range chunkIDs {
+		ids[i] = int64(id)
+	}
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, "TRUNCATE "+pgx.Identifier{schema, table}.Sanitize()); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "DELETE FROM "+bookkeepingTable(copiedChunks)+" WHERE task_id = $1 AND chunk_id = ANY($2)", taskID, ids)
+			return err
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to empty %s.%s: %w", schema, table, err)
+	}
+	return nil
+}
+
+// CopyChunk streams the rows of a chunk into its target table
+func (csm *CopyStreamManager) CopyChunk(ctx context.Context, target *CopyStreamManager, chunk *model.CopyChunk, columns []string, binary bool) (int64, error) {
+	return csm.CopyBetweenTables(ctx, target, chunkSource(chunk, columns), pgx.Identifier{chunk.TargetSchema, chunk.TargetTable}.Sanitize(), columns, binary)
+}
+
+// CopyChunkTransformed copies the rows of a chunk through a row transformation
+// sourceColumns are read from the source table, transform maps them to targetColumns
+func (csm *CopyStreamManager) CopyChunkTransformed(ctx context.Context, target *CopyStreamManager, chunk *model.CopyChunk, sourceColumns, targetColumns []string, transform RowTransform) (int64, error) {
+	return csm.CopyTransformed(ctx, target, chunkSource(chunk, sourceColumns), pgx.Identifier{chunk.TargetSchema, chunk.TargetTable}.Sanitize(), sourceColumns, targetColumns, transform)
+}
+
+// chunkSource returns what COPY reads for a chunk: its source table, or a query selecting the rows
+// of its range and subset
+func chunkSource(chunk *model.CopyChunk, columns []string) string {
+	source := pgx.Identifier{chunk.SourceSchema, chunk.SourceTable}.Sanitize()
+	conditions := chunkConditions(chunk)
+	if len(conditions) == 0 {
+		return source
+	}
+	return fmt.Sprintf("(SELECT %s FROM %s WHERE %s)", quoteColumns(columns), source, strings.Join(conditions, " AND "))
+}
+
+// chunkConditions returns the conditions selecting the rows of a chunk's range and subset
+func chunkConditions(chunk *model.CopyChunk) []string {
+	var conditions []string
+	if predicate := chunk.Predicate(); predicate != "" {
+		conditions = append(conditions, predicate)
+	}
+	if chunk.Subset != "" {
+		conditions = append(conditions, "("+chunk.Subset+")")
+	}
+	return conditions
+}
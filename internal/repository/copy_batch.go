@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pg/dts/internal/model"
+)
+
+const (
+	// copyBatchSize is the number of rows read per batch
+	copyBatchSize = 1000
+	// maxBindParams is the PostgreSQL limit of bind parameters per statement
+	maxBindParams = 65535
+	// batchCursor is the cursor reading the chunks of tables without a primary key
+	batchCursor = "dts_chunk_rows"
+)
+
+// CopyCursor is the position of a chunk copied with batched INSERTs
+// Chunks of tables with a primary key are read in key order, the cursor holds the key of the last
+// row copied so that the copy resumes after it
+type CopyCursor struct {
+	LastKey []string `json:"last_key,omitempty"` // Primary key of the last row copied, in text format
+	Rows    int64    `json:"rows"`               // Rows copied so far
+}
+
+// CopyUnsupported reports whether err means that a connection cannot run COPY
+func CopyUnsupported(err error) bool {
+	return errors.Is(err, ErrCopyUnsupported) || isPgError(err, "0A000")
+}
+
+// CopySupported reports whether the connection runs COPY TO, or COPY FROM with write
+// COPY FROM is tried on an empty temporary table in a transaction that is rolled back.
+func (csm *CopyStreamManager) CopySupported(ctx context.Context, write bool) (bool, error) {
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		if !write {
+			_, err := conn.PgConn().CopyTo(ctx, io.Discard, "COPY (SELECT 1 WHERE false) TO STDOUT")
+			return err
+		}
+
+		if _, err := conn.Exec(ctx, "BEGIN"); err != nil {
+			return err
+		}
+		defer conn.Exec(context.Background(), "ROLLBACK")
+		if _, err := conn.Exec(ctx, "CREATE TEMPORARY TABLE dts_copy_probe (probe int) ON COMMIT DROP"); err != nil {
+			return err
+		}
+		_, err := conn.PgConn().CopyFrom(ctx, strings.NewReader(""), "COPY dts_copy_probe FROM STDIN")
+		return err
+	})
+	if CopyUnsupported(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check COPY support: %w", err)
+	}
+	return true, nil
+}
+
+// PrimaryKey returns the primary key columns of a table in key order, none without a primary key
+func (csm *CopyStreamManager) PrimaryKey(ctx context.Context, schema, table string) ([]CopyColumn, error) {
+	var columns []CopyColumn
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		rows, err := conn.Query(ctx, `
+			SELECT a.attname, a.atttypid, format_type(a.atttypid, a.atttypmod)
+			FROM pg_index i
+			JOIN pg_class c ON c.oid = i.indrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			CROSS JOIN LATERAL unnest(i.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+			WHERE n.nspname = $1 AND c.relname = $2 AND i.indisprimary AND k.ord <= i.indnkeyatts
+			ORDER BY k.ord`, schema, table)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var col CopyColumn
+			if err := rows.Scan(&col.Name, &col.TypeOID, &col.Type); err != nil {
+				return err
+			}
+			columns = append(columns, col)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary key of %s.%s: %w", schema, table, err)
+	}
+	return columns, nil
+}
+
+// ReadChunkBatches reads the rows of a chunk in batches and passes every batch to fn
+// With a primary key, rows are read in key order after the key in after, nil to start from the
+// first row, and fn gets the key of the last row of the batch. Without one, rows are read with a
+// cursor in the current transaction and fn gets no key. Values are in PostgreSQL text format, nil
+// is NULL. Batches are throttled and counted like COPY TO.
+func (csm *CopyStreamManager) ReadChunkBatches(ctx context.Context, chunk *model.CopyChunk, columns []string, key []CopyColumn, after []string, fn func(rows [][]*string, lastKey []string) error) error {
+	if len(key) == 0 {
+		return csm.scanChunkBatches(ctx, chunk, columns, fn)
+	}
+
+	// Key columns that are not copied are read after the copied columns
+	selected := append([]string{}, columns...)
+	keyIndex := make([]int, len(key))
+	keyNames := make([]string, len(key))
+	keyValues := make([]string, len(key))
+	for i, col := range key {
+		keyNames[i] = col.Name
+		keyValues[i] = fmt.Sprintf("$%d::text::%s", i+1, col.Type)
+		keyIndex[i] = indexOf(selected, col.Name)
+		if keyIndex[i] < 0 {
+			keyIndex[i] = len(selected)
+			selected = append(selected, col.Name)
+		}
+	}
+	source := pgx.Identifier{chunk.SourceSchema, chunk.SourceTable}.Sanitize()
+	conditions := chunkConditions(chunk)
+
+	for {
+		where := conditions
+		var args []interface{}
+		if after != nil {
+			where = append(where[:len(where):len(where)], fmt.Sprintf("(%s) > (%s)", quoteColumns(keyNames), strings.Join(keyValues, ", ")))
+			for _, value := range after {
+				args = append(args, value)
+			}
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s", quoteColumns(selected), source)
+		if len(where) > 0 {
+			query += " WHERE " + strings.Join(where, " AND ")
+		}
+		query += fmt.Sprintf(" ORDER BY %s LIMIT %d", quoteColumns(keyNames), copyBatchSize)
+
+		rows, err := csm.readRows(ctx, query, args)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", chunk, err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		last := rows[len(rows)-1]
+		after = make([]string, len(key))
+		for i, index := range keyIndex {
+			after[i] = *last[index]
+		}
+		for i := range rows {
+			rows[i] = rows[i][:len(columns)]
+		}
+		if err := fn(rows, after); err != nil {
+			return err
+		}
+		if len(rows) < copyBatchSize {
+			return nil
+		}
+	}
+}
+
+// scanChunkBatches reads the rows of a chunk in batches with a cursor in the current transaction
+func (csm *CopyStreamManager) scanChunkBatches(ctx context.Context, chunk *model.CopyChunk, columns []string, fn func(rows [][]*string, lastKey []string) error) error {
+	query := fmt.Sprintf("SELECT %s FROM %s", quoteColumns(columns), pgx.Identifier{chunk.SourceSchema, chunk.SourceTable}.Sanitize())
+	if conditions := chunkConditions(chunk); len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "DECLARE "+batchCursor+" NO SCROLL CURSOR FOR "+query)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", chunk, err)
+	}
+
+	for {
+		rows, err := csm.readRows(ctx, fmt.Sprintf("FETCH %d FROM %s", copyBatchSize, batchCursor), nil)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", chunk, err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		if err := fn(rows, nil); err != nil {
+			return err
+		}
+	}
+	return csm.withConn(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "CLOSE "+batchCursor)
+		return err
+	})
+}
+
+// readRows runs a query and returns its rows in text format, waiting for the limiter
+func (csm *CopyStreamManager) readRows(ctx context.Context, query string, args []interface{}) ([][]*string, error) {
+	var result [][]*string
+	size := 0
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		rows, err := conn.Query(ctx, query, append([]interface{}{pgx.QueryResultFormats{pgx.TextFormatCode}}, args...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			raw := rows.RawValues()
+			values := make([]*string, len(raw))
+			for i, value := range raw {
+				if value != nil {
+					text := string(value)
+					values[i] = &text
+					size += len(value)
+				}
+			}
+			result = append(result, values)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if csm.limiter != nil && len(result) > 0 {
+		if err := csm.limiter.WaitFullSync(ctx, len(result), size); err != nil {
+			return nil, err
+		}
+	}
+	if csm.progress != nil {
+		csm.progress.Add(len(result), size)
+	}
+	return result, nil
+}
+
+// InsertRows inserts rows into a table with batched INSERTs
+// Values are in PostgreSQL text format, nil is NULL, and are converted to the types of columns.
+// Large batches are split so that no statement exceeds the bind parameter limit.
+func (csm *CopyStreamManager) InsertRows(ctx context.Context, schema, table string, columns []CopyColumn, rows [][]*string) error {
+	if len(rows) == 0 || len(columns) == 0 {
+		return nil
+	}
+
+	rowsPerStatement := maxBindParams / len(columns)
+	for len(rows) > rowsPerStatement {
+		if err := csm.InsertRows(ctx, schema, table, columns, rows[:rowsPerStatement]); err != nil {
+			return err
+		}
+		rows = rows[rowsPerStatement:]
+	}
+
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	placeholders := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		values := make([]string, len(columns))
+		for j, col := range columns {
+			values[j] = fmt.Sprintf("$%d::text::%s", i*len(columns)+j+1, col.Type)
+			args = append(args, row[j])
+		}
+		placeholders[i] = "(" + strings.Join(values, ", ") + ")"
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+		pgx.Identifier{schema, table}.Sanitize(), quoteColumns(names), strings.Join(placeholders, ", "))
+
+	err := csm.withConn(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert into %s.%s: %w", schema, table, err)
+	}
+	return nil
+}
+
+// indexOf returns the position of s in list, or -1
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RowTransform rewrites a row read by COPY TO before it is written by COPY FROM
+// Values are in PostgreSQL text format, nil is NULL. Returns false to skip the row.
+type RowTransform func(values []*string) ([]*string, bool, error)
+
+// transformWriter applies a RowTransform to a text format COPY stream
+// Rows end with a newline (newlines in values are escaped), so rows split across writes are buffered
+type transformWriter struct {
+	w         io.Writer
+	transform RowTransform
+	buf       []byte
+	out       bytes.Buffer
+}
+
+func (tw *transformWriter) Write(p []byte) (int, error) {
+	tw.buf = append(tw.buf, p...)
+	tw.out.Reset()
+	for {
+		end := bytes.IndexByte(tw.buf, '\n')
+		if end < 0 {
+			break
+		}
+		line := tw.buf[:end]
+		tw.buf = tw.buf[end+1:]
+
+		values, err := decodeCopyText(line)
+		if err != nil {
+			return 0, err
+		}
+		values, keep, err := tw.transform(values)
+		if err != nil {
+			return 0, fmt.Errorf("failed to transform row: %w", err)
+		}
+		if keep {
+			encodeCopyText(&tw.out, values)
+		}
+	}
+	if tw.out.Len() > 0 {
+		if _, err := tw.w.Write(tw.out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decodeCopyText decodes a text format COPY row without its newline
+func decodeCopyText(line []byte) ([]*string, error) {
+	fields := bytes.Split(line, []byte{'\t'})
+	values := make([]*string, len(fields))
+	for i, field := range fields {
+		if string(field) == `\N` {
+			continue
+		}
+		s, err := unescapeCopyText(field)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = &s
+	}
+	return values, nil
+}
+
+// unescapeCopyText resolves the backslash escapes of a text format COPY value
+func unescapeCopyText(field []byte) (string, error) {
+	if bytes.IndexByte(field, '\\') < 0 {
+		return string(field), nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 == len(field) {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = field[i]; c {
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i + 1
+			for end < len(field) && end < i+3 && field[end] >= '0' && field[end] <= '7' {
+				end++
+			}
+			n, err := strconv.ParseUint(string(field[i:end]), 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid octal escape in COPY data: %w", err)
+			}
+			sb.WriteByte(byte(n))
+			i = end - 1
+		case 'x':
+			end := i + 1
+			for end < len(field) && end < i+3 && isHexDigit(field[end]) {
+				end++
+			}
+			if end == i+1 {
+				sb.WriteByte('x')
+				continue
+			}
+			n, _ := strconv.ParseUint(string(field[i+1:end]), 16, 8)
+			sb.WriteByte(byte(n))
+			i = end - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+// encodeCopyText appends a row in text format COPY, ending with a newline
+func encodeCopyText(buf *bytes.Buffer, values []*string) {
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte('\t')
+		}
+		if v == nil {
+			buf.WriteString(`\N`)
+			continue
+		}
+		for j := 0; j < len(*v); j++ {
+			switch c := (*v)[j]; c {
+			case '\\':
+				buf.WriteString(`\\`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,1076 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"gorm.io/gorm"
+)
+
+// Categories order the pre-data objects that do not depend on each other
+// Functions written in SQL come after the tables, since their bodies are checked against them on creation
+const (
+	categorySchema = iota
+	categoryExtension
+	categoryType
+	categorySequence
+	categoryFunction
+	categoryTable
+	categorySQLFunction
+	categoryView
+)
+
+// ddlObject is a pre-data statement and the catalog object it creates
+type ddlObject struct {
+	key       string // Catalog object, e.g. "class:16384"
+	category  int
+	statement string
+}
+
+// relation is a table, view or materialized view of the extracted schemas
+type relation struct {
+	ID           int64
+	TypeID       int64 // Row type
+	Schema       string
+	Name         string
+	Kind         string // r table, p partitioned table, v view, m materialized view
+	Unlogged     bool
+	IsPartition  bool
+	Bound        string
+	PartitionKey string
+	Definition   string // Query of a view
+	RootSchema   string
+	RootName     string
+}
+
+// objectName is the schema and name of a catalog object
+type objectName struct {
+	schema string
+	name   string
+}
+
+// schemaExtractor generates the DDL of the selected schemas of a database from its catalog
+// Statements name objects by their target names.
+type schemaExtractor struct {
+	repo    *SourceRepository
+	schemas []string
+	tables  map[string]bool       // Migrated tables and partitions as schema.table
+	names   *naming.Mapper        // Target names of the schemas and objects
+	targets map[objectName]string // Quoted target names of the objects of the schemas
+	objects []ddlObject           // Pre-data objects in catalog order
+	aliases map[string]string     // Keys of composite type relations to the key of their type
+	deps    map[string][]string   // Keys of the objects each object depends on
+	classes map[int64]*relation   // Extracted relations by OID
+
+	// Views and functions are skipped when they use a table that is not migrated
+	unmigrated map[string]bool   // Keys of the tables of the schemas that are not migrated, and of the skipped objects
+	skippable  map[string]string // Keys of the views and functions to their source name
+	skipped    []string          // Source names of the skipped views and functions
+
+	// Post-data statements by kind
+	constraints []model.PostDataStatement // Primary key, unique and exclusion constraints
+	indexes     []model.PostDataStatement // Indexes and attachments of partition indexes
+	foreignKeys []model.PostDataStatement
+	checks      []model.PostDataStatement // Check constraints not yet validated
+	triggers    []model.PostDataStatement
+}
+
+// ExtractSchema generates the DDL of the given schemas of the source database from its catalog
+// Only the listed tables (schema.table, including partitions) are created, along with the types,
+// sequences, functions and views of the schemas; views and functions using a table that is not
+// migrated are skipped and listed in Skipped. Pre-data statements come after the objects they
+// depend on; post-data statements build indexes before the constraints and triggers that use them.
+// Migrated tables get their mapped names; the other objects of the schemas, indexes and constraints
+// get the prefix and suffix of the mapping, so that they do not collide with the source objects
+// when source and target share a database.
+func (r *SourceRepository) ExtractSchema(schemas []string, tables map[string]bool, names *naming.Mapper) (*model.SchemaDDL, error) {
+	var ddl *model.SchemaDDL
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// With only pg_catalog on the search path, the catalog functions schema-qualify every other name
+		if err := tx.Exec("SET LOCAL search_path = pg_catalog").Error; err != nil {
+			return fmt.Errorf("failed to set search_path: %w", err)
+		}
+		e := &schemaExtractor{
+			repo:    &SourceRepository{db: tx},
+			schemas: schemas,
+			tables:  tables,
+			names:   names,
+			targets: make(map[objectName]string),
+			aliases: make(map[string]string),
+			deps:    make(map[string][]string),
+			classes: make(map[int64]*relation),
+
+			unmigrated: make(map[string]bool),
+			skippable:  make(map[string]string),
+		}
+		var err error
+		ddl, err = e.extract()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ddl, nil
+}
+
+// extract generates the pre-data and post-data statements
+func (e *schemaExtractor) extract() (*model.SchemaDDL, error) {
+	if len(e.schemas) == 0 {
+		return &model.SchemaDDL{}, nil
+	}
+	for _, schema := range e.schemas {
+		e.add("schema:"+schema, categorySchema, "CREATE SCHEMA "+pgx.Identifier{e.names.Schema(schema)}.Sanitize())
+	}
+
+	steps := []func() error{
+		e.extractNames,
+		e.extractExtensions,
+		e.extractTypes,
+		e.extractSequences,
+		e.extractFunctions,
+		e.extractRelations,
+		e.extractDependencies,
+		e.skipUnmigrated,
+		e.extractConstraints,
+		e.extractIndexes,
+		e.extractTriggers,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Indexes come first, foreign keys need the unique index of the table they reference
+	ddl := &model.SchemaDDL{PreData: e.sortObjects(), Skipped: e.skipped}
+	for _, statements := range [][]model.PostDataStatement{e.constraints, e.indexes, e.foreignKeys, e.checks, e.triggers} {
+		ddl.PostData = append(ddl.PostData, statements...)
+	}
+	return ddl, nil
+}
+
+// extractNames maps the relations, types and functions of the schemas to their target names
+// Objects of extensions keep their names, the extension creates them in the mapped schema.
+func (e *schemaExtractor) extractNames() error {
+	type NameRow struct {
+		Schema    string
+		Name      string
+		Extension bool
+	}
+
+	var rows []NameRow
+	err := e.repo.db.Raw(`
+		SELECT n.nspname AS schema, c.relname AS name,
+		       EXISTS (SELECT 1 FROM pg_depend x
+		               WHERE x.classid = 'pg_class'::regclass AND x.objid = c.oid AND x.deptype = 'e') AS extension
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname IN ? AND c.relkind IN ('r', 'p', 'v', 'm', 'S', 'c', 'f')
+		UNION
+		SELECT n.nspname, t.typname,
+		       EXISTS (SELECT 1 FROM pg_depend x
+		               WHERE x.classid = 'pg_type'::regclass AND x.objid = t.oid AND x.deptype = 'e')
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE n.nspname IN ? AND t.typtype IN ('e', 'd', 'c') AND t.typrelid = 0
+		UNION
+		SELECT n.nspname, p.proname,
+		       EXISTS (SELECT 1 FROM pg_depend x
+		               WHERE x.classid = 'pg_proc'::regclass AND x.objid = p.oid AND x.deptype = 'e')
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname IN ?
+	`, e.schemas, e.schemas, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get object names: %w", err)
+	}
+
+	for _, row := range rows {
+		key := objectName{row.Schema, row.Name}
+		switch {
+		case e.tables[row.Schema+"."+row.Name]:
+			schema, table := e.names.Table(row.Schema, row.Name)
+			e.targets[key] = pgx.Identifier{schema, table}.Sanitize()
+		case row.Extension:
+			// An extension object shares its name with an object outside any extension only by overloading
+			if _, ok := e.targets[key]; !ok {
+				e.targets[key] = pgx.Identifier{e.names.Schema(row.Schema), row.Name}.Sanitize()
+			}
+		default:
+			e.targets[key] = pgx.Identifier{e.names.Schema(row.Schema), e.names.Object(row.Name)}.Sanitize()
+		}
+	}
+	return nil
+}
+
+// target returns the quoted target name of an object of the schemas
+func (e *schemaExtractor) target(schema, name string) string {
+	if target, ok := e.targets[objectName{schema, name}]; ok {
+		return target
+	}
+	return pgx.Identifier{e.names.Schema(schema), e.names.Object(name)}.Sanitize()
+}
+
+// index returns the quoted target name of an index, which is in the target schema of its table
+func (e *schemaExtractor) index(rel *relation, name string) string {
+	schema, _ := e.names.Table(rel.Schema, rel.Name)
+	return pgx.Identifier{schema, e.names.Object(name)}.Sanitize()
+}
+
+// object returns the quoted target name of an index or constraint
+func (e *schemaExtractor) object(name string) string {
+	return pgx.Identifier{e.names.Object(name)}.Sanitize()
+}
+
+// rename replaces the names of the objects of the schemas in catalog output by their target names
+// Catalog functions run with only pg_catalog on the search path, so they schema-qualify every such
+// name; a qualified name is replaced when it names an object of the schemas, including in the
+// regclass literals of sequence defaults.
+func (e *schemaExtractor) rename(text string) string {
+	if e.names.Identity() {
+		return text
+	}
+	return replaceQualified(text, func(schema, name string) (string, bool) {
+		target, ok := e.targets[objectName{schema, name}]
+		return target, ok
+	})
+}
+
+// replaceQualified replaces the schema-qualified names in text for which replace returns a replacement
+// A name inside a longer qualified name, such as a column reference, is left as is.
+func replaceQualified(text string, replace func(schema, name string) (string, bool)) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		schema, n := identifierAt(text, i)
+		if n == 0 {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+		if end := i + n; end < len(text) && text[end] == '.' && (i == 0 || text[i-1] != '.') {
+			if name, m := identifierAt(text, end+1); m > 0 {
+				if target, ok := replace(schema, name); ok {
+					b.WriteString(target)
+					i = end + 1 + m
+					continue
+				}
+			}
+		}
+		b.WriteString(text[i : i+n])
+		i += n
+	}
+	return b.String()
+}
+
+// identifierAt returns the identifier starting at text[i] and its length in text, 0 if there is none
+func identifierAt(text string, i int) (string, int) {
+	if text[i] == '"' {
+		var name strings.Builder
+		for j := i + 1; j < len(text); j++ {
+			if text[j] != '"' {
+				name.WriteByte(text[j])
+				continue
+			}
+			if j+1 < len(text) && text[j+1] == '"' {
+				name.WriteByte('"')
+				j++
+				continue
+			}
+			return name.String(), j + 1 - i
+		}
+		return "", 0
+	}
+	if !isIdentifierStart(text[i]) {
+		return "", 0
+	}
+	j := i + 1
+	for j < len(text) && (isIdentifierStart(text[j]) || text[j] >= '0' && text[j] <= '9' || text[j] == '$') {
+		j++
+	}
+	return text[i:j], j - i
+}
+
+// isIdentifierStart reports whether an unquoted identifier can start with c, bytes of multibyte characters included
+func isIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+// postData returns a post-data statement on a relation
+func postData(rel *relation, phase int, statement string) model.PostDataStatement {
+	return model.PostDataStatement{Table: rel.Schema + "." + rel.Name, Phase: phase, Statement: statement}
+}
+
+// add adds a pre-data object
+func (e *schemaExtractor) add(key string, category int, statement string) {
+	e.objects = append(e.objects, ddlObject{key: key, category: category, statement: statement})
+}
+
+// extractExtensions creates the extensions installed in the schemas
+func (e *schemaExtractor) extractExtensions() error {
+	type ExtensionRow struct {
+		Name   string
+		Schema string
+	}
+
+	var rows []ExtensionRow
+	err := e.repo.db.Raw(`
+		SELECT x.extname AS name, n.nspname AS schema
+		FROM pg_extension x
+		JOIN pg_namespace n ON n.oid = x.extnamespace
+		WHERE n.nspname IN ? AND x.extname <> 'plpgsql'
+		ORDER BY x.extname
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get extensions: %w", err)
+	}
+
+	for _, row := range rows {
+		e.add("extension:"+row.Name, categoryExtension, fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s",
+			pgx.Identifier{row.Name}.Sanitize(), pgx.Identifier{e.names.Schema(row.Schema)}.Sanitize()))
+	}
+	return nil
+}
+
+// extractTypes creates the enums, domains and composite types of the schemas
+func (e *schemaExtractor) extractTypes() error {
+	type TypeRow struct {
+		ID           int64
+		Schema       string
+		Name         string
+		Kind         string
+		BaseType     string
+		NotNull      bool
+		DefaultValue *string
+		Collation    string
+		RelID        int64
+	}
+
+	var rows []TypeRow
+	err := e.repo.db.Raw(`
+		SELECT t.oid::bigint AS id, n.nspname AS schema, t.typname AS name, t.typtype::text AS kind,
+		       CASE WHEN t.typtype = 'd' THEN format_type(t.typbasetype, t.typtypmod) ELSE '' END AS base_type,
+		       t.typnotnull AS not_null, t.typdefault AS default_value,
+		       CASE WHEN t.typtype = 'd' AND t.typcollation <> bt.typcollation
+		            THEN quote_ident(cn.nspname) || '.' || quote_ident(co.collname) ELSE '' END AS collation,
+		       t.typrelid::bigint AS rel_id
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		LEFT JOIN pg_type bt ON bt.oid = t.typbasetype
+		LEFT JOIN pg_collation co ON co.oid = t.typcollation
+		LEFT JOIN pg_namespace cn ON cn.oid = co.collnamespace
+		LEFT JOIN pg_class rc ON rc.oid = t.typrelid
+		WHERE n.nspname IN ?
+		  AND (t.typtype IN ('e', 'd') OR (t.typtype = 'c' AND rc.relkind = 'c'))
+		  AND NOT EXISTS (
+		      SELECT 1 FROM pg_depend x
+		      WHERE x.classid = 'pg_type'::regclass AND x.objid = t.oid AND x.deptype = 'e'
+		  )
+		ORDER BY n.nspname, t.typname
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get types: %w", err)
+	}
+
+	type LabelRow struct {
+		TypeID int64
+		Label  string
+	}
+	var labelRows []LabelRow
+	err = e.repo.db.Raw(`
+		SELECT x.enumtypid::bigint AS type_id, x.enumlabel AS label
+		FROM pg_enum x
+		JOIN pg_type t ON t.oid = x.enumtypid
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE n.nspname IN ?
+		ORDER BY x.enumtypid, x.enumsortorder
+	`, e.schemas).Scan(&labelRows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get enum labels: %w", err)
+	}
+	labels := make(map[int64][]string)
+	for _, row := range labelRows {
+		labels[row.TypeID] = append(labels[row.TypeID], quoteLiteral(row.Label))
+	}
+
+	type CheckRow struct {
+		TypeID     int64
+		Name       string
+		Definition string
+	}
+	var checkRows []CheckRow
+	err = e.repo.db.Raw(`
+		SELECT con.contypid::bigint AS type_id, con.conname AS name, pg_get_constraintdef(con.oid) AS definition
+		FROM pg_constraint con
+		JOIN pg_type t ON t.oid = con.contypid
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE n.nspname IN ? AND con.contype = 'c'
+		ORDER BY con.contypid, con.conname
+	`, e.schemas).Scan(&checkRows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get domain constraints: %w", err)
+	}
+	checks := make(map[int64][]string)
+	for _, row := range checkRows {
+		checks[row.TypeID] = append(checks[row.TypeID], "CONSTRAINT "+e.object(row.Name)+" "+e.rename(row.Definition))
+	}
+
+	type AttributeRow struct {
+		RelID    int64
+		Name     string
+		DataType string
+	}
+	var attributeRows []AttributeRow
+	err = e.repo.db.Raw(`
+		SELECT a.attrelid::bigint AS rel_id, a.attname AS name, format_type(a.atttypid, a.atttypmod) AS data_type
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname IN ? AND c.relkind = 'c' AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attrelid, a.attnum
+	`, e.schemas).Scan(&attributeRows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get composite type attributes: %w", err)
+	}
+	attributes := make(map[int64][]string)
+	for _, row := range attributeRows {
+		attributes[row.RelID] = append(attributes[row.RelID], pgx.Identifier{row.Name}.Sanitize()+" "+e.rename(row.DataType))
+	}
+
+	for _, row := range rows {
+		key := fmt.Sprintf("type:%d", row.ID)
+		name := e.target(row.Schema, row.Name)
+		switch row.Kind {
+		case "e":
+			e.add(key, categoryType, fmt.Sprintf("CREATE TYPE %s AS ENUM (%s)", name, strings.Join(labels[row.ID], ", ")))
+		case "d":
+			stmt := fmt.Sprintf("CREATE DOMAIN %s AS %s", name, e.rename(row.BaseType))
+			if row.Collation != "" {
+				stmt += " COLLATE " + row.Collation
+			}
+			if row.DefaultValue != nil {
+				stmt += " DEFAULT " + e.rename(*row.DefaultValue)
+			}
+			if row.NotNull {
+				stmt += " NOT NULL"
+			}
+			for _, check := range checks[row.ID] {
+				stmt += " " + check
+			}
+			e.add(key, categoryType, stmt)
+		case "c":
+			// Attributes depend on types through the type's relation
+			e.aliases[fmt.Sprintf("class:%d", row.RelID)] = key
+			e.add(key, categoryType, fmt.Sprintf("CREATE TYPE %s AS (\n    %s\n)", name, strings.Join(attributes[row.RelID], ",\n    ")))
+		}
+	}
+	return nil
+}
+
+// extractSequences creates the sequences of the schemas, except those of identity columns and of tables not migrated
+func (e *schemaExtractor) extractSequences() error {
+	type SequenceRow struct {
+		ID          int64
+		Schema      string
+		Name        string
+		DataType    string
+		Start       int64
+		Increment   int64
+		MinValue    int64
+		MaxValue    int64
+		Cache       int64
+		Cycle       bool
+		OwnerID     int64
+		OwnerSchema string
+		OwnerTable  string
+		OwnerColumn string
+	}
+
+	var rows []SequenceRow
+	err := e.repo.db.Raw(`
+		SELECT c.oid::bigint AS id, c.reltype::bigint AS type_id, n.nspname AS schema, c.relname AS name, format_type(s.seqtypid, NULL) AS data_type,
+		       s.seqstart AS start, s.seqincrement AS increment, s.seqmin AS min_value, s.seqmax AS max_value,
+		       s.seqcache AS cache, s.seqcycle AS cycle,
+		       COALESCE(tc.oid::bigint, 0) AS owner_id, COALESCE(tn.nspname, '') AS owner_schema,
+		       COALESCE(tc.relname, '') AS owner_table, COALESCE(ta.attname, '') AS owner_column
+		FROM pg_sequence s
+		JOIN pg_class c ON c.oid = s.seqrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = c.oid
+		     AND d.refclassid = 'pg_class'::regclass AND d.deptype = 'a'
+		LEFT JOIN pg_class tc ON tc.oid = d.refobjid
+		LEFT JOIN pg_namespace tn ON tn.oid = tc.relnamespace
+		LEFT JOIN pg_attribute ta ON ta.attrelid = d.refobjid AND ta.attnum = d.refobjsubid
+		WHERE n.nspname IN ?
+		  AND NOT EXISTS (
+		      SELECT 1 FROM pg_depend x
+		      WHERE x.classid = 'pg_class'::regclass AND x.objid = c.oid AND x.deptype IN ('i', 'e')
+		  )
+		ORDER BY n.nspname, c.relname
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get sequences: %w", err)
+	}
+
+	for _, row := range rows {
+		owned := row.OwnerTable != ""
+		if owned && !e.tables[row.OwnerSchema+"."+row.OwnerTable] {
+			continue
+		}
+		key := fmt.Sprintf("class:%d", row.ID)
+		name := e.target(row.Schema, row.Name)
+		stmt := fmt.Sprintf("CREATE SEQUENCE %s AS %s START WITH %d INCREMENT BY %d MINVALUE %d MAXVALUE %d CACHE %d",
+			name, row.DataType, row.Start, row.Increment, row.MinValue, row.MaxValue, row.Cache)
+		if row.Cycle {
+			stmt += " CYCLE"
+		}
+		e.add(key, categorySequence, stmt)
+
+		if owned {
+			ownerKey := fmt.Sprintf("owner:%d", row.ID)
+			e.add(ownerKey, categoryTable, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s", name,
+				e.target(row.OwnerSchema, row.OwnerTable), pgx.Identifier{row.OwnerColumn}.Sanitize()))
+			e.deps[ownerKey] = append(e.deps[ownerKey], key, fmt.Sprintf("class:%d", row.OwnerID))
+		}
+	}
+	return nil
+}
+
+// extractFunctions creates the functions and procedures of the schemas
+func (e *schemaExtractor) extractFunctions() error {
+	type FunctionRow struct {
+		ID         int64
+		Name       string
+		Definition string
+		Language   string
+	}
+
+	var rows []FunctionRow
+	err := e.repo.db.Raw(`
+		SELECT p.oid::bigint AS id, n.nspname || '.' || p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')' AS name,
+		       pg_get_functiondef(p.oid) AS definition, l.lanname AS language
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		JOIN pg_language l ON l.oid = p.prolang
+		WHERE n.nspname IN ? AND p.prokind IN ('f', 'p')
+		  AND NOT EXISTS (
+		      SELECT 1 FROM pg_depend x
+		      WHERE x.classid = 'pg_proc'::regclass AND x.objid = p.oid AND x.deptype = 'e'
+		  )
+		ORDER BY n.nspname, p.proname, p.oid
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get functions: %w", err)
+	}
+
+	for _, row := range rows {
+		category := categoryFunction
+		if row.Language == "sql" {
+			category = categorySQLFunction
+		}
+		key := fmt.Sprintf("proc:%d", row.ID)
+		e.add(key, category, e.rename(strings.TrimSpace(row.Definition)))
+		e.skippable[key] = row.Name
+	}
+	return nil
+}
+
+// extractRelations creates the migrated tables and their partitions, and the views of the schemas
+func (e *schemaExtractor) extractRelations() error {
+	var rows []relation
+	err := e.repo.db.Raw(`
+		SELECT c.oid::bigint AS id, n.nspname AS schema, c.relname AS name, c.relkind::text AS kind,
+		       c.relpersistence = 'u' AS unlogged, c.relispartition AS is_partition,
+		       CASE WHEN c.relispartition THEN pg_get_expr(c.relpartbound, c.oid) ELSE '' END AS bound,
+		       CASE WHEN c.relkind = 'p' THEN pg_get_partkeydef(c.oid) ELSE '' END AS partition_key,
+		       CASE WHEN c.relkind IN ('v', 'm') THEN pg_get_viewdef(c.oid) ELSE '' END AS definition,
+		       COALESCE(rn.nspname, '') AS root_schema, COALESCE(rc.relname, '') AS root_name
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_class rc ON c.relispartition AND rc.oid = pg_partition_root(c.oid)
+		LEFT JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+		WHERE n.nspname IN ? AND c.relkind IN ('r', 'p', 'v', 'm')
+		  AND NOT EXISTS (
+		      SELECT 1 FROM pg_depend x
+		      WHERE x.classid = 'pg_class'::regclass AND x.objid = c.oid AND x.deptype = 'e'
+		  )
+		ORDER BY n.nspname, c.relname
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get relations: %w", err)
+	}
+
+	// Partitions of a migrated table are created with it, including sub-partitioned intermediate levels
+	for i := range rows {
+		rel := &rows[i]
+		switch rel.Kind {
+		case "r", "p":
+			if e.tables[rel.Schema+"."+rel.Name] || (rel.IsPartition && e.tables[rel.RootSchema+"."+rel.RootName]) {
+				e.classes[rel.ID] = rel
+			} else {
+				e.unmigrated[fmt.Sprintf("class:%d", rel.ID)] = true
+				e.unmigrated[fmt.Sprintf("type:%d", rel.TypeID)] = true
+			}
+		default:
+			e.classes[rel.ID] = rel
+			e.skippable[fmt.Sprintf("class:%d", rel.ID)] = rel.Schema + "." + rel.Name
+		}
+	}
+
+	type ParentRow struct {
+		ID       int64
+		ParentID int64
+	}
+	var parentRows []ParentRow
+	err = e.repo.db.Raw(`
+		SELECT i.inhrelid::bigint AS id, i.inhparent::bigint AS parent_id
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE c.relkind IN ('r', 'p')
+		ORDER BY i.inhrelid, i.inhseqno
+	`).Scan(&parentRows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get table parents: %w", err)
+	}
+	parents := make(map[int64][]*relation)
+	for _, row := range parentRows {
+		if parent, ok := e.classes[row.ParentID]; ok && e.classes[row.ID] != nil {
+			parents[row.ID] = append(parents[row.ID], parent)
+		}
+	}
+
+	checks, err := e.localChecks()
+	if err != nil {
+		return err
+	}
+
+	for i := range rows {
+		rel := &rows[i]
+		if e.classes[rel.ID] == nil {
+			continue
+		}
+		key := fmt.Sprintf("class:%d", rel.ID)
+		for _, parent := range parents[rel.ID] {
+			e.deps[key] = append(e.deps[key], fmt.Sprintf("class:%d", parent.ID))
+		}
+
+		switch rel.Kind {
+		case "v":
+			e.add(key, categoryView, fmt.Sprintf("CREATE VIEW %s AS\n%s", e.target(rel.Schema, rel.Name), e.rename(viewQuery(rel.Definition))))
+		case "m":
+			e.add(key, categoryView, fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS\n%s\nWITH NO DATA", e.target(rel.Schema, rel.Name), e.rename(viewQuery(rel.Definition))))
+		default:
+			stmt, err := e.createTable(rel, parents[rel.ID], checks[rel.ID])
+			if err != nil {
+				return err
+			}
+			e.add(key, categoryTable, stmt)
+			if rel.IsPartition {
+				// A partition inherits the columns and constraints of its parent, local checks are added after it
+				for j, check := range checks[rel.ID] {
+					checkKey := fmt.Sprintf("check:%d:%d", rel.ID, j)
+					e.add(checkKey, categoryTable, fmt.Sprintf("ALTER TABLE %s ADD %s", e.target(rel.Schema, rel.Name), check))
+					e.deps[checkKey] = append(e.deps[checkKey], key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// localChecks returns the validated check constraints defined on the tables themselves, by table OID
+// Inherited checks come with the parent, checks not yet validated are added after full sync
+func (e *schemaExtractor) localChecks() (map[int64][]string, error) {
+	type CheckRow struct {
+		RelID      int64
+		Name       string
+		Definition string
+	}
+
+	var rows []CheckRow
+	err := e.repo.db.Raw(`
+		SELECT con.conrelid::bigint AS rel_id, con.conname AS name, pg_get_constraintdef(con.oid) AS definition
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname IN ? AND con.contype = 'c' AND con.conislocal AND con.convalidated
+		ORDER BY con.conrelid, con.conname
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get check constraints: %w", err)
+	}
+
+	checks := make(map[int64][]string)
+	for _, row := range rows {
+		checks[row.RelID] = append(checks[row.RelID], "CONSTRAINT "+e.object(row.Name)+" "+e.rename(row.Definition))
+	}
+	return checks, nil
+}
+
+// createTable returns the CREATE TABLE statement of a table or partition
+// Primary keys and other index-backed constraints are left to the post-data statements
+func (e *schemaExtractor) createTable(rel *relation, parents []*relation, checks []string) (string, error) {
+	var stmt strings.Builder
+	stmt.WriteString("CREATE ")
+	if rel.Unlogged {
+		stmt.WriteString("UNLOGGED ")
+	}
+	stmt.WriteString("TABLE " + e.target(rel.Schema, rel.Name))
+
+	if rel.IsPartition && len(parents) > 0 {
+		stmt.WriteString(" PARTITION OF " + e.target(parents[0].Schema, parents[0].Name) + " " + e.rename(rel.Bound))
+	} else {
+		tableInfo, err := e.repo.GetTableInfo(rel.Schema, rel.Name)
+		if err != nil {
+			return "", fmt.Errorf("failed to get table info of %s.%s: %w", rel.Schema, rel.Name, err)
+		}
+		var defs []string
+		for _, col := range tableInfo.Columns {
+			defs = append(defs, e.rename(columnDefinition(col)))
+		}
+		defs = append(defs, checks...)
+		stmt.WriteString(" (\n    " + strings.Join(defs, ",\n    ") + "\n)")
+
+		if len(parents) > 0 {
+			names := make([]string, len(parents))
+			for i, parent := range parents {
+				names[i] = e.target(parent.Schema, parent.Name)
+			}
+			stmt.WriteString(" INHERITS (" + strings.Join(names, ", ") + ")")
+		}
+	}
+
+	if rel.Kind == "p" {
+		stmt.WriteString(" PARTITION BY " + e.rename(rel.PartitionKey))
+	}
+	return stmt.String(), nil
+}
+
+// extractDependencies reads the dependencies between the extracted objects from pg_depend
+// Column types and defaults, check constraints and view queries make their table or view depend on
+// the types, functions, sequences and relations they use.
+func (e *schemaExtractor) extractDependencies() error {
+	type DependencyRow struct {
+		Object string
+		Ref    string
+	}
+
+	var rows []DependencyRow
+	err := e.repo.db.Raw(`
+		SELECT DISTINCT
+		       CASE d.classid
+		            WHEN 'pg_class'::regclass THEN 'class:' || d.objid
+		            WHEN 'pg_type'::regclass THEN 'type:' || d.objid
+		            WHEN 'pg_proc'::regclass THEN 'proc:' || d.objid
+		            WHEN 'pg_rewrite'::regclass THEN 'class:' || rw.ev_class
+		            WHEN 'pg_attrdef'::regclass THEN 'class:' || ad.adrelid
+		            ELSE CASE WHEN con.conrelid <> 0 THEN 'class:' || con.conrelid ELSE 'type:' || con.contypid END
+		       END AS object,
+		       CASE d.refclassid
+		            WHEN 'pg_class'::regclass THEN 'class:' || d.refobjid
+		            WHEN 'pg_type'::regclass THEN 'type:' || CASE WHEN rt.typcategory = 'A' THEN rt.typelem ELSE rt.oid END
+		            ELSE 'proc:' || d.refobjid
+		       END AS ref
+		FROM pg_depend d
+		LEFT JOIN pg_rewrite rw ON d.classid = 'pg_rewrite'::regclass AND rw.oid = d.objid
+		LEFT JOIN pg_attrdef ad ON d.classid = 'pg_attrdef'::regclass AND ad.oid = d.objid
+		LEFT JOIN pg_constraint con ON d.classid = 'pg_constraint'::regclass AND con.oid = d.objid
+		LEFT JOIN pg_type rt ON d.refclassid = 'pg_type'::regclass AND rt.oid = d.refobjid
+		WHERE d.deptype = 'n'
+		  AND d.classid IN ('pg_class'::regclass, 'pg_type'::regclass, 'pg_proc'::regclass,
+		                    'pg_rewrite'::regclass, 'pg_attrdef'::regclass, 'pg_constraint'::regclass)
+		  AND d.refclassid IN ('pg_class'::regclass, 'pg_type'::regclass, 'pg_proc'::regclass)
+		  AND (con.oid IS NULL OR con.contype = 'c')
+	`).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get dependencies: %w", err)
+	}
+
+	for _, row := range rows {
+		object, ref := e.resolve(row.Object), e.resolve(row.Ref)
+		if object != ref {
+			e.deps[object] = append(e.deps[object], ref)
+		}
+	}
+	return nil
+}
+
+// skipUnmigrated drops the views and functions that use a table that is not migrated, directly or
+// through other views and functions, since they cannot be created on the target
+// Dependencies are those recorded in pg_depend: the body of a function is only covered when it is
+// written in SQL-standard form.
+func (e *schemaExtractor) skipUnmigrated() error {
+	for changed := true; changed; {
+		changed = false
+		for key, name := range e.skippable {
+			if e.unmigrated[key] {
+				continue
+			}
+			for _, dep := range e.deps[key] {
+				if e.unmigrated[dep] {
+					e.unmigrated[key] = true
+					e.skipped = append(e.skipped, name)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	if len(e.skipped) == 0 {
+		return nil
+	}
+	sort.Strings(e.skipped)
+
+	objects := e.objects[:0]
+	for _, obj := range e.objects {
+		if !e.unmigrated[obj.key] {
+			objects = append(objects, obj)
+		}
+	}
+	e.objects = objects
+	for id := range e.classes {
+		if e.unmigrated[fmt.Sprintf("class:%d", id)] {
+			delete(e.classes, id) // Nor are the indexes and triggers of skipped views created
+		}
+	}
+	return nil
+}
+
+// resolve returns the key of the extracted object a catalog object belongs to
+func (e *schemaExtractor) resolve(key string) string {
+	if alias, ok := e.aliases[key]; ok {
+		return alias
+	}
+	return key
+}
+
+// sortObjects orders the pre-data objects so that every object comes after the objects it depends on
+// Objects that are free to go are taken by category, then in catalog order. Objects in a dependency
+// cycle are taken in the same order once nothing else is left.
+func (e *schemaExtractor) sortObjects() []string {
+	sort.SliceStable(e.objects, func(i, j int) bool {
+		return e.objects[i].category < e.objects[j].category
+	})
+	pending := make(map[string]bool, len(e.objects))
+	for _, obj := range e.objects {
+		pending[obj.key] = true
+	}
+	ready := func(obj ddlObject) bool {
+		for _, dep := range e.deps[obj.key] {
+			if dep != obj.key && pending[dep] {
+				return false
+			}
+		}
+		return true
+	}
+
+	statements := make([]string, 0, len(e.objects))
+	done := make([]bool, len(e.objects))
+	for len(statements) < len(e.objects) {
+		next := -1
+		for i, obj := range e.objects {
+			if done[i] {
+				continue
+			}
+			if next < 0 {
+				next = i // First left, taken if nothing is ready
+			}
+			if ready(obj) {
+				next = i
+				break
+			}
+		}
+		done[next] = true
+		pending[e.objects[next].key] = false
+		statements = append(statements, e.objects[next].statement)
+	}
+	return statements
+}
+
+// extractConstraints adds the primary key, unique, exclusion and foreign key constraints and the
+// check constraints not yet validated of the extracted tables
+// A foreign key is only added when the table it references is extracted too.
+func (e *schemaExtractor) extractConstraints() error {
+	type ConstraintRow struct {
+		RelID      int64
+		Name       string
+		Kind       string
+		Definition string
+		Validated  bool
+		Local      bool
+		ParentID   int64
+		RefID      int64
+	}
+
+	var rows []ConstraintRow
+	err := e.repo.db.Raw(`
+		SELECT con.conrelid::bigint AS rel_id, con.conname AS name, con.contype::text AS kind,
+		       pg_get_constraintdef(con.oid) AS definition, con.convalidated AS validated, con.conislocal AS local,
+		       con.conparentid::bigint AS parent_id, con.confrelid::bigint AS ref_id
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname IN ? AND con.contype IN ('p', 'u', 'x', 'f', 'c')
+		ORDER BY n.nspname, c.relname, con.conname
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get constraints: %w", err)
+	}
+
+	for _, row := range rows {
+		rel := e.classes[row.RelID]
+		if rel == nil {
+			continue
+		}
+		table := e.target(rel.Schema, rel.Name)
+		constraint := "CONSTRAINT " + e.object(row.Name) + " " + e.rename(row.Definition)
+		switch row.Kind {
+		case "p", "u", "x":
+			// Partitions get their own constraint, attached to the parent's with its index
+			stmt := postData(rel, model.PhaseIndexes, fmt.Sprintf("ALTER TABLE ONLY %s ADD %s", table, constraint))
+			stmt.PrimaryKey = row.Kind == "p"
+			e.constraints = append(e.constraints, stmt)
+		case "f":
+			if row.ParentID != 0 || e.classes[row.RefID] == nil {
+				continue
+			}
+			e.foreignKeys = append(e.foreignKeys, postData(rel, model.PhaseOther, fmt.Sprintf("ALTER TABLE %s%s ADD %s", onlyUnlessPartitioned(rel), table, constraint)))
+		case "c":
+			if row.Validated || !row.Local {
+				continue
+			}
+			e.checks = append(e.checks, postData(rel, model.PhaseOther, fmt.Sprintf("ALTER TABLE %s ADD %s", table, constraint)))
+		}
+	}
+	return nil
+}
+
+// onlyUnlessPartitioned returns ONLY for a regular table, constraints of a partitioned table apply to its partitions
+func onlyUnlessPartitioned(rel *relation) string {
+	if rel.Kind == "p" {
+		return ""
+	}
+	return "ONLY "
+}
+
+// extractIndexes adds the indexes of the extracted tables and materialized views, and the attachment
+// of partition indexes to the index of their parent
+func (e *schemaExtractor) extractIndexes() error {
+	type IndexRow struct {
+		RelID      int64
+		Name       string
+		IsUnique   bool
+		Definition string // After the index name, e.g. ON schema.table USING btree (column)
+	}
+
+	var rows []IndexRow
+	err := e.repo.db.Raw(`
+		SELECT i.indrelid::bigint AS rel_id, ic.relname AS name, i.indisunique AS is_unique,
+		       substr(pg_get_indexdef(i.indexrelid),
+		              length('CREATE ' || CASE WHEN i.indisunique THEN 'UNIQUE ' ELSE '' END || 'INDEX ' || quote_ident(ic.relname)) + 2) AS definition
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		WHERE n.nspname IN ?
+		  AND NOT EXISTS (
+		      SELECT 1 FROM pg_constraint con
+		      WHERE con.conindid = i.indexrelid AND con.contype IN ('p', 'u', 'x')
+		  )
+		ORDER BY n.nspname, c.relname, ic.relname
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get indexes: %w", err)
+	}
+
+	type AttachRow struct {
+		RelID        int64
+		ParentRelID  int64
+		Schema       string
+		Name         string
+		ParentSchema string
+		ParentName   string
+	}
+	var attachRows []AttachRow
+	err = e.repo.db.Raw(`
+		SELECT ci.indrelid::bigint AS rel_id, pi.indrelid::bigint AS parent_rel_id,
+		       cn.nspname AS schema, cc.relname AS name, pn.nspname AS parent_schema, pc.relname AS parent_name
+		FROM pg_inherits inh
+		JOIN pg_index ci ON ci.indexrelid = inh.inhrelid
+		JOIN pg_index pi ON pi.indexrelid = inh.inhparent
+		JOIN pg_class cc ON cc.oid = inh.inhrelid
+		JOIN pg_namespace cn ON cn.oid = cc.relnamespace
+		JOIN pg_class pc ON pc.oid = inh.inhparent
+		JOIN pg_namespace pn ON pn.oid = pc.relnamespace
+		ORDER BY pn.nspname, pc.relname, cn.nspname, cc.relname
+	`).Scan(&attachRows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get partition indexes: %w", err)
+	}
+
+	for _, row := range rows {
+		rel := e.classes[row.RelID]
+		if rel == nil {
+			continue
+		}
+		stmt := "CREATE INDEX "
+		if row.IsUnique {
+			stmt = "CREATE UNIQUE INDEX "
+		}
+		e.indexes = append(e.indexes, postData(rel, model.PhaseIndexes, stmt+e.object(row.Name)+" "+e.rename(row.Definition)))
+	}
+	for _, row := range attachRows {
+		rel, parent := e.classes[row.RelID], e.classes[row.ParentRelID]
+		if rel != nil && parent != nil {
+			e.indexes = append(e.indexes, postData(rel, model.PhaseAttach, fmt.Sprintf("ALTER INDEX %s ATTACH PARTITION %s",
+				e.index(parent, row.ParentName), e.index(rel, row.Name))))
+		}
+	}
+	return nil
+}
+
+// extractTriggers adds the triggers of the extracted tables and views
+// Triggers cloned to partitions from their parent are created by the parent's trigger.
+func (e *schemaExtractor) extractTriggers() error {
+	version, err := e.repo.GetServerVersion()
+	if err != nil {
+		return err
+	}
+	// Before PostgreSQL 13 cloned triggers are internal
+	cloned := ""
+	if version >= 130000 {
+		cloned = "AND t.tgparentid = 0"
+	}
+
+	type TriggerRow struct {
+		RelID      int64
+		Definition string
+	}
+	var rows []TriggerRow
+	err = e.repo.db.Raw(`
+		SELECT t.tgrelid::bigint AS rel_id, pg_get_triggerdef(t.oid) AS definition
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname IN ? AND NOT t.tgisinternal `+cloned+`
+		ORDER BY n.nspname, c.relname, t.tgname
+	`, e.schemas).Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to get triggers: %w", err)
+	}
+
+	for _, row := range rows {
+		if rel := e.classes[row.RelID]; rel != nil {
+			e.triggers = append(e.triggers, postData(rel, model.PhaseOther, e.rename(row.Definition)))
+		}
+	}
+	return nil
+}
+
+// viewQuery returns the query of a view without the terminating semicolon
+func viewQuery(definition string) string {
+	return strings.TrimSuffix(strings.TrimSpace(definition), ";")
+}
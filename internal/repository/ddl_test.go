@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+)
+
+func TestRename(t *testing.T) {
+	names, err := naming.New(&model.NameMapping{Schemas: map[string]string{"app": "stage"}, Prefix: "t_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &schemaExtractor{names: names, targets: map[objectName]string{
+		{"app", "orders"}:        `"stage"."t_orders"`,
+		{"app", "orders_id_seq"}: `"stage"."t_orders_id_seq"`,
+		{"app", "status"}:        `"stage"."t_status"`,
+		{"Mixed", "Case"}:        `"Mixed"."t_Case"`,
+	}}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"nextval('app.orders_id_seq'::regclass)", `nextval('"stage"."t_orders_id_seq"'::regclass)`},
+		{"app.status[]", `"stage"."t_status"[]`},
+		{"ON app.orders USING btree (id)", `ON "stage"."t_orders" USING btree (id)`},
+		{`SELECT "Mixed"."Case".id FROM "Mixed"."Case"`, `SELECT "Mixed"."t_Case".id FROM "Mixed"."t_Case"`},
+		// Names that are not objects of the schemas, and names inside a longer qualified name, stay
+		{"orders.id, app.unknown, other.orders, x.app.orders", "orders.id, app.unknown, other.orders, x.app.orders"},
+		{"app.orders_extra", "app.orders_extra"},
+	}
+	for _, tt := range tests {
+		if got := e.rename(tt.in); got != tt.want {
+			t.Errorf("rename(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSkipUnmigrated(t *testing.T) {
+	e := &schemaExtractor{
+		objects: []ddlObject{
+			{key: "class:1", statement: "CREATE TABLE orders"},
+			{key: "class:3", statement: "CREATE VIEW order_totals"},
+			{key: "class:4", statement: "CREATE VIEW big_orders"},
+			{key: "proc:5", statement: "CREATE FUNCTION order_count"},
+			{key: "class:6", statement: "CREATE VIEW recent_orders"},
+		},
+		deps: map[string][]string{
+			"class:3": {"class:2"}, // Uses the table that is not migrated
+			"class:4": {"class:3"}, // Through another view
+			"proc:5":  {"type:20"}, // Its row type
+			"class:6": {"class:1"},
+		},
+		classes:    map[int64]*relation{1: {ID: 1}, 3: {ID: 3}, 4: {ID: 4}, 6: {ID: 6}},
+		unmigrated: map[string]bool{"class:2": true, "type:20": true},
+		skippable: map[string]string{
+			"class:3": "app.order_totals",
+			"class:4": "app.big_orders",
+			"proc:5":  "app.order_count()",
+			"class:6": "app.recent_orders",
+		},
+	}
+	if err := e.skipUnmigrated(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"app.big_orders", "app.order_count()", "app.order_totals"}
+	if len(e.skipped) != len(want) {
+		t.Fatalf("skipped = %v, want %v", e.skipped, want)
+	}
+	for i := range want {
+		if e.skipped[i] != want[i] {
+			t.Fatalf("skipped = %v, want %v", e.skipped, want)
+		}
+	}
+	if len(e.objects) != 2 || e.objects[0].key != "class:1" || e.objects[1].key != "class:6" {
+		t.Errorf("objects = %v, want the table and recent_orders", e.objects)
+	}
+	if e.classes[3] != nil || e.classes[4] != nil || e.classes[6] == nil {
+		t.Errorf("classes = %v, want the skipped views removed", e.classes)
+	}
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/pg/dts/internal/model"
+	"gorm.io/gorm"
+)
+
+// FullSyncRepository persists full sync chunk progress in the metadata database
+type FullSyncRepository struct {
+	db *gorm.DB
+}
+
+// NewFullSyncRepository creates a full sync progress repository
+func NewFullSyncRepository(db *gorm.DB) *FullSyncRepository {
+	return &FullSyncRepository{db: db}
+}
+
+// ListChunks lists the chunks of a task in plan order
+func (r *FullSyncRepository) ListChunks(taskID string) ([]model.FullSyncChunk, error) {
+	var chunks []model.FullSyncChunk
+	if err := r.db.Where("task_id = ?", taskID).Order("seq").Find(&chunks).Error; err != nil {
+		return nil, fmt.Errorf("failed to list full sync chunks: %w", err)
+	}
+	return chunks, nil
+}
+
+// SaveChunks stores the copy plan of a task, replacing any previous plan
+func (r *FullSyncRepository) SaveChunks(taskID string, chunks []model.FullSyncChunk) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("task_id = ?", taskID).Delete(&model.FullSyncChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to delete full sync chunks: %w", err)
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		for i := range chunks {
+			chunks[i].TaskID = taskID
+			chunks[i].Seq = i
+			if chunks[i].Status == "" {
+				chunks[i].Status = model.ChunkPending
+			}
+		}
+		if err := tx.Create(&chunks).Error; err != nil {
+			return fmt.Errorf("failed to save full sync chunks: %w", err)
+		}
+		return nil
+	})
+}
+
+// StartChunk marks a chunk as being copied
+func (r *FullSyncRepository) StartChunk(id uint) error {
+	now := time.Now()
+	err := r.db.Model(&model.FullSyncChunk{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       model.ChunkCopying,
+		"rows":         0,
+		"bytes":        0,
+		"started_at":   &now,
+		"completed_at": nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update full sync chunk: %w", err)
+	}
+	return nil
+}
+
+// UpdateChunkProgress records the rows and bytes copied so far by a chunk being copied
+func (r *FullSyncRepository) UpdateChunkProgress(id uint, rows, bytes int64) error {
+	err := r.db.Model(&model.FullSyncChunk{}).Where("id = ? AND status = ?", id, model.ChunkCopying).Updates(map[string]interface{}{
+		"rows":  rows,
+		"bytes": bytes,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update full sync chunk: %w", err)
+	}
+	return nil
+}
+
+// CompleteChunk marks a chunk as copied
+func (r *FullSyncRepository) CompleteChunk(id uint, rows, bytes int64) error {
+	now := time.Now()
+	err := r.db.Model(&model.FullSyncChunk{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       model.ChunkDone,
+		"rows":         rows,
+		"bytes":        bytes,
+		"completed_at": &now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update full sync chunk: %w", err)
+	}
+	return nil
+}
+
+// ResetChunks marks chunks as not copied
+func (r *FullSyncRepository) ResetChunks(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := r.db.Model(&model.FullSyncChunk{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"status":       model.ChunkPending,
+		"rows":         0,
+		"bytes":        0,
+		"cursor":       "",
+		"started_at":   nil,
+		"completed_at": nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to reset full sync chunks: %w", err)
+	}
+	return nil
+}
+
+// SetSnapshotLSN records that chunks are copied from a snapshot taken at lsn, newer than the slot's
+func (r *FullSyncRepository) SetSnapshotLSN(ids []uint, lsn string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := r.db.Model(&model.FullSyncChunk{}).Where("id IN ?", ids).Update("snapshot_lsn", lsn).Error; err != nil {
+		return fmt.Errorf("failed to update full sync chunks: %w", err)
+	}
+	return nil
+}
+
+// CatchUpLSN returns the WAL position up to which the changes decoded by the slot of a task may
+// already be in the copied rows, empty if every chunk was copied from the slot's snapshot
+func (r *FullSyncRepository) CatchUpLSN(taskID string) (string, error) {
+	var positions []string
+	err := r.db.Model(&model.FullSyncChunk{}).Where("task_id = ? AND snapshot_lsn <> ''", taskID).
+		Distinct().Pluck("snapshot_lsn", &positions).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to get full sync snapshot positions: %w", err)
+	}
+
+	var latest pglogrepl.LSN
+	for _, position := range positions {
+		lsn, err := pglogrepl.ParseLSN(position)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse snapshot position %q: %w", position, err)
+		}
+		latest = max(latest, lsn)
+	}
+	if latest == 0 {
+		return "", nil
+	}
+	return latest.String(), nil
+}
+
+// SaveCursor records the position of a chunk copied with batched INSERTs
+func (r *FullSyncRepository) SaveCursor(chunk *model.FullSyncChunk, cursor *CopyCursor) error {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return fmt.Errorf("failed to marshal copy cursor: %w", err)
+	}
+	chunk.Cursor, chunk.Rows = string(data), cursor.Rows
+	err = r.db.Model(&model.FullSyncChunk{}).Where("id = ?", chunk.ID).Updates(map[string]interface{}{
+		"cursor": chunk.Cursor,
+		"rows":   chunk.Rows,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update full sync chunk: %w", err)
+	}
+	return nil
+}
+
+// ParseCopyCursor parses the position of a chunk copied with batched INSERTs, empty if it has none
+func ParseCopyCursor(chunk *model.FullSyncChunk) (*CopyCursor, error) {
+	var cursor CopyCursor
+	if chunk.Cursor != "" {
+		if err := json.Unmarshal([]byte(chunk.Cursor), &cursor); err != nil {
+			return nil, fmt.Errorf("failed to parse copy cursor of %s: %w", &chunk.CopyChunk, err)
+		}
+	}
+	return &cursor, nil
+}
+
+// UpdateTaskProgress records the overall full sync progress of a task
+func (r *FullSyncRepository) UpdateTaskProgress(taskID string, progress int) error {
+	if err := r.db.Model(&model.MigrationTask{}).Where("id = ?", taskID).Update("progress", progress).Error; err != nil {
+		return fmt.Errorf("failed to update task progress: %w", err)
+	}
+	return nil
+}
+
+// DeleteChunks deletes the copy plan of a task
+func (r *FullSyncRepository) DeleteChunks(taskID string) error {
+	if err := r.db.Where("task_id = ?", taskID).Delete(&model.FullSyncChunk{}).Error; err != nil {
+		return fmt.Errorf("failed to delete full sync chunks: %w", err)
+	}
+	return nil
+}
@@ -57,6 +57,20 @@ func (r *MigrationRepository) UpdateState(id string, state model.StateType, erro
 	return r.db.Model(&model.MigrationTask{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// UpdatePausedFrom records the state a task is paused in
+func (r *MigrationRepository) UpdatePausedFrom(id string, state model.StateType) error {
+	return r.db.Model(&model.MigrationTask{}).Where("id = ?", id).Update("paused_from", state.String()).Error
+}
+
+// UpdateThrottle stores the rate limits of a task
+func (r *MigrationRepository) UpdateThrottle(id string, cfg *model.ThrottleConfig) error {
+	throttleJSON, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal throttle config: %w", err)
+	}
+	return r.db.Model(&model.MigrationTask{}).Where("id = ?", id).Update("throttle", string(throttleJSON)).Error
+}
+
 // UpdateProgress updates task progress
 func (r *MigrationRepository) UpdateProgress(id string, progress int) error {
 	return r.db.Model(&model.MigrationTask{}).Where("id = ?", id).Update("progress", progress).Error
@@ -85,6 +99,162 @@ func ParseTargetDB(task *model.MigrationTask) (*model.DBConfig, error) {
 	return &dbConfig, nil
 }
 
+// ParseArchiveConfig parses change stream archive configuration
+// Returns nil if archiving is not enabled for the task
+func ParseArchiveConfig(task *model.MigrationTask) (*model.ArchiveConfig, error) {
+	if task.Archive == "" {
+		return nil, nil
+	}
+	var archiveConfig model.ArchiveConfig
+	if err := json.Unmarshal([]byte(task.Archive), &archiveConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse archive config: %w", err)
+	}
+	if archiveConfig.Dir == "" {
+		return nil, fmt.Errorf("archive dir is required")
+	}
+	return &archiveConfig, nil
+}
+
+// ParseSinkConfig parses change sink configuration
+// Returns the PostgreSQL target sink if no sink is configured for the task
+func ParseSinkConfig(task *model.MigrationTask) (*model.SinkConfig, error) {
+	sinkConfig := model.SinkConfig{Type: model.SinkPostgreSQL}
+	if task.Sink == "" {
+		return &sinkConfig, nil
+	}
+	if err := json.Unmarshal([]byte(task.Sink), &sinkConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse sink config: %w", err)
+	}
+	if sinkConfig.Type == "" {
+		sinkConfig.Type = model.SinkPostgreSQL
+	}
+	return &sinkConfig, nil
+}
+
+// ParsePartitioning parses the target partitioning overrides, keyed by source table name
+func ParsePartitioning(task *model.MigrationTask) (map[string]model.PartitionConfig, error) {
+	partitioning := make(map[string]model.PartitionConfig)
+	if task.Partitioning == "" {
+		return partitioning, nil
+	}
+	if err := json.Unmarshal([]byte(task.Partitioning), &partitioning); err != nil {
+		return nil, fmt.Errorf("failed to parse partitioning config: %w", err)
+	}
+	for table, cfg := range partitioning {
+		if cfg.Strategy != "" && cfg.Key == "" {
+			return nil, fmt.Errorf("partitioning of table %s requires a key", table)
+		}
+	}
+	return partitioning, nil
+}
+
+// ParseFullSyncConfig parses full sync configuration, filling in defaults
+func ParseFullSyncConfig(task *model.MigrationTask) (*model.FullSyncConfig, error) {
+	var fullSyncConfig model.FullSyncConfig
+	if task.FullSync != "" {
+		if err := json.Unmarshal([]byte(task.FullSync), &fullSyncConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse full sync config: %w", err)
+		}
+	}
+	if fullSyncConfig.Parallelism <= 0 {
+		fullSyncConfig.Parallelism = 4
+	}
+	if fullSyncConfig.ChunkRows <= 0 {
+		fullSyncConfig.ChunkRows = 1000000
+	}
+	switch fullSyncConfig.Method {
+	case "":
+		fullSyncConfig.Method = model.CopyMethodCopy
+	case model.CopyMethodCopy, model.CopyMethodInsert:
+	default:
+		return nil, fmt.Errorf("invalid full sync method %q, expected copy or insert", fullSyncConfig.Method)
+	}
+	return &fullSyncConfig, nil
+}
+
+// ParseDDLConfig parses the schema creation configuration, filling in defaults
+func ParseDDLConfig(task *model.MigrationTask) (*model.DDLConfig, error) {
+	var ddlConfig model.DDLConfig
+	if task.DDL != "" {
+		if err := json.Unmarshal([]byte(task.DDL), &ddlConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse ddl config: %w", err)
+		}
+	}
+	switch ddlConfig.OnError {
+	case "":
+		ddlConfig.OnError = model.DDLOnErrorFail
+	case model.DDLOnErrorFail, model.DDLOnErrorContinue:
+	default:
+		return nil, fmt.Errorf("invalid ddl on_error policy %q, expected fail or continue", ddlConfig.OnError)
+	}
+	return &ddlConfig, nil
+}
+
+// ParseThrottleConfig parses the rate limits of a task
+// Returns unlimited rates if no limits are configured
+func ParseThrottleConfig(task *model.MigrationTask) (*model.ThrottleConfig, error) {
+	var throttleConfig model.ThrottleConfig
+	if task.Throttle == "" {
+		return &throttleConfig, nil
+	}
+	if err := json.Unmarshal([]byte(task.Throttle), &throttleConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse throttle config: %w", err)
+	}
+	return &throttleConfig, nil
+}
+
+// ParseTransforms parses the column transformations, keyed by source table name
+func ParseTransforms(task *model.MigrationTask) (map[string]model.TableTransform, error) {
+	transforms := make(map[string]model.TableTransform)
+	if task.Transform == "" {
+		return transforms, nil
+	}
+	if err := json.Unmarshal([]byte(task.Transform), &transforms); err != nil {
+		return nil, fmt.Errorf("failed to parse transform config: %w", err)
+	}
+	return transforms, nil
+}
+
+// ParseMaskingConfig parses the column masking rules, nil if the task masks nothing
+func ParseMaskingConfig(task *model.MigrationTask) (*model.MaskingConfig, error) {
+	if task.Masking == "" {
+		return nil, nil
+	}
+	var maskingConfig model.MaskingConfig
+	if err := json.Unmarshal([]byte(task.Masking), &maskingConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse masking config: %w", err)
+	}
+	return &maskingConfig, nil
+}
+
+// ParseNameMapping parses the name mapping of a task
+// Tasks without a mapping use TableSuffix as the suffix of every target table
+func ParseNameMapping(task *model.MigrationTask) (*model.NameMapping, error) {
+	nameMapping := model.NameMapping{Suffix: task.TableSuffix}
+	if task.NameMapping == "" {
+		return &nameMapping, nil
+	}
+	if err := json.Unmarshal([]byte(task.NameMapping), &nameMapping); err != nil {
+		return nil, fmt.Errorf("failed to parse name mapping: %w", err)
+	}
+	if nameMapping.Suffix == "" {
+		nameMapping.Suffix = task.TableSuffix
+	}
+	return &nameMapping, nil
+}
+
+// ParseSelection parses the database, schema and table filters of a task, nil if not set
+func ParseSelection(task *model.MigrationTask) (*model.TableSelection, error) {
+	if task.Selection == "" {
+		return nil, nil
+	}
+	var selection model.TableSelection
+	if err := json.Unmarshal([]byte(task.Selection), &selection); err != nil {
+		return nil, fmt.Errorf("failed to parse selection: %w", err)
+	}
+	return &selection, nil
+}
+
 // ParseTables parses table list
 func ParseTables(task *model.MigrationTask) ([]string, error) {
 	var tables []string
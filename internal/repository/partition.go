@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pg/dts/internal/model"
+	"gorm.io/gorm"
+)
+
+// partitionStrategies maps pg_partitioned_table.partstrat to strategy names
+var partitionStrategies = map[string]string{
+	"r": "range",
+	"l": "list",
+	"h": "hash",
+}
+
+// GetPartitionInfo gets the partition hierarchy of a source table
+func (r *SourceRepository) GetPartitionInfo(schema, tableName string) (*model.PartitionInfo, error) {
+	return getPartitionInfo(r.db, schema, tableName)
+}
+
+// GetPartitionInfo gets the partition hierarchy of a target table
+func (r *TargetRepository) GetPartitionInfo(schema, tableName string) (*model.PartitionInfo, error) {
+	return getPartitionInfo(r.db, schema, tableName)
+}
+
+// getPartitionInfo queries the partition strategy, key and leaf partitions of a table
+func getPartitionInfo(db *gorm.DB, schema, tableName string) (*model.PartitionInfo, error) {
+	type KeyRow struct {
+		Strategy     string
+		PartitionKey string
+	}
+
+	var keyRows []KeyRow
+	err := db.Raw(`
+		SELECT pt.partstrat AS strategy, pg_get_partkeydef(c.oid) AS partition_key
+		FROM pg_partitioned_table pt
+		JOIN pg_class c ON c.oid = pt.partrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = ? AND c.relname = ?
+	`, schema, tableName).Scan(&keyRows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partition key of %s.%s: %w", schema, tableName, err)
+	}
+
+	info := &model.PartitionInfo{Leaves: []model.PartitionLeaf{}}
+	if len(keyRows) == 0 {
+		return info, nil
+	}
+	info.Strategy = partitionStrategies[keyRows[0].Strategy]
+	info.Key = keyRows[0].PartitionKey
+
+	// pg_partition_tree returns the whole hierarchy, including sub-partitioned intermediate levels
+	err = db.Raw(`
+		SELECT n.nspname AS schema, c.relname AS name, p.relname AS parent,
+			pg_get_expr(c.relpartbound, c.oid) AS bound
+		FROM pg_partition_tree(format('%I.%I', ?::text, ?::text)::regclass) t
+		JOIN pg_class c ON c.oid = t.relid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class p ON p.oid = t.parentrelid
+		WHERE t.isleaf AND t.level > 0
+		ORDER BY n.nspname, c.relname
+	`, schema, tableName).Scan(&info.Leaves).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions of %s.%s: %w", schema, tableName, err)
+	}
+
+	return info, nil
+}
+
+// CreatePartitionedTable creates a target table with overridden partitioning
+// The table is created from the source table DDL, it and its partitions are named by mapName
+func (r *TargetRepository) CreatePartitionedTable(tableInfo *model.TableInfo, mapName func(schema, table string) (string, string), partitioning *model.PartitionConfig) error {
+	targetSchema, targetTableName := mapName(tableInfo.Schema, tableInfo.Name)
+	targetTable := pgx.Identifier{targetSchema, targetTableName}.Sanitize()
+	ddl := strings.Replace(tableInfo.DDL,
+		pgx.Identifier{tableInfo.Schema, tableInfo.Name}.Sanitize(),
+		targetTable,
+		1)
+	if partitioning.Strategy != "" {
+		ddl += fmt.Sprintf(" PARTITION BY %s (%s)", strings.ToUpper(partitioning.Strategy), partitioning.Key)
+	}
+
+	if err := r.db.Exec(ddl).Error; err != nil {
+		return fmt.Errorf("failed to create table %s: %w", targetTableName, err)
+	}
+
+	for _, partition := range partitioning.Partitions {
+		partitionSchema, partitionName := mapName(tableInfo.Schema, partition.Name)
+		query := fmt.Sprintf("CREATE TABLE %s PARTITION OF %s %s",
+			pgx.Identifier{partitionSchema, partitionName}.Sanitize(), targetTable, partition.Bound)
+		if err := r.db.Exec(query).Error; err != nil {
+			return fmt.Errorf("failed to create partition %s: %w", partitionName, err)
+		}
+	}
+
+	return nil
+}
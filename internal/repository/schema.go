@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pg/dts/internal/model"
+	"gorm.io/gorm"
+)
+
+// SchemaRepository persists the DDL statements of a task and their outcome in the metadata database
+type SchemaRepository struct {
+	db *gorm.DB
+}
+
+// NewSchemaRepository creates a schema statement repository
+func NewSchemaRepository(db *gorm.DB) *SchemaRepository {
+	return &SchemaRepository{db: db}
+}
+
+// ListStatements lists the statements of a task section in dump order
+func (r *SchemaRepository) ListStatements(taskID, section string) ([]model.SchemaStatement, error) {
+	var statements []model.SchemaStatement
+	if err := r.db.Where("task_id = ? AND section = ?", taskID, section).Order("seq").Find(&statements).Error; err != nil {
+		return nil, fmt.Errorf("failed to list schema statements: %w", err)
+	}
+	return statements, nil
+}
+
+// ListTaskStatements lists the statements of a task, optionally only those of a section or with a status
+func (r *SchemaRepository) ListTaskStatements(taskID, section, status string) ([]model.SchemaStatement, error) {
+	query := r.db.Where("task_id = ?", taskID)
+	if section != "" {
+		query = query.Where("section = ?", section)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var statements []model.SchemaStatement
+	if err := query.Order("section DESC, database, seq").Find(&statements).Error; err != nil {
+		return nil, fmt.Errorf("failed to list schema statements: %w", err)
+	}
+	return statements, nil
+}
+
+// SaveStatements stores the statements of a task section for a target database, replacing any previous ones
+func (r *SchemaRepository) SaveStatements(taskID, section, database string, statements []model.SchemaStatement) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("task_id = ? AND section = ? AND database = ?", taskID, section, database).Delete(&model.SchemaStatement{}).Error; err != nil {
+			return fmt.Errorf("failed to delete schema statements: %w", err)
+		}
+		if len(statements) == 0 {
+			return nil
+		}
+		for i := range statements {
+			statements[i].TaskID = taskID
+			statements[i].Section = section
+			statements[i].Database = database
+			statements[i].Seq = i
+			if statements[i].Status == "" {
+				statements[i].Status = model.StatementPending
+			}
+		}
+		if err := tx.Create(&statements).Error; err != nil {
+			return fmt.Errorf("failed to save schema statements: %w", err)
+		}
+		return nil
+	})
+}
+
+// StartStatement marks a statement as running
+func (r *SchemaRepository) StartStatement(id uint) error {
+	now := time.Now()
+	return r.updateStatement(id, map[string]interface{}{
+		"status":       model.StatementRunning,
+		"error":        "",
+		"started_at":   &now,
+		"completed_at": nil,
+	})
+}
+
+// CompleteStatement records the outcome of a statement
+func (r *SchemaRepository) CompleteStatement(id uint, status, message string) error {
+	now := time.Now()
+	return r.updateStatement(id, map[string]interface{}{
+		"status":       status,
+		"error":        message,
+		"completed_at": &now,
+	})
+}
+
+// updateStatement updates the columns of a statement
+func (r *SchemaRepository) updateStatement(id uint, values map[string]interface{}) error {
+	if err := r.db.Model(&model.SchemaStatement{}).Where("id = ?", id).Updates(values).Error; err != nil {
+		return fmt.Errorf("failed to update schema statement: %w", err)
+	}
+	return nil
+}
+
+// DeleteStatements deletes the statements of a task
+func (r *SchemaRepository) DeleteStatements(taskID string) error {
+	if err := r.db.Where("task_id = ?", taskID).Delete(&model.SchemaStatement{}).Error; err != nil {
+		return fmt.Errorf("failed to delete schema statements: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"gorm.io/gorm"
+)
+
+// SchemaNames maps the objects of source schemas to their target names in catalog output
+type SchemaNames struct {
+	extractor *schemaExtractor
+}
+
+// GetSchemaNames reads the target names of the relations, types and functions of the given schemas
+// The listed tables (schema.table, including partitions) get their mapped names, as in ExtractSchema.
+func (r *SourceRepository) GetSchemaNames(schemas []string, tables map[string]bool, names *naming.Mapper) (*SchemaNames, error) {
+	e := &schemaExtractor{
+		repo:    r,
+		schemas: schemas,
+		tables:  tables,
+		names:   names,
+		targets: make(map[objectName]string),
+	}
+	if len(schemas) > 0 {
+		if err := e.extractNames(); err != nil {
+			return nil, err
+		}
+	}
+	return &SchemaNames{extractor: e}, nil
+}
+
+// Rename replaces the schema-qualified names of the objects in text by their quoted target names
+func (n *SchemaNames) Rename(text string) string {
+	if n == nil {
+		return text
+	}
+	return n.extractor.rename(text)
+}
+
+// GetQualifiedTableInfo gets the information of a table as GetTableInfo does, with every type and
+// function outside pg_catalog schema-qualified, so that the output of two databases compares
+func (r *SourceRepository) GetQualifiedTableInfo(schema, tableName string) (*model.TableInfo, error) {
+	var tableInfo *model.TableInfo
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL search_path = pg_catalog").Error; err != nil {
+			return fmt.Errorf("failed to set search_path: %w", err)
+		}
+		var err error
+		tableInfo, err = (&SourceRepository{db: tx}).GetTableInfo(schema, tableName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tableInfo, nil
+}
+
+// normalizeNames quotes every schema-qualified name in catalog output, which quotes names only as needed
+func normalizeNames(text string) string {
+	return replaceQualified(text, func(schema, name string) (string, bool) {
+		return pgx.Identifier{schema, name}.Sanitize(), true
+	})
+}
+
+// tableDiffer compares a source table with its target table and collects the changes and the
+// statements making the target match the source
+type tableDiffer struct {
+	source, target *model.TableInfo
+	names          *naming.Mapper
+	objects        *SchemaNames // Target names of the types and functions the source definitions use
+	table          string       // Quoted target table name
+	diff           model.TableDiff
+
+	// Statements by step, so that objects are dropped before they are recreated and columns exist
+	// before the indexes and constraints using them
+	drops, columns, sequences, creates []string
+}
+
+// DiffTable compares the structure of a source table with its target table
+// Columns are matched by name and sequences by their owning column. Indexes and constraints are
+// matched by definition, since their target names may be mapped; one whose definition changed is
+// reported missing and extra. Types and functions in source definitions are mapped through objects
+// before they are compared, both tables should come from GetQualifiedTableInfo. A target with no
+// columns is reported missing as a whole. The statements are only generated, never run.
+func DiffTable(database string, source, target *model.TableInfo, names *naming.Mapper, objects *SchemaNames) model.TableDiff {
+	d := &tableDiffer{
+		source:  source,
+		target:  target,
+		names:   names,
+		objects: objects,
+		table:   pgx.Identifier{target.Schema, target.Name}.Sanitize(),
+		diff: model.TableDiff{
+			Database:     database,
+			SourceSchema: source.Schema,
+			SourceTable:  source.Name,
+			TargetSchema: target.Schema,
+			TargetTable:  target.Name,
+			Changes:      []model.SchemaChange{},
+			Statements:   []string{},
+		},
+	}
+
+	if len(target.Columns) == 0 {
+		d.change("table", source.Name, model.ChangeMissing, "", "", "")
+		d.columns = append(d.columns, strings.Replace(objects.Rename(source.DDL),
+			pgx.Identifier{source.Schema, source.Name}.Sanitize(), d.table, 1))
+		// The primary key is part of the table definition
+		d.target = &model.TableInfo{Schema: target.Schema, Name: target.Name}
+		for _, c := range source.Constraints {
+			if c.Type == "PRIMARY KEY" {
+				d.target.Constraints = append(d.target.Constraints, c)
+			}
+		}
+		d.diffIndexes()
+		d.diffConstraints()
+	} else {
+		d.diffColumns()
+		d.diffSequences()
+		d.diffIndexes()
+		d.diffConstraints()
+	}
+
+	for _, step := range [][]string{d.drops, d.columns, d.sequences, d.creates} {
+		d.diff.Statements = append(d.diff.Statements, step...)
+	}
+	return d.diff
+}
+
+// change records a change
+func (d *tableDiffer) change(object, name, kind, field, source, target string) {
+	d.diff.Changes = append(d.diff.Changes, model.SchemaChange{
+		Object: object,
+		Name:   name,
+		Kind:   kind,
+		Field:  field,
+		Source: source,
+		Target: target,
+	})
+}
+
+// alterTable returns an ALTER TABLE statement on the target table
+func (d *tableDiffer) alterTable(action string) string {
+	return "ALTER TABLE " + d.table + " " + action
+}
+
+// diffColumns compares the columns by name
+func (d *tableDiffer) diffColumns() {
+	targetColumns := make(map[string]model.ColumnInfo, len(d.target.Columns))
+	for _, col := range d.target.Columns {
+		targetColumns[col.Name] = col
+	}
+	sourceColumns := make(map[string]bool, len(d.source.Columns))
+
+	for _, src := range d.source.Columns {
+		sourceColumns[src.Name] = true
+		tgt, ok := targetColumns[src.Name]
+		if !ok {
+			d.change("column", src.Name, model.ChangeMissing, "", columnDefinition(src), "")
+			d.columns = append(d.columns, d.alterTable("ADD COLUMN "+d.objects.Rename(columnDefinition(src))))
+			continue
+		}
+		d.diffColumn(src, tgt)
+	}
+
+	for _, tgt := range d.target.Columns {
+		if !sourceColumns[tgt.Name] {
+			d.change("column", tgt.Name, model.ChangeExtra, "", "", columnDefinition(tgt))
+			d.drops = append(d.drops, d.alterTable("DROP COLUMN "+pgx.Identifier{tgt.Name}.Sanitize()))
+		}
+	}
+}
+
+// diffColumn compares the attributes of a column present on both sides
+func (d *tableDiffer) diffColumn(src, tgt model.ColumnInfo) {
+	column := "ALTER COLUMN " + pgx.Identifier{src.Name}.Sanitize() + " "
+	dataType := d.objects.Rename(src.DataType)
+
+	sameType := normalizeNames(dataType) == normalizeNames(tgt.DataType)
+	if !sameType || src.Collation != tgt.Collation {
+		if !sameType {
+			d.change("column", src.Name, model.ChangeChanged, "type", src.DataType, tgt.DataType)
+		}
+		if src.Collation != tgt.Collation {
+			d.change("column", src.Name, model.ChangeChanged, "collation", src.Collation, tgt.Collation)
+		}
+		action := column + "TYPE " + dataType
+		if src.Collation != "" {
+			action += " COLLATE " + src.Collation
+		}
+		action += " USING " + pgx.Identifier{src.Name}.Sanitize() + "::" + dataType
+		d.columns = append(d.columns, d.alterTable(action))
+	}
+
+	if src.IsNullable != tgt.IsNullable {
+		d.change("column", src.Name, model.ChangeChanged, "nullable", nullability(src), nullability(tgt))
+		if src.IsNullable {
+			d.columns = append(d.columns, d.alterTable(column+"DROP NOT NULL"))
+		} else {
+			d.columns = append(d.columns, d.alterTable(column+"SET NOT NULL"))
+		}
+	}
+
+	if src.Identity != tgt.Identity {
+		d.change("column", src.Name, model.ChangeChanged, "identity", src.Identity, tgt.Identity)
+		switch {
+		case src.Identity == "":
+			d.columns = append(d.columns, d.alterTable(column+"DROP IDENTITY"))
+		case tgt.Identity == "":
+			d.columns = append(d.columns, d.alterTable(column+"ADD GENERATED "+src.Identity+" AS IDENTITY"))
+		default:
+			d.columns = append(d.columns, d.alterTable(column+"SET GENERATED "+src.Identity))
+		}
+	}
+
+	if !sameDefinition(d.objects.Rename(src.Generated), tgt.Generated) {
+		// A generation expression cannot be changed in place
+		d.change("column", src.Name, model.ChangeChanged, "generated", src.Generated, tgt.Generated)
+	}
+
+	defaultValue := d.objects.Rename(src.DefaultValue)
+	if src.Identity == "" && src.Generated == "" && !sameDefault(defaultValue, tgt.DefaultValue) {
+		d.change("column", src.Name, model.ChangeChanged, "default", src.DefaultValue, tgt.DefaultValue)
+		if src.DefaultValue == "" {
+			d.columns = append(d.columns, d.alterTable(column+"DROP DEFAULT"))
+		} else {
+			d.columns = append(d.columns, d.alterTable(column+"SET DEFAULT "+defaultValue))
+		}
+	}
+}
+
+// sameDefault reports whether two column defaults match
+// Defaults drawing from a sequence match whatever the sequence is named, sequences are compared by owning column.
+func sameDefault(source, target string) bool {
+	if strings.HasPrefix(source, "nextval(") && strings.HasPrefix(target, "nextval(") {
+		return true
+	}
+	return sameDefinition(source, target)
+}
+
+// sameDefinition reports whether two definitions printed by the catalog match, however their names are quoted
+func sameDefinition(source, target string) bool {
+	return normalizeNames(source) == normalizeNames(target)
+}
+
+// nullability describes whether a column is nullable
+func nullability(col model.ColumnInfo) string {
+	if col.IsNullable {
+		return "NULL"
+	}
+	return "NOT NULL"
+}
+
+// diffSequences compares the sequences owned by each column
+func (d *tableDiffer) diffSequences() {
+	targetSequences := make(map[string]model.SequenceInfo, len(d.target.Sequences))
+	for _, seq := range d.target.Sequences {
+		targetSequences[seq.Column] = seq
+	}
+	sourceSequences := make(map[string]bool, len(d.source.Sequences))
+
+	for _, src := range d.source.Sequences {
+		sourceSequences[src.Column] = true
+		tgt, ok := targetSequences[src.Column]
+		if !ok {
+			d.change("sequence", src.Name, model.ChangeMissing, "", src.Column, "")
+			continue
+		}
+
+		var clauses []string
+		compare := func(field, clause, source, target string) {
+			if source != target {
+				d.change("sequence", src.Name, model.ChangeChanged, field, source, target)
+				clauses = append(clauses, clause+source)
+			}
+		}
+		compare("data_type", "AS ", src.DataType, tgt.DataType)
+		compare("increment", "INCREMENT BY ", strconv.FormatInt(src.Increment, 10), strconv.FormatInt(tgt.Increment, 10))
+		compare("min_value", "MINVALUE ", strconv.FormatInt(src.MinValue, 10), strconv.FormatInt(tgt.MinValue, 10))
+		compare("max_value", "MAXVALUE ", strconv.FormatInt(src.MaxValue, 10), strconv.FormatInt(tgt.MaxValue, 10))
+		compare("start", "START WITH ", strconv.FormatInt(src.Start, 10), strconv.FormatInt(tgt.Start, 10))
+		compare("cache", "CACHE ", strconv.FormatInt(src.Cache, 10), strconv.FormatInt(tgt.Cache, 10))
+		if src.Cycle != tgt.Cycle {
+			d.change("sequence", src.Name, model.ChangeChanged, "cycle", strconv.FormatBool(src.Cycle), strconv.FormatBool(tgt.Cycle))
+			if src.Cycle {
+				clauses = append(clauses, "CYCLE")
+			} else {
+				clauses = append(clauses, "NO CYCLE")
+			}
+		}
+		if len(clauses) > 0 {
+			d.sequences = append(d.sequences, fmt.Sprintf("ALTER SEQUENCE %s %s",
+				pgx.Identifier{tgt.Schema, tgt.Name}.Sanitize(), strings.Join(clauses, " ")))
+		}
+	}
+
+	for _, tgt := range d.target.Sequences {
+		if !sourceSequences[tgt.Column] {
+			d.change("sequence", tgt.Name, model.ChangeExtra, "", "", tgt.Column)
+		}
+	}
+}
+
+// diffIndexes compares the indexes by definition
+func (d *tableDiffer) diffIndexes() {
+	targetIndexes := make(map[string][]model.IndexInfo, len(d.target.Indexes))
+	for _, idx := range d.target.Indexes {
+		key := indexKey(idx, nil)
+		targetIndexes[key] = append(targetIndexes[key], idx)
+	}
+
+	for _, src := range d.source.Indexes {
+		key := indexKey(src, d.objects)
+		if matches := targetIndexes[key]; len(matches) > 0 {
+			targetIndexes[key] = matches[1:]
+			continue
+		}
+		d.change("index", src.Name, model.ChangeMissing, "", src.DDL, "")
+		stmt := "CREATE INDEX "
+		if src.Unique {
+			stmt = "CREATE UNIQUE INDEX "
+		}
+		d.creates = append(d.creates, stmt+pgx.Identifier{d.names.Object(src.Name)}.Sanitize()+" ON "+d.table+" "+d.objects.Rename(indexMethod(src.DDL)))
+	}
+
+	for _, idx := range d.target.Indexes {
+		for _, extra := range targetIndexes[indexKey(idx, nil)] {
+			if extra.Name == idx.Name {
+				d.change("index", idx.Name, model.ChangeExtra, "", "", idx.DDL)
+				d.drops = append(d.drops, "DROP INDEX "+pgx.Identifier{d.target.Schema, idx.Name}.Sanitize())
+			}
+		}
+	}
+}
+
+// indexKey returns the definition of an index without its name and table, with the names it uses
+// mapped through objects for a source index
+func indexKey(idx model.IndexInfo, objects *SchemaNames) string {
+	key := normalizeNames(objects.Rename(indexMethod(idx.DDL)))
+	if idx.Unique {
+		return "UNIQUE " + key
+	}
+	return key
+}
+
+// indexMethod returns the part of an index definition from its access method on, e.g. "USING btree (id)"
+func indexMethod(def string) string {
+	if i := strings.Index(def, " USING "); i >= 0 {
+		return def[i+1:]
+	}
+	return def
+}
+
+// diffConstraints compares the constraints by definition
+func (d *tableDiffer) diffConstraints() {
+	targetConstraints := make(map[string][]model.ConstraintInfo, len(d.target.Constraints))
+	for _, c := range d.target.Constraints {
+		key := d.constraintKey(c, false)
+		targetConstraints[key] = append(targetConstraints[key], c)
+	}
+
+	for _, src := range d.source.Constraints {
+		key := d.constraintKey(src, true)
+		if matches := targetConstraints[key]; len(matches) > 0 {
+			targetConstraints[key] = matches[1:]
+			continue
+		}
+		d.change("constraint", src.Name, model.ChangeMissing, "", src.Definition, "")
+		d.creates = append(d.creates, d.alterTable("ADD CONSTRAINT "+
+			pgx.Identifier{d.names.Object(src.Name)}.Sanitize()+" "+d.constraintDefinition(src)))
+	}
+
+	for _, c := range d.target.Constraints {
+		for _, extra := range targetConstraints[d.constraintKey(c, false)] {
+			if extra.Name == c.Name {
+				d.change("constraint", c.Name, model.ChangeExtra, "", "", c.Definition)
+				d.drops = append(d.drops, d.alterTable("DROP CONSTRAINT "+pgx.Identifier{c.Name}.Sanitize()))
+			}
+		}
+	}
+}
+
+// constraintKey returns the definition of a constraint, with the names a source constraint uses
+// mapped to their target names
+func (d *tableDiffer) constraintKey(c model.ConstraintInfo, source bool) string {
+	def := c.Definition
+	switch {
+	case source:
+		def = d.constraintDefinition(c)
+	case c.Type == "FOREIGN KEY":
+		def = foreignKeyDefinition(c, c.RefSchema, c.RefTable)
+	}
+	return normalizeNames(def)
+}
+
+// constraintDefinition returns the definition a source constraint has on the target
+func (d *tableDiffer) constraintDefinition(c model.ConstraintInfo) string {
+	if c.Type != "FOREIGN KEY" {
+		return d.objects.Rename(c.Definition)
+	}
+	refSchema, refTable := d.names.Table(c.RefSchema, c.RefTable)
+	return foreignKeyDefinition(c, refSchema, refTable)
+}
+
+// foreignKeyDefinition returns the definition of a foreign key referencing the given table
+// Match type, actions and deferrability are taken from the printed definition.
+func foreignKeyDefinition(c model.ConstraintInfo, refSchema, refTable string) string {
+	def := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s)", quoteColumns(c.Columns),
+		pgx.Identifier{refSchema, refTable}.Sanitize(), quoteColumns(c.RefColumns))
+	if i := strings.Index(c.Definition, " REFERENCES "); i >= 0 {
+		if j := strings.IndexByte(c.Definition[i:], ')'); j >= 0 {
+			def += c.Definition[i+j+1:]
+		}
+	}
+	return def
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+)
+
+func TestDiffTableMapsNames(t *testing.T) {
+	names, err := naming.New(&model.NameMapping{Schemas: map[string]string{"app": "stage"}, Prefix: "t_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := &SchemaNames{extractor: &schemaExtractor{names: names, targets: map[objectName]string{
+		{"app", "status"}:    `"stage"."t_status"`,
+		{"app", "normalize"}: `"stage"."t_normalize"`,
+	}}}
+
+	source := &model.TableInfo{
+		Schema: "app",
+		Name:   "orders",
+		Columns: []model.ColumnInfo{
+			{Name: "state", DataType: "app.status", DefaultValue: "'new'::app.status"},
+			{Name: "code", DataType: "text", DefaultValue: "app.normalize('x'::text)"},
+		},
+		Constraints: []model.ConstraintInfo{
+			{Name: "orders_state_check", Type: "CHECK", Definition: "CHECK ((state <> 'gone'::app.status))"},
+		},
+	}
+	target := &model.TableInfo{
+		Schema: "stage",
+		Name:   "t_orders",
+		Columns: []model.ColumnInfo{
+			{Name: "state", DataType: "stage.t_status", DefaultValue: "'new'::stage.t_status"},
+			{Name: "code", DataType: "text", DefaultValue: "stage.t_normalize('x'::text)"},
+		},
+		Constraints: []model.ConstraintInfo{
+			{Name: "t_orders_state_check", Type: "CHECK", Definition: "CHECK ((state <> 'gone'::stage.t_status))"},
+		},
+	}
+	if diff := DiffTable("db", source, target, names, objects); len(diff.Changes) != 0 {
+		t.Errorf("changes = %+v, want none", diff.Changes)
+	}
+
+	target.Columns[0].DataType = "text"
+	diff := DiffTable("db", source, target, names, objects)
+	want := `ALTER TABLE "stage"."t_orders" ALTER COLUMN "state" TYPE "stage"."t_status" USING "state"::"stage"."t_status"`
+	if len(diff.Statements) != 1 || diff.Statements[0] != want {
+		t.Errorf("statements = %q, want %q", diff.Statements, want)
+	}
+}
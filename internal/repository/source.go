@@ -3,8 +3,11 @@ package repository
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -48,6 +51,11 @@ func NewSourceRepositoryFromTask(task *model.MigrationTask) (*SourceRepository,
 	return &SourceRepository{db: db}, nil
 }
 
+// NewSourceRepositoryFromDB creates a source repository from an existing GORM connection
+func NewSourceRepositoryFromDB(db *gorm.DB) *SourceRepository {
+	return &SourceRepository{db: db}
+}
+
 // Close closes the connection
 func (r *SourceRepository) Close() error {
 	sqlDB, err := r.db.DB()
@@ -80,6 +88,7 @@ func (r *SourceRepository) GetTableInfo(schema, tableName string) (*model.TableI
 		Columns:     []model.ColumnInfo{},
 		Indexes:     []model.IndexInfo{},
 		Constraints: []model.ConstraintInfo{},
+		Sequences:   []model.SequenceInfo{},
 	}
 
 	// Get column information
@@ -103,6 +112,13 @@ func (r *SourceRepository) GetTableInfo(schema, tableName string) (*model.TableI
 	}
 	tableInfo.Constraints = constraints
 
+	// Get owned sequence information
+	sequences, err := r.getSequences(schema, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sequences: %w", err)
+	}
+	tableInfo.Sequences = sequences
+
 	// Generate DDL
 	ddl, err := r.generateDDL(tableInfo)
 	if err != nil {
@@ -117,32 +133,39 @@ func (r *SourceRepository) GetTableInfo(schema, tableName string) (*model.TableI
 func (r *SourceRepository) getColumns(schema, tableName string) ([]model.ColumnInfo, error) {
 	query := `
 		SELECT
-			c.column_name,
-			c.data_type,
-			c.is_nullable,
-			c.column_default,
-			CASE WHEN pk.column_name IS NOT NULL THEN true ELSE false END as is_primary_key
-		FROM information_schema.columns c
-		LEFT JOIN (
-			SELECT ku.table_schema, ku.table_name, ku.column_name
-			FROM information_schema.table_constraints tc
-			JOIN information_schema.key_column_usage ku
-				ON tc.constraint_name = ku.constraint_name
-				AND tc.table_schema = ku.table_schema
-			WHERE tc.constraint_type = 'PRIMARY KEY'
-		) pk ON c.table_schema = pk.table_schema
-			AND c.table_name = pk.table_name
-			AND c.column_name = pk.column_name
-		WHERE c.table_schema = ? AND c.table_name = ?
-		ORDER BY c.ordinal_position
+			a.attname AS name,
+			format_type(a.atttypid, a.atttypmod) AS data_type,
+			NOT a.attnotnull AS is_nullable,
+			CASE WHEN a.attgenerated = '' THEN pg_get_expr(d.adbin, d.adrelid) END AS default_value,
+			EXISTS (
+				SELECT 1 FROM pg_index i
+				WHERE i.indrelid = a.attrelid AND i.indisprimary AND a.attnum = ANY (i.indkey)
+			) AS is_primary_key,
+			CASE a.attidentity WHEN 'a' THEN 'ALWAYS' WHEN 'd' THEN 'BY DEFAULT' ELSE '' END AS identity,
+			CASE WHEN a.attgenerated <> '' THEN pg_get_expr(d.adbin, d.adrelid) ELSE '' END AS generated,
+			CASE WHEN a.attcollation <> t.typcollation
+				THEN quote_ident(cn.nspname) || '.' || quote_ident(co.collname) ELSE '' END AS collation
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_type t ON t.oid = a.atttypid
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		LEFT JOIN pg_collation co ON co.oid = a.attcollation
+		LEFT JOIN pg_namespace cn ON cn.oid = co.collnamespace
+		WHERE n.nspname = ? AND c.relname = ?
+			AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum
 	`
 
 	type ColumnRow struct {
 		Name         string
 		DataType     string
-		IsNullable   string
+		IsNullable   bool
 		DefaultValue *string
 		IsPrimaryKey bool
+		Identity     string
+		Generated    string
+		Collation    string
 	}
 
 	var rows []ColumnRow
@@ -155,9 +178,12 @@ func (r *SourceRepository) getColumns(schema, tableName string) ([]model.ColumnI
 		columns[i] = model.ColumnInfo{
 			Name:         row.Name,
 			DataType:     row.DataType,
-			IsNullable:   row.IsNullable == "YES",
+			IsNullable:   row.IsNullable,
 			DefaultValue: "",
 			IsPrimaryKey: row.IsPrimaryKey,
+			Identity:     row.Identity,
+			Generated:    row.Generated,
+			Collation:    row.Collation,
 		}
 		if row.DefaultValue != nil {
 			columns[i].DefaultValue = *row.DefaultValue
@@ -168,16 +194,24 @@ func (r *SourceRepository) getColumns(schema, tableName string) ([]model.ColumnI
 }
 
 // getIndexes gets index information
+// Indexes backing a primary key, unique or exclusion constraint are listed with the constraints
 func (r *SourceRepository) getIndexes(schema, tableName string) ([]model.IndexInfo, error) {
 	query := `
 		SELECT
-			i.indexname,
-			i.indexdef,
-			i.indexdef LIKE '%UNIQUE%' as is_unique
-		FROM pg_indexes i
-		WHERE i.schemaname = ? AND i.tablename = ?
-		AND i.indexname NOT LIKE '%_pkey'
-		ORDER BY i.indexname
+			ic.relname AS name,
+			pg_get_indexdef(i.indexrelid) AS index_def,
+			i.indisunique AS is_unique
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = ? AND c.relname = ?
+			AND NOT EXISTS (
+				SELECT 1 FROM pg_constraint con
+				WHERE con.conindid = i.indexrelid AND con.conrelid = i.indrelid
+					AND con.contype IN ('p', 'u', 'x')
+			)
+		ORDER BY ic.relname
 	`
 
 	type IndexRow struct {
@@ -208,28 +242,47 @@ func (r *SourceRepository) getIndexes(schema, tableName string) ([]model.IndexIn
 func (r *SourceRepository) getConstraints(schema, tableName string) ([]model.ConstraintInfo, error) {
 	query := `
 		SELECT
-			tc.constraint_name,
-			tc.constraint_type,
-			STRING_AGG(kcu.column_name, ', ' ORDER BY kcu.ordinal_position) as columns,
-			cc.check_clause
-		FROM information_schema.table_constraints tc
-		LEFT JOIN information_schema.key_column_usage kcu
-			ON tc.constraint_name = kcu.constraint_name
-			AND tc.table_schema = kcu.table_schema
-		LEFT JOIN information_schema.check_constraints cc
-			ON tc.constraint_name = cc.constraint_name
-		WHERE tc.table_schema = ?
-			AND tc.table_name = ?
-			AND tc.constraint_type != 'PRIMARY KEY'
-		GROUP BY tc.constraint_name, tc.constraint_type, cc.check_clause
-		ORDER BY tc.constraint_name
+			con.conname AS name,
+			CASE con.contype
+				WHEN 'p' THEN 'PRIMARY KEY'
+				WHEN 'f' THEN 'FOREIGN KEY'
+				WHEN 'u' THEN 'UNIQUE'
+				WHEN 'c' THEN 'CHECK'
+				WHEN 'x' THEN 'EXCLUDE'
+			END AS type,
+			array_to_string(ARRAY(
+				SELECT a.attname
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			), ', ') AS columns,
+			pg_get_constraintdef(con.oid) AS definition,
+			COALESCE(rn.nspname, '') AS ref_schema,
+			COALESCE(rc.relname, '') AS ref_table,
+			array_to_string(ARRAY(
+				SELECT a.attname
+				FROM unnest(con.confkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			), ', ') AS ref_columns
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_class rc ON rc.oid = con.confrelid
+		LEFT JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+		WHERE n.nspname = ? AND c.relname = ?
+			AND con.contype IN ('p', 'f', 'u', 'c', 'x')
+		ORDER BY con.conname
 	`
 
 	type ConstraintRow struct {
-		Name        string
-		Type        string
-		Columns     *string
-		CheckClause *string
+		Name       string
+		Type       string
+		Columns    string
+		Definition string
+		RefSchema  string
+		RefTable   string
+		RefColumns string
 	}
 
 	var rows []ConstraintRow
@@ -242,51 +295,100 @@ func (r *SourceRepository) getConstraints(schema, tableName string) ([]model.Con
 		constraints[i] = model.ConstraintInfo{
 			Name:       row.Name,
 			Type:       row.Type,
-			Columns:    []string{},
-			Definition: "",
+			Columns:    parseStringArray(row.Columns),
+			Definition: row.Definition,
 		}
-
-		if row.Columns != nil {
-			constraints[i].Columns = parseStringArray(*row.Columns)
+		if row.Type == "FOREIGN KEY" {
+			constraints[i].RefSchema = row.RefSchema
+			constraints[i].RefTable = row.RefTable
+			constraints[i].RefColumns = parseStringArray(row.RefColumns)
 		}
+	}
+
+	return constraints, nil
+}
+
+// getSequences gets the sequences owned by the columns of a table, serial and identity sequences
+func (r *SourceRepository) getSequences(schema, tableName string) ([]model.SequenceInfo, error) {
+	query := `
+		SELECT
+			sn.nspname AS schema,
+			sc.relname AS name,
+			a.attname AS column_name,
+			format_type(s.seqtypid, NULL) AS data_type,
+			s.seqstart AS start,
+			s.seqincrement AS increment,
+			s.seqmin AS min_value,
+			s.seqmax AS max_value,
+			s.seqcache AS cache,
+			s.seqcycle AS cycle
+		FROM pg_depend d
+		JOIN pg_class sc ON sc.oid = d.objid AND sc.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = sc.relnamespace
+		JOIN pg_sequence s ON s.seqrelid = sc.oid
+		JOIN pg_class c ON c.oid = d.refobjid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_class'::regclass AND d.refclassid = 'pg_class'::regclass
+			AND d.deptype IN ('a', 'i')
+			AND n.nspname = ? AND c.relname = ?
+		ORDER BY a.attnum
+	`
+
+	type SequenceRow struct {
+		Schema     string
+		Name       string
+		ColumnName string
+		DataType   string
+		Start      int64
+		Increment  int64
+		MinValue   int64
+		MaxValue   int64
+		Cache      int64
+		Cycle      bool
+	}
+
+	var rows []SequenceRow
+	if err := r.db.Raw(query, schema, tableName).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
 
-		if row.CheckClause != nil {
-			constraints[i].Definition = *row.CheckClause
+	sequences := make([]model.SequenceInfo, len(rows))
+	for i, row := range rows {
+		sequences[i] = model.SequenceInfo{
+			Schema:    row.Schema,
+			Name:      row.Name,
+			Column:    row.ColumnName,
+			DataType:  row.DataType,
+			Start:     row.Start,
+			Increment: row.Increment,
+			MinValue:  row.MinValue,
+			MaxValue:  row.MaxValue,
+			Cache:     row.Cache,
+			Cycle:     row.Cycle,
 		}
 	}
 
-	return constraints, nil
+	return sequences, nil
 }
 
 // generateDDL generates CREATE TABLE DDL
 func (r *SourceRepository) generateDDL(tableInfo *model.TableInfo) (string, error) {
 	var ddl strings.Builder
 
-	ddl.WriteString(fmt.Sprintf("CREATE TABLE %s.%s (\n", tableInfo.Schema, tableInfo.Name))
+	ddl.WriteString(fmt.Sprintf("CREATE TABLE %s (\n", pgx.Identifier{tableInfo.Schema, tableInfo.Name}.Sanitize()))
 
 	// Column definitions
 	var columnDefs []string
 	for _, col := range tableInfo.Columns {
-		def := fmt.Sprintf("  %s %s", col.Name, col.DataType)
-
-		// Add NOT NULL
-		if !col.IsNullable {
-			def += " NOT NULL"
-		}
-
-		// Add default value
-		if col.DefaultValue != "" {
-			def += " DEFAULT " + col.DefaultValue
-		}
-
-		columnDefs = append(columnDefs, def)
+		columnDefs = append(columnDefs, "  "+columnDefinition(col))
 	}
 
 	// Add primary key constraint
 	var pkColumns []string
 	for _, col := range tableInfo.Columns {
 		if col.IsPrimaryKey {
-			pkColumns = append(pkColumns, col.Name)
+			pkColumns = append(pkColumns, pgx.Identifier{col.Name}.Sanitize())
 		}
 	}
 	if len(pkColumns) > 0 {
@@ -299,6 +401,29 @@ func (r *SourceRepository) generateDDL(tableInfo *model.TableInfo) (string, erro
 	return ddl.String(), nil
 }
 
+// columnDefinition returns the definition of a column in CREATE TABLE
+func columnDefinition(col model.ColumnInfo) string {
+	def := pgx.Identifier{col.Name}.Sanitize() + " " + col.DataType
+	if col.Collation != "" {
+		def += " COLLATE " + col.Collation
+	}
+
+	switch {
+	case col.Identity != "":
+		def += " GENERATED " + col.Identity + " AS IDENTITY"
+	case col.Generated != "":
+		def += " GENERATED ALWAYS AS (" + col.Generated + ") STORED"
+	case col.DefaultValue != "":
+		def += " DEFAULT " + col.DefaultValue
+	}
+
+	// Add NOT NULL
+	if !col.IsNullable {
+		def += " NOT NULL"
+	}
+	return def
+}
+
 // extractColumnsFromIndexDef extracts column names from index definition
 func extractColumnsFromIndexDef(indexDef string) []string {
 	// Simple implementation: extract column names from CREATE INDEX ... ON table (col1, col2)
@@ -338,7 +463,7 @@ func parseStringArray(s string) []string {
 // GetTableCount gets table row count
 func (r *SourceRepository) GetTableCount(schema, tableName string) (int64, error) {
 	var count int64
-	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s.%s`, schema, tableName)
+	query := "SELECT COUNT(*) FROM " + pgx.Identifier{schema, tableName}.Sanitize()
 	err := r.db.Raw(query).Scan(&count).Error
 	if err != nil {
 		return 0, fmt.Errorf("failed to get table count: %w", err)
@@ -346,6 +471,147 @@ func (r *SourceRepository) GetTableCount(schema, tableName string) (int64, error
 	return count, nil
 }
 
+// GetFilteredTableCount gets the number of rows of a table matching a predicate
+func (r *SourceRepository) GetFilteredTableCount(schema, tableName, predicate string) (int64, error) {
+	var count int64
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, pgx.Identifier{schema, tableName}.Sanitize(), predicate)
+	if err := r.db.Raw(query).Scan(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to get filtered table count: %w", err)
+	}
+	return count, nil
+}
+
+// ExplainPredicate plans a query of the rows of a table matching predicate, failing if the predicate is invalid
+func (r *SourceRepository) ExplainPredicate(schema, tableName, predicate string) error {
+	query := fmt.Sprintf(`EXPLAIN SELECT 1 FROM %s WHERE %s`, pgx.Identifier{schema, tableName}.Sanitize(), predicate)
+	if err := r.db.Exec(query).Error; err != nil {
+		return fmt.Errorf("failed to explain predicate on %s.%s: %w", schema, tableName, err)
+	}
+	return nil
+}
+
+// GetReplicaIdentity returns the replica identity of a table (d, n, f or i as in pg_class.relreplident)
+// and whether any of its columns can hold TOASTed values
+func (r *SourceRepository) GetReplicaIdentity(schema, tableName string) (string, bool, error) {
+	var result struct {
+		Identity  string
+		Toastable bool
+	}
+	err := r.db.Raw(`
+		SELECT c.relreplident::text AS identity,
+		       EXISTS (SELECT 1 FROM pg_attribute a
+		               WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		                 AND a.attlen = -1 AND a.attstorage <> 'p') AS toastable
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = ? AND c.relname = ?`, schema, tableName).Scan(&result).Error
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get replica identity of %s.%s: %w", schema, tableName, err)
+	}
+	return result.Identity, result.Toastable, nil
+}
+
+// GetUniqueColumns gets the columns of a table that are part of its primary key or a unique index
+// Included columns of a unique index are not part of its key
+func (r *SourceRepository) GetUniqueColumns(schema, tableName string) ([]string, error) {
+	var columns []string
+	err := r.db.Raw(`
+		SELECT DISTINCT a.attname
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = i.indrelid
+			AND a.attnum = ANY((i.indkey::int2[])[0:i.indnkeyatts - 1])
+		WHERE n.nspname = ? AND c.relname = ? AND i.indisunique AND a.attnum > 0
+	`, schema, tableName).Scan(&columns).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unique columns of %s.%s: %w", schema, tableName, err)
+	}
+	return columns, nil
+}
+
+// GetForeignKeys gets the foreign keys of every table in the database
+// Foreign keys of partitions inherited from their partitioned table are listed once, on the partitioned table
+func (r *SourceRepository) GetForeignKeys() ([]model.ForeignKey, error) {
+	type ForeignKeyColumn struct {
+		ID         int64
+		Schema     string
+		TableName  string
+		ColumnName string
+		RefSchema  string
+		RefTable   string
+		RefColumn  string
+	}
+
+	var rows []ForeignKeyColumn
+	err := r.db.Raw(`
+		SELECT k.oid::bigint AS id, cn.nspname AS schema, c.relname AS table_name, a.attname AS column_name,
+		       rn.nspname AS ref_schema, rc.relname AS ref_table, ra.attname AS ref_column
+		FROM pg_constraint k
+		JOIN pg_class c ON c.oid = k.conrelid
+		JOIN pg_namespace cn ON cn.oid = c.relnamespace
+		JOIN pg_class rc ON rc.oid = k.confrelid
+		JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+		CROSS JOIN LATERAL unnest(k.conkey, k.confkey) WITH ORDINALITY AS u(attnum, ref_attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = k.conrelid AND a.attnum = u.attnum
+		JOIN pg_attribute ra ON ra.attrelid = k.confrelid AND ra.attnum = u.ref_attnum
+		WHERE k.contype = 'f' AND k.conparentid = 0
+		ORDER BY k.oid, u.ord
+	`).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get foreign keys: %w", err)
+	}
+
+	var foreignKeys []model.ForeignKey
+	for i, row := range rows {
+		if i == 0 || row.ID != rows[i-1].ID {
+			foreignKeys = append(foreignKeys, model.ForeignKey{
+				Schema: row.Schema, Table: row.TableName,
+				RefSchema: row.RefSchema, RefTable: row.RefTable,
+			})
+		}
+		fk := &foreignKeys[len(foreignKeys)-1]
+		fk.Columns = append(fk.Columns, row.ColumnName)
+		fk.RefColumns = append(fk.RefColumns, row.RefColumn)
+	}
+	return foreignKeys, nil
+}
+
+// GetServerVersion returns the server version number, such as 140005
+func (r *SourceRepository) GetServerVersion() (int, error) {
+	var version int
+	if err := r.db.Raw("SELECT current_setting('server_version_num')::int").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to get server version: %w", err)
+	}
+	return version, nil
+}
+
+// GetWALPosition gets the current WAL position and the position confirmed by a replication slot
+// Confirmed is nil if the slot does not exist
+func (r *SourceRepository) GetWALPosition(slotName string) (*model.WALPosition, error) {
+	var row struct {
+		Current   int64
+		Confirmed *int64
+	}
+	err := r.db.Raw(`
+		SELECT (pg_current_wal_lsn() - '0/0')::bigint AS current,
+		       (SELECT (confirmed_flush_lsn - '0/0')::bigint FROM pg_replication_slots WHERE slot_name = ?) AS confirmed
+	`, slotName).Scan(&row).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WAL position: %w", err)
+	}
+	return &model.WALPosition{At: time.Now(), Current: row.Current, Confirmed: row.Confirmed}, nil
+}
+
+// EmitLogicalMessage writes a transactional logical decoding message into the WAL
+// It is decoded in commit order, after every transaction committed before it
+func (r *SourceRepository) EmitLogicalMessage(prefix, content string) error {
+	if err := r.db.Exec("SELECT pg_logical_emit_message(true, ?, ?)", prefix, content).Error; err != nil {
+		return fmt.Errorf("failed to emit logical message: %w", err)
+	}
+	return nil
+}
+
 // SetReadOnly sets database to read-only
 func (r *SourceRepository) SetReadOnly() error {
 	err := r.db.Exec("ALTER DATABASE current_database() SET default_transaction_read_only = true").Error
@@ -371,13 +637,16 @@ func (r *SourceRepository) RestoreWritePermissions() error {
 }
 
 // GetAllTables gets all tables under specified schema
+// Partitioned tables are listed by their root only, their partitions are migrated as part of the root
 func (r *SourceRepository) GetAllTables(schema string) ([]string, error) {
 	query := `
-		SELECT table_name
-		FROM information_schema.tables
-		WHERE table_schema = ?
-		AND table_type = 'BASE TABLE'
-		ORDER BY table_name
+		SELECT c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = ?
+		AND c.relkind IN ('r', 'p')
+		AND NOT c.relispartition
+		ORDER BY c.relname
 	`
 
 	var tables []string
@@ -387,3 +656,68 @@ func (r *SourceRepository) GetAllTables(schema string) ([]string, error) {
 
 	return tables, nil
 }
+
+// GetDatabases gets the databases of the server, without templates and the postgres database
+func (r *SourceRepository) GetDatabases() ([]string, error) {
+	query := `
+		SELECT datname
+		FROM pg_database
+		WHERE NOT datistemplate
+		AND datname <> 'postgres'
+		ORDER BY datname
+	`
+
+	var databases []string
+	if err := r.db.Raw(query).Scan(&databases).Error; err != nil {
+		return nil, fmt.Errorf("failed to get databases: %w", err)
+	}
+
+	return databases, nil
+}
+
+// GetSchemas gets the non-system schemas of the database
+// The bookkeeping schema of a database that was a migration target is left out
+func (r *SourceRepository) GetSchemas() ([]string, error) {
+	query := `
+		SELECT nspname
+		FROM pg_namespace
+		WHERE nspname <> 'information_schema'
+		AND nspname NOT LIKE 'pg\_%'
+		AND nspname <> ?
+		ORDER BY nspname
+	`
+
+	var schemas []string
+	if err := r.db.Raw(query, bookkeepingSchema).Scan(&schemas).Error; err != nil {
+		return nil, fmt.Errorf("failed to get schemas: %w", err)
+	}
+
+	return schemas, nil
+}
+
+// DiscoverTables gets the selected tables of every non-system schema
+// Tables outside the public schema are qualified with their schema
+func (r *SourceRepository) DiscoverTables(selector *naming.Selector) ([]string, error) {
+	schemas, err := r.GetSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	for _, schema := range schemas {
+		if !selector.Schema(schema) {
+			continue
+		}
+		schemaTables, err := r.GetAllTables(schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range schemaTables {
+			if selector.Table(schema, table) {
+				tables = append(tables, naming.Join(schema, table))
+			}
+		}
+	}
+
+	return tables, nil
+}
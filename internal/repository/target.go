@@ -1,17 +1,29 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pg/dts/internal/model"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// Conflict policies for applying inserts
+const (
+	// ConflictError fails the apply when an inserted row already exists
+	ConflictError = "error"
+	// ConflictIgnore skips inserted rows that already exist
+	ConflictIgnore = "ignore"
+)
+
 // TargetRepository handles target database operations
 type TargetRepository struct {
-	db *gorm.DB
+	db         *gorm.DB
+	onConflict string // Conflict policy for ApplyInsert, defaults to ConflictError
 }
 
 // NewTargetRepository creates a target repository
@@ -48,6 +60,135 @@ func NewTargetRepositoryFromTask(task *model.MigrationTask) (*TargetRepository,
 	return &TargetRepository{db: db}, nil
 }
 
+// NewTargetRepositoryFromDB creates a target repository from an existing GORM connection
+// Used when changes are applied back to the source database (reverse replication)
+func NewTargetRepositoryFromDB(db *gorm.DB) *TargetRepository {
+	return &TargetRepository{db: db}
+}
+
+// SetConflictPolicy sets the conflict policy used by ApplyInsert
+func (r *TargetRepository) SetConflictPolicy(policy string) error {
+	switch policy {
+	case "", ConflictError, ConflictIgnore:
+		r.onConflict = policy
+		return nil
+	default:
+		return fmt.Errorf("unsupported conflict policy: %s (supported: %s, %s)", policy, ConflictError, ConflictIgnore)
+	}
+}
+
+// Begin starts a transaction and returns a repository bound to it
+func (r *TargetRepository) Begin() (*TargetRepository, error) {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	return &TargetRepository{db: tx, onConflict: r.onConflict}, nil
+}
+
+// Commit commits the transaction the repository is bound to
+func (r *TargetRepository) Commit() error {
+	return r.db.Commit().Error
+}
+
+// Rollback rolls back the transaction the repository is bound to
+func (r *TargetRepository) Rollback() error {
+	return r.db.Rollback().Error
+}
+
+// preparedLog records the prepared transactions staged on the target, a row becomes visible when
+// its transaction commits, so that a commit can be told apart from a rollback once the prepared
+// transaction is gone
+const preparedLog = "prepared_xacts"
+
+// EnsurePreparedLog creates the table recording the prepared transactions staged on the target
+// The table is kept in the bookkeeping schema, out of the migrated schemas
+func (r *TargetRepository) EnsurePreparedLog() error {
+	err := r.db.Exec(createBookkeepingSchema()).Error
+	if err == nil {
+		err = r.db.Exec("CREATE TABLE IF NOT EXISTS " + bookkeepingTable(preparedLog) + " (gid text PRIMARY KEY, prepared_at timestamptz NOT NULL DEFAULT now())").Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create prepared transaction log: %w", err)
+	}
+	return nil
+}
+
+// PreparedState returns whether gid is prepared in the target database and whether it was committed
+func (r *TargetRepository) PreparedState(gid string) (prepared, committed bool, err error) {
+	var count int64
+	if err := r.db.Raw("SELECT count(*) FROM pg_prepared_xacts WHERE gid = ? AND database = current_database()", gid).Scan(&count).Error; err != nil {
+		return false, false, fmt.Errorf("failed to look up prepared transaction %s: %w", gid, err)
+	}
+	prepared = count > 0
+	if err := r.db.Raw("SELECT count(*) FROM "+bookkeepingTable(preparedLog)+" WHERE gid = ?", gid).Scan(&count).Error; err != nil {
+		return false, false, fmt.Errorf("failed to look up prepared transaction log: %w", err)
+	}
+	return prepared, count > 0, nil
+}
+
+// PrepareTransaction prepares the transaction the repository is bound to under gid
+// The gid is logged in the transaction, so that the log shows it once committed
+func (r *TargetRepository) PrepareTransaction(gid string) error {
+	if err := r.db.Exec("INSERT INTO "+bookkeepingTable(preparedLog)+" (gid) VALUES (?)", gid).Error; err != nil {
+		r.db.Rollback()
+		return fmt.Errorf("failed to log prepared transaction %s: %w", gid, err)
+	}
+	if err := r.db.Exec("PREPARE TRANSACTION " + quoteLiteral(gid)).Error; err != nil {
+		r.db.Rollback()
+		return fmt.Errorf("failed to prepare transaction %s: %w", gid, err)
+	}
+	// The session is no longer in a transaction, release the connection
+	r.db.Commit()
+	return nil
+}
+
+// CommitPrepared commits a prepared transaction
+// A missing gid is only accepted when the prepared transaction log shows it was committed before
+func (r *TargetRepository) CommitPrepared(gid string) error {
+	err := r.db.Exec("COMMIT PREPARED " + quoteLiteral(gid)).Error
+	if isPgError(err, "42704") { // undefined_object
+		if _, committed, lookupErr := r.PreparedState(gid); lookupErr != nil || committed {
+			return lookupErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to commit prepared transaction %s: %w", gid, err)
+	}
+	return nil
+}
+
+// RollbackPrepared rolls back a prepared transaction
+// A missing gid (already rolled back before a restart) is not an error, unless it was committed
+func (r *TargetRepository) RollbackPrepared(gid string) error {
+	err := r.db.Exec("ROLLBACK PREPARED " + quoteLiteral(gid)).Error
+	if isPgError(err, "42704") { // undefined_object
+		_, committed, lookupErr := r.PreparedState(gid)
+		if lookupErr != nil {
+			return lookupErr
+		}
+		if committed {
+			return fmt.Errorf("failed to roll back prepared transaction %s: it was committed", gid)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to roll back prepared transaction %s: %w", gid, err)
+	}
+	return nil
+}
+
+// quoteLiteral quotes a string literal for statements that take no parameters
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// isPgError returns whether err is a PostgreSQL error with the given SQLSTATE code
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
 // Close closes the connection
 func (r *TargetRepository) Close() error {
 	sqlDB, err := r.db.DB()
@@ -69,8 +210,8 @@ func (r *TargetRepository) CreateTable(tableInfo *model.TableInfo, suffix string
 
 	// Modify table name in DDL
 	ddl := strings.Replace(tableInfo.DDL,
-		fmt.Sprintf("%s.%s", tableInfo.Schema, tableInfo.Name),
-		fmt.Sprintf("%s.%s", tableInfo.Schema, targetTableName),
+		pgx.Identifier{tableInfo.Schema, tableInfo.Name}.Sanitize(),
+		pgx.Identifier{tableInfo.Schema, targetTableName}.Sanitize(),
 		1)
 
 	// Execute DDL
@@ -99,13 +240,9 @@ func (r *TargetRepository) CreateTable(tableInfo *model.TableInfo, suffix string
 
 // createIndex creates an index
 func (r *TargetRepository) createIndex(schema, tableName string, index model.IndexInfo, suffix string) error {
-	// Modify index name and table name
+	// Modify index name
 	indexName := index.Name + suffix
 	indexDDL := strings.Replace(index.DDL, index.Name, indexName, 1)
-	indexDDL = strings.Replace(indexDDL,
-		fmt.Sprintf("ON %s.%s", schema, tableName),
-		fmt.Sprintf("ON %s.%s", schema, tableName),
-		1)
 
 	return r.db.Exec(indexDDL).Error
 }
@@ -115,16 +252,10 @@ func (r *TargetRepository) createConstraint(schema, tableName string, constraint
 	var constraintDDL string
 
 	switch constraint.Type {
-	case "UNIQUE":
-		constraintDDL = fmt.Sprintf("ALTER TABLE %s.%s ADD CONSTRAINT %s UNIQUE (%s)",
-			schema, tableName, constraint.Name, strings.Join(constraint.Columns, ", "))
-	case "CHECK":
-		constraintDDL = fmt.Sprintf("ALTER TABLE %s.%s ADD CONSTRAINT %s CHECK (%s)",
-			schema, tableName, constraint.Name, constraint.Definition)
-	case "FOREIGN KEY":
-		// Foreign keys require more complex handling, simplified here
-		constraintDDL = fmt.Sprintf("ALTER TABLE %s.%s ADD CONSTRAINT %s %s",
-			schema, tableName, constraint.Name, constraint.Definition)
+	case "UNIQUE", "CHECK", "FOREIGN KEY", "EXCLUDE":
+		// Foreign keys keep referencing the source table name
+		constraintDDL = fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s",
+			pgx.Identifier{schema, tableName}.Sanitize(), pgx.Identifier{constraint.Name}.Sanitize(), constraint.Definition)
 	default:
 		return fmt.Errorf("unsupported constraint type: %s", constraint.Type)
 	}
@@ -135,7 +266,7 @@ func (r *TargetRepository) createConstraint(schema, tableName string, constraint
 // GetTableCount gets table row count
 func (r *TargetRepository) GetTableCount(schema, tableName string) (int64, error) {
 	var count int64
-	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s.%s`, schema, tableName)
+	query := "SELECT COUNT(*) FROM " + pgx.Identifier{schema, tableName}.Sanitize()
 	err := r.db.Raw(query).Scan(&count).Error
 	if err != nil {
 		return 0, fmt.Errorf("failed to get table count: %w", err)
@@ -143,101 +274,62 @@ func (r *TargetRepository) GetTableCount(schema, tableName string) (int64, error
 	return count, nil
 }
 
-// CopyData copies data
-func (r *TargetRepository) CopyData(sourceRepo *SourceRepository, sourceSchema, sourceTable, targetSchema, targetTable string) error {
-	// Get source table column information
-	tableInfo, err := sourceRepo.GetTableInfo(sourceSchema, sourceTable)
-	if err != nil {
-		return fmt.Errorf("failed to get table info: %w", err)
+// GetFilteredTableCount gets the number of rows of a table matching a predicate
+func (r *TargetRepository) GetFilteredTableCount(schema, tableName, predicate string) (int64, error) {
+	var count int64
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, pgx.Identifier{schema, tableName}.Sanitize(), predicate)
+	if err := r.db.Raw(query).Scan(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to get filtered table count: %w", err)
 	}
+	return count, nil
+}
 
-	// Build column name list
+// TransformTable changes a created target table to the shape produced by a column transformation
+// Cast columns change their type, then columns are renamed, dropped and added.
+// Statements are idempotent, so the table may already have been changed.
+func (r *TargetRepository) TransformTable(schema, tableName string, spec model.TableTransform) error {
 	var columns []string
-	for _, col := range tableInfo.Columns {
-		columns = append(columns, col.Name)
+	if err := r.db.Raw(`
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = ? AND table_name = ?`, schema, tableName).Scan(&columns).Error; err != nil {
+		return fmt.Errorf("failed to get columns of %s.%s: %w", schema, tableName, err)
+	}
+	existing := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		existing[col] = true
 	}
-	_ = strings.Join
-
-	// Use COPY command to copy data (reserved for future optimization)
-	// Simplified here to batch read + insert
-	// Need to get source database pgx.Conn connection
-	// Simplified implementation: use batch query and insert
-	return r.copyDataBatched(sourceRepo.db, sourceSchema, sourceTable, targetSchema, targetTable, columns)
-}
-
-// copyDataBatched copies data in batches
-func (r *TargetRepository) copyDataBatched(sourceDB *gorm.DB, sourceSchema, sourceTable, targetSchema, targetTable string, columns []string) error {
-	batchSize := 1000
-	offset := 0
-
-	for {
-		// Query a batch of data from source database
-		query := fmt.Sprintf("SELECT %s FROM %s.%s ORDER BY 1 LIMIT ? OFFSET ?",
-			strings.Join(columns, ", "), sourceSchema, sourceTable)
-
-		type Row map[string]interface{}
-		var rows []Row
-
-		// Use GORM to query
-		if err := sourceDB.Raw(query, batchSize, offset).Scan(&rows).Error; err != nil {
-			return fmt.Errorf("failed to query source: %w", err)
-		}
-
-		if len(rows) == 0 {
-			break
-		}
-
-		// Convert to batch insert format
-		batch := make([][]interface{}, len(rows))
-		for i, row := range rows {
-			values := make([]interface{}, len(columns))
-			for j, col := range columns {
-				values[j] = row[col]
-			}
-			batch[i] = values
-		}
 
-		// Batch insert into target database
-		if err := r.batchInsert(targetSchema, targetTable, columns, batch); err != nil {
-			return fmt.Errorf("failed to insert batch: %w", err)
+	table := pgx.Identifier{schema, tableName}.Sanitize()
+	var statements []string
+	for col, typ := range spec.Cast {
+		if existing[col] {
+			name := pgx.Identifier{col}.Sanitize()
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s", table, name, typ, name, typ))
 		}
-
-		// If batch size is less than batchSize, all data has been read
-		if len(batch) < batchSize {
-			break
+	}
+	for col, name := range spec.Rename {
+		// RENAME COLUMN has no IF EXISTS form
+		if existing[col] && !existing[name] {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, pgx.Identifier{col}.Sanitize(), pgx.Identifier{name}.Sanitize()))
 		}
-
-		offset += len(batch)
 	}
-
-	return nil
-}
-
-// batchInsert performs batch insert
-func (r *TargetRepository) batchInsert(schema, table string, columns []string, batch [][]interface{}) error {
-	if len(batch) == 0 {
-		return nil
+	for _, col := range spec.Drop {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s", table, pgx.Identifier{col}.Sanitize()))
 	}
-
-	// Build INSERT statement
-	placeholders := make([]string, len(batch))
-	args := make([]interface{}, 0, len(batch)*len(columns))
-
-	for i, row := range batch {
-		rowPlaceholders := make([]string, len(columns))
-		for j := range rowPlaceholders {
-			rowPlaceholders[j] = fmt.Sprintf("$%d", i*len(columns)+j+1)
-			args = append(args, row[j])
+	for _, add := range spec.Add {
+		typ := add.Type
+		if typ == "" {
+			typ = "text"
 		}
-		placeholders[i] = "(" + strings.Join(rowPlaceholders, ", ") + ")"
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, pgx.Identifier{add.Name}.Sanitize(), typ))
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES %s",
-		schema, table,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "))
-
-	return r.db.Exec(query, args...).Error
+	for _, stmt := range statements {
+		if err := r.db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to transform %s.%s: %w", schema, tableName, err)
+		}
+	}
+	return nil
 }
 
 // ApplyInsert applies insert operation
@@ -250,13 +342,16 @@ func (r *TargetRepository) ApplyInsert(schema, tableName string, values map[stri
 	placeholders := make([]string, 0, len(values))
 	i := 1
 	for k, v := range values {
-		cols = append(cols, k)
+		cols = append(cols, pgx.Identifier{k}.Sanitize())
 		args = append(args, v)
 		placeholders = append(placeholders, fmt.Sprintf("$%d", i))
 		i++
 	}
-	query := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)",
-		schema, tableName, strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		pgx.Identifier{schema, tableName}.Sanitize(), strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+	if r.onConflict == ConflictIgnore {
+		query += " ON CONFLICT DO NOTHING"
+	}
 	return r.db.Exec(query, args...).Error
 }
 
@@ -270,20 +365,51 @@ func (r *TargetRepository) ApplyUpdate(schema, tableName string, oldValues, newV
 	args := make([]interface{}, 0, len(newValues)+len(oldValues))
 	i := 1
 	for k, v := range newValues {
-		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", k, i))
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", pgx.Identifier{k}.Sanitize(), i))
 		args = append(args, v)
 		i++
 	}
 	for k, v := range oldValues {
-		whereClauses = append(whereClauses, fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", k, i))
+		whereClauses = append(whereClauses, fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", pgx.Identifier{k}.Sanitize(), i))
 		args = append(args, v)
 		i++
 	}
-	query := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s",
-		schema, tableName, strings.Join(setClauses, ", "), strings.Join(whereClauses, " AND "))
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		pgx.Identifier{schema, tableName}.Sanitize(), strings.Join(setClauses, ", "), strings.Join(whereClauses, " AND "))
 	return r.db.Exec(query, args...).Error
 }
 
+// ApplyUpsert applies an update, inserting the new row if no row matches the old values
+func (r *TargetRepository) ApplyUpsert(schema, tableName string, oldValues, newValues map[string]interface{}) error {
+	if len(newValues) == 0 || len(oldValues) == 0 {
+		return nil
+	}
+	setClauses := make([]string, 0, len(newValues))
+	whereClauses := make([]string, 0, len(oldValues))
+	args := make([]interface{}, 0, len(newValues)+len(oldValues))
+	i := 1
+	for k, v := range newValues {
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", pgx.Identifier{k}.Sanitize(), i))
+		args = append(args, v)
+		i++
+	}
+	for k, v := range oldValues {
+		whereClauses = append(whereClauses, fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", pgx.Identifier{k}.Sanitize(), i))
+		args = append(args, v)
+		i++
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		pgx.Identifier{schema, tableName}.Sanitize(), strings.Join(setClauses, ", "), strings.Join(whereClauses, " AND "))
+	result := r.db.Exec(query, args...)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return r.ApplyInsert(schema, tableName, newValues)
+}
+
 // ApplyDelete applies delete operation
 func (r *TargetRepository) ApplyDelete(schema, tableName string, values map[string]interface{}) error {
 	if len(values) == 0 {
@@ -293,10 +419,15 @@ func (r *TargetRepository) ApplyDelete(schema, tableName string, values map[stri
 	args := make([]interface{}, 0, len(values))
 	i := 1
 	for k, v := range values {
-		whereClauses = append(whereClauses, fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", k, i))
+		whereClauses = append(whereClauses, fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", pgx.Identifier{k}.Sanitize(), i))
 		args = append(args, v)
 		i++
 	}
-	query := fmt.Sprintf("DELETE FROM %s.%s WHERE %s", schema, tableName, strings.Join(whereClauses, " AND "))
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", pgx.Identifier{schema, tableName}.Sanitize(), strings.Join(whereClauses, " AND "))
 	return r.db.Exec(query, args...).Error
 }
+
+// ApplyTruncate applies truncate operation
+func (r *TargetRepository) ApplyTruncate(schema, tableName string) error {
+	return r.db.Exec("TRUNCATE TABLE " + pgx.Identifier{schema, tableName}.Sanitize()).Error
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pg/dts/internal/logger"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/state"
+)
+
+const (
+	// walSampleInterval is how often a running task samples the source WAL position
+	walSampleInterval = 10 * time.Second
+	// walSampleWindow is the period the WAL and apply rates are measured over
+	walSampleWindow = 5 * time.Minute
+	// minRateWindow is the shortest period a rate is computed from
+	minRateWindow = 30 * time.Second
+)
+
+// walMeter keeps the recent WAL position samples of a running task
+type walMeter struct {
+	mu      sync.Mutex
+	samples []model.WALPosition
+}
+
+// add records a sample and drops the samples older than walSampleWindow
+func (m *walMeter) add(sample *model.WALPosition) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = append(m.samples, *sample)
+	cutoff := sample.At.Add(-walSampleWindow)
+	drop := 0
+	for drop < len(m.samples)-1 && m.samples[drop].At.Before(cutoff) {
+		drop++
+	}
+	m.samples = m.samples[drop:]
+}
+
+// estimate fills in the WAL rates, the lag and the catch-up prediction
+func (m *walMeter) estimate(e *model.Estimate) {
+	m.mu.Lock()
+	samples := append([]model.WALPosition(nil), m.samples...)
+	m.mu.Unlock()
+	if len(samples) == 0 {
+		return
+	}
+
+	latest := samples[len(samples)-1]
+	if first := samples[0]; latest.At.Sub(first.At) >= minRateWindow {
+		e.WALBytesPerSec = float64(latest.Current-first.Current) / latest.At.Sub(first.At).Seconds()
+	}
+	if latest.Confirmed == nil {
+		return
+	}
+	e.LagBytes = max(latest.Current-*latest.Confirmed, 0)
+	if e.LagBytes <= model.CaughtUpLagBytes {
+		e.CatchUp = model.CatchUpCaughtUp
+		e.CatchUpMs = 0
+		return
+	}
+
+	// The apply rate is measured from the first sample taken after the forward stream started
+	var first *model.WALPosition
+	for i := range samples {
+		if samples[i].Confirmed != nil {
+			first = &samples[i]
+			break
+		}
+	}
+	elapsed := latest.At.Sub(first.At)
+	if elapsed < minRateWindow || e.WALBytesPerSec == 0 {
+		return
+	}
+	e.ApplyBytesPerSec = float64(*latest.Confirmed-*first.Confirmed) / elapsed.Seconds()
+	if e.ApplyBytesPerSec > e.WALBytesPerSec {
+		e.CatchUp = model.CatchUpCatchingUp
+		e.CatchUpMs = int64(float64(e.LagBytes) / (e.ApplyBytesPerSec - e.WALBytesPerSec) * 1000)
+		return
+	}
+	e.CatchUp = model.CatchUpFallingBehind
+}
+
+// sampleWAL samples the source WAL position of a running task until ctx is done
+func (s *MigrationService) sampleWAL(ctx context.Context, task *model.MigrationTask) {
+	meter := &walMeter{}
+	s.meterMu.Lock()
+	s.meters[task.ID] = meter
+	s.meterMu.Unlock()
+	defer func() {
+		s.meterMu.Lock()
+		if s.meters[task.ID] == meter {
+			delete(s.meters, task.ID)
+		}
+		s.meterMu.Unlock()
+	}()
+
+	ticker := time.NewTicker(walSampleInterval)
+	defer ticker.Stop()
+	for {
+		// Tasks feeding non-database sinks or not connected yet may fail to sample, they are retried
+		if sample, err := state.WALPosition(task); err == nil {
+			meter.add(sample)
+		} else {
+			logger.GetLogger().WithError(err).WithField("task_id", task.ID).Debug("Failed to sample WAL position")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EstimateTask estimates the remaining full sync time of a task and whether its incremental sync catches up
+// WAL rates are only known while the task runs in this process
+func (s *MigrationService) EstimateTask(id string) (*model.Estimate, error) {
+	task, err := s.taskRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &model.Estimate{FullSyncRemainingMs: -1, LagBytes: -1, CatchUp: model.CatchUpUnknown, CatchUpMs: -1}
+	chunks, err := s.fullSyncRepo.ListChunks(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if len(chunks) > 0 {
+		tables, _ := model.SummarizeProgress(chunks, now)
+		if remaining, rate, ok := model.EstimateFullSync(tables, now); ok {
+			eta := now.Add(remaining)
+			e.FullSyncRemainingMs = remaining.Milliseconds()
+			e.FullSyncETA = &eta
+			e.FullSyncBytesPerSec = rate
+		}
+	} else if progressForState(model.StateType(task.State)) == 100 {
+		// Full sync is over, or was skipped for a non-database sink
+		e.FullSyncRemainingMs = 0
+	}
+
+	s.meterMu.Lock()
+	meter := s.meters[id]
+	s.meterMu.Unlock()
+	if meter != nil {
+		meter.estimate(e)
+	}
+	return e, nil
+}
@@ -3,30 +3,51 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pg/dts/internal/logger"
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
 	"github.com/pg/dts/internal/repository"
 	"github.com/pg/dts/internal/state"
+	"github.com/pg/dts/internal/transform"
+	"github.com/pg/dts/internal/wal"
 	"gorm.io/gorm"
 )
 
 // MigrationService provides migration service
 type MigrationService struct {
-	taskRepo    *repository.MigrationRepository
-	db          *gorm.DB
-	taskManager *TaskManager
+	taskRepo     *repository.MigrationRepository
+	fullSyncRepo *repository.FullSyncRepository
+	schemaRepo   *repository.SchemaRepository
+	db           *gorm.DB
+	taskManager  *TaskManager
+
+	replays  map[string]*ReplayStatus // key: task ID, value: status of the latest archive replay
+	replayMu sync.Mutex               // protects concurrent access to replays
+
+	meters  map[string]*walMeter // key: task ID, value: WAL position samples of the running task
+	meterMu sync.Mutex           // protects concurrent access to meters
 }
 
 // NewMigrationService creates a new migration service
 func NewMigrationService(db *gorm.DB) *MigrationService {
+	fullSyncRepo := repository.NewFullSyncRepository(db)
+	schemaRepo := repository.NewSchemaRepository(db)
+
 	return &MigrationService{
-		taskRepo:    repository.NewMigrationRepository(db),
-		db:          db,
-		taskManager: NewTaskManager(),
+		taskRepo:     repository.NewMigrationRepository(db),
+		fullSyncRepo: fullSyncRepo,
+		schemaRepo:   schemaRepo,
+		db:           db,
+		taskManager:  NewTaskManager(),
+		replays:      make(map[string]*ReplayStatus),
+		meters:       make(map[string]*walMeter),
 	}
 }
 
@@ -42,6 +63,35 @@ func (s *MigrationService) CreateTaskWithID(id string, req *CreateTaskRequest) (
 		return nil, fmt.Errorf("task with id %s already exists", id)
 	}
 
+	task, err := buildTask(req)
+	if err != nil {
+		return nil, err
+	}
+	task.ID = id
+
+	if err := s.taskRepo.Create(task); err != nil {
+		return nil, fmt.Errorf("failed to create task: %w", err)
+	}
+
+	return task, nil
+}
+
+// CreateTask creates a migration task (auto-generates ID)
+func (s *MigrationService) CreateTask(req *CreateTaskRequest) (*model.MigrationTask, error) {
+	task, err := buildTask(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.taskRepo.Create(task); err != nil {
+		return nil, fmt.Errorf("failed to create task: %w", err)
+	}
+
+	return task, nil
+}
+
+// buildTask validates a request and serializes its configuration into a new task in the init state
+func buildTask(req *CreateTaskRequest) (*model.MigrationTask, error) {
 	// Serialize database configuration
 	sourceDBJSON, err := json.Marshal(req.SourceDB)
 	if err != nil {
@@ -53,51 +103,82 @@ func (s *MigrationService) CreateTaskWithID(id string, req *CreateTaskRequest) (
 		return nil, fmt.Errorf("failed to marshal target db config: %w", err)
 	}
 
-	tablesJSON, err := json.Marshal(req.Tables)
+	tables, selectionJSON, err := selectTables(req)
+	if err != nil {
+		return nil, err
+	}
+	tablesJSON, err := json.Marshal(tables)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal tables: %w", err)
 	}
 
-	databaseType := req.DatabaseType
-	if databaseType == "" {
-		databaseType = "postgresql" // Default to PostgreSQL
+	var archiveJSON []byte
+	if req.Archive != nil {
+		archiveJSON, err = json.Marshal(req.Archive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal archive config: %w", err)
+		}
 	}
 
-	task := &model.MigrationTask{
-		ID:           id,
-		DatabaseType: databaseType,
-		SourceDB:     string(sourceDBJSON),
-		TargetDB:     string(targetDBJSON),
-		Tables:       string(tablesJSON),
-		TableSuffix:  req.TableSuffix,
-		State:        model.StateInit.String(),
-		Progress:     0,
-		ErrorMessage: "",
+	var sinkJSON []byte
+	if req.Sink != nil {
+		if !req.Sink.WritesDatabase() && req.Fallback {
+			return nil, fmt.Errorf("fallback requires the postgresql sink")
+		}
+		if !req.Sink.WritesDatabase() && req.TwoPhase {
+			return nil, fmt.Errorf("two_phase requires the postgresql sink")
+		}
+		sinkJSON, err = json.Marshal(req.Sink)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal sink config: %w", err)
+		}
 	}
 
-	if err := s.taskRepo.Create(task); err != nil {
-		return nil, fmt.Errorf("failed to create task: %w", err)
+	var partitioningJSON []byte
+	if len(req.Partitioning) > 0 {
+		partitioningJSON, err = json.Marshal(req.Partitioning)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal partitioning config: %w", err)
+		}
 	}
 
-	return task, nil
-}
+	if err := checkSubsets(req); err != nil {
+		return nil, err
+	}
+	var fullSyncJSON []byte
+	if req.FullSync != nil {
+		switch req.FullSync.Method {
+		case "", model.CopyMethodCopy, model.CopyMethodInsert:
+		default:
+			return nil, fmt.Errorf("invalid full sync method %q, expected copy or insert", req.FullSync.Method)
+		}
+		fullSyncJSON, err = json.Marshal(req.FullSync)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal full sync config: %w", err)
+		}
+	}
 
-// CreateTask creates a migration task (auto-generates ID)
-func (s *MigrationService) CreateTask(req *CreateTaskRequest) (*model.MigrationTask, error) {
-	// Serialize database configuration
-	sourceDBJSON, err := json.Marshal(req.SourceDB)
+	var throttleJSON []byte
+	if req.Throttle != nil {
+		throttleJSON, err = json.Marshal(req.Throttle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal throttle config: %w", err)
+		}
+	}
+
+	transformJSON, maskingJSON, err := marshalTransforms(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal source db config: %w", err)
+		return nil, err
 	}
 
-	targetDBJSON, err := json.Marshal(req.TargetDB)
+	nameMappingJSON, err := marshalNameMapping(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal target db config: %w", err)
+		return nil, err
 	}
 
-	tablesJSON, err := json.Marshal(req.Tables)
+	ddlJSON, err := marshalDDL(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal tables: %w", err)
+		return nil, err
 	}
 
 	databaseType := req.DatabaseType
@@ -111,16 +192,176 @@ func (s *MigrationService) CreateTask(req *CreateTaskRequest) (*model.MigrationT
 		TargetDB:     string(targetDBJSON),
 		Tables:       string(tablesJSON),
 		TableSuffix:  req.TableSuffix,
+		Fallback:     req.Fallback,
+		TwoPhase:     req.TwoPhase,
+		Archive:      string(archiveJSON),
+		Sink:         string(sinkJSON),
+		Partitioning: string(partitioningJSON),
+		FullSync:     string(fullSyncJSON),
+		Throttle:     string(throttleJSON),
+		Transform:    string(transformJSON),
+		Masking:      string(maskingJSON),
+		NameMapping:  string(nameMappingJSON),
+		Selection:    string(selectionJSON),
+		DDL:          string(ddlJSON),
 		State:        model.StateInit.String(),
 		Progress:     0,
 		ErrorMessage: "",
 	}
 
-	if err := s.taskRepo.Create(task); err != nil {
-		return nil, fmt.Errorf("failed to create task: %w", err)
+	return task, nil
+}
+
+// marshalTransforms validates and serializes the column transformations and masking of a request
+// Neither can be combined with fallback, the reverse stream would write the changed values back to the source.
+// Masking cannot be combined with the archive, which stores changes before they are masked.
+func marshalTransforms(req *CreateTaskRequest) ([]byte, []byte, error) {
+	if len(req.Transform) == 0 && req.Masking == nil {
+		return nil, nil, nil
+	}
+	if req.Fallback {
+		return nil, nil, fmt.Errorf("fallback cannot be combined with transform or masking")
+	}
+	if req.Archive != nil && req.Masking != nil {
+		return nil, nil, fmt.Errorf("archive cannot be combined with masking, archived changes are not masked")
+	}
+	set, err := transform.NewSet(req.Transform)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := set.AddMasking(req.Masking, ""); err != nil {
+		return nil, nil, err
 	}
 
-	return task, nil
+	var transformJSON, maskingJSON []byte
+	if len(req.Transform) > 0 {
+		transformJSON, err = json.Marshal(req.Transform)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal transform config: %w", err)
+		}
+	}
+	if req.Masking != nil {
+		maskingJSON, err = json.Marshal(req.Masking)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal masking config: %w", err)
+		}
+	}
+	return transformJSON, maskingJSON, nil
+}
+
+// checkSubsets validates the subset predicates of a request
+// The change stream evaluates a predicate as a transform expression and validation evaluates it on
+// both sides, so it may only use columns the transformation and masking copy unchanged. Each
+// predicate is explained on the source to catch SQL errors before the task runs.
+func checkSubsets(req *CreateTaskRequest) error {
+	if req.FullSync == nil || len(req.FullSync.Subset) == 0 {
+		return nil
+	}
+	for name, predicate := range req.FullSync.Subset {
+		expr, err := transform.ParseExpr(predicate)
+		if err != nil {
+			return fmt.Errorf("invalid subset predicate of %s: %w", name, err)
+		}
+		spec, rules := tableTransform(req, name)
+		for _, col := range expr.Columns() {
+			_, renamed := spec.Rename[col]
+			_, cast := spec.Cast[col]
+			_, masked := rules[col]
+			if renamed || cast || masked || slices.Contains(spec.Drop, col) {
+				return fmt.Errorf("subset predicate of %s uses column %s, which is not copied unchanged", name, col)
+			}
+		}
+	}
+
+	sourceRepo, err := repository.NewSourceRepository(req.SourceDB.DSN())
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer sourceRepo.Close()
+	for name, predicate := range req.FullSync.Subset {
+		schema, table := naming.Split(name)
+		if err := sourceRepo.ExplainPredicate(schema, table, predicate); err != nil {
+			return fmt.Errorf("invalid subset predicate of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// tableTransform returns the transformation and masking rules a request declares for a table
+func tableTransform(req *CreateTaskRequest, name string) (model.TableTransform, map[string]model.MaskRule) {
+	schema, table := naming.Split(name)
+	var spec model.TableTransform
+	for key, s := range req.Transform {
+		if keySchema, keyTable := naming.Split(key); keySchema == schema && keyTable == table {
+			spec = s
+		}
+	}
+	var rules map[string]model.MaskRule
+	if req.Masking != nil {
+		for key, r := range req.Masking.Tables {
+			if keySchema, keyTable := naming.Split(key); keySchema == schema && keyTable == table {
+				rules = r
+			}
+		}
+	}
+	return spec, rules
+}
+
+// selectTables validates and serializes the selection of a request and drops the listed tables it does not select
+func selectTables(req *CreateTaskRequest) ([]string, []byte, error) {
+	if req.Selection == nil {
+		return req.Tables, nil, nil
+	}
+	selector, err := naming.NewSelector(req.Selection)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tables []string
+	for _, table := range req.Tables {
+		if selector.Table(naming.Split(table)) {
+			tables = append(tables, table)
+		}
+	}
+	if len(tables) == 0 {
+		return nil, nil, fmt.Errorf("selection excludes every table of the task")
+	}
+	selectionJSON, err := json.Marshal(req.Selection)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal selection: %w", err)
+	}
+	return tables, selectionJSON, nil
+}
+
+// marshalDDL validates and serializes the schema creation configuration of a request
+func marshalDDL(req *CreateTaskRequest) ([]byte, error) {
+	if req.DDL == nil {
+		return nil, nil
+	}
+	switch req.DDL.OnError {
+	case "", model.DDLOnErrorFail, model.DDLOnErrorContinue:
+	default:
+		return nil, fmt.Errorf("invalid ddl on_error policy %q, expected fail or continue", req.DDL.OnError)
+	}
+	ddlJSON, err := json.Marshal(req.DDL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ddl config: %w", err)
+	}
+	return ddlJSON, nil
+}
+
+// marshalNameMapping validates and serializes the name mapping of a request
+func marshalNameMapping(req *CreateTaskRequest) ([]byte, error) {
+	if req.NameMapping == nil {
+		return nil, nil
+	}
+	if _, err := naming.New(req.NameMapping); err != nil {
+		return nil, err
+	}
+	nameMappingJSON, err := json.Marshal(req.NameMapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal name mapping: %w", err)
+	}
+	return nameMappingJSON, nil
 }
 
 // GetTask gets a task
@@ -177,7 +418,14 @@ func (s *MigrationService) StartTask(ctx context.Context, id string) error {
 	log.WithField("task_id", id).Info("Task added to task manager")
 
 	// Create state machine
-	sm := state.NewStateMachine(task)
+	sm := state.NewStateMachine(task, &state.Repositories{FullSync: s.fullSyncRepo, Schema: s.schemaRepo})
+
+	// The state machine outlives the request that started it; it is cancelled when the task
+	// is paused, stopped or removed
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s.taskManager.SetCancel(id, cancel)
+	done := s.taskManager.Started(id)
+	go s.sampleWAL(ctx, task)
 
 	// Execute state machine
 	go func() {
@@ -190,6 +438,9 @@ func (s *MigrationService) StartTask(ctx context.Context, id string) error {
 				// Log cleanup error but don't affect task state
 				log.WithError(err).Warn("Failed to cleanup task")
 			}
+			// A held snapshot keeps the source from removing old rows, a resumed full sync exports a new one
+			state.ReleaseCopySnapshot(id)
+			close(done)
 		}()
 
 		// Simple retry mechanism configuration
@@ -199,12 +450,14 @@ func (s *MigrationService) StartTask(ctx context.Context, id string) error {
 		for {
 			// Get current state
 			currentState := sm.GetCurrentState()
-			if currentState != nil {
-				log.WithFields(map[string]interface{}{
-					"task_id": id,
-					"state":   currentState.Name(),
-				}).Info("Executing state")
+			if currentState == nil {
+				return
 			}
+			prevStateName := currentState.Name()
+			log.WithFields(map[string]interface{}{
+				"task_id": id,
+				"state":   prevStateName,
+			}).Info("Executing state")
 
 			// Execute current state with retry
 			var execErr error
@@ -227,12 +480,17 @@ func (s *MigrationService) StartTask(ctx context.Context, id string) error {
 				select {
 				case <-ctx.Done():
 					log.WithField("task_id", id).Warn("Context cancelled")
-					s.taskRepo.UpdateState(task.ID, model.StateFailed, ctx.Err().Error())
 					return
 				case <-time.After(time.Duration(delay) * time.Millisecond):
 				}
 			}
 
+			if execErr != nil && ctx.Err() != nil {
+				// Interrupted by pause, stop or cancel, which have already set the task state
+				log.WithField("task_id", id).Info("State execution interrupted")
+				return
+			}
+
 			if execErr != nil {
 				// Update task to failed state
 				log.WithError(execErr).WithField("task_id", id).Error("State execution failed")
@@ -242,32 +500,50 @@ func (s *MigrationService) StartTask(ctx context.Context, id string) error {
 				return
 			}
 
-			// Update task state
+			// Update task state (only when the state machine actually moved, so that
+			// transitions triggered through the API are not overwritten)
 			currentState = sm.GetCurrentState()
-			if currentState != nil {
-				newState := model.StateType(currentState.Name())
+			newState := model.StateType(currentState.Name())
+			if currentState.Name() != prevStateName {
 				log.WithFields(map[string]interface{}{
 					"task_id":   id,
 					"new_state": newState.String(),
 				}).Info("State transition completed")
 				s.taskRepo.UpdateState(task.ID, newState, "")
-				// Coarse-grained progress: advance by state
-				s.taskRepo.UpdateProgress(task.ID, progressForState(newState))
+				// Full sync reports its own progress, weighted by table size
+				if newState != model.StateFullSync {
+					s.taskRepo.UpdateProgress(task.ID, progressForState(newState))
+				}
 			}
 
 			// Check if reached terminal state
-			if task.State == model.StateCompleted.String() || task.State == model.StateFailed.String() {
+			if newState.IsTerminal() {
 				log.WithFields(map[string]interface{}{
 					"task_id":     id,
-					"final_state": task.State,
+					"final_state": newState.String(),
 				}).Info("Task reached terminal state")
 				// Task completed, clean up connections (defer will also execute, but explicit call here ensures cleanup)
 				task.CloseAllConnections()
 				return
 			}
 
-			// Reload task to get latest state
-			task, _ = s.taskRepo.GetByID(id)
+			// Reload task to pick up transitions triggered externally (switch, finalize, pause, stop)
+			latest, err := s.taskRepo.GetByID(id)
+			if err != nil {
+				log.WithError(err).WithField("task_id", id).Warn("Failed to reload task")
+				continue
+			}
+			latestState := model.StateType(latest.State)
+			if latestState.IsTerminal() || latestState == model.StatePaused {
+				log.WithFields(map[string]interface{}{
+					"task_id":     id,
+					"final_state": latest.State,
+				}).Info("Task stopped externally")
+				return
+			}
+			if latest.State != newState.String() {
+				sm.SetState(latest.State)
+			}
 		}
 	}()
 
@@ -290,24 +566,11 @@ func isRetryable(err error) bool {
 	return false
 }
 
-// progressForState provides coarse-grained progress for different states
+// progressForState provides progress for the states outside full sync
+// Progress measures the data copied, so it is 0 before full sync and 100 once full sync is over
 func progressForState(s model.StateType) int {
 	switch s {
-	case model.StateInit:
-		return 0
-	case model.StateConnect:
-		return 10
-	case model.StateCreateTables:
-		return 20
-	case model.StateFullSync:
-		return 50
-	case model.StateIncSync:
-		return 70
-	case model.StateWaiting:
-		return 80
-	case model.StateValidating:
-		return 95
-	case model.StateCompleted:
+	case model.StateCreateIndexes, model.StateIncSync, model.StateWaiting, model.StateValidating, model.StateFallback, model.StateCompleted:
 		return 100
 	default:
 		return 0
@@ -325,8 +588,20 @@ func (s *MigrationService) PauseTask(id string) error {
 	if currentState.IsTerminal() {
 		return fmt.Errorf("cannot pause task in terminal state: %s", currentState)
 	}
+	if currentState == model.StatePaused {
+		return fmt.Errorf("task is already paused")
+	}
 
-	return s.taskRepo.UpdateState(id, model.StatePaused, "")
+	// Remember where to resume, then interrupt the running state
+	// An interrupted full sync resumes from its persisted chunk progress
+	if err := s.taskRepo.UpdatePausedFrom(id, currentState); err != nil {
+		return err
+	}
+	if err := s.taskRepo.UpdateState(id, model.StatePaused, ""); err != nil {
+		return err
+	}
+	s.taskManager.Cancel(id)
+	return nil
 }
 
 // ResumeTask resumes a task
@@ -339,6 +614,18 @@ func (s *MigrationService) ResumeTask(ctx context.Context, id string) error {
 	if task.State != model.StatePaused.String() {
 		return fmt.Errorf("task is not paused")
 	}
+	if _, running := s.taskManager.GetTask(id); running {
+		return fmt.Errorf("task %s is still stopping, retry shortly", id)
+	}
+
+	// Resume in the state the task was paused in
+	resumeState := model.StateType(task.PausedFrom)
+	if resumeState == "" {
+		resumeState = model.StateConnect
+	}
+	if err := s.taskRepo.UpdateState(id, resumeState, ""); err != nil {
+		return err
+	}
 
 	// Resume task
 	return s.StartTask(ctx, id)
@@ -351,26 +638,230 @@ func (s *MigrationService) DeleteTask(id string) error {
 
 	// Remove from task manager
 	s.taskManager.RemoveTask(id)
+	state.ReleaseCopySnapshot(id)
 
 	// Delete from database
+	if err := s.fullSyncRepo.DeleteChunks(id); err != nil {
+		return err
+	}
+	if err := s.schemaRepo.DeleteStatements(id); err != nil {
+		return err
+	}
 	return s.taskRepo.Delete(id)
 }
 
+// ErrSchemaDrift is returned when switchover is refused because the target schema differs from the source
+var ErrSchemaDrift = errors.New("target schema differs from source")
+
 // TriggerSwitchover triggers switchover
-// Only allowed when task is in Waiting state
-func (s *MigrationService) TriggerSwitchover(ctx context.Context, id string) error {
+// Only allowed when task is in Waiting state. Unless forced, switchover is refused while the
+// structure of a target table differs from the source; the diff is returned either way. With
+// fallback, reverse replication is set up before it returns.
+func (s *MigrationService) TriggerSwitchover(ctx context.Context, id string, force bool) (*model.SchemaDiff, error) {
 	task, err := s.taskRepo.GetByID(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if task is in Waiting state
 	if task.State != string(model.StateWaiting) {
-		return fmt.Errorf("task must be in 'waiting' state to perform switchover. Current state: %s", task.State)
+		return nil, fmt.Errorf("task must be in 'waiting' state to perform switchover. Current state: %s", task.State)
+	}
+
+	// Catch schema drift on either side since the tables were created
+	diff, err := s.DiffSchema(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare schema: %w", err)
+	}
+	if diff != nil && !diff.Empty() && !force {
+		return diff, fmt.Errorf("%w in %d tables", ErrSchemaDrift, len(diff.Tables))
+	}
+
+	// A task falling back captures target changes from now on, before applications move to the target
+	if task.Fallback {
+		if running, ok := s.taskManager.GetTask(id); ok {
+			task = running
+		} else {
+			defer task.CloseAllConnections()
+		}
+		if err := state.PrepareFallback(ctx, task); err != nil {
+			return diff, fmt.Errorf("failed to prepare fallback: %w", err)
+		}
 	}
 
 	// Transition from Waiting to Validating state
-	return s.taskRepo.UpdateState(id, model.StateValidating, "")
+	return diff, s.taskRepo.UpdateState(id, model.StateValidating, "")
+}
+
+// DiffSchema compares the structure of a task's source tables with their target tables
+// Returns nil when changes do not go to a PostgreSQL target
+func (s *MigrationService) DiffSchema(id string) (*model.SchemaDiff, error) {
+	task, err := s.taskRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	sinkConfig, err := repository.ParseSinkConfig(task)
+	if err != nil {
+		return nil, err
+	}
+	if !sinkConfig.WritesDatabase() {
+		return nil, nil
+	}
+
+	// Use the connections of the running task, a stopped task connects just for the diff
+	if running, ok := s.taskManager.GetTask(id); ok {
+		task = running
+	} else {
+		defer task.CloseAllConnections()
+	}
+	return state.DiffSchema(task)
+}
+
+// FinalizeTask ends the fallback period after switchover
+// Only allowed when task is in Fallback state, stops reverse replication and completes the task
+func (s *MigrationService) FinalizeTask(id string) error {
+	task, err := s.taskRepo.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if task.State != string(model.StateFallback) {
+		return fmt.Errorf("task must be in 'fallback' state to finalize. Current state: %s", task.State)
+	}
+
+	// Stop the state machine first, otherwise the fallback loop could recreate the reverse slot
+	// and publication after they are dropped. Its exit closes the reverse stream.
+	s.taskManager.Stop(id)
+	defer task.CloseAllConnections()
+
+	if err := state.StopReverseReplication(task); err != nil {
+		return fmt.Errorf("failed to stop reverse replication: %w", err)
+	}
+
+	return s.taskRepo.UpdateState(id, model.StateCompleted, "")
+}
+
+// ListMarkers lists the logical decoding markers applied by a running task's forward or reverse stream
+// Only markers whose prefix starts with prefix are returned
+func (s *MigrationService) ListMarkers(id, stream, prefix string) ([]wal.Marker, error) {
+	if stream == "" {
+		stream = "forward"
+	}
+	if stream != "forward" && stream != "reverse" {
+		return nil, fmt.Errorf("unsupported stream: %s (supported: forward, reverse)", stream)
+	}
+
+	task, ok := s.taskManager.GetTask(id)
+	if !ok {
+		return nil, fmt.Errorf("task %s is not running", id)
+	}
+	return state.StreamMarkers(task, stream, prefix)
+}
+
+// TaskProgress represents the progress of a task's full sync and deferred index creation
+type TaskProgress struct {
+	State    string                `json:"state"`
+	Progress int                   `json:"progress"` // 0-100, tables weighted by estimated rows
+	Tables   []model.TableProgress `json:"tables"`
+	PreData  model.SectionProgress `json:"pre_data"`  // Schemas, types, tables and functions created before full sync
+	PostData model.SectionProgress `json:"post_data"` // Indexes, constraints and triggers created after full sync
+}
+
+// GetProgress returns a task's overall progress and the full sync progress of every table
+func (s *MigrationService) GetProgress(id string) (*TaskProgress, error) {
+	task, err := s.taskRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := s.fullSyncRepo.ListChunks(id)
+	if err != nil {
+		return nil, err
+	}
+
+	preData, err := s.schemaRepo.ListStatements(id, model.SectionPreData)
+	if err != nil {
+		return nil, err
+	}
+	postData, err := s.schemaRepo.ListStatements(id, model.SectionPostData)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, _ := model.SummarizeProgress(chunks, time.Now())
+	if tables == nil {
+		tables = []model.TableProgress{}
+	}
+	return &TaskProgress{
+		State:    task.State,
+		Progress: task.Progress,
+		Tables:   tables,
+		PreData:  model.SummarizeSection(preData),
+		PostData: model.SummarizeSection(postData),
+	}, nil
+}
+
+// ListSchemaStatements lists the DDL statements run on a task's target, optionally only those of a section or with a status
+func (s *MigrationService) ListSchemaStatements(id, section, status string) ([]model.SchemaStatement, error) {
+	if _, err := s.taskRepo.GetByID(id); err != nil {
+		return nil, err
+	}
+	return s.schemaRepo.ListTaskStatements(id, section, status)
+}
+
+// ThrottleUpdate represents a change of a task's rate limits, nil fields keep their current value
+type ThrottleUpdate struct {
+	FullSyncRowsPerSec   *int64 `json:"full_sync_rows_per_sec"`
+	FullSyncBytesPerSec  *int64 `json:"full_sync_bytes_per_sec"`
+	ApplyRowsPerSec      *int64 `json:"apply_rows_per_sec"`
+	ApplyBytesPerSec     *int64 `json:"apply_bytes_per_sec"`
+	MaxSourceConnections *int   `json:"max_source_connections"`
+}
+
+// UpdateThrottle changes a task's rate limits
+// The limits are stored with the task and applied immediately if the task is running
+func (s *MigrationService) UpdateThrottle(id string, update *ThrottleUpdate) (*model.ThrottleConfig, error) {
+	task, err := s.taskRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := repository.ParseThrottleConfig(task)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range []*int64{update.FullSyncRowsPerSec, update.FullSyncBytesPerSec, update.ApplyRowsPerSec, update.ApplyBytesPerSec} {
+		if v != nil && *v < 0 {
+			return nil, fmt.Errorf("rate limits must not be negative")
+		}
+	}
+	if update.MaxSourceConnections != nil && *update.MaxSourceConnections < 0 {
+		return nil, fmt.Errorf("max_source_connections must not be negative")
+	}
+	if update.FullSyncRowsPerSec != nil {
+		cfg.FullSyncRowsPerSec = *update.FullSyncRowsPerSec
+	}
+	if update.FullSyncBytesPerSec != nil {
+		cfg.FullSyncBytesPerSec = *update.FullSyncBytesPerSec
+	}
+	if update.ApplyRowsPerSec != nil {
+		cfg.ApplyRowsPerSec = *update.ApplyRowsPerSec
+	}
+	if update.ApplyBytesPerSec != nil {
+		cfg.ApplyBytesPerSec = *update.ApplyBytesPerSec
+	}
+	if update.MaxSourceConnections != nil {
+		cfg.MaxSourceConnections = *update.MaxSourceConnections
+	}
+
+	if err := s.taskRepo.UpdateThrottle(id, cfg); err != nil {
+		return nil, fmt.Errorf("failed to update throttle: %w", err)
+	}
+	if running, ok := s.taskManager.GetTask(id); ok {
+		if err := state.UpdateThrottle(running, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
 }
 
 // StopTask stops a task (task remains, just stops running)
@@ -411,9 +902,21 @@ func (s *MigrationService) CancelTask(id string) error {
 
 // CreateTaskRequest represents a create task request
 type CreateTaskRequest struct {
-	DatabaseType string        `json:"database_type"` // postgresql, mysql, etc.
-	SourceDB     model.DBConfig `json:"source_db"`
-	TargetDB     model.DBConfig `json:"target_db"`
-	Tables       []string      `json:"tables"`
-	TableSuffix  string        `json:"table_suffix"`
+	DatabaseType string                           `json:"database_type"` // postgresql, mysql, etc.
+	SourceDB     model.DBConfig                   `json:"source_db"`
+	TargetDB     model.DBConfig                   `json:"target_db"`
+	Tables       []string                         `json:"tables"`
+	TableSuffix  string                           `json:"table_suffix"`
+	Fallback     bool                             `json:"fallback"`               // Stream target changes back to source after switchover until finalized
+	TwoPhase     bool                             `json:"two_phase"`              // Decode prepared transactions and stage them as prepared transactions on the target
+	Archive      *model.ArchiveConfig             `json:"archive,omitempty"`      // Optional change stream archive to local files
+	Sink         *model.SinkConfig                `json:"sink,omitempty"`         // Optional change sink, defaults to the PostgreSQL target
+	Partitioning map[string]model.PartitionConfig `json:"partitioning,omitempty"` // Optional target partitioning overrides by table
+	FullSync     *model.FullSyncConfig            `json:"full_sync,omitempty"`    // Optional full sync parallelism and chunking
+	Throttle     *model.ThrottleConfig            `json:"throttle,omitempty"`     // Optional initial rate limits, adjustable at runtime
+	Transform    map[string]model.TableTransform  `json:"transform,omitempty"`    // Optional column transformations by source table
+	Masking      *model.MaskingConfig             `json:"masking,omitempty"`      // Optional column masking for non-production targets
+	NameMapping  *model.NameMapping               `json:"name_mapping,omitempty"` // Optional target names of databases, schemas and tables
+	Selection    *model.TableSelection            `json:"selection,omitempty"`    // Optional database, schema and table filters
+	DDL          *model.DDLConfig                 `json:"ddl,omitempty"`          // Optional schema creation error policy
 }
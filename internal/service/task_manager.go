@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"sync"
 
 	"github.com/pg/dts/internal/model"
@@ -8,14 +9,18 @@ import (
 
 // TaskManager manages all running migration tasks
 type TaskManager struct {
-	tasks map[string]*model.MigrationTask // key: task ID, value: MigrationTask
-	mu    sync.RWMutex                    // protects concurrent access to tasks
+	tasks   map[string]*model.MigrationTask // key: task ID, value: MigrationTask
+	cancels map[string]context.CancelFunc   // key: task ID, value: cancels the task's state machine
+	done    map[string]chan struct{}        // key: task ID, value: closed when the task's state machine exits
+	mu      sync.RWMutex                    // protects concurrent access to tasks
 }
 
 // NewTaskManager creates a new task manager
 func NewTaskManager() *TaskManager {
 	return &TaskManager{
-		tasks: make(map[string]*model.MigrationTask),
+		tasks:   make(map[string]*model.MigrationTask),
+		cancels: make(map[string]context.CancelFunc),
+		done:    make(map[string]chan struct{}),
 	}
 }
 
@@ -26,6 +31,47 @@ func (tm *TaskManager) AddTask(task *model.MigrationTask) {
 	tm.tasks[task.ID] = task
 }
 
+// SetCancel registers the function that cancels a running task's state machine
+func (tm *TaskManager) SetCancel(taskID string, cancel context.CancelFunc) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.cancels[taskID] = cancel
+}
+
+// Started registers a running task's state machine and returns the channel to close when it exits
+func (tm *TaskManager) Started(taskID string) chan struct{} {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	done := make(chan struct{})
+	tm.done[taskID] = done
+	return done
+}
+
+// Stop cancels a running task's state machine and waits for it to exit
+func (tm *TaskManager) Stop(taskID string) {
+	tm.mu.Lock()
+	done := tm.done[taskID]
+	if cancel, ok := tm.cancels[taskID]; ok {
+		cancel()
+		delete(tm.cancels, taskID)
+	}
+	tm.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Cancel cancels a running task's state machine, interrupting the state being executed
+func (tm *TaskManager) Cancel(taskID string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if cancel, ok := tm.cancels[taskID]; ok {
+		cancel()
+		delete(tm.cancels, taskID)
+	}
+}
+
 // GetTask gets a task
 func (tm *TaskManager) GetTask(taskID string) (*model.MigrationTask, bool) {
 	tm.mu.RLock()
@@ -39,6 +85,13 @@ func (tm *TaskManager) RemoveTask(taskID string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	if cancel, ok := tm.cancels[taskID]; ok {
+		cancel()
+		delete(tm.cancels, taskID)
+	}
+
+	delete(tm.done, taskID)
+
 	task, ok := tm.tasks[taskID]
 	if !ok {
 		return nil // Task does not exist, no need to process
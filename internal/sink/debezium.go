@@ -0,0 +1,206 @@
+package sink
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pg/dts/internal/wal"
+)
+
+// debeziumEvent is a change event in the Debezium JSON envelope with schemas enabled
+type debeziumEvent struct {
+	Schema  debeziumField   `json:"schema"`
+	Payload debeziumPayload `json:"payload"`
+}
+
+// debeziumField describes a value in the Kafka Connect schema format used by Debezium
+type debeziumField struct {
+	Type     string          `json:"type"`
+	Fields   []debeziumField `json:"fields,omitempty"`
+	Optional bool            `json:"optional"`
+	Name     string          `json:"name,omitempty"`
+	Field    string          `json:"field,omitempty"`
+}
+
+// debeziumPayload is the envelope payload
+type debeziumPayload struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+	Source debeziumSource         `json:"source"`
+	Op     string                 `json:"op"` // c, u, d or t
+	TsMs   int64                  `json:"ts_ms"`
+}
+
+// debeziumSource is the source block of the payload
+type debeziumSource struct {
+	Version   string `json:"version"`
+	Connector string `json:"connector"`
+	Name      string `json:"name"`
+	TsMs      int64  `json:"ts_ms"`
+	Snapshot  string `json:"snapshot"`
+	Schema    string `json:"schema"`
+	Table     string `json:"table"`
+	TxID      int64  `json:"txId"`
+	LSN       int64  `json:"lsn"` // Commit LSN of the transaction
+}
+
+// debeziumSourceSchema is the schema of the source block
+var debeziumSourceSchema = debeziumField{
+	Type: "struct",
+	Fields: []debeziumField{
+		{Type: "string", Field: "version"},
+		{Type: "string", Field: "connector"},
+		{Type: "string", Field: "name"},
+		{Type: "int64", Field: "ts_ms"},
+		{Type: "string", Optional: true, Field: "snapshot"},
+		{Type: "string", Field: "schema"},
+		{Type: "string", Field: "table"},
+		{Type: "int64", Optional: true, Field: "txId"},
+		{Type: "int64", Optional: true, Field: "lsn"},
+	},
+	Name:  "io.debezium.connector.postgresql.Source",
+	Field: "source",
+}
+
+// debeziumOps maps row change operations to Debezium op codes
+var debeziumOps = map[string]string{
+	wal.OpInsert:   "c",
+	wal.OpUpdate:   "u",
+	wal.OpDelete:   "d",
+	wal.OpTruncate: "t",
+}
+
+// newDebeziumEvent converts a row change of the transaction started by begin
+// name is the logical producer name, the schema names follow <name>.<schema>.<table>.Value
+func newDebeziumEvent(name string, begin *wal.BeginMessage, change *wal.RowChange) debeziumEvent {
+	table := change.Table
+	valueName := strings.Join([]string{name, table.Schema, table.TableName}, ".")
+
+	// The relation message carries no nullability, only key columns are known to be non-null
+	keys := make(map[string]bool, len(table.KeyColumns))
+	for _, col := range table.KeyColumns {
+		keys[col] = true
+	}
+	types := make(map[string]int, len(table.Columns))
+	fields := make([]debeziumField, len(table.Columns))
+	for i, col := range table.Columns {
+		var oid int
+		if i < len(table.ColumnTypes) {
+			oid = table.ColumnTypes[i]
+		}
+		types[col] = oid
+		field := debeziumColumnSchema(oid)
+		field.Field = col
+		field.Optional = !keys[col]
+		fields[i] = field
+	}
+
+	source := debeziumSource{
+		Version:   "dts",
+		Connector: "postgresql",
+		Name:      name,
+		Snapshot:  "false",
+		Schema:    table.Schema,
+		Table:     table.TableName,
+	}
+	if begin != nil {
+		source.TsMs = begin.Timestamp.UnixMilli()
+		source.TxID = int64(begin.XID)
+		if lsn, err := pglogrepl.ParseLSN(begin.FinalLSN); err == nil {
+			source.LSN = int64(lsn)
+		}
+	}
+
+	return debeziumEvent{
+		Schema: debeziumField{
+			Type: "struct",
+			Fields: []debeziumField{
+				{Type: "struct", Fields: fields, Optional: true, Name: valueName + ".Value", Field: "before"},
+				{Type: "struct", Fields: fields, Optional: true, Name: valueName + ".Value", Field: "after"},
+				debeziumSourceSchema,
+				{Type: "string", Field: "op"},
+				{Type: "int64", Optional: true, Field: "ts_ms"},
+			},
+			Name: valueName + ".Envelope",
+		},
+		Payload: debeziumPayload{
+			Before: debeziumValues(change.Before, types),
+			After:  debeziumValues(change.After, types),
+			Source: source,
+			Op:     debeziumOps[change.Op],
+			TsMs:   time.Now().UnixMilli(),
+		},
+	}
+}
+
+// debeziumColumnSchema returns the schema of a column by its type OID
+// Types without a native JSON representation are emitted as strings
+func debeziumColumnSchema(oid int) debeziumField {
+	switch oid {
+	case pgtype.BoolOID:
+		return debeziumField{Type: "boolean"}
+	case pgtype.Int2OID:
+		return debeziumField{Type: "int16"}
+	case pgtype.Int4OID:
+		return debeziumField{Type: "int32"}
+	case pgtype.Int8OID, pgtype.OIDOID:
+		return debeziumField{Type: "int64"}
+	case pgtype.Float4OID:
+		return debeziumField{Type: "float"}
+	case pgtype.Float8OID:
+		return debeziumField{Type: "double"}
+	case pgtype.ByteaOID:
+		return debeziumField{Type: "bytes"}
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		return debeziumField{Type: "string", Name: "io.debezium.data.Json"}
+	case pgtype.UUIDOID:
+		return debeziumField{Type: "string", Name: "io.debezium.data.Uuid"}
+	default:
+		return debeziumField{Type: "string"}
+	}
+}
+
+// debeziumValues converts text-format column values to the JSON types declared in the schema
+func debeziumValues(values map[string]interface{}, types map[string]int) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(values))
+	for col, v := range values {
+		text, ok := v.(string)
+		if !ok {
+			result[col] = v
+			continue
+		}
+		result[col] = debeziumValue(types[col], text)
+	}
+	return result
+}
+
+// debeziumValue converts a text-format value, values that fail to parse are kept as text
+func debeziumValue(oid int, text string) interface{} {
+	switch oid {
+	case pgtype.BoolOID:
+		return text == "t"
+	case pgtype.Int2OID, pgtype.Int4OID, pgtype.Int8OID, pgtype.OIDOID:
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	case pgtype.Float4OID, pgtype.Float8OID:
+		// NaN and Infinity have no JSON number form
+		if f, err := strconv.ParseFloat(text, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+	case pgtype.ByteaOID:
+		// Encoded as base64 by encoding/json, as Debezium does
+		if b, err := hex.DecodeString(strings.TrimPrefix(text, `\x`)); err == nil {
+			return b
+		}
+	}
+	return text
+}
@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/wal"
+)
+
+// FileSink appends change events as JSON Lines to a local file
+// Events are written when their transaction commits
+type FileSink struct {
+	file *os.File
+	buf  *bufio.Writer
+	txn  txnBuffer
+}
+
+// NewFileSink creates a file sink writing to <dir>/<task_id>.jsonl
+func NewFileSink(cfg *model.SinkConfig, taskID string) (*FileSink, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("file sink requires dir")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sink directory: %w", err)
+	}
+
+	path := filepath.Join(cfg.Dir, taskID+".jsonl")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sink file: %w", err)
+	}
+
+	return &FileSink{file: file, buf: bufio.NewWriter(file), txn: newTxnBuffer(cfg, taskID)}, nil
+}
+
+// Begin starts buffering a transaction
+func (s *FileSink) Begin(ctx context.Context, msg *wal.BeginMessage) error {
+	s.txn.start(msg)
+	return nil
+}
+
+// Change buffers a row change
+func (s *FileSink) Change(ctx context.Context, change *wal.RowChange) error {
+	s.txn.add(change)
+	return nil
+}
+
+// Commit writes the events of the transaction
+func (s *FileSink) Commit(ctx context.Context, msg *wal.CommitMessage) error {
+	for _, event := range s.txn.take() {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		if _, err := s.buf.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+	}
+	if err := s.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to flush sink file: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the file, events of an uncommitted transaction are dropped
+func (s *FileSink) Close() error {
+	if err := s.buf.Flush(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("failed to flush sink file: %w", err)
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,207 @@
+package sink
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/wal"
+)
+
+// maxGIDLength is the longest transaction identifier PREPARE TRANSACTION accepts
+const maxGIDLength = 199
+
+// PostgresSink applies changes to the target database
+// Every source transaction is applied in one target transaction
+type PostgresSink struct {
+	target    *repository.TargetRepository
+	tx        *repository.TargetRepository // Current transaction, nil outside of a transaction
+	namespace string                       // Prefix of the prepared transaction identifiers, unique per task
+	skip      bool                         // The current prepared transaction was staged before and is skipped
+	catchUp   pglogrepl.LSN                // Transactions committed up to it may already be on the target
+
+	preparedLog bool // The prepared transaction log exists on the target
+}
+
+// NewPostgresSink creates a PostgreSQL sink
+// Prepared transactions are staged under identifiers namespaced by taskID
+func NewPostgresSink(target *repository.TargetRepository, taskID string) *PostgresSink {
+	return &PostgresSink{target: target, namespace: "dts_" + taskID}
+}
+
+// SetCatchUp applies the transactions committed up to lsn idempotently
+// Their changes may already be in rows copied from a snapshot newer than the slot's, so inserted
+// rows that already exist are skipped. Empty lsn disables catching up.
+func (s *PostgresSink) SetCatchUp(lsn string) error {
+	if lsn == "" {
+		s.catchUp = 0
+		return nil
+	}
+	position, err := pglogrepl.ParseLSN(lsn)
+	if err != nil {
+		return fmt.Errorf("failed to parse catch-up position %q: %w", lsn, err)
+	}
+	s.catchUp = position
+	return nil
+}
+
+// preparedGID returns the target identifier of a prepared source transaction
+// Source identifiers are only unique on their own server, so they are prefixed with the task and
+// the source XID; a source identifier that would not fit is replaced by its hash
+func (s *PostgresSink) preparedGID(xid int, gid string) string {
+	prefix := fmt.Sprintf("%s_%d_", s.namespace, xid)
+	if len(prefix)+len(gid) > maxGIDLength {
+		sum := md5.Sum([]byte(gid))
+		gid = hex.EncodeToString(sum[:])
+	}
+	return prefix + gid
+}
+
+// Begin starts a target transaction
+func (s *PostgresSink) Begin(ctx context.Context, msg *wal.BeginMessage) error {
+	s.skip = false
+	return s.begin(msg.FinalLSN)
+}
+
+// begin starts the target transaction of a source transaction committed or prepared at lsn
+func (s *PostgresSink) begin(lsn string) error {
+	if s.tx != nil {
+		// Previous transaction never committed (stream restarted), discard it
+		s.tx.Rollback()
+	}
+	tx, err := s.target.Begin()
+	if err != nil {
+		return err
+	}
+	s.tx = tx
+
+	if s.catchUp != 0 {
+		position, err := pglogrepl.ParseLSN(lsn)
+		if err != nil {
+			return fmt.Errorf("failed to parse transaction position %q: %w", lsn, err)
+		}
+		if position <= s.catchUp {
+			return tx.SetConflictPolicy(repository.ConflictIgnore)
+		}
+	}
+	return nil
+}
+
+// Change applies a row change
+// Changes received outside of a transaction (e.g. a replay starting mid-transaction) are applied directly
+func (s *PostgresSink) Change(ctx context.Context, change *wal.RowChange) error {
+	if s.skip {
+		return nil
+	}
+	repo := s.target
+	if s.tx != nil {
+		repo = s.tx
+	}
+
+	schema, table := change.Table.TargetSchema, change.Table.TargetName
+	if schema == "" {
+		schema = change.Table.Schema
+	}
+	var err error
+	switch change.Op {
+	case wal.OpInsert:
+		err = repo.ApplyInsert(schema, table, change.After)
+	case wal.OpUpdate:
+		if change.Upsert {
+			err = repo.ApplyUpsert(schema, table, change.Before, change.After)
+		} else {
+			err = repo.ApplyUpdate(schema, table, change.Before, change.After)
+		}
+	case wal.OpDelete:
+		err = repo.ApplyDelete(schema, table, change.Before)
+	case wal.OpTruncate:
+		err = repo.ApplyTruncate(schema, table)
+	default:
+		err = fmt.Errorf("unknown change operation: %s", change.Op)
+	}
+	if err != nil {
+		s.rollback()
+		return fmt.Errorf("failed to apply %s on %s.%s: %w", change.Op, schema, table, err)
+	}
+	return nil
+}
+
+// Commit commits the target transaction
+func (s *PostgresSink) Commit(ctx context.Context, msg *wal.CommitMessage) error {
+	if s.tx == nil {
+		return nil
+	}
+	tx := s.tx
+	s.tx = nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Retryable reports that failed transactions may be applied again, since they are rolled back
+func (s *PostgresSink) Retryable() bool {
+	return true
+}
+
+// BeginPrepare starts a target transaction for a prepared source transaction
+// A transaction redelivered after a restart that is still prepared or already committed on the
+// target is skipped, so that its changes are not applied twice
+func (s *PostgresSink) BeginPrepare(ctx context.Context, msg *wal.BeginPrepareMessage) error {
+	if !s.preparedLog {
+		if err := s.target.EnsurePreparedLog(); err != nil {
+			return err
+		}
+		s.preparedLog = true
+	}
+	prepared, committed, err := s.target.PreparedState(s.preparedGID(msg.XID, msg.GID))
+	if err != nil {
+		return err
+	}
+	s.rollback()
+	s.skip = prepared || committed
+	if s.skip {
+		return nil
+	}
+	return s.begin(msg.PrepareLSN)
+}
+
+// Prepare stages the target transaction as a prepared transaction under its namespaced GID
+// The target needs max_prepared_transactions > 0
+func (s *PostgresSink) Prepare(ctx context.Context, msg *wal.PrepareMessage) error {
+	s.skip = false
+	if s.tx == nil {
+		return nil
+	}
+	tx := s.tx
+	s.tx = nil
+	return tx.PrepareTransaction(s.preparedGID(msg.XID, msg.GID))
+}
+
+// CommitPrepared commits the staged transaction
+func (s *PostgresSink) CommitPrepared(ctx context.Context, msg *wal.CommitPreparedMessage) error {
+	return s.target.CommitPrepared(s.preparedGID(msg.XID, msg.GID))
+}
+
+// RollbackPrepared rolls back the staged transaction
+func (s *PostgresSink) RollbackPrepared(ctx context.Context, msg *wal.RollbackPreparedMessage) error {
+	return s.target.RollbackPrepared(s.preparedGID(msg.XID, msg.GID))
+}
+
+// Close rolls back an unfinished transaction
+// The target connection belongs to the task connection pool and is not closed here
+func (s *PostgresSink) Close() error {
+	s.rollback()
+	return nil
+}
+
+// rollback rolls back the current transaction, if any
+func (s *PostgresSink) rollback() {
+	if s.tx != nil {
+		s.tx.Rollback()
+		s.tx = nil
+	}
+}
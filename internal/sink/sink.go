@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/wal"
+)
+
+// Event formats of the non-database sinks
+const (
+	FormatDTS      = "dts"      // Event, one flat object per change
+	FormatDebezium = "debezium" // Debezium JSON envelope with schema and payload
+)
+
+// New creates the sink configured for a task
+// target is only used by the PostgreSQL sink and may be nil for the others
+func New(cfg *model.SinkConfig, taskID string, target *repository.TargetRepository) (wal.Sink, error) {
+	if cfg.Format != "" && cfg.Format != FormatDTS && cfg.Format != FormatDebezium {
+		return nil, fmt.Errorf("unsupported sink format: %s (supported: %s, %s)", cfg.Format, FormatDTS, FormatDebezium)
+	}
+
+	switch cfg.Type {
+	case "", model.SinkPostgreSQL:
+		if target == nil {
+			return nil, fmt.Errorf("postgresql sink requires a target database")
+		}
+		return NewPostgresSink(target, taskID), nil
+	case model.SinkFile:
+		return NewFileSink(cfg, taskID)
+	case model.SinkWebhook:
+		return NewWebhookSink(cfg, taskID)
+	default:
+		return nil, fmt.Errorf("unsupported sink type: %s (supported: %s, %s, %s)",
+			cfg.Type, model.SinkPostgreSQL, model.SinkFile, model.SinkWebhook)
+	}
+}
+
+// Event is the serialized form of a row change used by the non-database sinks
+type Event struct {
+	Op         string                 `json:"op"`
+	Schema     string                 `json:"schema"`
+	Table      string                 `json:"table"`
+	Before     map[string]interface{} `json:"before,omitempty"`
+	After      map[string]interface{} `json:"after,omitempty"`
+	XID        int                    `json:"xid"`
+	CommitTime time.Time              `json:"commit_time"`
+}
+
+// txnBuffer collects the encoded events of the current source transaction
+// Non-database sinks only emit events of committed transactions
+type txnBuffer struct {
+	format string // FormatDTS or FormatDebezium
+	name   string // Logical name of the producer, used in Debezium schema names
+	begin  *wal.BeginMessage
+	events []interface{}
+}
+
+// newTxnBuffer creates a transaction buffer encoding events in format
+func newTxnBuffer(cfg *model.SinkConfig, taskID string) txnBuffer {
+	format := cfg.Format
+	if format == "" {
+		format = FormatDTS
+	}
+	return txnBuffer{format: format, name: taskID}
+}
+
+// start starts collecting a new transaction
+func (b *txnBuffer) start(msg *wal.BeginMessage) {
+	b.begin = msg
+	b.events = b.events[:0]
+}
+
+// add encodes a row change and buffers it
+func (b *txnBuffer) add(change *wal.RowChange) {
+	if b.format == FormatDebezium {
+		b.events = append(b.events, newDebeziumEvent(b.name, b.begin, change))
+		return
+	}
+
+	event := Event{
+		Op:     change.Op,
+		Schema: change.Table.Schema,
+		Table:  change.Table.TableName,
+		Before: change.Before,
+		After:  change.After,
+	}
+	if b.begin != nil {
+		event.XID = b.begin.XID
+		event.CommitTime = b.begin.Timestamp
+	}
+	b.events = append(b.events, event)
+}
+
+// take returns the buffered events and resets the buffer
+func (b *txnBuffer) take() []interface{} {
+	events := make([]interface{}, len(b.events))
+	copy(events, b.events)
+	b.begin = nil
+	b.events = b.events[:0]
+	return events
+}
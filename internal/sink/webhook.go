@@ -0,0 +1,209 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/wal"
+)
+
+// Webhook sink defaults
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultMaxRetries    = 3
+	defaultRetryBackoff  = 500 * time.Millisecond
+	defaultTimeout       = 10 * time.Second
+)
+
+// WebhookSink POSTs batches of committed change events as a JSON array to an HTTP endpoint
+// A batch is sent when it reaches the batch size at a commit, or when the flush interval elapses.
+// Failed requests are retried with exponential backoff, the stream fails once retries are exhausted.
+// Transactions are confirmed to the source only once their batch is delivered, so events may be
+// sent again after a failure but are never lost
+type WebhookSink struct {
+	url          string
+	headers      map[string]string
+	batchSize    int
+	maxRetries   int
+	retryBackoff time.Duration
+	client       *http.Client
+
+	txn txnBuffer // Only touched by the stream goroutine
+
+	mu        sync.Mutex
+	batch     []interface{}
+	batchEnd  string // End LSN of the last transaction in the batch
+	delivered string // End LSN of the last transaction delivered
+	flushErr  error  // Error of a background flush, reported on the next call
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWebhookSink creates a webhook sink
+func NewWebhookSink(cfg *model.SinkConfig, taskID string) (*WebhookSink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook sink requires url")
+	}
+
+	s := &WebhookSink{
+		url:          cfg.URL,
+		headers:      cfg.Headers,
+		batchSize:    cfg.BatchSize,
+		maxRetries:   defaultMaxRetries,
+		retryBackoff: time.Duration(cfg.RetryBackoffMs) * time.Millisecond,
+		client:       &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond},
+		txn:          newTxnBuffer(cfg, taskID),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = defaultBatchSize
+	}
+	if cfg.MaxRetries != nil {
+		if *cfg.MaxRetries < 0 {
+			return nil, fmt.Errorf("webhook max_retries must not be negative")
+		}
+		s.maxRetries = *cfg.MaxRetries
+	}
+	if s.retryBackoff <= 0 {
+		s.retryBackoff = defaultRetryBackoff
+	}
+	if s.client.Timeout <= 0 {
+		s.client.Timeout = defaultTimeout
+	}
+	flushInterval := time.Duration(cfg.FlushIntervalMs) * time.Millisecond
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	go s.flushLoop(flushInterval)
+	return s, nil
+}
+
+// Begin starts buffering a transaction
+func (s *WebhookSink) Begin(ctx context.Context, msg *wal.BeginMessage) error {
+	s.txn.start(msg)
+	return nil
+}
+
+// Change buffers a row change
+func (s *WebhookSink) Change(ctx context.Context, change *wal.RowChange) error {
+	s.txn.add(change)
+	return nil
+}
+
+// Commit adds the events of the transaction to the batch and sends it once full
+func (s *WebhookSink) Commit(ctx context.Context, msg *wal.CommitMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.flushErr != nil {
+		return s.flushErr
+	}
+	s.batch = append(s.batch, s.txn.take()...)
+	s.batchEnd = msg.TransactionEndLSN
+	if len(s.batch) < s.batchSize {
+		return nil
+	}
+	return s.flushLocked()
+}
+
+// Delivered returns the end LSN of the last transaction delivered and whether a batch is waiting
+func (s *WebhookSink) Delivered() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delivered, len(s.batch) > 0
+}
+
+// Close stops the flush loop and sends the remaining batch
+func (s *WebhookSink) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flushErr != nil {
+		return s.flushErr
+	}
+	return s.flushLocked()
+}
+
+// flushLoop sends partial batches every interval
+func (s *WebhookSink) flushLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.flushErr == nil {
+				s.flushErr = s.flushLocked()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// flushLocked sends the batch, the caller must hold mu
+func (s *WebhookSink) flushLocked() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(s.batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode events: %w", err)
+	}
+
+	backoff := s.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(body)
+		if err == nil {
+			s.batch = s.batch[:0]
+			s.delivered = s.batchEnd
+			return nil
+		}
+		if attempt == s.maxRetries {
+			return fmt.Errorf("webhook delivery failed after %d retries: %w", s.maxRetries, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends one request
+func (s *WebhookSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
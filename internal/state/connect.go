@@ -53,11 +53,23 @@ func (s *ConnectState) Execute(ctx context.Context, task *model.MigrationTask) e
 	defer sourceManager.Close()
 
 	// Step 2: Get all databases from source
-	databases, err := sourceManager.GetAllDatabases()
+	allDatabases, err := sourceManager.GetAllDatabases()
 	if err != nil {
 		return fmt.Errorf("failed to get databases from source: %w", err)
 	}
 
+	// Only the databases selected by the task's filters are migrated
+	selector, err := taskSelector(task)
+	if err != nil {
+		return err
+	}
+	var databases []database.DatabaseInfo
+	for _, dbInfo := range allDatabases {
+		if selector.Database(dbInfo.Datname) {
+			databases = append(databases, dbInfo)
+		}
+	}
+
 	// Step 3: For each database, get business tables
 	for i := range databases {
 		// Connect to each business database
@@ -87,7 +99,15 @@ func (s *ConnectState) Execute(ctx context.Context, task *model.MigrationTask) e
 		task.AddConnection(connKey, dbManager.GetDB())
 	}
 
-	// Step 4: Create all databases in target
+	// Step 4: Create all databases in target, unless changes go to a non-database sink
+	writes, err := writesTarget(task)
+	if err != nil {
+		return err
+	}
+	if !writes {
+		return nil
+	}
+
 	targetPostgresDSN := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=postgres sslmode=%s",
 		targetConfig.Host, targetConfig.Port, targetConfig.User, targetConfig.Password, targetConfig.SSLMode)
 	if targetConfig.SSLMode == "" {
@@ -101,32 +121,38 @@ func (s *ConnectState) Execute(ctx context.Context, task *model.MigrationTask) e
 	}
 	defer targetManager.Close()
 
-	// Create databases in target
+	names, err := taskNames(task)
+	if err != nil {
+		return err
+	}
+
+	// Create databases in target, named by the task's name mapping
 	for _, dbInfo := range databases {
-		createDBQuery := fmt.Sprintf("CREATE DATABASE %s", dbInfo.Datname)
+		targetName := names.Database(dbInfo.Datname)
+		createDBQuery := fmt.Sprintf("CREATE DATABASE %s", targetName)
 		if err := targetManager.GetDB().Exec(createDBQuery).Error; err != nil {
 			// Check if database already exists
 			if !isDatabaseExistsError(err) {
-				return fmt.Errorf("failed to create database %s in target: %w", dbInfo.Datname, err)
+				return fmt.Errorf("failed to create database %s in target: %w", targetName, err)
 			}
 		}
 
 		// Connect to target database and store connection
 		targetDBDSN := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-			targetConfig.Host, targetConfig.Port, targetConfig.User, targetConfig.Password, dbInfo.Datname, targetConfig.SSLMode)
+			targetConfig.Host, targetConfig.Port, targetConfig.User, targetConfig.Password, targetName, targetConfig.SSLMode)
 		if targetConfig.SSLMode == "" {
 			targetDBDSN = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-				targetConfig.Host, targetConfig.Port, targetConfig.User, targetConfig.Password, dbInfo.Datname)
+				targetConfig.Host, targetConfig.Port, targetConfig.User, targetConfig.Password, targetName)
 		}
 
 		targetDBManager, err := database.NewManager(dbType, targetDBDSN)
 		if err != nil {
-			return fmt.Errorf("failed to connect to target database %s: %w", dbInfo.Datname, err)
+			return fmt.Errorf("failed to connect to target database %s: %w", targetName, err)
 		}
 		// Don't defer close here, we need to keep the connection
 
 		// Store target connection
-		targetConnKey := fmt.Sprintf("%s:%d:%s", targetConfig.Host, targetConfig.Port, dbInfo.Datname)
+		targetConnKey := fmt.Sprintf("%s:%d:%s", targetConfig.Host, targetConfig.Port, targetName)
 		task.AddConnection(targetConnKey, targetDBManager.GetDB())
 	}
 
@@ -0,0 +1,148 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pg/dts/internal/logger"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
+)
+
+// CreateIndexesState represents the state creating indexes, constraints and triggers after full sync
+type CreateIndexesState struct {
+	BaseState
+	statements *repository.SchemaRepository // Holds the deferred statements, nil when none were deferred
+}
+
+// NewCreateIndexesState creates a new create indexes state
+func NewCreateIndexesState() *CreateIndexesState {
+	return &CreateIndexesState{
+		BaseState: BaseState{name: model.StateCreateIndexes.String()},
+	}
+}
+
+// useRepositories sets the repository the post-data statements are recorded in
+func (s *CreateIndexesState) useRepositories(repos *Repositories) {
+	s.statements = repos.Schema
+}
+
+// Execute runs the post-data statements recorded when the tables were created
+// Statements run phase by phase, those of a phase in parallel. Statements already run are
+// skipped, so a resumed task only runs what is left. Failures are handled according to the
+// DDL error policy of the task once all phases have run.
+func (s *CreateIndexesState) Execute(ctx context.Context, task *model.MigrationTask) error {
+	writes, err := writesTarget(task)
+	if err != nil {
+		return err
+	}
+	if !writes || s.statements == nil {
+		return nil
+	}
+
+	statements, err := s.statements.ListStatements(task.ID, model.SectionPostData)
+	if err != nil {
+		return err
+	}
+	phases := make(map[int][]*model.SchemaStatement)
+	for i := range statements {
+		if stmt := &statements[i]; stmt.Status == model.StatementPending || stmt.Status == model.StatementRunning {
+			phases[stmt.Phase] = append(phases[stmt.Phase], stmt)
+		}
+	}
+	order := make([]int, 0, len(phases))
+	for phase := range phases {
+		order = append(order, phase)
+	}
+	sort.Ints(order)
+
+	cfg, err := repository.ParseFullSyncConfig(task)
+	if err != nil {
+		return err
+	}
+	for _, phase := range order {
+		if err := s.runPhase(ctx, task, phases[phase], cfg.Parallelism); err != nil {
+			return err
+		}
+	}
+	if err := checkSchemaFailures(task, model.SectionPostData, statements); err != nil {
+		return err
+	}
+
+	// Report the target tables that do not match the source now that the schema is complete
+	diff, err := DiffSchema(task)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("task_id", task.ID).Warn("Failed to compare schema")
+		return nil
+	}
+	logSchemaDiff(task, diff)
+	return nil
+}
+
+// runPhase runs the statements of a phase with a pool of workers
+// A failed statement is recorded and does not stop the others. An error recording a statement
+// or connecting to the target stops the phase.
+func (s *CreateIndexesState) runPhase(ctx context.Context, task *model.MigrationTask, statements []*model.SchemaStatement, parallelism int) error {
+	targetConfig, err := repository.ParseTargetDB(task)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan *model.SchemaStatement)
+	errs := make(chan error, parallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism && i < len(statements); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for stmt := range queue {
+				if err := s.runStatement(ctx, task, *targetConfig, stmt); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		for _, stmt := range statements {
+			select {
+			case queue <- stmt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// runStatement runs a statement in its target database and records the outcome
+func (s *CreateIndexesState) runStatement(ctx context.Context, task *model.MigrationTask, targetConfig model.DBConfig, stmt *model.SchemaStatement) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	targetConfig.DBName = stmt.Database
+	db, err := repository.GetOrCreateGORMConnection(task, &targetConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s: %w", stmt.Database, err)
+	}
+	return runSchemaStatement(ctx, s.statements, db, stmt)
+}
+
+// Next returns the next state
+func (s *CreateIndexesState) Next() State {
+	return NewIncSyncState()
+}
@@ -4,17 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"regexp"
 	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/pg/dts/internal/database"
+	"github.com/pg/dts/internal/logger"
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"github.com/pg/dts/internal/repository"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 // CreateTablesState represents the create tables state
 type CreateTablesState struct {
 	BaseState
+	statements *repository.SchemaRepository // Records the schema statements, nil runs post-data with the tables
 }
 
 // NewCreateTablesState creates a new create tables state
@@ -24,8 +30,22 @@ func NewCreateTablesState() *CreateTablesState {
 	}
 }
 
+// useRepositories sets the repository the schema statements are recorded in
+func (s *CreateTablesState) useRepositories(repos *Repositories) {
+	s.statements = repos.Schema
+}
+
 // Execute executes the table creation logic
 func (s *CreateTablesState) Execute(ctx context.Context, task *model.MigrationTask) error {
+	// Nothing to create when changes go to a non-database sink
+	writes, err := writesTarget(task)
+	if err != nil {
+		return err
+	}
+	if !writes {
+		return nil
+	}
+
 	// Parse database type
 	dbType := database.DatabaseType(task.DatabaseType)
 	if dbType == "" {
@@ -44,7 +64,7 @@ func (s *CreateTablesState) Execute(ctx context.Context, task *model.MigrationTa
 		return fmt.Errorf("failed to parse target database config: %w", err)
 	}
 
-	// For PostgreSQL, use pg_dump to get table definitions
+	// For PostgreSQL, generate the table definitions from the source catalog
 	if dbType == database.DatabaseTypePostgreSQL {
 		return s.createTablesForPostgreSQL(ctx, task, &sourceConfig, &targetConfig)
 	}
@@ -53,8 +73,14 @@ func (s *CreateTablesState) Execute(ctx context.Context, task *model.MigrationTa
 	return s.createTablesGeneric(ctx, task)
 }
 
-// createTablesForPostgreSQL creates tables using pg_dump for PostgreSQL
+// createTablesForPostgreSQL creates tables from the DDL generated from the source catalog for PostgreSQL
 func (s *CreateTablesState) createTablesForPostgreSQL(ctx context.Context, task *model.MigrationTask, sourceConfig, targetConfig *model.DBConfig) error {
+	names, err := taskNames(task)
+	if err != nil {
+		return err
+	}
+	diff := newSchemaDiff()
+
 	// Parse table list - we need to get all tables from all databases
 	// For now, we'll iterate through connections stored in task
 	// The connections were created in ConnectState
@@ -65,7 +91,7 @@ func (s *CreateTablesState) createTablesForPostgreSQL(ctx context.Context, task
 			continue
 		}
 
-		_, ok := conn.(*gorm.DB)
+		sourceGormDB, ok := conn.(*gorm.DB)
 		if !ok {
 			continue
 		}
@@ -83,33 +109,36 @@ func (s *CreateTablesState) createTablesForPostgreSQL(ctx context.Context, task
 			continue
 		}
 
-		// Get tables for this database from task metadata or query again
-		// For now, we'll need to query tables from the database
-		// TODO: Use cached table information from ConnectState
-
-		// Use pg_dump to get schema for all tables in this database
-		pgDumpCmd := exec.CommandContext(ctx, "pg_dump",
-			"-h", sourceConfig.Host,
-			"-p", fmt.Sprintf("%d", sourceConfig.Port),
-			"-U", sourceConfig.User,
-			"-d", databaseName,
-			"--schema-only",
-			"--no-owner",
-			"--no-privileges",
-		)
-		pgDumpCmd.Env = append(pgDumpCmd.Env, fmt.Sprintf("PGPASSWORD=%s", sourceConfig.Password))
-
-		schemaSQL, err := pgDumpCmd.Output()
+		// Only the selected schemas and the migrated tables of this database are created
+		tables, err := migratedTables(task, sourceGormDB)
 		if err != nil {
-			return fmt.Errorf("failed to run pg_dump for database %s: %w", databaseName, err)
+			return fmt.Errorf("failed to list tables of database %s: %w", databaseName, err)
+		}
+		schemas, err := selectedSchemas(task, sourceGormDB)
+		if err != nil {
+			return fmt.Errorf("failed to select schemas of database %s: %w", databaseName, err)
+		}
+		if len(schemas) == 0 {
+			continue
 		}
 
-		// Modify table names in schema SQL
-		// Replace table names with new names (table + suffix)
-		modifiedSQL := s.modifyTableNames(string(schemaSQL), task.TableSuffix)
+		// Tables, types, sequences and functions are created now; indexes, constraints and
+		// triggers are deferred until after full sync, so that the bulk load does not maintain them
+		ddl, err := repository.NewSourceRepositoryFromDB(sourceGormDB).ExtractSchema(schemas, tables, names)
+		if err != nil {
+			return fmt.Errorf("failed to extract schema of database %s: %w", databaseName, err)
+		}
+		if len(ddl.Skipped) > 0 {
+			logger.GetLogger().WithFields(logrus.Fields{
+				"task_id":  task.ID,
+				"database": databaseName,
+				"objects":  ddl.Skipped,
+			}).Warn("Skipped views and functions that use tables not migrated")
+		}
 
 		// Get target connection for this database
-		targetConnKey := fmt.Sprintf("%s:%d:%s", targetConfig.Host, targetConfig.Port, databaseName)
+		targetDatabase := names.Database(databaseName)
+		targetConnKey := fmt.Sprintf("%s:%d:%s", targetConfig.Host, targetConfig.Port, targetDatabase)
 		targetConn, ok := task.GetConnection(targetConnKey)
 		if !ok {
 			return fmt.Errorf("target connection not found for database %s", databaseName)
@@ -120,119 +149,232 @@ func (s *CreateTablesState) createTablesForPostgreSQL(ctx context.Context, task
 			return fmt.Errorf("invalid target connection type for database %s", databaseName)
 		}
 
-		// Split by semicolon and execute each statement
-		statements := strings.Split(modifiedSQL, ";")
-		for _, stmt := range statements {
-			stmt = strings.TrimSpace(stmt)
-			if stmt == "" || strings.HasPrefix(stmt, "--") {
-				continue
-			}
-			if err := targetGormDB.Exec(stmt).Error; err != nil {
-				// Some statements might fail (e.g., if table already exists), log but continue
-				// TODO: Better error handling
-				continue
+		// Create target tables whose partitioning is overridden before the extracted definitions
+		skipPatterns, overridden, err := s.createPartitionOverrides(task, names, sourceGormDB, targetGormDB)
+		if err != nil {
+			return fmt.Errorf("failed to create partitioned tables for database %s: %w", databaseName, err)
+		}
+
+		var preData []model.SchemaStatement
+		for _, stmt := range splitDDL(ddl.PreData) {
+			if !matchesAny(stmt, skipPatterns) {
+				preData = append(preData, model.SchemaStatement{Database: targetDatabase, Statement: stmt})
 			}
 		}
+		if err := s.runPreData(ctx, task, targetDatabase, targetGormDB, preData); err != nil {
+			return fmt.Errorf("failed to create schema of database %s: %w", databaseName, err)
+		}
+
+		// Record the post-data statements for after full sync; those of transformed tables run now,
+		// since they name source columns that the transformation may rename or drop
+		if err := s.deferPostData(ctx, task, targetDatabase, targetGormDB, ddl.PostData, skipPatterns, overridden); err != nil {
+			return fmt.Errorf("failed to create post-data objects of database %s: %w", databaseName, err)
+		}
+
+		// Reshape the created tables that have column transformations
+		if err := s.transformTables(task, names, sourceGormDB, targetGormDB); err != nil {
+			return fmt.Errorf("failed to transform tables for database %s: %w", databaseName, err)
+		}
+
+		// Report the created tables that do not match the source; deferred indexes and constraints
+		// are compared once they are created
+		if err := diffDatabase(task, databaseName, sourceGormDB, targetGormDB, s.statements != nil, diff); err != nil {
+			return fmt.Errorf("failed to compare schema of database %s: %w", databaseName, err)
+		}
 	}
 
+	logSchemaDiff(task, diff)
 	return nil
 }
 
-// modifyTableNames modifies table names in SQL schema
-// Replaces table names with new names (table + suffix)
-// Also modifies index names, constraint names that reference table names
-func (s *CreateTablesState) modifyTableNames(schemaSQL, suffix string) string {
-	if suffix == "" {
-		return schemaSQL
+// runPreData records the pre-data statements of a database and runs them in order
+// Statements creating an object that already exists are ignored, other failures are handled
+// according to the DDL error policy of the task once all statements have run.
+func (s *CreateTablesState) runPreData(ctx context.Context, task *model.MigrationTask, targetDatabase string, targetDB *gorm.DB, statements []model.SchemaStatement) error {
+	if s.statements != nil {
+		if err := s.statements.SaveStatements(task.ID, model.SectionPreData, targetDatabase, statements); err != nil {
+			return err
+		}
+	}
+	for i := range statements {
+		if err := runSchemaStatement(ctx, s.statements, targetDB, &statements[i]); err != nil {
+			return err
+		}
 	}
+	return checkSchemaFailures(task, model.SectionPreData, statements)
+}
 
-	// Simple approach: replace table names in CREATE TABLE, ALTER TABLE, CREATE INDEX statements
-	// This is a simplified implementation - a more robust solution would use SQL parser
-	lines := strings.Split(schemaSQL, "\n")
-	var modifiedLines []string
+// deferPostData records the post-data statements of a database to run after full sync
+// Statements on transformed tables run right away. The primary keys of the tables whose
+// partitioning is overridden are skipped, those tables are created with theirs. Without a schema repository nothing can be
+// recorded, so every statement runs right away.
+func (s *CreateTablesState) deferPostData(ctx context.Context, task *model.MigrationTask, targetDatabase string, targetDB *gorm.DB, postData []model.PostDataStatement, skipPatterns []*regexp.Regexp, overridden map[string]bool) error {
+	transforms, err := repository.ParseTransforms(task)
+	if err != nil {
+		return err
+	}
+	transformed := make(map[string]bool)
+	for name := range transforms {
+		schema, table := naming.Split(name)
+		transformed[schema+"."+table] = true
+	}
 
-	for _, line := range lines {
-		modifiedLine := line
+	var statements []model.SchemaStatement
+	for _, stmt := range postData {
+		if matchesAny(stmt.Statement, skipPatterns) || (stmt.PrimaryKey && overridden[stmt.Table]) {
+			continue
+		}
+		phase := stmt.Phase
+		if s.statements == nil || transformed[stmt.Table] {
+			phase = model.PhaseWithTables
+		}
+		statements = append(statements, model.SchemaStatement{Database: targetDatabase, Phase: phase, Statement: stmt.Statement})
+	}
+	if s.statements != nil {
+		if err := s.statements.SaveStatements(task.ID, model.SectionPostData, targetDatabase, statements); err != nil {
+			return err
+		}
+	}
 
-		// Match CREATE TABLE statements
-		if strings.Contains(line, "CREATE TABLE") {
-			// Extract table name and replace
-			// Format: CREATE TABLE public.tablename ( or CREATE TABLE tablename (
-			modifiedLine = s.replaceTableNameInLine(line, suffix)
+	var immediate []model.SchemaStatement
+	for i := range statements {
+		if statements[i].Phase != model.PhaseWithTables {
+			continue
+		}
+		if err := runSchemaStatement(ctx, s.statements, targetDB, &statements[i]); err != nil {
+			return err
 		}
+		immediate = append(immediate, statements[i])
+	}
+	return checkSchemaFailures(task, model.SectionPostData, immediate)
+}
+
+// transformTables changes the target tables that have a column transformation to its output shape
+func (s *CreateTablesState) transformTables(task *model.MigrationTask, names *naming.Mapper, sourceDB, targetDB *gorm.DB) error {
+	transforms, err := repository.ParseTransforms(task)
+	if err != nil {
+		return err
+	}
+	if len(transforms) == 0 {
+		return nil
+	}
 
-		// Match ALTER TABLE statements
-		if strings.Contains(line, "ALTER TABLE") {
-			modifiedLine = s.replaceTableNameInLine(line, suffix)
+	sourceRepo := repository.NewSourceRepositoryFromDB(sourceDB)
+	targetRepo := repository.NewTargetRepositoryFromDB(targetDB)
+	for name, spec := range transforms {
+		schema, table := naming.Split(name)
+		tableInfo, err := sourceRepo.GetTableInfo(schema, table)
+		if err != nil {
+			return err
+		}
+		if len(tableInfo.Columns) == 0 {
+			continue // Table is not in this database
 		}
+		targetSchema, targetTable := names.Table(schema, table)
+		if err := targetRepo.TransformTable(targetSchema, targetTable, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPartitionOverrides creates the target tables that have a partitioning override
+// Returns patterns matching the extracted statements of the source leaf partitions of those tables,
+// which must be skipped because the target is partitioned differently, and the created tables as
+// source schema.table names.
+func (s *CreateTablesState) createPartitionOverrides(task *model.MigrationTask, names *naming.Mapper, sourceDB, targetDB *gorm.DB) ([]*regexp.Regexp, map[string]bool, error) {
+	partitioning, err := repository.ParsePartitioning(task)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(partitioning) == 0 {
+		return nil, nil, nil
+	}
+
+	sourceRepo := repository.NewSourceRepositoryFromDB(sourceDB)
+	targetRepo := repository.NewTargetRepositoryFromDB(targetDB)
 
-		// Match CREATE INDEX statements
-		if strings.Contains(line, "CREATE INDEX") {
-			// Extract index name and table name
-			modifiedLine = s.replaceIndexNameInLine(line, suffix)
+	var skipPatterns []*regexp.Regexp
+	overridden := make(map[string]bool)
+	for name, cfg := range partitioning {
+		schema, table := naming.Split(name)
+		tableInfo, err := sourceRepo.GetTableInfo(schema, table)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tableInfo.Columns) == 0 {
+			continue // Table is not in this database
 		}
 
-		// Match ALTER TABLE ... ADD CONSTRAINT statements
-		if strings.Contains(line, "ADD CONSTRAINT") {
-			modifiedLine = s.replaceConstraintNameInLine(line, suffix)
+		overridden[schema+"."+table] = true
+		if err := targetRepo.CreatePartitionedTable(tableInfo, names.Table, &cfg); err != nil && !isDatabaseExistsError(err) {
+			return nil, nil, err
 		}
 
-		modifiedLines = append(modifiedLines, modifiedLine)
+		sourcePartitions, err := sourceRepo.GetPartitionInfo(schema, table)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, leaf := range sourcePartitions.Leaves {
+			leafSchema, leafName := names.Table(leaf.Schema, leaf.Name)
+			name := regexp.QuoteMeta(pgx.Identifier{leafSchema, leafName}.Sanitize())
+			skipPatterns = append(skipPatterns, regexp.MustCompile(name))
+		}
 	}
 
-	return strings.Join(modifiedLines, "\n")
+	return skipPatterns, overridden, nil
 }
 
-// replaceTableNameInLine replaces table name in a line
-func (s *CreateTablesState) replaceTableNameInLine(line, suffix string) string {
-	// Simple regex-like replacement
-	// This is a simplified implementation
-	// Match patterns like: public.tablename or tablename
-	// Replace with: public.tablename_suffix or tablename_suffix
-
-	// For now, we'll do a simple string replacement
-	// A more robust solution would parse the SQL properly
-	words := strings.Fields(line)
-	for i, word := range words {
-		// Check if word contains a table name pattern
-		if strings.Contains(word, ".") {
-			// Format: schema.tablename
-			parts := strings.Split(word, ".")
-			if len(parts) == 2 {
-				// Replace tablename with tablename + suffix
-				words[i] = parts[0] + "." + parts[1] + suffix
-			}
-		} else if i > 0 && (words[i-1] == "TABLE" || words[i-1] == "ON") {
-			// Might be a table name
-			// Simple heuristic: if previous word is TABLE or ON, this might be table name
-			words[i] = word + suffix
+// matchesAny returns whether stmt matches any of the patterns
+func matchesAny(stmt string, patterns []*regexp.Regexp) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(stmt) {
+			return true
 		}
 	}
-	return strings.Join(words, " ")
+	return false
 }
 
-// replaceIndexNameInLine replaces index name in a line
-func (s *CreateTablesState) replaceIndexNameInLine(line, suffix string) string {
-	// Match: CREATE INDEX indexname ON tablename
-	// Replace indexname if it contains table name pattern (e.g., tablename_pkey -> tablename_suffix_pkey)
-	words := strings.Fields(line)
-	for i, word := range words {
-		if i > 0 && words[i-1] == "INDEX" {
-			// This is index name
-			// If index name contains table name pattern, replace it
-			words[i] = word + suffix
-		} else if i > 1 && words[i-2] == "INDEX" && words[i-1] == "ON" {
-			// This is table name after ON
-			words[i] = word + suffix
-		}
-	}
-	return strings.Join(words, " ")
+// migratedTables returns the migrated tables of a source database and their leaf partitions as schema.table names
+func migratedTables(task *model.MigrationTask, sourceDB *gorm.DB) (map[string]bool, error) {
+	tables, err := repository.ParseTables(task)
+	if err != nil {
+		return nil, err
+	}
+	sourceRepo := repository.NewSourceRepositoryFromDB(sourceDB)
+	migrated := make(map[string]bool)
+	for _, table := range tables {
+		schema, name := naming.Split(table)
+		migrated[schema+"."+name] = true
+		partitions, err := sourceRepo.GetPartitionInfo(schema, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, leaf := range partitions.Leaves {
+			migrated[leaf.Schema+"."+leaf.Name] = true
+		}
+	}
+	return migrated, nil
 }
 
-// replaceConstraintNameInLine replaces constraint name in a line
-func (s *CreateTablesState) replaceConstraintNameInLine(line, suffix string) string {
-	// Similar to replaceIndexNameInLine
-	return s.replaceIndexNameInLine(line, suffix)
+// selectedSchemas returns the schemas of a source database that the task's filters select
+func selectedSchemas(task *model.MigrationTask, sourceDB *gorm.DB) ([]string, error) {
+	selector, err := taskSelector(task)
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := repository.NewSourceRepositoryFromDB(sourceDB).GetSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, schema := range schemas {
+		if selector.Schema(schema) {
+			selected = append(selected, schema)
+		}
+	}
+	return selected, nil
 }
 
 // createTablesGeneric creates tables using generic repository approach
@@ -0,0 +1,232 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
+	"gorm.io/gorm"
+)
+
+// alreadyExistsCodes are the SQLSTATE codes of a statement creating an object that already exists
+var alreadyExistsCodes = map[string]bool{
+	"42P04": true, // duplicate_database
+	"42P06": true, // duplicate_schema
+	"42P07": true, // duplicate_table
+	"42710": true, // duplicate_object
+	"42723": true, // duplicate_function
+	"42701": true, // duplicate_column
+}
+
+// isAlreadyExistsError reports whether a statement failed because the object it creates already exists
+func isAlreadyExistsError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && alreadyExistsCodes[pgErr.Code]
+}
+
+// statementOutcome returns the status and error message recorded for a statement
+func statementOutcome(err error) (string, string) {
+	switch {
+	case err == nil:
+		return model.StatementDone, ""
+	case isAlreadyExistsError(err):
+		return model.StatementIgnored, err.Error()
+	default:
+		return model.StatementFailed, err.Error()
+	}
+}
+
+// runSchemaStatement runs a DDL statement on the target and sets its outcome
+// The outcome is recorded in repo when it is set. An interrupted statement is left running and
+// returns the context error, so that it runs again on resume.
+func runSchemaStatement(ctx context.Context, repo *repository.SchemaRepository, db *gorm.DB, stmt *model.SchemaStatement) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if repo != nil && stmt.ID != 0 {
+		if err := repo.StartStatement(stmt.ID); err != nil {
+			return err
+		}
+	}
+
+	execErr := db.WithContext(ctx).Exec(stmt.Statement).Error
+	if execErr != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	stmt.Status, stmt.Error = statementOutcome(execErr)
+	if repo != nil && stmt.ID != 0 {
+		return repo.CompleteStatement(stmt.ID, stmt.Status, stmt.Error)
+	}
+	return nil
+}
+
+// checkSchemaFailures applies the DDL error policy of a task to the statements of a section
+// With the fail policy, any failed statement fails the task; with continue they are only reported.
+func checkSchemaFailures(task *model.MigrationTask, section string, statements []model.SchemaStatement) error {
+	var failed []model.SchemaStatement
+	for _, stmt := range statements {
+		if stmt.Status == model.StatementFailed {
+			failed = append(failed, stmt)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	cfg, err := repository.ParseDDLConfig(task)
+	if err != nil {
+		return err
+	}
+	if cfg.OnError == model.DDLOnErrorContinue {
+		return nil
+	}
+	return fmt.Errorf("%d %s statements failed, first in database %s: %s: %s",
+		len(failed), section, failed[0].Database, statementSummary(failed[0].Statement), failed[0].Error)
+}
+
+// statementSummary returns the first line of a statement, shortened for error messages
+func statementSummary(stmt string) string {
+	if i := strings.IndexByte(stmt, '\n'); i >= 0 {
+		stmt = stmt[:i] + " ..."
+	}
+	if len(stmt) > 120 {
+		stmt = stmt[:120] + " ..."
+	}
+	return stmt
+}
+
+// splitStatements splits SQL text into statements at the semicolons outside of string literals,
+// quoted identifiers, dollar-quoted bodies and comments
+// Parts holding only whitespace and comments are dropped, the statements have no trailing semicolon.
+func splitStatements(sql string) []string {
+	var statements []string
+	start, code := 0, false
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+		case c == '\'':
+			escapes := i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i < 2 || !isIdentifierByte(sql[i-2]))
+			i = skipQuoted(sql, i, '\'', escapes)
+			code = true
+		case c == '"':
+			i = skipQuoted(sql, i, '"', false)
+			code = true
+		case c == '$':
+			if tag := dollarTag(sql, i); tag != "" {
+				if end := strings.Index(sql[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag)
+				} else {
+					i = len(sql)
+				}
+			} else {
+				i++
+			}
+			code = true
+		case c == ';':
+			if code {
+				statements = append(statements, strings.TrimSpace(sql[start:i]))
+			}
+			i++
+			start, code = i, false
+		default:
+			if !isSpaceByte(c) {
+				code = true
+			}
+			i++
+		}
+	}
+	if code {
+		statements = append(statements, strings.TrimSpace(sql[start:]))
+	}
+	return statements
+}
+
+// skipQuoted returns the position after the quoted text starting at i
+// A doubled quote is part of the text, as is a backslash escaped character when escapes is set.
+func skipQuoted(sql string, i int, quote byte, escapes bool) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case escapes && sql[j] == '\\':
+			j++
+		case sql[j] == quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+// skipBlockComment returns the position after the block comment starting at i, comments nest
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for j := i; j < len(sql); {
+		switch {
+		case strings.HasPrefix(sql[j:], "/*"):
+			depth++
+			j += 2
+		case strings.HasPrefix(sql[j:], "*/"):
+			depth--
+			j += 2
+			if depth == 0 {
+				return j
+			}
+		default:
+			j++
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the dollar quote tag starting at i, such as $$ or $body$, empty if there is none
+// A $ following an identifier character is part of the identifier, and $1 is a parameter.
+func dollarTag(sql string, i int) string {
+	if i > 0 && isIdentifierByte(sql[i-1]) {
+		return ""
+	}
+	for j := i + 1; j < len(sql); j++ {
+		c := sql[j]
+		switch {
+		case c == '$':
+			return sql[i : j+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+		case c >= '0' && c <= '9' && j > i+1:
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// isIdentifierByte reports whether a byte can be part of an unquoted identifier
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// isSpaceByte reports whether a byte is SQL whitespace
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// splitDDL splits generated DDL into single statements, so that each one runs and is recorded on its own
+func splitDDL(ddl []string) []string {
+	var statements []string
+	for _, sql := range ddl {
+		statements = append(statements, splitStatements(sql)...)
+	}
+	return statements
+}
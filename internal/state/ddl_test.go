@@ -0,0 +1,145 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "statements",
+			sql:  "CREATE TABLE a (id int); CREATE TABLE b (id int);",
+			want: []string{"CREATE TABLE a (id int)", "CREATE TABLE b (id int)"},
+		},
+		{
+			name: "trailing statement without semicolon",
+			sql:  "SELECT 1;\nSELECT 2",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "dollar quoted body",
+			sql:  "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; SELECT 2;",
+			want: []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT 2"},
+		},
+		{
+			name: "tagged dollar quoted body",
+			sql:  "DO $body$ BEGIN PERFORM 1; RAISE NOTICE '$$;'; END $body$; SELECT 2;",
+			want: []string{"DO $body$ BEGIN PERFORM 1; RAISE NOTICE '$$;'; END $body$", "SELECT 2"},
+		},
+		{
+			name: "parameters and identifiers with dollar signs",
+			sql:  "PREPARE p AS SELECT $1 FROM a$b; SELECT 2;",
+			want: []string{"PREPARE p AS SELECT $1 FROM a$b", "SELECT 2"},
+		},
+		{
+			name: "nested block comment",
+			sql:  "SELECT 1 /* outer /* inner; */ still; */; SELECT 2;",
+			want: []string{"SELECT 1 /* outer /* inner; */ still; */", "SELECT 2"},
+		},
+		{
+			name: "line comment",
+			sql:  "SELECT 1; -- comment;\nSELECT 2;",
+			want: []string{"SELECT 1", "-- comment;\nSELECT 2"},
+		},
+		{
+			name: "escape string",
+			sql:  `SELECT E'it\'s;'; SELECT 2;`,
+			want: []string{`SELECT E'it\'s;'`, "SELECT 2"},
+		},
+		{
+			name: "backslash in standard string",
+			sql:  `SELECT 'a\'; SELECT 2;`,
+			want: []string{`SELECT 'a\'`, "SELECT 2"},
+		},
+		{
+			name: "doubled quotes",
+			sql:  `SELECT 'it''s;' AS "a "";"; SELECT 2;`,
+			want: []string{`SELECT 'it''s;' AS "a "";"`, "SELECT 2"},
+		},
+		{
+			name: "empty statements",
+			sql:  " ; ;SELECT 1;; ",
+			want: []string{"SELECT 1"},
+		},
+		{
+			name: "comments only",
+			sql:  "-- nothing;\n/* to; run */ ;",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipQuoted(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		quote   byte
+		escapes bool
+		want    int
+	}{
+		{name: "string", sql: "'abc' x", quote: '\'', want: 5},
+		{name: "doubled quote", sql: "'a''b' x", quote: '\'', want: 6},
+		{name: "escaped quote", sql: `'a\'b' x`, quote: '\'', escapes: true, want: 6},
+		{name: "backslash without escapes", sql: `'a\' x`, quote: '\'', want: 4},
+		{name: "identifier", sql: `"a""b" x`, quote: '"', want: 6},
+		{name: "unterminated", sql: "'abc", quote: '\'', want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := skipQuoted(tt.sql, 0, tt.quote, tt.escapes); got != tt.want {
+				t.Errorf("skipQuoted(%q) = %d, want %d", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipBlockComment(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want int
+	}{
+		{"/* a */ x", 7},
+		{"/* a /* b */ c */ x", 17},
+		{"/**/ x", 4},
+		{"/* a /* b */", 12},
+	}
+	for _, tt := range tests {
+		if got := skipBlockComment(tt.sql, 0); got != tt.want {
+			t.Errorf("skipBlockComment(%q) = %d, want %d", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestDollarTag(t *testing.T) {
+	tests := []struct {
+		sql  string
+		i    int
+		want string
+	}{
+		{"$$ body $$", 0, "$$"},
+		{"$body$ x $body$", 0, "$body$"},
+		{"$_1$", 0, "$_1$"},
+		{"$1", 0, ""},
+		{"$1$", 0, ""},
+		{"a$b$", 1, ""},
+		{"$ab", 0, ""},
+		{"x = $", 4, ""},
+	}
+	for _, tt := range tests {
+		if got := dollarTag(tt.sql, tt.i); got != tt.want {
+			t.Errorf("dollarTag(%q, %d) = %q, want %q", tt.sql, tt.i, got, tt.want)
+		}
+	}
+}
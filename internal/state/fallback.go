@@ -0,0 +1,228 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"github.com/pg/dts/internal/replication"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/sink"
+)
+
+// FallbackState represents the reverse replication state after switchover
+// Changes made on the target are streamed back to the original source tables,
+// so that the source can be switched back to if the target misbehaves
+type FallbackState struct {
+	BaseState
+}
+
+// NewFallbackState creates a new fallback state
+func NewFallbackState() *FallbackState {
+	return &FallbackState{
+		BaseState: BaseState{name: model.StateFallback.String()},
+	}
+}
+
+// PrepareFallback readies reverse replication at switchover, before applications move to the target
+// The forward stream is drained up to a fence and dropped along with its slot and publication, so
+// that changes applied back to the source are not replicated to the target in a loop. The reverse
+// slot is then created on the target: every target change from now on is streamed back to the
+// source once the task reaches the fallback state.
+func PrepareFallback(ctx context.Context, task *model.MigrationTask) error {
+	if err := awaitFence(ctx, task); err != nil {
+		return fmt.Errorf("failed to await fence: %w", err)
+	}
+	if err := dropForwardReplication(task); err != nil {
+		return err
+	}
+	return createReverseReplication(task)
+}
+
+// Execute executes the fallback state logic
+func (s *FallbackState) Execute(ctx context.Context, task *model.MigrationTask) error {
+	if err := s.ensureReverseReplication(task); err != nil {
+		return err
+	}
+
+	// Fail fast if the reverse stream has stopped
+	if err := checkStream(task, reverseStreamKey); err != nil {
+		return err
+	}
+
+	// Keep streaming until the finalize API is called
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(5 * time.Second):
+	}
+
+	return nil
+}
+
+// ensureReverseReplication starts the reverse stream
+// Forward replication and the reverse slot are normally handled at switchover; they are handled
+// here too for a task switched over without it.
+func (s *FallbackState) ensureReverseReplication(task *model.MigrationTask) error {
+	if _, ok := task.GetConnection(reverseStreamKey); ok {
+		return nil
+	}
+	if err := dropForwardReplication(task); err != nil {
+		return err
+	}
+	if err := createReverseReplication(task); err != nil {
+		return err
+	}
+
+	tables, err := repository.ParseTables(task)
+	if err != nil {
+		return fmt.Errorf("failed to parse tables: %w", err)
+	}
+	names, err := TaskNames(task)
+	if err != nil {
+		return err
+	}
+
+	// Apply target changes to the source tables, mapping names back
+	sourceDB, err := repository.GetOrCreateSourceGORMConnection(task)
+	if err != nil {
+		return fmt.Errorf("failed to get source connection: %w", err)
+	}
+	// Leaf partitions are published under their own names unless published via the root
+	sourceRepo := repository.NewSourceRepositoryFromDB(sourceDB)
+	for _, table := range tables {
+		partitions, err := sourceRepo.GetPartitionInfo(naming.Split(table))
+		if err != nil {
+			return err
+		}
+		for _, leaf := range partitions.Leaves {
+			names.Register(leaf.Schema, leaf.Name)
+		}
+	}
+	targetConfig, err := repository.ParseTargetDB(task)
+	if err != nil {
+		return err
+	}
+	changeSink := sink.NewPostgresSink(repository.NewTargetRepositoryFromDB(sourceDB), task.ID)
+	return startStream(task, reverseStreamKey, targetConfig, reverseSlotName(task), reversePublicationName(task), false, changeSink, names.Reverse, nil)
+}
+
+// createReverseReplication creates the reverse slot and publication on the target unless they exist
+func createReverseReplication(task *model.MigrationTask) error {
+	tables, err := repository.ParseTables(task)
+	if err != nil {
+		return fmt.Errorf("failed to parse tables: %w", err)
+	}
+
+	targetDB, err := repository.GetOrCreateTargetGORMConnection(task)
+	if err != nil {
+		return fmt.Errorf("failed to get target connection: %w", err)
+	}
+
+	var walLevel string
+	if err := targetDB.Raw("SHOW wal_level").Scan(&walLevel).Error; err != nil {
+		return fmt.Errorf("failed to check target wal_level: %w", err)
+	}
+	if walLevel != "logical" {
+		return fmt.Errorf("target database wal_level must be 'logical' for fallback, got '%s'", walLevel)
+	}
+
+	slotManager, err := replication.NewSlotManagerFromDB(targetDB)
+	if err != nil {
+		return fmt.Errorf("failed to create slot manager: %w", err)
+	}
+	pubManager, err := replication.NewPublicationManagerFromDB(targetDB)
+	if err != nil {
+		return fmt.Errorf("failed to create publication manager: %w", err)
+	}
+
+	slotName := reverseSlotName(task)
+	pubName := reversePublicationName(task)
+
+	// The publication comes first, pgoutput looks it up as of each change the slot decodes
+	exists, err := pubManager.PublicationExists(pubName)
+	if err != nil {
+		return fmt.Errorf("failed to check reverse publication existence: %w", err)
+	}
+	if !exists {
+		names, err := TaskNames(task)
+		if err != nil {
+			return err
+		}
+		// Publish the target tables
+		tableNames := make([]string, len(tables))
+		for i, table := range tables {
+			targetSchema, targetTable := names.Table(naming.Split(table))
+			tableNames[i] = pgx.Identifier{targetSchema, targetTable}.Sanitize()
+		}
+		viaRoot, err := publishViaRoot(task, tables)
+		if err != nil {
+			return fmt.Errorf("failed to compare partitioning: %w", err)
+		}
+		if err := createTaskPublication(pubManager, pubName, tableNames, viaRoot); err != nil {
+			return fmt.Errorf("failed to create reverse publication: %w", err)
+		}
+	}
+
+	exists, err = slotManager.SlotExists(slotName)
+	if err != nil {
+		return fmt.Errorf("failed to check reverse slot existence: %w", err)
+	}
+	if !exists {
+		if err := slotManager.CreateSlot(slotName, "pgoutput"); err != nil {
+			return fmt.Errorf("failed to create reverse replication slot: %w", err)
+		}
+	}
+	return nil
+}
+
+// Next returns the next state
+func (s *FallbackState) Next() State {
+	return NewCompletedState()
+}
+
+// CanTransition returns whether the fallback state can transition
+func (s *FallbackState) CanTransition() bool {
+	// Fallback ends when the finalize API is called
+	// This is controlled externally, so return false here
+	return false
+}
+
+// StopReverseReplication stops the reverse stream and drops the reverse slot and publication on the target
+func StopReverseReplication(task *model.MigrationTask) error {
+	if err := stopStream(task, reverseStreamKey); err != nil {
+		return fmt.Errorf("failed to stop reverse replication stream: %w", err)
+	}
+
+	targetDB, err := repository.GetOrCreateTargetGORMConnection(task)
+	if err != nil {
+		return fmt.Errorf("failed to get target connection: %w", err)
+	}
+
+	slotManager, err := replication.NewSlotManagerFromDB(targetDB)
+	if err != nil {
+		return fmt.Errorf("failed to create slot manager: %w", err)
+	}
+	if err := slotManager.DropSlotIfExists(reverseSlotName(task), slotReleaseWait); err != nil {
+		return err
+	}
+
+	pubManager, err := replication.NewPublicationManagerFromDB(targetDB)
+	if err != nil {
+		return fmt.Errorf("failed to create publication manager: %w", err)
+	}
+	return pubManager.DropPublication(reversePublicationName(task))
+}
+
+// reverseSlotName returns the reverse replication slot name of the task
+func reverseSlotName(task *model.MigrationTask) string {
+	return replicationObjectName("dts_fb_slot", task)
+}
+
+// reversePublicationName returns the reverse publication name of the task
+func reversePublicationName(task *model.MigrationTask) string {
+	return replicationObjectName("dts_fb_pub", task)
+}
@@ -0,0 +1,55 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pg/dts/internal/logger"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/wal"
+)
+
+// fenceTimeout is how long to wait for the forward stream to apply a fence
+const fenceTimeout = 5 * time.Minute
+
+// awaitFence writes a fence marker into the source WAL and waits until the forward stream has applied it
+// Once the fence is applied, every transaction committed on the source before it has been applied as well.
+// It is a no-op if the forward stream is not running in this process
+func awaitFence(ctx context.Context, task *model.MigrationTask) error {
+	markers := streamMarkers(task, forwardStreamKey)
+	if markers == nil {
+		logger.GetLogger().WithField("task_id", task.ID).Warn("Forward stream is not running, skipping fence")
+		return nil
+	}
+
+	sourceRepo, err := repository.NewSourceRepositoryFromTask(task)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	content := task.ID + ":" + uuid.New().String()
+	if err := sourceRepo.EmitLogicalMessage(wal.MarkerPrefixFence, content); err != nil {
+		return err
+	}
+
+	deadline := time.After(fenceTimeout)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if markers.Contains(wal.MarkerPrefixFence, content) {
+			return nil
+		}
+		if err := checkStream(task, forwardStreamKey); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("fence was not applied within %s", fenceTimeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
 	"github.com/pg/dts/internal/repository"
 )
 
 // FullSyncState represents the full sync state
 type FullSyncState struct {
 	BaseState
+	chunks *repository.FullSyncRepository // Persists chunk progress, nil disables resuming
 }
 
 // NewFullSyncState creates a new full sync state
@@ -20,13 +22,31 @@ func NewFullSyncState() *FullSyncState {
 	}
 }
 
+// useRepositories sets the repository chunk progress is persisted in
+func (s *FullSyncState) useRepositories(repos *Repositories) {
+	s.chunks = repos.FullSync
+}
+
 // Execute executes the full data synchronization logic
 func (s *FullSyncState) Execute(ctx context.Context, task *model.MigrationTask) error {
+	// Non-database sinks only receive the change stream
+	writes, err := writesTarget(task)
+	if err != nil {
+		return err
+	}
+	if !writes {
+		return nil
+	}
+
 	// Parse table list
 	tables, err := repository.ParseTables(task)
 	if err != nil {
 		return fmt.Errorf("failed to parse tables: %w", err)
 	}
+	fullSyncConfig, err := repository.ParseFullSyncConfig(task)
+	if err != nil {
+		return err
+	}
 
 	// Create repositories (using connection pool)
 	sourceRepo, err := repository.NewSourceRepositoryFromTask(task)
@@ -41,27 +61,75 @@ func (s *FullSyncState) Execute(ctx context.Context, task *model.MigrationTask)
 	}
 	// Connections are managed by task manager, don't close here
 
-	// Migrate data for each table using replication technology
-	schema := "public"
-	for i, tableName := range tables {
-		sourceTable := tableName
-		targetTable := tableName + task.TableSuffix
+	names, err := taskNames(task)
+	if err != nil {
+		return err
+	}
+
+	// Subset tables only copy the rows matching their predicate
+	subsets, err := subsetPredicates(fullSyncConfig, sourceRepo, tables)
+	if err != nil {
+		return err
+	}
 
-		if err := targetRepo.CopyData(sourceRepo, schema, sourceTable, schema, targetTable); err != nil {
-			return fmt.Errorf("failed to copy data for table %s: %w", tableName, err)
+	// Resolve the source tables and partitions to copy and their destinations
+	var targets []model.CopyChunk
+	for _, name := range tables {
+		schema, tableName := naming.Split(name)
+		tableTargets, err := s.copyTargets(sourceRepo, targetRepo, names, schema, tableName)
+		if err != nil {
+			return fmt.Errorf("failed to resolve copy targets for table %s: %w", name, err)
 		}
+		for i := range tableTargets {
+			tableTargets[i].Subset = subsets[schema+"."+tableName]
+		}
+		targets = append(targets, tableTargets...)
+	}
+
+	return s.copyParallel(ctx, task, targets, fullSyncConfig)
+}
+
+// copyTargets returns the copies needed for a table, a partitioned source table is copied one leaf partition at a time
+// A leaf goes directly into the matching target partition (the leaf's mapped name) if the target has one,
+// otherwise into the target table, which routes the rows if it is partitioned differently
+func (s *FullSyncState) copyTargets(sourceRepo *repository.SourceRepository, targetRepo *repository.TargetRepository, names *naming.Mapper, schema, sourceTable string) ([]model.CopyChunk, error) {
+	targetSchema, targetTable := names.Table(schema, sourceTable)
+	sourcePartitions, err := sourceRepo.GetPartitionInfo(schema, sourceTable)
+	if err != nil {
+		return nil, err
+	}
+	if !sourcePartitions.IsPartitioned() {
+		return []model.CopyChunk{{
+			SourceSchema: schema, SourceTable: sourceTable,
+			TargetSchema: targetSchema, TargetTable: targetTable,
+		}}, nil
+	}
 
-		// Update progress (simple implementation, can be more precise)
-		progress := (i + 1) * 100 / len(tables)
-		// TODO: Update task progress to database
-		_ = progress
+	targetPartitions, err := targetRepo.GetPartitionInfo(targetSchema, targetTable)
+	if err != nil {
+		return nil, err
+	}
+	targetLeaves := make(map[string]bool, len(targetPartitions.Leaves))
+	for _, leaf := range targetPartitions.Leaves {
+		targetLeaves[leaf.Schema+"."+leaf.Name] = true
 	}
 
-	return nil
+	var targets []model.CopyChunk
+	for _, leaf := range sourcePartitions.Leaves {
+		destSchema, destTable := targetSchema, targetTable
+		if leafSchema, leafTable := names.Table(leaf.Schema, leaf.Name); targetLeaves[leafSchema+"."+leafTable] {
+			destSchema, destTable = leafSchema, leafTable
+		}
+		targets = append(targets, model.CopyChunk{
+			SourceSchema: leaf.Schema, SourceTable: leaf.Name,
+			TargetSchema: destSchema, TargetTable: destTable,
+		})
+	}
+	return targets, nil
 }
 
 // Next returns the next state
 func (s *FullSyncState) Next() State {
-	return NewIncSyncState()
+	return NewCreateIndexesState()
 }
 
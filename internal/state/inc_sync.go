@@ -3,16 +3,19 @@ package state
 import (
 	"context"
 	"fmt"
-	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
 	"github.com/pg/dts/internal/replication"
 	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/sink"
 )
 
 // IncSyncState represents the incremental sync state
 type IncSyncState struct {
 	BaseState
+	chunks *repository.FullSyncRepository // Full sync chunks, whose snapshots tell what to catch up
 }
 
 // NewIncSyncState creates a new incremental sync state
@@ -22,6 +25,11 @@ func NewIncSyncState() *IncSyncState {
 	}
 }
 
+// useRepositories sets the repository full sync chunks are persisted in
+func (s *IncSyncState) useRepositories(repos *Repositories) {
+	s.chunks = repos.FullSync
+}
+
 // Execute executes the incremental synchronization logic
 func (s *IncSyncState) Execute(ctx context.Context, task *model.MigrationTask) error {
 	// Parse table list
@@ -60,17 +68,22 @@ func (s *IncSyncState) Execute(ctx context.Context, task *model.MigrationTask) e
 	// Note: pubManager uses shared connection, don't close separately
 
 	// Generate replication slot and publication names
-	slotName := fmt.Sprintf("dts_slot_%s", task.ID)
-	pubName := fmt.Sprintf("dts_pub_%s", task.ID)
+	slotName := taskSlotName(task)
+	pubName := taskPublicationName(task)
 
 	// Check and create replication slot
+	// Tasks writing the target created it with the full sync snapshot, others start from now
 	exists, err := slotManager.SlotExists(slotName)
 	if err != nil {
 		return fmt.Errorf("failed to check slot existence: %w", err)
 	}
 
 	if !exists {
-		if err := slotManager.CreateSlot(slotName, "pgoutput"); err != nil {
+		createSlot := slotManager.CreateSlot
+		if task.TwoPhase {
+			createSlot = slotManager.CreateSlotTwoPhase
+		}
+		if err := createSlot(slotName, "pgoutput"); err != nil {
 			return fmt.Errorf("failed to create replication slot: %w", err)
 		}
 	}
@@ -82,45 +95,73 @@ func (s *IncSyncState) Execute(ctx context.Context, task *model.MigrationTask) e
 	}
 
 	if !exists {
-		// Build table name list (format: schema.table)
-		schema := "public"
+		// Build the quoted table name list
 		tableNames := make([]string, len(tables))
 		for i, table := range tables {
-			tableNames[i] = fmt.Sprintf("%s.%s", schema, table)
+			schema, name := naming.Split(table)
+			tableNames[i] = pgx.Identifier{schema, name}.Sanitize()
 		}
 
-		if err := pubManager.CreatePublication(pubName, tableNames); err != nil {
+		// Publish partition changes as root table changes when the target is partitioned differently
+		viaRoot, err := publishViaRoot(task, tables)
+		if err != nil {
+			return fmt.Errorf("failed to compare partitioning: %w", err)
+		}
+		if err := createTaskPublication(pubManager, pubName, tableNames, viaRoot); err != nil {
 			return fmt.Errorf("failed to create publication: %w", err)
 		}
 	}
 
-	// Create subscriber and start synchronization
-	// Note: Need to start a background goroutine to handle WAL stream
-	// In actual implementation, should use context to control synchronization stop
-	// Here is a simplified implementation that returns after syncing for a period
-	// Should actually run continuously until Waiting state
-
-	// TODO: Start WAL subscriber
-	// subscriber, err := replication.NewSubscriber(sourceDB.DSN(), slotName)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to create subscriber: %w", err)
-	// }
-	// defer subscriber.Close()
-	//
-	// if err := subscriber.StartReplication(ctx, pubName); err != nil {
-	// 	return fmt.Errorf("failed to start replication: %w", err)
-	// }
-	//
-	// // Process replication stream in background
-	// go func() {
-	// 	if err := subscriber.ProcessReplicationStream(ctx); err != nil {
-	// 		// Handle error
-	// 	}
-	// }()
-
-	// Wait for a period to let WAL sync (should actually run continuously)
-	// This is a simplified implementation
-	time.Sleep(1 * time.Second)
+	// Start streaming source changes into the target tables in the background
+	// The stream keeps running through the Waiting and Validating states
+	sourceConfig, err := repository.ParseSourceDB(task)
+	if err != nil {
+		return err
+	}
+	sinkConfig, err := repository.ParseSinkConfig(task)
+	if err != nil {
+		return err
+	}
+	transforms, err := taskTransforms(task)
+	if err != nil {
+		return err
+	}
+	sourceRepo, err := repository.NewSourceRepositoryFromTask(task)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	if err := checkFilterIdentity(sourceRepo, transforms, tables); err != nil {
+		return err
+	}
+	names, err := taskNames(task)
+	if err != nil {
+		return err
+	}
+	var targetRepo *repository.TargetRepository
+	if sinkConfig.WritesDatabase() {
+		targetRepo, err = repository.NewTargetRepositoryFromTask(task)
+		if err != nil {
+			return fmt.Errorf("failed to connect to target database: %w", err)
+		}
+	}
+	changeSink, err := sink.New(sinkConfig, task.ID, targetRepo)
+	if err != nil {
+		return fmt.Errorf("failed to create sink: %w", err)
+	}
+	// Rows copied from a snapshot newer than the slot's may already hold the first changes
+	if pgSink, ok := changeSink.(*sink.PostgresSink); ok && s.chunks != nil {
+		lsn, err := s.chunks.CatchUpLSN(task.ID)
+		if err == nil {
+			err = pgSink.SetCatchUp(lsn)
+		}
+		if err != nil {
+			changeSink.Close()
+			return err
+		}
+	}
+	if err := startStream(task, forwardStreamKey, sourceConfig, slotName, pubName, task.TwoPhase, changeSink, names.Table, transforms); err != nil {
+		return err
+	}
 
 	return nil
 }
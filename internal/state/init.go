@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
 	"github.com/pg/dts/internal/repository"
 )
 
@@ -52,8 +53,8 @@ func (s *InitState) Execute(ctx context.Context, task *model.MigrationTask) erro
 	// Note: Do not close connection here, connections are managed by task manager
 
 	// Verify tables exist
-	schema := "public" // Default schema, can be read from configuration
-	for _, tableName := range tables {
+	for _, name := range tables {
+		schema, tableName := naming.Split(name)
 		_, err := sourceRepo.GetTableInfo(schema, tableName)
 		if err != nil {
 			return fmt.Errorf("table %s.%s not found or inaccessible: %w", schema, tableName, err)
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"sync"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"github.com/pg/dts/internal/repository"
+)
+
+// namesKey is the connection pool key of the task's name mapper
+const namesKey = "names"
+
+// namesMu serializes creating the name mapper of a task
+var namesMu sync.Mutex
+
+// taskNames returns the name mapper of a task, created from its configuration on first use
+func taskNames(task *model.MigrationTask) (*naming.Mapper, error) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+
+	if m, ok := task.GetConnection(namesKey); ok {
+		return m.(*naming.Mapper), nil
+	}
+	cfg, err := repository.ParseNameMapping(task)
+	if err != nil {
+		return nil, err
+	}
+	m, err := naming.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	task.AddConnection(namesKey, m)
+	return m, nil
+}
+
+// taskSelector returns the database, schema and table filters of a task
+func taskSelector(task *model.MigrationTask) (*naming.Selector, error) {
+	selection, err := repository.ParseSelection(task)
+	if err != nil {
+		return nil, err
+	}
+	return naming.NewSelector(selection)
+}
+
+// TaskNames returns the name mapper of a task
+// Each source table of the task is registered, so that target names map back to the source
+func TaskNames(task *model.MigrationTask) (*naming.Mapper, error) {
+	m, err := taskNames(task)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := repository.ParseTables(task)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		m.Register(naming.Split(table))
+	}
+	return m, nil
+}
@@ -0,0 +1,782 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pg/dts/internal/logger"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/replication"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/throttle"
+	"github.com/pg/dts/internal/transform"
+	"github.com/sirupsen/logrus"
+)
+
+// copySnapshots holds by task the replication connections exporting the snapshots full syncs copy from
+var (
+	copySnapshotsMu sync.Mutex
+	copySnapshots   = make(map[string]*replication.SnapshotSlot)
+)
+
+// ReleaseCopySnapshot closes the connection exporting the full sync snapshot of a task, if any
+// A held snapshot keeps the source from removing rows it can still see
+func ReleaseCopySnapshot(taskID string) {
+	copySnapshotsMu.Lock()
+	slot := copySnapshots[taskID]
+	delete(copySnapshots, taskID)
+	copySnapshotsMu.Unlock()
+
+	if slot != nil {
+		slot.Close()
+	}
+}
+
+// heldSnapshot returns the full sync snapshot held for a task, nil if there is none
+func heldSnapshot(taskID string) *replication.SnapshotSlot {
+	copySnapshotsMu.Lock()
+	defer copySnapshotsMu.Unlock()
+	return copySnapshots[taskID]
+}
+
+// holdSnapshot keeps the connection exporting the full sync snapshot of a task open until released
+func holdSnapshot(taskID string, slot *replication.SnapshotSlot) {
+	copySnapshotsMu.Lock()
+	defer copySnapshotsMu.Unlock()
+	copySnapshots[taskID] = slot
+}
+
+// copyColumns holds the columns copied from a source table and whether binary COPY can be used
+// A transformed table reads all source columns and writes the target columns of its binding
+type copyColumns struct {
+	names   []string
+	binary  bool
+	source  []string
+	binding *transform.Binding
+	target  []repository.CopyColumn // Target columns of names with their types, for batched INSERTs
+}
+
+// read returns the source columns read for a table
+func (c copyColumns) read() []string {
+	if c.binding != nil {
+		return c.source
+	}
+	return c.names
+}
+
+// copyUnit is the work a copy worker takes at once: one chunk of a large table,
+// or several small tables packed together
+type copyUnit struct {
+	chunks []*model.FullSyncChunk
+	rows   int64
+}
+
+// copyParallel copies the targets with a pool of workers
+// Large tables are split into chunks, small tables are packed into units of about chunk_rows rows.
+// All workers read from the snapshot exported when the task's replication slot is created, so the
+// copied data is consistent across tables and chunks and the slot decodes every later change.
+// An interrupted copy resumes with the chunks not yet copied, from the same snapshot while it is
+// still held and from a newer one otherwise.
+func (s *FullSyncState) copyParallel(ctx context.Context, task *model.MigrationTask, targets []model.CopyChunk, cfg *model.FullSyncConfig) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	sourceConfig, err := repository.ParseSourceDB(task)
+	if err != nil {
+		return err
+	}
+	targetConfig, err := repository.ParseTargetDB(task)
+	if err != nil {
+		return err
+	}
+
+	coordinator, err := repository.NewCopyStreamManagerFromDSN(sourceConfig.DSN())
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer coordinator.Close()
+
+	snapshot, resumed, err := s.copySnapshot(ctx, task, sourceConfig)
+	if err != nil {
+		return err
+	}
+
+	targetMeta, err := repository.NewCopyStreamManagerFromDSN(targetConfig.DSN())
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer targetMeta.Close()
+	transforms, err := taskTransforms(task)
+	if err != nil {
+		return err
+	}
+	columns, err := s.lookupColumns(ctx, coordinator, targetMeta, targets, transforms)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := s.loadPlan(ctx, task, coordinator, targetMeta, targets, cfg.ChunkRows, snapshot, resumed)
+	if err != nil {
+		return err
+	}
+	units := packUnits(chunks, cfg.ChunkRows)
+	insert, err := useInserts(ctx, coordinator, targetMeta, cfg)
+	if err != nil {
+		return err
+	}
+
+	limits, err := taskThrottle(task)
+	if err != nil {
+		return err
+	}
+
+	progress := newCopyProgress(task.ID, s.chunks)
+	reportCtx, stopReport := context.WithCancel(context.Background())
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		progress.run(reportCtx)
+	}()
+	defer func() {
+		stopReport()
+		<-reported
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan copyUnit)
+	errs := make(chan error, cfg.Parallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Parallelism && i < len(units); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.copyWorker(ctx, task.ID, sourceConfig, targetConfig, snapshot.Snapshot, columns, insert, limits, progress, queue); err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		for _, unit := range units {
+			select {
+			case queue <- unit:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The copy is complete, its snapshot and the record of copied chunks are no longer needed
+	ReleaseCopySnapshot(task.ID)
+	if s.chunks != nil {
+		return targetMeta.ClearCopiedChunks(context.Background(), task.ID)
+	}
+	return nil
+}
+
+// useInserts returns whether chunks are copied with batched INSERTs instead of COPY
+// Inserts are used when configured, or when the source does not run COPY TO or the target COPY FROM
+func useInserts(ctx context.Context, source, target *repository.CopyStreamManager, cfg *model.FullSyncConfig) (bool, error) {
+	if cfg.Method == model.CopyMethodInsert {
+		return true, nil
+	}
+	supported, err := source.CopySupported(ctx, false)
+	if err != nil || !supported {
+		return !supported, err
+	}
+	supported, err = target.CopySupported(ctx, true)
+	return !supported, err
+}
+
+// copySnapshot returns the snapshot the copy reads from and whether an earlier run copied from it
+// The task's replication slot is created with the snapshot on a replication connection, so every
+// change committed after the snapshot is decoded by the slot and none falls between the copy and
+// the change stream. The connection is held until the copy completes or the task stops. When the
+// slot exists but its snapshot is gone, a copy that persists its progress keeps the slot and
+// continues from a snapshot exported on a regular connection; otherwise the slot is created again
+// and the copy starts over.
+func (s *FullSyncState) copySnapshot(ctx context.Context, task *model.MigrationTask, sourceConfig *model.DBConfig) (*replication.SnapshotSlot, bool, error) {
+	if slot := heldSnapshot(task.ID); slot != nil {
+		return slot, true, nil
+	}
+
+	sourceDB, err := repository.GetOrCreateSourceGORMConnection(task)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get source connection: %w", err)
+	}
+	slotManager, err := replication.NewSlotManagerFromDB(sourceDB)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create slot manager: %w", err)
+	}
+	exists, err := slotManager.SlotExists(taskSlotName(task))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check slot existence: %w", err)
+	}
+
+	var slot *replication.SnapshotSlot
+	switch {
+	case exists && s.chunks != nil:
+		slot, err = replication.ExportSnapshot(ctx, sourceConfig.DSN())
+	case exists:
+		// No change has been consumed from the slot before the copy completes
+		if err := slotManager.DropSlot(taskSlotName(task)); err != nil {
+			return nil, false, fmt.Errorf("failed to drop slot without snapshot: %w", err)
+		}
+		fallthrough
+	default:
+		slot, err = replication.CreateSnapshotSlot(ctx, replicationDSN(sourceConfig), taskSlotName(task), task.TwoPhase)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	holdSnapshot(task.ID, slot)
+	return slot, false, nil
+}
+
+// lookupColumns looks up the copied columns of every target
+func (s *FullSyncState) lookupColumns(ctx context.Context, source, target *repository.CopyStreamManager, targets []model.CopyChunk, transforms *transform.Set) (map[string]copyColumns, error) {
+	columns := make(map[string]copyColumns, len(targets))
+	for i := range targets {
+		t := &targets[i]
+		sourceColumns, err := source.Columns(ctx, t.SourceSchema, t.SourceTable)
+		if err != nil {
+			return nil, err
+		}
+		targetColumns, err := target.Columns(ctx, t.TargetSchema, t.TargetTable)
+		if err != nil {
+			return nil, err
+		}
+
+		// Columns missing on the target (or generated there) are not copied
+		onTarget := make(map[string]repository.CopyColumn, len(targetColumns))
+		for _, col := range targetColumns {
+			onTarget[col.Name] = col
+		}
+
+		var cols copyColumns
+		if tr := transforms.Table(t.SourceSchema, t.SourceTable); tr != nil {
+			cols, err = transformColumns(tr, sourceColumns, onTarget)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transform %s.%s: %w", t.SourceSchema, t.SourceTable, err)
+			}
+		} else {
+			for _, col := range sourceColumns {
+				if _, ok := onTarget[col.Name]; ok {
+					cols.names = append(cols.names, col.Name)
+				}
+			}
+			if len(cols.names) == 0 {
+				return nil, fmt.Errorf("no common columns between %s.%s and %s.%s", t.SourceSchema, t.SourceTable, t.TargetSchema, t.TargetTable)
+			}
+			cols.binary = repository.BinaryCompatible(sourceColumns, targetColumns)
+		}
+		for _, name := range cols.names {
+			cols.target = append(cols.target, onTarget[name])
+		}
+		columns[copyKey(t)] = cols
+	}
+	return columns, nil
+}
+
+// transformColumns binds a transformation to the columns of a source table
+// Transformed rows are copied in text format, target columns produced by the transformation
+// that the target table does not have are left out
+func transformColumns(t *transform.Table, sourceColumns []repository.CopyColumn, onTarget map[string]repository.CopyColumn) (copyColumns, error) {
+	source := make([]string, len(sourceColumns))
+	for i, col := range sourceColumns {
+		source[i] = col.Name
+	}
+	binding, err := t.Bind(source, func(column string) bool {
+		_, ok := onTarget[column]
+		return ok
+	})
+	if err != nil {
+		return copyColumns{}, err
+	}
+	if len(binding.Columns()) == 0 {
+		return copyColumns{}, fmt.Errorf("transformation produces no columns of the target table")
+	}
+	return copyColumns{names: binding.Columns(), source: source, binding: binding}, nil
+}
+
+// loadPlan returns the chunks still to copy
+// A persisted plan is resumed when the copy continues on the snapshot the plan was copied from,
+// or caught up when it continues on a newer snapshot than the slot's. Otherwise the targets are
+// split into chunks and the new plan is persisted; the target tables an earlier run copied into,
+// whose changes the slot no longer has, are emptied first.
+func (s *FullSyncState) loadPlan(ctx context.Context, task *model.MigrationTask, source, target *repository.CopyStreamManager, targets []model.CopyChunk, chunkRows int64, snapshot *replication.SnapshotSlot, resumed bool) ([]*model.FullSyncChunk, error) {
+	if s.chunks != nil {
+		if err := target.EnsureCopiedChunks(ctx); err != nil {
+			return nil, err
+		}
+		records, err := s.chunks.ListChunks(task.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			if resumed {
+				return s.resumePlan(ctx, task, target, records)
+			}
+			if snapshot.Name == "" {
+				return s.catchUpPlan(ctx, task, source, target, records, snapshot.ConsistentPoint)
+			}
+		}
+		if err := s.emptyTargets(ctx, task, target, records); err != nil {
+			return nil, err
+		}
+		if err := target.ClearCopiedChunks(ctx, task.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []model.FullSyncChunk
+	for _, t := range targets {
+		chunks, err := source.SplitTable(ctx, t, chunkRows)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range chunks {
+			// The slot of a snapshot exported without one decodes changes from before it
+			records = append(records, model.FullSyncChunk{CopyChunk: chunk, Status: model.ChunkPending, SnapshotLSN: snapshotLSN(snapshot)})
+		}
+	}
+	if s.chunks != nil {
+		if err := s.chunks.SaveChunks(task.ID, records); err != nil {
+			return nil, err
+		}
+	}
+
+	pending := make([]*model.FullSyncChunk, len(records))
+	for i := range records {
+		pending[i] = &records[i]
+	}
+	return pending, nil
+}
+
+// snapshotLSN returns the position of a snapshot exported without a slot, empty for a slot's snapshot
+func snapshotLSN(snapshot *replication.SnapshotSlot) string {
+	if snapshot.Name != "" {
+		return ""
+	}
+	return snapshot.ConsistentPoint
+}
+
+// resumePlan settles the chunks that were being copied when the previous run stopped and returns
+// the chunks not yet copied
+// A chunk recorded on the target as done committed all of its rows, a chunk recorded with a key
+// committed the rows up to it and continues after it, any other chunk left none behind and is
+// copied again
+func (s *FullSyncState) resumePlan(ctx context.Context, task *model.MigrationTask, target *repository.CopyStreamManager, records []model.FullSyncChunk) ([]*model.FullSyncChunk, error) {
+	copied, err := target.CopiedChunks(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var reset []uint
+	for i := range records {
+		record := &records[i]
+		if record.Status != model.ChunkCopying {
+			continue
+		}
+		copiedChunk, ok := copied[record.ID]
+		switch {
+		case ok && copiedChunk.Done:
+			if err := s.chunks.CompleteChunk(record.ID, copiedChunk.Rows, record.Bytes); err != nil {
+				return nil, err
+			}
+			record.Status = model.ChunkDone
+		case ok:
+			// Batched INSERTs committed up to the recorded key, the copy resumes after it
+			cursor := &repository.CopyCursor{LastKey: copiedChunk.LastKey, Rows: copiedChunk.Rows}
+			if err := s.chunks.SaveCursor(record, cursor); err != nil {
+				return nil, err
+			}
+		default:
+			record.Status = model.ChunkPending
+			record.Cursor = ""
+			reset = append(reset, record.ID)
+		}
+	}
+	if err := s.chunks.ResetChunks(reset); err != nil {
+		return nil, err
+	}
+
+	var pending []*model.FullSyncChunk
+	for i := range records {
+		if records[i].Status != model.ChunkDone {
+			pending = append(pending, &records[i])
+		}
+	}
+	return pending, nil
+}
+
+// catchUpPlan continues a copy whose snapshot is gone from a newer snapshot taken at lsn
+// The slot still decodes every change after the old snapshot, so the chunks already copied are kept
+// and the changes up to lsn are applied idempotently once the copy completes. The rest of a table
+// split by key is copied from the new snapshot, as a row only leaves its chunk when its key changes;
+// a target table split by ctid blocks that holds rows of the old snapshot is emptied and copied
+// again, as updated rows move between blocks. Rows are caught up by their primary key, so every
+// table copied from the new snapshot needs one.
+func (s *FullSyncState) catchUpPlan(ctx context.Context, task *model.MigrationTask, source, target *repository.CopyStreamManager, records []model.FullSyncChunk, lsn string) ([]*model.FullSyncChunk, error) {
+	if _, err := s.resumePlan(ctx, task, target, records); err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string][]*model.FullSyncChunk)
+	var order []string
+	for i := range records {
+		key := records[i].TargetSchema + "." + records[i].TargetTable
+		if _, ok := tables[key]; !ok {
+			order = append(order, key)
+		}
+		tables[key] = append(tables[key], &records[i])
+	}
+
+	var reset, pending []uint
+	for _, key := range order {
+		chunks := tables[key]
+		copied, byBlocks, complete := false, false, true
+		for _, chunk := range chunks {
+			copied = copied || chunk.Status == model.ChunkDone || chunk.Cursor != ""
+			byBlocks = byBlocks || chunk.ByBlocks
+			complete = complete && chunk.Status == model.ChunkDone
+		}
+		if complete {
+			continue
+		}
+
+		for _, chunk := range chunks {
+			primaryKey, err := source.PrimaryKey(ctx, chunk.SourceSchema, chunk.SourceTable)
+			if err != nil {
+				return nil, err
+			}
+			if len(primaryKey) == 0 {
+				return nil, fmt.Errorf("cannot copy %s.%s from a new snapshot: changes since the snapshot of replication slot %s cannot be caught up without a primary key",
+					chunk.SourceSchema, chunk.SourceTable, taskSlotName(task))
+			}
+		}
+
+		var ids []uint
+		for _, chunk := range chunks {
+			ids = append(ids, chunk.ID)
+		}
+		if copied && byBlocks {
+			logger.GetLogger().WithFields(logrus.Fields{
+				"task_id": task.ID,
+				"table":   key,
+			}).Warn("Emptying target table partially copied by ctid blocks from an earlier snapshot")
+			if err := target.EmptyTarget(ctx, task.ID, chunks[0].TargetSchema, chunks[0].TargetTable, ids); err != nil {
+				return nil, err
+			}
+			for _, chunk := range chunks {
+				chunk.Status, chunk.Cursor = model.ChunkPending, ""
+			}
+			reset = append(reset, ids...)
+		}
+		for _, chunk := range chunks {
+			if chunk.Status != model.ChunkDone {
+				chunk.SnapshotLSN = lsn
+				pending = append(pending, chunk.ID)
+			}
+		}
+	}
+	if err := s.chunks.ResetChunks(reset); err != nil {
+		return nil, err
+	}
+	if err := s.chunks.SetSnapshotLSN(pending, lsn); err != nil {
+		return nil, err
+	}
+
+	var chunks []*model.FullSyncChunk
+	for i := range records {
+		if records[i].Status != model.ChunkDone {
+			chunks = append(chunks, &records[i])
+		}
+	}
+	return chunks, nil
+}
+
+// emptyTargets empties the target tables of the chunks an earlier run started copying
+func (s *FullSyncState) emptyTargets(ctx context.Context, task *model.MigrationTask, target *repository.CopyStreamManager, records []model.FullSyncChunk) error {
+	tables := make(map[string][]uint)
+	var order []*model.FullSyncChunk
+	for i := range records {
+		record := &records[i]
+		key := record.TargetSchema + "." + record.TargetTable
+		if record.Status == model.ChunkPending {
+			continue
+		}
+		if _, ok := tables[key]; !ok {
+			order = append(order, record)
+		}
+		tables[key] = append(tables[key], record.ID)
+	}
+
+	for _, record := range order {
+		key := record.TargetSchema + "." + record.TargetTable
+		logger.GetLogger().WithFields(logrus.Fields{
+			"task_id": task.ID,
+			"table":   key,
+		}).Warn("Emptying target table copied from a snapshot whose replication slot is gone")
+		if err := target.EmptyTarget(ctx, task.ID, record.TargetSchema, record.TargetTable, tables[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packUnits groups chunks into work units
+// Chunks of split tables get a unit each, whole small tables are packed until a unit reaches chunkRows.
+// Units are ordered largest first so that long copies start early.
+func packUnits(chunks []*model.FullSyncChunk, chunkRows int64) []copyUnit {
+	var units []copyUnit
+	small := copyUnit{}
+	for _, chunk := range chunks {
+		if chunk.Ranged() || chunk.EstimatedRows >= chunkRows {
+			units = append(units, copyUnit{chunks: []*model.FullSyncChunk{chunk}, rows: chunk.EstimatedRows})
+			continue
+		}
+		small.chunks = append(small.chunks, chunk)
+		small.rows += chunk.EstimatedRows
+		if small.rows >= chunkRows {
+			units = append(units, small)
+			small = copyUnit{}
+		}
+	}
+	if len(small.chunks) > 0 {
+		units = append(units, small)
+	}
+
+	sort.SliceStable(units, func(i, j int) bool { return units[i].rows > units[j].rows })
+	return units
+}
+
+// copyWorker copies units from the queue until it is closed
+// Each unit is read in its own transaction on the shared snapshot. The worker holds a source
+// connection slot while its source connection is open and gives it back when the limit is lowered.
+func (s *FullSyncState) copyWorker(ctx context.Context, taskID string, sourceConfig, targetConfig *model.DBConfig, snapshot string, columns map[string]copyColumns, insert bool, limits *throttle.Throttle, progress *copyProgress, queue <-chan copyUnit) error {
+	target, err := repository.NewCopyStreamManagerFromDSN(targetConfig.DSN())
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer target.Close()
+
+	slots := limits.SourceConnections()
+	var source *repository.CopyStreamManager
+	closeSource := func() {
+		source.Close()
+		source = nil
+		slots.Release()
+	}
+	defer func() {
+		if source != nil {
+			closeSource()
+		}
+	}()
+
+	for unit := range queue {
+		if source == nil {
+			if err := slots.Acquire(ctx); err != nil {
+				return err
+			}
+			source, err = repository.NewCopyStreamManagerFromDSN(sourceConfig.DSN())
+			if err != nil {
+				slots.Release()
+				return fmt.Errorf("failed to connect to source database: %w", err)
+			}
+			source.SetLimiter(limits)
+		}
+
+		if err := source.ImportSnapshot(ctx, snapshot); err != nil {
+			return err
+		}
+		for _, chunk := range unit.chunks {
+			copyChunk := s.copyChunk
+			if insert {
+				copyChunk = s.insertChunk
+			}
+			if err := copyChunk(ctx, taskID, source, target, chunk, columns[copyKey(&chunk.CopyChunk)], progress); err != nil {
+				source.EndTransaction(context.Background())
+				return err
+			}
+		}
+		if err := source.EndTransaction(ctx); err != nil {
+			return fmt.Errorf("failed to end snapshot transaction: %w", err)
+		}
+
+		if slots.Excess() {
+			closeSource()
+		}
+	}
+	return nil
+}
+
+// copyChunk copies one chunk, recording its progress
+// The rows are copied in a target transaction that also records the chunk on the target, so an
+// interrupted chunk is either recorded as copied or has left nothing behind
+func (s *FullSyncState) copyChunk(ctx context.Context, taskID string, source, target *repository.CopyStreamManager, chunk *model.FullSyncChunk, cols copyColumns, progress *copyProgress) error {
+	if s.chunks != nil {
+		if err := s.chunks.StartChunk(chunk.ID); err != nil {
+			return err
+		}
+	}
+	if err := target.BeginTransaction(ctx); err != nil {
+		return fmt.Errorf("failed to begin copy of %s: %w", &chunk.CopyChunk, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			target.RollbackTransaction(context.Background())
+		}
+	}()
+
+	counter := progress.start(chunk.ID)
+	source.SetProgress(counter)
+	var rows int64
+	var err error
+	if cols.binding != nil {
+		rows, err = source.CopyChunkTransformed(ctx, target, &chunk.CopyChunk, cols.source, cols.names, cols.binding.Apply)
+	} else {
+		rows, err = source.CopyChunk(ctx, target, &chunk.CopyChunk, cols.names, cols.binary)
+	}
+	source.SetProgress(nil)
+	progress.finish(chunk.ID)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", &chunk.CopyChunk, err)
+	}
+
+	if s.chunks != nil {
+		if err := target.RecordChunk(ctx, taskID, chunk.ID, rows); err != nil {
+			return err
+		}
+	}
+	if err := target.EndTransaction(ctx); err != nil {
+		return fmt.Errorf("failed to commit copy of %s: %w", &chunk.CopyChunk, err)
+	}
+	committed = true
+
+	if s.chunks != nil {
+		if err := s.chunks.CompleteChunk(chunk.ID, rows, counter.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertChunk copies one chunk with batched INSERTs, for when COPY is not used
+// Chunks of tables with a primary key are read in key order, every batch is committed on the target
+// together with the key of its last row and the copy resumes after the last key committed. Other
+// chunks are copied in one target transaction, like with COPY.
+func (s *FullSyncState) insertChunk(ctx context.Context, taskID string, source, target *repository.CopyStreamManager, chunk *model.FullSyncChunk, cols copyColumns, progress *copyProgress) error {
+	key, err := source.PrimaryKey(ctx, chunk.SourceSchema, chunk.SourceTable)
+	if err != nil {
+		return err
+	}
+	cursor, err := repository.ParseCopyCursor(chunk)
+	if err != nil {
+		return err
+	}
+	// Without persisted progress there is no position to resume from
+	resumable := s.chunks != nil && len(key) > 0
+	if s.chunks != nil {
+		if err := s.chunks.StartChunk(chunk.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := target.BeginTransaction(ctx); err != nil {
+		return fmt.Errorf("failed to begin copy of %s: %w", &chunk.CopyChunk, err)
+	}
+	open := true
+	defer func() {
+		if open {
+			target.RollbackTransaction(context.Background())
+		}
+	}()
+
+	counter := progress.start(chunk.ID)
+	counter.Add(int(cursor.Rows), 0)
+	source.SetProgress(counter)
+	err = source.ReadChunkBatches(ctx, &chunk.CopyChunk, cols.read(), key, cursor.LastKey, func(rows [][]*string, lastKey []string) error {
+		if cols.binding != nil {
+			transformed := rows[:0]
+			for _, row := range rows {
+				values, keep, err := cols.binding.Apply(row)
+				if err != nil {
+					return err
+				}
+				if keep {
+					transformed = append(transformed, values)
+				}
+			}
+			rows = transformed
+		}
+		if err := target.InsertRows(ctx, chunk.TargetSchema, chunk.TargetTable, cols.target, rows); err != nil {
+			return err
+		}
+		cursor.Rows += int64(len(rows))
+		if !resumable {
+			return nil
+		}
+
+		cursor.LastKey = lastKey
+		if err := target.RecordBatch(ctx, taskID, chunk.ID, cursor); err != nil {
+			return err
+		}
+		open = false
+		if err := target.EndTransaction(ctx); err != nil {
+			return fmt.Errorf("failed to commit batch: %w", err)
+		}
+		if err := s.chunks.SaveCursor(chunk, cursor); err != nil {
+			return err
+		}
+		if err := target.BeginTransaction(ctx); err != nil {
+			return fmt.Errorf("failed to begin batch: %w", err)
+		}
+		open = true
+		return nil
+	})
+	source.SetProgress(nil)
+	progress.finish(chunk.ID)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", &chunk.CopyChunk, err)
+	}
+
+	if s.chunks != nil {
+		if err := target.RecordChunk(ctx, taskID, chunk.ID, cursor.Rows); err != nil {
+			return err
+		}
+	}
+	open = false
+	if err := target.EndTransaction(ctx); err != nil {
+		return fmt.Errorf("failed to commit copy of %s: %w", &chunk.CopyChunk, err)
+	}
+
+	if s.chunks != nil {
+		if err := s.chunks.CompleteChunk(chunk.ID, cursor.Rows, counter.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyKey identifies the source and target tables of a chunk
+func copyKey(chunk *model.CopyChunk) string {
+	return chunk.SourceSchema + "." + chunk.SourceTable + "->" + chunk.TargetSchema + "." + chunk.TargetTable
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"github.com/pg/dts/internal/replication"
+	"github.com/pg/dts/internal/repository"
+)
+
+// publishViaRoot reports whether publications of the task should use publish_via_partition_root
+// Partition changes are only published as leaf changes when every partitioned table has the same
+// layout on the target, otherwise the leaf tables would not exist there. Non-database sinks
+// always receive changes under the root table name
+func publishViaRoot(task *model.MigrationTask, tables []string) (bool, error) {
+	writes, err := writesTarget(task)
+	if err != nil {
+		return false, err
+	}
+	if !writes {
+		return true, nil
+	}
+
+	sourceRepo, err := repository.NewSourceRepositoryFromTask(task)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	targetRepo, err := repository.NewTargetRepositoryFromTask(task)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	names, err := taskNames(task)
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range tables {
+		schema, table := naming.Split(name)
+		sourcePartitions, err := sourceRepo.GetPartitionInfo(schema, table)
+		if err != nil {
+			return false, err
+		}
+		targetSchema, targetTable := names.Table(schema, table)
+		targetPartitions, err := targetRepo.GetPartitionInfo(targetSchema, targetTable)
+		if err != nil {
+			return false, err
+		}
+		if !sourcePartitions.IsPartitioned() && !targetPartitions.IsPartitioned() {
+			continue
+		}
+		if !sourcePartitions.SameLayout(targetPartitions, names.Table) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// createTaskPublication creates a publication, via the partition root if viaRoot is set
+func createTaskPublication(pubManager *replication.PublicationManager, pubName string, tables []string, viaRoot bool) error {
+	if viaRoot {
+		return pubManager.CreatePublicationViaRoot(pubName, tables)
+	}
+	return pubManager.CreatePublication(pubName, tables)
+}
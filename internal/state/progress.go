@@ -0,0 +1,90 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pg/dts/internal/logger"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
+)
+
+// progressInterval is how often the progress of chunks being copied is persisted
+const progressInterval = 2 * time.Second
+
+// copyProgress tracks the chunks being copied and periodically persists their progress
+// together with the overall task progress
+type copyProgress struct {
+	taskID string
+	chunks *repository.FullSyncRepository
+	mu     sync.Mutex
+	active map[uint]*repository.CopyProgress
+}
+
+// newCopyProgress creates a progress tracker for a task, persisting to chunks unless it is nil
+func newCopyProgress(taskID string, chunks *repository.FullSyncRepository) *copyProgress {
+	return &copyProgress{taskID: taskID, chunks: chunks, active: make(map[uint]*repository.CopyProgress)}
+}
+
+// start registers a chunk being copied and returns its counter
+func (p *copyProgress) start(id uint) *repository.CopyProgress {
+	counter := &repository.CopyProgress{}
+	p.mu.Lock()
+	p.active[id] = counter
+	p.mu.Unlock()
+	return counter
+}
+
+// finish unregisters a chunk
+func (p *copyProgress) finish(id uint) {
+	p.mu.Lock()
+	delete(p.active, id)
+	p.mu.Unlock()
+}
+
+// run persists progress right away and every progressInterval until ctx is done, then a last time
+func (p *copyProgress) run(ctx context.Context) {
+	p.flush()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.flush()
+			return
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+// flush persists the rows and bytes of the chunks being copied and the overall task progress
+func (p *copyProgress) flush() {
+	if p.chunks == nil {
+		return
+	}
+
+	p.mu.Lock()
+	counts := make(map[uint][2]int64, len(p.active))
+	for id, counter := range p.active {
+		counts[id] = [2]int64{counter.Rows(), counter.Bytes()}
+	}
+	p.mu.Unlock()
+
+	for id, count := range counts {
+		if err := p.chunks.UpdateChunkProgress(id, count[0], count[1]); err != nil {
+			logger.GetLogger().WithError(err).WithField("task_id", p.taskID).Warn("Failed to persist chunk progress")
+		}
+	}
+
+	chunks, err := p.chunks.ListChunks(p.taskID)
+	if err != nil {
+		logger.GetLogger().WithError(err).WithField("task_id", p.taskID).Warn("Failed to load full sync progress")
+		return
+	}
+	_, progress := model.SummarizeProgress(chunks, time.Now())
+	if err := p.chunks.UpdateTaskProgress(p.taskID, progress); err != nil {
+		logger.GetLogger().WithError(err).WithField("task_id", p.taskID).Warn("Failed to persist task progress")
+	}
+}
@@ -0,0 +1,185 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pg/dts/internal/logger"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"github.com/pg/dts/internal/repository"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// DiffSchema compares the structure of a task's tables in its source databases with their target tables
+// Tables with column transformations or a partitioning override are reshaped on purpose and are skipped.
+func DiffSchema(task *model.MigrationTask) (*model.SchemaDiff, error) {
+	writes, err := writesTarget(task)
+	if err != nil {
+		return nil, err
+	}
+	if !writes {
+		return nil, fmt.Errorf("schema diff requires the postgresql sink")
+	}
+
+	sourceConfig, err := repository.ParseSourceDB(task)
+	if err != nil {
+		return nil, err
+	}
+	targetConfig, err := repository.ParseTargetDB(task)
+	if err != nil {
+		return nil, err
+	}
+	names, err := taskNames(task)
+	if err != nil {
+		return nil, err
+	}
+	databases, err := sourceDatabases(task)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := newSchemaDiff()
+	for _, database := range databases {
+		sourceDBConfig, targetDBConfig := *sourceConfig, *targetConfig
+		sourceDBConfig.DBName, targetDBConfig.DBName = database, names.Database(database)
+		sourceDB, err := repository.GetOrCreateGORMConnection(task, &sourceDBConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to source database %s: %w", database, err)
+		}
+		targetDB, err := repository.GetOrCreateGORMConnection(task, &targetDBConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to target database %s: %w", targetDBConfig.DBName, err)
+		}
+		if err := diffDatabase(task, database, sourceDB, targetDB, false, diff); err != nil {
+			return nil, err
+		}
+	}
+	return diff, nil
+}
+
+// sourceDatabases returns the source databases the task's filters select
+func sourceDatabases(task *model.MigrationTask) ([]string, error) {
+	selector, err := taskSelector(task)
+	if err != nil {
+		return nil, err
+	}
+	sourceDB, err := repository.GetOrCreateSourceGORMConnection(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	databases, err := repository.NewSourceRepositoryFromDB(sourceDB).GetDatabases()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, database := range databases {
+		if selector.Database(database) {
+			selected = append(selected, database)
+		}
+	}
+	return selected, nil
+}
+
+// newSchemaDiff returns an empty schema diff checked now
+func newSchemaDiff() *model.SchemaDiff {
+	return &model.SchemaDiff{
+		CheckedAt:  time.Now(),
+		Tables:     []model.TableDiff{},
+		Statements: []string{},
+	}
+}
+
+// diffDatabase compares the task's tables found in a source database with their target tables and
+// adds the differences to diff
+// With columnsOnly, indexes and constraints are not compared, for when they are not created yet.
+func diffDatabase(task *model.MigrationTask, database string, sourceDB, targetDB *gorm.DB, columnsOnly bool, diff *model.SchemaDiff) error {
+	names, err := taskNames(task)
+	if err != nil {
+		return err
+	}
+	tables, err := repository.ParseTables(task)
+	if err != nil {
+		return err
+	}
+	transforms, err := repository.ParseTransforms(task)
+	if err != nil {
+		return err
+	}
+	partitioning, err := repository.ParsePartitioning(task)
+	if err != nil {
+		return err
+	}
+	reshaped := make(map[string]bool, len(transforms)+len(partitioning))
+	for name := range transforms {
+		schema, table := naming.Split(name)
+		reshaped[schema+"."+table] = true
+	}
+	for name := range partitioning {
+		schema, table := naming.Split(name)
+		reshaped[schema+"."+table] = true
+	}
+
+	// Types and functions used by the tables are mapped to their target names before comparing
+	migrated, err := migratedTables(task, sourceDB)
+	if err != nil {
+		return err
+	}
+	schemas, err := selectedSchemas(task, sourceDB)
+	if err != nil {
+		return err
+	}
+	sourceRepo := repository.NewSourceRepositoryFromDB(sourceDB)
+	objects, err := sourceRepo.GetSchemaNames(schemas, migrated, names)
+	if err != nil {
+		return err
+	}
+
+	targetRepo := repository.NewSourceRepositoryFromDB(targetDB)
+	for _, table := range tables {
+		schema, name := naming.Split(table)
+		source, err := sourceRepo.GetQualifiedTableInfo(schema, name)
+		if err != nil {
+			return fmt.Errorf("failed to get source table %s: %w", table, err)
+		}
+		if len(source.Columns) == 0 {
+			continue // Table is not in this database
+		}
+		if reshaped[schema+"."+name] {
+			diff.Skipped = append(diff.Skipped, table)
+			continue
+		}
+
+		targetSchema, targetTable := names.Table(schema, name)
+		target, err := targetRepo.GetQualifiedTableInfo(targetSchema, targetTable)
+		if err != nil {
+			return fmt.Errorf("failed to get target table %s.%s: %w", targetSchema, targetTable, err)
+		}
+		if columnsOnly {
+			source.Indexes, source.Constraints = nil, nil
+			target.Indexes, target.Constraints = nil, nil
+		}
+		diff.Compared++
+		tableDiff := repository.DiffTable(database, source, target, names, objects)
+		if len(tableDiff.Changes) > 0 {
+			diff.Tables = append(diff.Tables, tableDiff)
+			diff.Statements = append(diff.Statements, tableDiff.Statements...)
+		}
+	}
+	return nil
+}
+
+// logSchemaDiff logs the tables whose target structure differs from the source
+func logSchemaDiff(task *model.MigrationTask, diff *model.SchemaDiff) {
+	for _, table := range diff.Tables {
+		logger.GetLogger().WithFields(logrus.Fields{
+			"task_id":    task.ID,
+			"database":   table.Database,
+			"table":      table.SourceSchema + "." + table.SourceTable,
+			"changes":    len(table.Changes),
+			"statements": table.Statements,
+		}).Warn("Target table structure differs from the source")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
 )
 
 // State represents the state interface
@@ -36,19 +37,44 @@ func (b *BaseState) CanTransition() bool {
 	return true
 }
 
+// Repositories are the metadata repositories states persist their progress in
+// A nil repository disables what it persists, e.g. a full sync without one cannot be resumed
+type Repositories struct {
+	FullSync *repository.FullSyncRepository
+	Schema   *repository.SchemaRepository // Without it post-data statements run with the tables
+}
+
+// repositoryUser is implemented by states that persist their progress
+type repositoryUser interface {
+	useRepositories(repos *Repositories)
+}
+
 // StateMachine represents the state machine
 type StateMachine struct {
 	currentState State
 	task         *model.MigrationTask
+	repos        *Repositories
 }
 
 // NewStateMachine creates a new state machine
-func NewStateMachine(task *model.MigrationTask) *StateMachine {
-	state := getInitialState(task.State)
-	return &StateMachine{
-		currentState: state,
-		task:         task,
+func NewStateMachine(task *model.MigrationTask, repos *Repositories) *StateMachine {
+	if repos == nil {
+		repos = &Repositories{}
+	}
+	sm := &StateMachine{
+		task:  task,
+		repos: repos,
+	}
+	sm.setState(getInitialState(task.State))
+	return sm
+}
+
+// setState makes state the current state, handing it the repositories it uses
+func (sm *StateMachine) setState(state State) {
+	if user, ok := state.(repositoryUser); ok {
+		user.useRepositories(sm.repos)
 	}
+	sm.currentState = state
 }
 
 // Execute executes the current state
@@ -66,7 +92,7 @@ func (sm *StateMachine) Execute(ctx context.Context) error {
 	if sm.currentState.CanTransition() {
 		nextState := sm.currentState.Next()
 		if nextState != nil {
-			sm.currentState = nextState
+			sm.setState(nextState)
 		}
 	}
 
@@ -80,7 +106,7 @@ func (sm *StateMachine) GetCurrentState() State {
 
 // SetState sets the state (for recovery)
 func (sm *StateMachine) SetState(stateName string) {
-	sm.currentState = getStateByName(stateName)
+	sm.setState(getStateByName(stateName))
 }
 
 // getInitialState gets the initial state by state name
@@ -95,12 +121,16 @@ func getInitialState(stateName string) State {
 		return NewCreateTablesState()
 	case model.StateFullSync:
 		return NewFullSyncState()
+	case model.StateCreateIndexes:
+		return NewCreateIndexesState()
 	case model.StateIncSync:
 		return NewIncSyncState()
 	case model.StateWaiting:
 		return NewWaitingState()
 	case model.StateValidating:
 		return NewValidatingState()
+	case model.StateFallback:
+		return NewFallbackState()
 	case model.StateCompleted:
 		return NewCompletedState()
 	case model.StateFailed:
@@ -0,0 +1,237 @@
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pg/dts/internal/archive"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/replication"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/transform"
+	"github.com/pg/dts/internal/wal"
+)
+
+// slotReleaseWait is how long a slot whose stream was just stopped is waited for before it is dropped
+const slotReleaseWait = 10 * time.Second
+
+const (
+	// forwardStreamKey is the connection pool key of the source -> target replication stream
+	forwardStreamKey = "stream:forward"
+	// reverseStreamKey is the connection pool key of the target -> source replication stream
+	reverseStreamKey = "stream:reverse"
+)
+
+// taskSlotName returns the replication slot name of the task
+func taskSlotName(task *model.MigrationTask) string {
+	return replicationObjectName("dts_slot", task)
+}
+
+// taskPublicationName returns the publication name of the task
+func taskPublicationName(task *model.MigrationTask) string {
+	return replicationObjectName("dts_pub", task)
+}
+
+// replicationObjectName builds a slot or publication name from prefix and task ID
+// Slot names may only contain lower case letters, numbers and underscores, so the UUID dashes are replaced
+func replicationObjectName(prefix string, task *model.MigrationTask) string {
+	return strings.ToLower(strings.ReplaceAll(fmt.Sprintf("%s_%s", prefix, task.ID), "-", "_"))
+}
+
+// replicationDSN returns the connection string of a logical replication connection
+func replicationDSN(dbConfig *model.DBConfig) string {
+	return dbConfig.DSN() + " replication=database"
+}
+
+// writesTarget reports whether the task's sink is the target database
+// Tasks feeding a file or webhook sink skip the stages that create, fill and verify target tables
+func writesTarget(task *model.MigrationTask) (bool, error) {
+	sinkConfig, err := repository.ParseSinkConfig(task)
+	if err != nil {
+		return false, err
+	}
+	return sinkConfig.WritesDatabase(), nil
+}
+
+// startStream starts a replication stream delivering changes to sink and stores it in the task connection pool
+// The stream owns the sink and closes it when stopped. If a stream is already stored under key, sink is closed.
+// twoPhase decodes prepared transactions at PREPARE TRANSACTION, the slot must support it.
+// Changes of tables in transforms are reshaped before they reach the sink, transforms may be nil
+func startStream(task *model.MigrationTask, key string, dbConfig *model.DBConfig, slot, publication string, twoPhase bool, sink wal.Sink, mapper wal.TableNameMapper, transforms *transform.Set) error {
+	if _, ok := task.GetConnection(key); ok {
+		sink.Close()
+		return nil
+	}
+
+	handler, err := newStreamHandler(task, sink, mapper, transforms)
+	if err != nil {
+		sink.Close()
+		return err
+	}
+	subscriber, err := replication.NewSubscriberWithHandler(replicationDSN(dbConfig), slot, handler)
+	if err != nil {
+		handler.Close()
+		return fmt.Errorf("failed to create subscriber: %w", err)
+	}
+	subscriber.SetTwoPhase(twoPhase)
+
+	// Archive the stream to <dir>/<task_id>/<forward|reverse> if enabled
+	archiveConfig, err := repository.ParseArchiveConfig(task)
+	if err != nil {
+		subscriber.Close()
+		return err
+	}
+	if archiveConfig != nil {
+		dir := filepath.Join(archiveConfig.Dir, task.ID, strings.TrimPrefix(key, "stream:"))
+		writer, err := archive.NewWriter(dir, archiveConfig)
+		if err != nil {
+			subscriber.Close()
+			return fmt.Errorf("failed to create archive writer: %w", err)
+		}
+		subscriber.SetArchive(writer)
+	}
+
+	runner, err := replication.StartRunner(subscriber, publication)
+	if err != nil {
+		return fmt.Errorf("failed to start replication stream: %w", err)
+	}
+
+	task.AddConnection(key, runner)
+	return nil
+}
+
+// newStreamHandler creates the handler passing the changes of a task's stream to sink
+// Changes are throttled by the task's apply limits and changes of tables in transforms are
+// reshaped before they reach the sink, transforms may be nil
+func newStreamHandler(task *model.MigrationTask, sink wal.Sink, mapper wal.TableNameMapper, transforms *transform.Set) (*wal.Handler, error) {
+	handler := wal.NewHandlerWithSink(sink, mapper)
+	handler.SetMarkerLog(wal.NewMarkerLog())
+	limits, err := taskThrottle(task)
+	if err != nil {
+		return nil, err
+	}
+	handler.SetLimiter(limits)
+	if !transforms.Empty() {
+		handler.SetTransformer(transforms)
+	}
+	return handler, nil
+}
+
+// NewReplayHandler creates the handler replaying the task's archived forward or reverse stream into sink
+// Archived changes are handled like the live stream: forward changes are transformed, masked and
+// filtered by the task's subsets before they reach the sink. The sink is not closed on error.
+func NewReplayHandler(task *model.MigrationTask, stream string, sink wal.Sink) (*wal.Handler, error) {
+	names, err := TaskNames(task)
+	if err != nil {
+		return nil, err
+	}
+	switch stream {
+	case "forward":
+		transforms, err := taskTransforms(task)
+		if err != nil {
+			return nil, err
+		}
+		return newStreamHandler(task, sink, names.Table, transforms)
+	case "reverse":
+		return newStreamHandler(task, sink, names.Reverse, nil)
+	default:
+		return nil, fmt.Errorf("unsupported stream: %s (supported: forward, reverse)", stream)
+	}
+}
+
+// checkStream returns the error that stopped the stream stored under key, if any
+func checkStream(task *model.MigrationTask, key string) error {
+	conn, ok := task.GetConnection(key)
+	if !ok {
+		return nil
+	}
+	runner, ok := conn.(*replication.Runner)
+	if !ok {
+		return nil
+	}
+	if err := runner.Err(); err != nil {
+		return fmt.Errorf("replication stream stopped: %w", err)
+	}
+	return nil
+}
+
+// streamMarkers returns the marker log of the stream stored under key, nil if there is no stream
+func streamMarkers(task *model.MigrationTask, key string) *wal.MarkerLog {
+	conn, ok := task.GetConnection(key)
+	if !ok {
+		return nil
+	}
+	runner, ok := conn.(*replication.Runner)
+	if !ok {
+		return nil
+	}
+	return runner.Markers()
+}
+
+// StreamMarkers returns the markers applied by the task's forward or reverse stream whose prefix starts with prefix
+// Returns an error if the stream is not running in this process
+func StreamMarkers(task *model.MigrationTask, stream, prefix string) ([]wal.Marker, error) {
+	markers := streamMarkers(task, "stream:"+stream)
+	if markers == nil {
+		return nil, fmt.Errorf("%s stream is not running", stream)
+	}
+	return markers.List(prefix), nil
+}
+
+// WALPosition samples the source WAL position and the position confirmed by the task's replication slot
+// The confirmed position is only sampled while the forward stream applies changes: during the full
+// sync the slot exists but does not advance.
+func WALPosition(task *model.MigrationTask) (*model.WALPosition, error) {
+	sourceRepo, err := repository.NewSourceRepositoryFromTask(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	position, err := sourceRepo.GetWALPosition(taskSlotName(task))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := task.GetConnection(forwardStreamKey); !ok {
+		position.Confirmed = nil
+	}
+	return position, nil
+}
+
+// stopStream stops the stream stored under key and removes it from the task connection pool
+func stopStream(task *model.MigrationTask, key string) error {
+	conn, ok := task.RemoveConnection(key)
+	if !ok {
+		return nil
+	}
+	runner, ok := conn.(*replication.Runner)
+	if !ok {
+		return nil
+	}
+	return runner.Close()
+}
+
+// dropForwardReplication stops the forward stream and drops its slot and publication on the source
+// Once changes no longer flow from the source, the slot would only make the source retain WAL.
+func dropForwardReplication(task *model.MigrationTask) error {
+	if err := stopStream(task, forwardStreamKey); err != nil {
+		return fmt.Errorf("failed to stop forward replication stream: %w", err)
+	}
+
+	sourceDB, err := repository.GetOrCreateSourceGORMConnection(task)
+	if err != nil {
+		return fmt.Errorf("failed to get source connection: %w", err)
+	}
+	slotManager, err := replication.NewSlotManagerFromDB(sourceDB)
+	if err != nil {
+		return fmt.Errorf("failed to create slot manager: %w", err)
+	}
+	if err := slotManager.DropSlotIfExists(taskSlotName(task), slotReleaseWait); err != nil {
+		return err
+	}
+	pubManager, err := replication.NewPublicationManagerFromDB(sourceDB)
+	if err != nil {
+		return fmt.Errorf("failed to create publication manager: %w", err)
+	}
+	return pubManager.DropPublication(taskPublicationName(task))
+}
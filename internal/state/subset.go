@@ -0,0 +1,122 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"github.com/pg/dts/internal/repository"
+)
+
+// subsetPredicates returns the WHERE predicates limiting the rows full sync copies, keyed by source schema.table
+// Tables without a predicate are copied whole. When foreign keys are followed, a subset table also
+// gets the rows referenced by the rows copied from the migrated tables referencing it.
+func subsetPredicates(cfg *model.FullSyncConfig, sourceRepo *repository.SourceRepository, tables []string) (map[string]string, error) {
+	base := subsetBase(cfg)
+	if len(base) == 0 || !cfg.FollowForeignKeys {
+		return base, nil
+	}
+	referencing, err := subsetReferencing(sourceRepo, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &subsetResolver{base: base, referencing: referencing}
+	predicates := make(map[string]string, len(base))
+	for table := range base {
+		predicates[table] = s.resolve(table, map[string]bool{})
+	}
+	return predicates, nil
+}
+
+// subsetBase returns the subset predicates as configured, keyed by source schema.table
+func subsetBase(cfg *model.FullSyncConfig) map[string]string {
+	base := make(map[string]string, len(cfg.Subset))
+	for name, predicate := range cfg.Subset {
+		schema, table := naming.Split(name)
+		base[schema+"."+table] = predicate
+	}
+	return base
+}
+
+// subsetChangeFilters returns the subset predicates the change stream applies, keyed by source schema.table
+// When foreign keys are followed, a subset table referenced by migrated tables gets every change,
+// since a new referencing row may reference any of its rows.
+func subsetChangeFilters(cfg *model.FullSyncConfig, sourceRepo *repository.SourceRepository, tables []string) (map[string]string, error) {
+	base := subsetBase(cfg)
+	if len(base) == 0 || !cfg.FollowForeignKeys {
+		return base, nil
+	}
+	referencing, err := subsetReferencing(sourceRepo, tables)
+	if err != nil {
+		return nil, err
+	}
+	for table := range referencing {
+		delete(base, table)
+	}
+	return base, nil
+}
+
+// subsetReferencing returns the foreign keys of the migrated tables by referenced schema.table
+func subsetReferencing(sourceRepo *repository.SourceRepository, tables []string) (map[string][]model.ForeignKey, error) {
+	foreignKeys, err := sourceRepo.GetForeignKeys()
+	if err != nil {
+		return nil, err
+	}
+	migrated := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		schema, name := naming.Split(table)
+		migrated[schema+"."+name] = true
+	}
+	referencing := make(map[string][]model.ForeignKey)
+	for _, fk := range foreignKeys {
+		if migrated[fk.Schema+"."+fk.Table] {
+			ref := fk.RefSchema + "." + fk.RefTable
+			referencing[ref] = append(referencing[ref], fk)
+		}
+	}
+	return referencing, nil
+}
+
+// subsetResolver expands subset predicates along foreign keys
+type subsetResolver struct {
+	base        map[string]string
+	referencing map[string][]model.ForeignKey
+}
+
+// resolve returns the predicate of a table, empty if it is copied whole
+// Tables on the path are not expanded again, so a cycle of foreign keys is followed once
+func (s *subsetResolver) resolve(table string, path map[string]bool) string {
+	predicate, ok := s.base[table]
+	if !ok {
+		return ""
+	}
+	conditions := []string{"(" + predicate + ")"}
+
+	path[table] = true
+	defer delete(path, table)
+	for _, fk := range s.referencing[table] {
+		child := fk.Schema + "." + fk.Table
+		childPredicate := s.base[child]
+		if !path[child] {
+			childPredicate = s.resolve(child, path)
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s", quoteIdentifiers(fk.Columns), pgx.Identifier{fk.Schema, fk.Table}.Sanitize())
+		if childPredicate != "" {
+			query += " WHERE " + childPredicate
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s) IN (%s)", quoteIdentifiers(fk.RefColumns), query))
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// quoteIdentifiers quotes a list of column names
+func quoteIdentifiers(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = pgx.Identifier{col}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,43 @@
+package state
+
+import (
+	"sync"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/throttle"
+)
+
+// throttleKey is the connection pool key of the task's live rate limits
+const throttleKey = "throttle"
+
+// throttleMu serializes creating the rate limits of a task
+var throttleMu sync.Mutex
+
+// taskThrottle returns the live rate limits of a task, created from its configuration on first use
+func taskThrottle(task *model.MigrationTask) (*throttle.Throttle, error) {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+
+	if t, ok := task.GetConnection(throttleKey); ok {
+		return t.(*throttle.Throttle), nil
+	}
+	cfg, err := repository.ParseThrottleConfig(task)
+	if err != nil {
+		return nil, err
+	}
+	t := throttle.New(cfg)
+	task.AddConnection(throttleKey, t)
+	return t, nil
+}
+
+// UpdateThrottle changes the rate limits of a running task
+// The full sync reader and the change apply writer slow down or speed up within a second
+func UpdateThrottle(task *model.MigrationTask, cfg *model.ThrottleConfig) error {
+	t, err := taskThrottle(task)
+	if err != nil {
+		return err
+	}
+	t.Update(cfg)
+	return nil
+}
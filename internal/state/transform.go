@@ -0,0 +1,139 @@
+package state
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
+	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/transform"
+)
+
+// transformKey is the connection pool key of the task's compiled column transformations
+const transformKey = "transform"
+
+// transformMu serializes compiling the transformations of a task
+var transformMu sync.Mutex
+
+// taskTransforms returns the compiled column transformations, masking and change stream subset
+// filters of a task, compiled on first use
+// Masks that collapse distinct values are rejected on the key and unique columns of the source tables.
+// Leaf partitions of a transformed or subset partitioned table use the table's transformation and
+// predicate, since they are copied and replicated under their own names
+func taskTransforms(task *model.MigrationTask) (*transform.Set, error) {
+	transformMu.Lock()
+	defer transformMu.Unlock()
+
+	if set, ok := task.GetConnection(transformKey); ok {
+		return set.(*transform.Set), nil
+	}
+	specs, err := repository.ParseTransforms(task)
+	if err != nil {
+		return nil, err
+	}
+	set, err := transform.NewSet(specs)
+	if err != nil {
+		return nil, err
+	}
+	maskingConfig, err := repository.ParseMaskingConfig(task)
+	if err != nil {
+		return nil, err
+	}
+	if err := set.AddMasking(maskingConfig, task.ID); err != nil {
+		return nil, err
+	}
+	fullSyncConfig, err := repository.ParseFullSyncConfig(task)
+	if err != nil {
+		return nil, err
+	}
+
+	if !set.Empty() || len(fullSyncConfig.Subset) > 0 {
+		sourceRepo, err := repository.NewSourceRepositoryFromTask(task)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to source database: %w", err)
+		}
+		if err := addSubsetFilters(set, sourceRepo, task, fullSyncConfig); err != nil {
+			return nil, err
+		}
+		for _, name := range set.Names() {
+			schema, table := naming.Split(name)
+			unique, err := sourceRepo.GetUniqueColumns(schema, table)
+			if err != nil {
+				return nil, err
+			}
+			if err := set.Table(schema, table).CheckUniqueMasks(unique); err != nil {
+				return nil, fmt.Errorf("invalid masking of table %s: %w", name, err)
+			}
+			partitions, err := sourceRepo.GetPartitionInfo(schema, table)
+			if err != nil {
+				return nil, err
+			}
+			for _, leaf := range partitions.Leaves {
+				set.AddPartition(leaf.Schema, leaf.Name, name)
+			}
+		}
+	}
+	task.AddConnection(transformKey, set)
+	return set, nil
+}
+
+// addSubsetFilters adds the subset predicates the change stream applies to a task's transformations
+func addSubsetFilters(set *transform.Set, sourceRepo *repository.SourceRepository, task *model.MigrationTask, cfg *model.FullSyncConfig) error {
+	tables, err := repository.ParseTables(task)
+	if err != nil {
+		return err
+	}
+	filters, err := subsetChangeFilters(cfg, sourceRepo, tables)
+	if err != nil {
+		return err
+	}
+	for name, predicate := range filters {
+		schema, table := naming.Split(name)
+		if err := set.AddSubset(schema, table, predicate); err != nil {
+			return err
+		}
+		partitions, err := sourceRepo.GetPartitionInfo(schema, table)
+		if err != nil {
+			return err
+		}
+		for _, leaf := range partitions.Leaves {
+			if err := set.AddSubset(leaf.Schema, leaf.Name, predicate); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkFilterIdentity requires REPLICA IDENTITY FULL on filtered and subset tables whose values can be TOASTed
+// An update leaves unchanged TOAST values out of its new row, and only the old row of REPLICA
+// IDENTITY FULL carries them for evaluating the filter and inserting the row
+func checkFilterIdentity(sourceRepo *repository.SourceRepository, transforms *transform.Set, tables []string) error {
+	for _, name := range tables {
+		schema, table := naming.Split(name)
+		if !transforms.FiltersChanges(schema, table) {
+			continue
+		}
+
+		// Changes of a partitioned table are decoded from its leaf partitions
+		partitions, err := sourceRepo.GetPartitionInfo(schema, table)
+		if err != nil {
+			return err
+		}
+		relations := []model.PartitionLeaf{{Schema: schema, Name: table}}
+		if partitions.IsPartitioned() {
+			relations = partitions.Leaves
+		}
+		for _, rel := range relations {
+			identity, toastable, err := sourceRepo.GetReplicaIdentity(rel.Schema, rel.Name)
+			if err != nil {
+				return err
+			}
+			if toastable && identity != "f" {
+				return fmt.Errorf("table %s.%s has a filter and columns that can be TOASTed, set REPLICA IDENTITY FULL on it", rel.Schema, rel.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -3,15 +3,19 @@ package state
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
 	"github.com/pg/dts/internal/repository"
+	"github.com/pg/dts/internal/transform"
 )
 
 // ValidatingState represents the validating state
 type ValidatingState struct {
 	BaseState
+	fallback bool // Whether the task continues with reverse replication after validation
 }
 
 // NewValidatingState creates a new validating state
@@ -23,6 +27,37 @@ func NewValidatingState() *ValidatingState {
 
 // Execute executes the validation logic
 func (s *ValidatingState) Execute(ctx context.Context, task *model.MigrationTask) error {
+	s.fallback = task.Fallback
+
+	// Wait until the target has applied every change committed on the source before the switchover,
+	// a task falling back awaited it at switchover and stopped forward replication then
+	if !s.fallback {
+		if err := awaitFence(ctx, task); err != nil {
+			return fmt.Errorf("failed to await fence: %w", err)
+		}
+	}
+	if err := s.validate(ctx, task); err != nil {
+		return err
+	}
+
+	// Without fallback nothing flows from the source any more
+	if !s.fallback {
+		return dropForwardReplication(task)
+	}
+	return nil
+}
+
+// validate compares the source and target tables until they match
+func (s *ValidatingState) validate(ctx context.Context, task *model.MigrationTask) error {
+	// There are no target tables to validate when changes go to a non-database sink
+	writes, err := writesTarget(task)
+	if err != nil {
+		return err
+	}
+	if !writes {
+		return nil
+	}
+
 	// Step 1: Set source database to read-only
 	// TODO: Implement setting source database to read-only mode
 	// This might require superuser privileges
@@ -46,9 +81,31 @@ func (s *ValidatingState) Execute(ctx context.Context, task *model.MigrationTask
 	}
 	// Connections are managed by task manager, don't close here
 
+	// Tables with a row filter are compared with the matching source rows
+	transforms, err := taskTransforms(task)
+	if err != nil {
+		return err
+	}
+	// The masked profile also compares the content of the columns that are copied unchanged
+	maskingConfig, err := repository.ParseMaskingConfig(task)
+	if err != nil {
+		return err
+	}
+	compareContent := maskingConfig != nil && maskingConfig.Profile == model.ValidationProfileMasked
+	names, err := taskNames(task)
+	if err != nil {
+		return err
+	}
+	// Subset tables compare the rows matching their predicate on both sides. Rows a followed
+	// foreign key copied besides, and the changes applied to them, are not compared.
+	fullSyncConfig, err := repository.ParseFullSyncConfig(task)
+	if err != nil {
+		return err
+	}
+	subsets := subsetBase(fullSyncConfig)
+
 	// Step 2: Loop to check source and target table data until they match
 	// Check if PostgreSQL checksum is enabled, if so use checksum, otherwise use count(*)
-	schema := "public"
 	maxRetries := 10
 	retryInterval := 5 * time.Second
 
@@ -56,8 +113,8 @@ func (s *ValidatingState) Execute(ctx context.Context, task *model.MigrationTask
 		allMatch := true
 
 		for _, tableName := range tables {
-			sourceTable := tableName
-			targetTable := tableName + task.TableSuffix
+			schema, sourceTable := naming.Split(tableName)
+			targetSchema, targetTable := names.Table(schema, sourceTable)
 
 			// Check if checksum is enabled (simplified: always use count for now)
 			// TODO: Check PostgreSQL checksum configuration
@@ -81,13 +138,37 @@ func (s *ValidatingState) Execute(ctx context.Context, task *model.MigrationTask
 				// }
 				// Fall through to count(*) method
 			}
+			// Tables with a row filter are compared by evaluating the filter the way the copy and
+			// the change stream do, the filter is not SQL
+			tr := transforms.Table(schema, sourceTable)
+			subset := subsets[schema+"."+sourceTable]
+			if tr != nil && tr.HasFilter() {
+				match, err := s.compareFiltered(ctx, task, sourceRepo, targetRepo, tr, subset, compareContent, schema, sourceTable, targetSchema, targetTable)
+				if err != nil {
+					return err
+				}
+				if !match {
+					allMatch = false
+					break
+				}
+				continue
+			}
+
 			// Use count(*) comparison
-			sourceValue, err = sourceRepo.GetTableCount(schema, sourceTable)
+			if subset != "" {
+				sourceValue, err = sourceRepo.GetFilteredTableCount(schema, sourceTable, subset)
+			} else {
+				sourceValue, err = sourceRepo.GetTableCount(schema, sourceTable)
+			}
 			if err != nil {
 				return fmt.Errorf("failed to get source table count for %s: %w", tableName, err)
 			}
 
-			targetValue, err = targetRepo.GetTableCount(schema, targetTable)
+			if subset != "" {
+				targetValue, err = targetRepo.GetFilteredTableCount(targetSchema, targetTable, subset)
+			} else {
+				targetValue, err = targetRepo.GetTableCount(targetSchema, targetTable)
+			}
 			if err != nil {
 				return fmt.Errorf("failed to get target table count for %s: %w", tableName, err)
 			}
@@ -98,6 +179,17 @@ func (s *ValidatingState) Execute(ctx context.Context, task *model.MigrationTask
 				// TODO: Log mismatch
 				break
 			}
+
+			if compareContent {
+				match, err := s.compareUnmasked(sourceRepo, targetRepo, tr, subset, schema, sourceTable, targetSchema, targetTable)
+				if err != nil {
+					return err
+				}
+				if !match {
+					allMatch = false
+					break
+				}
+			}
 		}
 
 		if allMatch {
@@ -119,7 +211,152 @@ func (s *ValidatingState) Execute(ctx context.Context, task *model.MigrationTask
 	return fmt.Errorf("validation failed: source and target data do not match after %d attempts", maxRetries)
 }
 
+// compareUnmasked compares the checksums of the source columns copied unchanged with their target columns
+// Masked, cast and dropped columns are left out, tr may be nil for tables copied as they are.
+// Only the rows matching predicate on both sides are compared, an empty predicate compares all rows
+func (s *ValidatingState) compareUnmasked(sourceRepo *repository.SourceRepository, targetRepo *repository.TargetRepository, tr *transform.Table, predicate, schema, sourceTable, targetSchema, targetTable string) (bool, error) {
+	compared, targetCompared, err := comparedColumns(sourceRepo, targetRepo, tr, schema, sourceTable, targetSchema, targetTable)
+	if err != nil {
+		return false, err
+	}
+	sourceChecksum, err := sourceRepo.GetTableChecksum(schema, sourceTable, compared, predicate)
+	if err != nil {
+		return false, err
+	}
+	targetChecksum, err := targetRepo.GetTableChecksum(targetSchema, targetTable, targetCompared, predicate)
+	if err != nil {
+		return false, err
+	}
+	return sourceChecksum == targetChecksum, nil
+}
+
+// compareFiltered compares a table with a row filter with the source rows matching the filter
+// and the subset predicate, whose target rows are those matching the subset predicate. The source
+// rows are read and filtered here; with compareContent the unmasked columns of both sides are also
+// checksummed here.
+func (s *ValidatingState) compareFiltered(ctx context.Context, task *model.MigrationTask, sourceRepo *repository.SourceRepository, targetRepo *repository.TargetRepository, tr *transform.Table, subset string, compareContent bool, schema, sourceTable, targetSchema, targetTable string) (bool, error) {
+	sourceColumns, err := sourceRepo.GetColumnNames(schema, sourceTable)
+	if err != nil {
+		return false, err
+	}
+	binding, err := tr.Bind(sourceColumns, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to bind transformation of %s.%s: %w", schema, sourceTable, err)
+	}
+	var compared, targetCompared []string
+	if compareContent {
+		if compared, targetCompared, err = comparedColumns(sourceRepo, targetRepo, tr, schema, sourceTable, targetSchema, targetTable); err != nil {
+			return false, err
+		}
+	}
+	positions := make([]int, len(compared))
+	for i, col := range compared {
+		positions[i] = slices.Index(sourceColumns, col)
+	}
+
+	sourceDB, err := repository.GetOrCreateSourceGORMConnection(task)
+	if err != nil {
+		return false, fmt.Errorf("failed to get source connection: %w", err)
+	}
+	source, err := repository.NewCopyStreamManager(sourceDB)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer source.Close()
+
+	var sourceCount int64
+	var sourceChecksum repository.RowChecksum
+	row := make([]*string, len(positions))
+	err = source.ScanTable(ctx, schema, sourceTable, sourceColumns, subset, func(values []*string) error {
+		match, err := binding.Match(values)
+		if err != nil || !match {
+			return err
+		}
+		sourceCount++
+		if len(positions) > 0 {
+			for i, pos := range positions {
+				row[i] = values[pos]
+			}
+			sourceChecksum.Add(row)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s.%s: %w", schema, sourceTable, err)
+	}
+
+	var targetCount int64
+	if subset != "" {
+		targetCount, err = targetRepo.GetFilteredTableCount(targetSchema, targetTable, subset)
+	} else {
+		targetCount, err = targetRepo.GetTableCount(targetSchema, targetTable)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get target table count for %s.%s: %w", targetSchema, targetTable, err)
+	}
+	if sourceCount != targetCount || len(targetCompared) == 0 {
+		return sourceCount == targetCount, nil
+	}
+
+	targetDB, err := repository.GetOrCreateTargetGORMConnection(task)
+	if err != nil {
+		return false, fmt.Errorf("failed to get target connection: %w", err)
+	}
+	target, err := repository.NewCopyStreamManager(targetDB)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer target.Close()
+
+	var targetChecksum repository.RowChecksum
+	err = target.ScanTable(ctx, targetSchema, targetTable, targetCompared, subset, func(values []*string) error {
+		targetChecksum.Add(values)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s.%s: %w", targetSchema, targetTable, err)
+	}
+	return sourceChecksum.String() == targetChecksum.String(), nil
+}
+
+// comparedColumns returns the source columns copied unchanged and their target columns
+// Masked, cast and dropped columns are left out, tr may be nil for tables copied as they are
+func comparedColumns(sourceRepo *repository.SourceRepository, targetRepo *repository.TargetRepository, tr *transform.Table, schema, sourceTable, targetSchema, targetTable string) ([]string, []string, error) {
+	sourceColumns, err := sourceRepo.GetColumnNames(schema, sourceTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	targetColumns, err := targetRepo.GetColumnNames(targetSchema, targetTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	onTarget := make(map[string]bool, len(targetColumns))
+	for _, col := range targetColumns {
+		onTarget[col] = true
+	}
+
+	var compared, targetCompared []string
+	for _, col := range sourceColumns {
+		name := col
+		if tr != nil {
+			if tr.Masked(col) || tr.Cast(col) {
+				continue
+			}
+			name = tr.TargetName(col)
+		}
+		if name == "" || !onTarget[name] {
+			continue
+		}
+		compared = append(compared, col)
+		targetCompared = append(targetCompared, name)
+	}
+	return compared, targetCompared, nil
+}
+
 // Next returns the next state
 func (s *ValidatingState) Next() State {
+	if s.fallback {
+		return NewFallbackState()
+	}
 	return NewCompletedState()
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/naming"
 	"github.com/pg/dts/internal/repository"
 )
 
@@ -26,6 +27,36 @@ func (s *WaitingState) Execute(ctx context.Context, task *model.MigrationTask) e
 	// This state mainly waits for switch API
 	// Periodically check synchronization status
 
+	// Fail fast if the background replication stream has stopped
+	if err := checkStream(task, forwardStreamKey); err != nil {
+		return err
+	}
+
+	// Compare row counts when changes are applied to the target database
+	writes, err := writesTarget(task)
+	if err != nil {
+		return err
+	}
+	if writes {
+		if err := s.compareRowCounts(task); err != nil {
+			return err
+		}
+	}
+
+	// Wait a bit before next check (this is a simplified implementation)
+	// In actual implementation, this should be controlled by external switch API
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(5 * time.Second):
+		// Continue waiting
+	}
+
+	return nil
+}
+
+// compareRowCounts compares row counts between source and target tables
+func (s *WaitingState) compareRowCounts(task *model.MigrationTask) error {
 	// Parse table list
 	tables, err := repository.ParseTables(task)
 	if err != nil {
@@ -43,12 +74,16 @@ func (s *WaitingState) Execute(ctx context.Context, task *model.MigrationTask) e
 		return fmt.Errorf("failed to connect to target database: %w", err)
 	}
 
+	names, err := taskNames(task)
+	if err != nil {
+		return err
+	}
+
 	// Periodically check synchronization status
 	// Compare row counts between source and target tables
-	schema := "public"
 	for _, tableName := range tables {
-		sourceTable := tableName
-		targetTable := tableName + task.TableSuffix
+		schema, sourceTable := naming.Split(tableName)
+		targetSchema, targetTable := names.Table(schema, sourceTable)
 
 		// Get source table row count
 		sourceCount, err := sourceRepo.GetTableCount(schema, sourceTable)
@@ -57,7 +92,7 @@ func (s *WaitingState) Execute(ctx context.Context, task *model.MigrationTask) e
 		}
 
 		// Get target table row count
-		targetCount, err := targetRepo.GetTableCount(schema, targetTable)
+		targetCount, err := targetRepo.GetTableCount(targetSchema, targetTable)
 		if err != nil {
 			return fmt.Errorf("failed to get target table count for %s: %w", tableName, err)
 		}
@@ -68,15 +103,6 @@ func (s *WaitingState) Execute(ctx context.Context, task *model.MigrationTask) e
 			tableName, sourceCount, targetCount, sourceCount-targetCount)
 	}
 
-	// Wait a bit before next check (this is a simplified implementation)
-	// In actual implementation, this should be controlled by external switch API
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(5 * time.Second):
-		// Continue waiting
-	}
-
 	return nil
 }
 
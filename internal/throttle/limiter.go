@@ -0,0 +1,105 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxSleep bounds a single wait so that rate changes are picked up promptly
+const maxSleep = time.Second
+
+// Limiter is a token bucket rate limiter whose rate can be changed while it is in use
+// The bucket holds at most one second of tokens. A request larger than the bucket is let
+// through once the bucket is not in debt and its excess is paid back by later requests.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens per second, 0 means unlimited
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a limiter allowing rate tokens per second, 0 means unlimited
+func NewLimiter(rate int64) *Limiter {
+	l := &Limiter{}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate changes the rate, 0 means unlimited
+// The tokens earned so far are kept, so a debt is still paid back; an unchanged rate is left alone
+func (l *Limiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rate < 0 {
+		rate = 0
+	}
+	if float64(rate) == l.rate && !l.last.IsZero() {
+		return
+	}
+
+	now := time.Now()
+	if l.rate == 0 {
+		// An unlimited limiter starts limiting with a full bucket
+		l.tokens = float64(rate)
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+	}
+	l.rate = float64(rate)
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+}
+
+// Rate returns the current rate, 0 means unlimited
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// WaitN blocks until n tokens are available or ctx is done
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	for {
+		wait := l.reserve(n)
+		if wait == 0 {
+			return nil
+		}
+		if wait > maxSleep {
+			wait = maxSleep
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes n tokens if the bucket is not in debt, otherwise returns how long to wait
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	if l.tokens < 0 {
+		return time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.tokens -= float64(n)
+	return 0
+}
@@ -0,0 +1,83 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+)
+
+// Semaphore limits concurrent use of a resource, its limit can be changed while it is in use
+// Lowering the limit does not revoke acquired slots; holders check Excess and give theirs back
+type Semaphore struct {
+	mu      sync.Mutex
+	limit   int // 0 means unlimited
+	inUse   int
+	changed chan struct{} // Closed and replaced whenever a slot is released or the limit changes
+}
+
+// NewSemaphore creates a semaphore with limit slots, 0 means unlimited
+func NewSemaphore(limit int) *Semaphore {
+	s := &Semaphore{changed: make(chan struct{})}
+	s.SetLimit(limit)
+	return s
+}
+
+// SetLimit changes the number of slots, 0 means unlimited
+func (s *Semaphore) SetLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit < 0 {
+		limit = 0
+	}
+	s.limit = limit
+	s.notify()
+}
+
+// Limit returns the number of slots, 0 means unlimited
+func (s *Semaphore) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+// Acquire blocks until a slot is free or ctx is done
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.limit == 0 || s.inUse < s.limit {
+			s.inUse++
+			s.mu.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release frees a slot
+func (s *Semaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inUse > 0 {
+		s.inUse--
+	}
+	s.notify()
+}
+
+// Excess reports whether more slots are in use than the limit allows
+func (s *Semaphore) Excess() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit > 0 && s.inUse > s.limit
+}
+
+// notify wakes up waiting acquirers, mu must be held
+func (s *Semaphore) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
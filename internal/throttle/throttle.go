@@ -0,0 +1,71 @@
+package throttle
+
+import (
+	"context"
+
+	"github.com/pg/dts/internal/model"
+)
+
+// Throttle holds the live rate limits of a task
+type Throttle struct {
+	fullSyncRows  *Limiter
+	fullSyncBytes *Limiter
+	applyRows     *Limiter
+	applyBytes    *Limiter
+	sourceConns   *Semaphore
+}
+
+// New creates the limits of a task
+func New(cfg *model.ThrottleConfig) *Throttle {
+	t := &Throttle{
+		fullSyncRows:  NewLimiter(0),
+		fullSyncBytes: NewLimiter(0),
+		applyRows:     NewLimiter(0),
+		applyBytes:    NewLimiter(0),
+		sourceConns:   NewSemaphore(0),
+	}
+	t.Update(cfg)
+	return t
+}
+
+// Update changes the limits, waiting readers and writers pick up the new limits within a second
+// Limits that keep their value are not touched
+func (t *Throttle) Update(cfg *model.ThrottleConfig) {
+	t.fullSyncRows.SetRate(cfg.FullSyncRowsPerSec)
+	t.fullSyncBytes.SetRate(cfg.FullSyncBytesPerSec)
+	t.applyRows.SetRate(cfg.ApplyRowsPerSec)
+	t.applyBytes.SetRate(cfg.ApplyBytesPerSec)
+	t.sourceConns.SetLimit(cfg.MaxSourceConnections)
+}
+
+// Config returns the current limits
+func (t *Throttle) Config() model.ThrottleConfig {
+	return model.ThrottleConfig{
+		FullSyncRowsPerSec:   t.fullSyncRows.Rate(),
+		FullSyncBytesPerSec:  t.fullSyncBytes.Rate(),
+		ApplyRowsPerSec:      t.applyRows.Rate(),
+		ApplyBytesPerSec:     t.applyBytes.Rate(),
+		MaxSourceConnections: t.sourceConns.Limit(),
+	}
+}
+
+// WaitFullSync blocks until the full sync reader may pass on rows and bytes
+func (t *Throttle) WaitFullSync(ctx context.Context, rows, bytes int) error {
+	if err := t.fullSyncRows.WaitN(ctx, rows); err != nil {
+		return err
+	}
+	return t.fullSyncBytes.WaitN(ctx, bytes)
+}
+
+// WaitApply blocks until the change apply writer may apply rows and bytes
+func (t *Throttle) WaitApply(ctx context.Context, rows, bytes int) error {
+	if err := t.applyRows.WaitN(ctx, rows); err != nil {
+		return err
+	}
+	return t.applyBytes.WaitN(ctx, bytes)
+}
+
+// SourceConnections returns the semaphore limiting concurrent full sync source connections
+func (t *Throttle) SourceConnections() *Semaphore {
+	return t.sourceConns
+}
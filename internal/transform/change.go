@@ -0,0 +1,303 @@
+package transform
+
+import (
+	"fmt"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/wal"
+)
+
+// Set holds the compiled transformations of a task by source table
+type Set struct {
+	tables  map[string]*Table // key: table name, or schema.table
+	aliases map[string]string // key: schema.leaf partition, value: key of its table
+	subsets map[string]*Expr  // key: schema.table, leaf partitions included
+	plain   *Table            // Transformation of subset tables that are not transformed
+}
+
+// NewSet compiles the transformations of a task, keyed by source table name or schema.table
+func NewSet(specs map[string]model.TableTransform) (*Set, error) {
+	s := &Set{tables: make(map[string]*Table, len(specs)), aliases: make(map[string]string), subsets: make(map[string]*Expr)}
+	for name, spec := range specs {
+		t, err := Compile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transformation of table %s: %w", name, err)
+		}
+		s.tables[name] = t
+	}
+	return s, nil
+}
+
+// Empty reports whether the set transforms no table and filters no change
+func (s *Set) Empty() bool {
+	return s == nil || len(s.tables) == 0 && len(s.subsets) == 0
+}
+
+// AddSubset makes the change stream drop the rows of a table that do not match a subset predicate
+// Full sync copies the subset with the predicate as SQL, so only changes are filtered here;
+// leaf partitions are added on their own.
+func (s *Set) AddSubset(schema, table, predicate string) error {
+	expr, err := ParseExpr(predicate)
+	if err != nil {
+		return fmt.Errorf("invalid subset predicate of %s.%s: %w", schema, table, err)
+	}
+	if s.plain == nil {
+		s.plain, _ = Compile(model.TableTransform{})
+	}
+	s.subsets[schema+"."+table] = expr
+	return nil
+}
+
+// FiltersChanges reports whether the change stream drops rows of a table by a filter or subset predicate
+func (s *Set) FiltersChanges(schema, table string) bool {
+	if s == nil {
+		return false
+	}
+	if t := s.Table(schema, table); t != nil && t.HasFilter() {
+		return true
+	}
+	return s.subsets[schema+"."+table] != nil
+}
+
+// AddMasking masks the columns of the tables in cfg, tables without a transformation get one
+// The hash method is salted with the masking key, or with taskID when the configuration has none
+func (s *Set) AddMasking(cfg *model.MaskingConfig, taskID string) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Profile != "" && cfg.Profile != model.ValidationProfileMasked {
+		return fmt.Errorf("unknown validation profile %q", cfg.Profile)
+	}
+	salt := cfg.Key
+	if salt == "" {
+		salt = taskID
+	}
+	for name, rules := range cfg.Tables {
+		t, ok := s.tables[name]
+		if !ok {
+			t, _ = Compile(model.TableTransform{})
+			s.tables[name] = t
+		}
+		if err := t.setMasks(rules, cfg.Key, salt); err != nil {
+			return fmt.Errorf("invalid masking of table %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Names returns the keys of the transformed tables
+func (s *Set) Names() []string {
+	names := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	return names
+}
+
+// AddPartition makes a leaf partition use the transformation of its partitioned table
+// Leaf partitions are copied, and replicated without publish_via_partition_root, under their own names
+func (s *Set) AddPartition(leafSchema, leafName, table string) {
+	if _, ok := s.tables[table]; ok {
+		s.aliases[leafSchema+"."+leafName] = table
+	}
+}
+
+// Table returns the transformation of a source table, nil if the table is not transformed
+func (s *Set) Table(schema, table string) *Table {
+	if s == nil {
+		return nil
+	}
+	if t, ok := s.tables[schema+"."+table]; ok {
+		return t
+	}
+	if alias, ok := s.aliases[schema+"."+table]; ok {
+		return s.tables[alias]
+	}
+	// Unqualified names refer to tables in the public schema
+	if schema == "public" {
+		return s.tables[table]
+	}
+	return nil
+}
+
+// TransformChange transforms a replicated row change
+// Inserts not matching the filter or subset predicate are dropped. An update whose new row does
+// not match deletes the row; one that matches is an upsert, since the row may not have matched
+// before. The identity of updates and deletes only carries key columns, so it is renamed and cast
+// but never filtered. An update of a filtered table takes the unchanged TOAST values its new row
+// leaves out from the old row, which carries every column under REPLICA IDENTITY FULL.
+func (s *Set) TransformChange(change *wal.RowChange) ([]*wal.RowChange, error) {
+	t := s.Table(change.Table.Schema, change.Table.TableName)
+	subset := s.subsets[change.Table.Schema+"."+change.Table.TableName]
+	if t == nil {
+		if subset == nil {
+			return []*wal.RowChange{change}, nil
+		}
+		t = s.plain
+	}
+	filtered := t.filter != nil || subset != nil
+
+	table := t.mapTable(change.Table)
+	switch change.Op {
+	case wal.OpInsert:
+		after, match, err := t.mapRow(change.After, subset)
+		if err != nil || !match {
+			return nil, err
+		}
+		return []*wal.RowChange{{Op: wal.OpInsert, Table: table, After: after}}, nil
+
+	case wal.OpUpdate:
+		before, err := t.mapIdentity(change.Before)
+		if err != nil {
+			return nil, err
+		}
+		newRow := change.After
+		if filtered {
+			newRow = withUnchanged(change.After, change.Before)
+			// The upsert may insert the row, which needs every column
+			for _, col := range change.Table.Columns {
+				if _, ok := newRow[col]; !ok {
+					return nil, fmt.Errorf("update of %s.%s leaves out the unchanged TOAST value of column %s, set REPLICA IDENTITY FULL on the table to filter it", change.Table.Schema, change.Table.TableName, col)
+				}
+			}
+		}
+		after, match, err := t.mapRow(newRow, subset)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			return []*wal.RowChange{{Op: wal.OpDelete, Table: table, Before: before}}, nil
+		}
+		return []*wal.RowChange{{Op: wal.OpUpdate, Table: table, Before: before, After: after, Upsert: filtered}}, nil
+
+	case wal.OpDelete:
+		before, err := t.mapIdentity(change.Before)
+		if err != nil {
+			return nil, err
+		}
+		return []*wal.RowChange{{Op: wal.OpDelete, Table: table, Before: before}}, nil
+
+	default:
+		return []*wal.RowChange{{Op: change.Op, Table: table}}, nil
+	}
+}
+
+// mapTable maps the column lists of a replicated table to the target columns
+func (t *Table) mapTable(mapping wal.TableMapping) wal.TableMapping {
+	var columns []string
+	var types []int
+	for i, col := range mapping.Columns {
+		name := t.TargetName(col)
+		if name == "" {
+			continue
+		}
+		columns = append(columns, name)
+		oid := 0 // Unknown type OID, sinks treat the value as text
+		if !t.Cast(col) && !t.Masked(col) && i < len(mapping.ColumnTypes) {
+			oid = mapping.ColumnTypes[i]
+		}
+		types = append(types, oid)
+	}
+	for _, d := range t.derived {
+		columns = append(columns, d.name)
+		types = append(types, 0)
+	}
+	var keys []string
+	for _, col := range mapping.KeyColumns {
+		if name := t.TargetName(col); name != "" {
+			keys = append(keys, name)
+		}
+	}
+	mapping.Columns, mapping.ColumnTypes, mapping.KeyColumns = columns, types, keys
+	return mapping
+}
+
+// mapRow transforms the new row of an insert or update, subset is the subset predicate of the table if any
+// Columns missing from the row (unchanged TOAST values) stay missing and derived columns depending
+// on them are left out. Rows of filtered tables are complete, see TransformChange.
+func (t *Table) mapRow(values map[string]interface{}, subset *Expr) (map[string]interface{}, bool, error) {
+	row := func(column string) (Value, bool) {
+		v, ok := values[column]
+		return v, ok
+	}
+
+	for _, filter := range []*Expr{t.filter, subset} {
+		if filter == nil {
+			continue
+		}
+		match, err := filter.Match(row)
+		if err != nil || !match {
+			return nil, false, err
+		}
+	}
+
+	result, err := t.mapIdentity(values)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range t.derived {
+		d := &t.derived[i]
+		if d.expr != nil && !complete(values, d.expr.Columns()) {
+			continue
+		}
+		v, err := d.eval(row)
+		if err != nil {
+			return nil, false, err
+		}
+		result[d.name] = textValue(v)
+	}
+	return result, true, nil
+}
+
+// mapIdentity renames, drops and casts the source columns of a row
+func (t *Table) mapIdentity(values map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(values))
+	for col, v := range values {
+		name := t.TargetName(col)
+		if name == "" {
+			continue
+		}
+		if typ, ok := t.casts[col]; ok {
+			converted, err := typ.convert(v)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", col, err)
+			}
+			v = textValue(converted)
+		}
+		if m, ok := t.masks[col]; ok {
+			v = textValue(m.mask(v))
+		}
+		result[name] = v
+	}
+	return result, nil
+}
+
+// withUnchanged adds the columns missing from a new row with their values in the old row
+func withUnchanged(after, before map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(before)+len(after))
+	for col, v := range before {
+		row[col] = v
+	}
+	for col, v := range after {
+		row[col] = v
+	}
+	return row
+}
+
+// complete reports whether values has every column
+func complete(values map[string]interface{}, columns []string) bool {
+	for _, col := range columns {
+		if _, ok := values[col]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// textValue converts a value to the representation of row change values: nil or text
+func textValue(v Value) interface{} {
+	if s := Text(v); s != nil {
+		return *s
+	}
+	return nil
+}
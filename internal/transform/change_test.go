@@ -0,0 +1,181 @@
+package transform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pg/dts/internal/model"
+	"github.com/pg/dts/internal/wal"
+)
+
+// testTable is a replicated table with a key, a TOASTable body and a region
+var testTable = wal.TableMapping{
+	Schema: "public", TableName: "docs",
+	Columns:    []string{"id", "body", "region"},
+	KeyColumns: []string{"id"},
+}
+
+func newTestSet(t *testing.T, spec model.TableTransform) *Set {
+	t.Helper()
+	set, err := NewSet(map[string]model.TableTransform{"docs": spec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestTransformChangeFilter(t *testing.T) {
+	set := newTestSet(t, model.TableTransform{Filter: "region = 'eu'", Rename: map[string]string{"body": "content"}})
+
+	tests := []struct {
+		name   string
+		change *wal.RowChange
+		want   []*wal.RowChange
+	}{
+		{
+			name:   "insert matching",
+			change: &wal.RowChange{Op: wal.OpInsert, Table: testTable, After: map[string]interface{}{"id": "1", "body": "x", "region": "eu"}},
+			want:   []*wal.RowChange{{Op: wal.OpInsert, After: map[string]interface{}{"id": "1", "content": "x", "region": "eu"}}},
+		},
+		{
+			name:   "insert not matching",
+			change: &wal.RowChange{Op: wal.OpInsert, Table: testTable, After: map[string]interface{}{"id": "1", "body": "x", "region": "us"}},
+			want:   nil,
+		},
+		{
+			name:   "update leaving the filter deletes",
+			change: &wal.RowChange{Op: wal.OpUpdate, Table: testTable, Before: map[string]interface{}{"id": "1"}, After: map[string]interface{}{"id": "1", "body": "x", "region": "us"}},
+			want:   []*wal.RowChange{{Op: wal.OpDelete, Before: map[string]interface{}{"id": "1"}}},
+		},
+		{
+			name:   "update matching upserts",
+			change: &wal.RowChange{Op: wal.OpUpdate, Table: testTable, Before: map[string]interface{}{"id": "1"}, After: map[string]interface{}{"id": "1", "body": "x", "region": "eu"}},
+			want:   []*wal.RowChange{{Op: wal.OpUpdate, Before: map[string]interface{}{"id": "1"}, After: map[string]interface{}{"id": "1", "content": "x", "region": "eu"}, Upsert: true}},
+		},
+		{
+			name: "unchanged TOAST value is taken from the full old row",
+			change: &wal.RowChange{Op: wal.OpUpdate, Table: testTable,
+				Before: map[string]interface{}{"id": "1", "body": "old", "region": "us"},
+				After:  map[string]interface{}{"id": "1", "region": "eu"}},
+			want: []*wal.RowChange{{Op: wal.OpUpdate,
+				Before: map[string]interface{}{"id": "1", "content": "old", "region": "us"},
+				After:  map[string]interface{}{"id": "1", "content": "old", "region": "eu"}, Upsert: true}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := set.TransformChange(tt.change)
+		if err != nil {
+			t.Errorf("%s: error: %v", tt.name, err)
+			continue
+		}
+		for _, c := range got {
+			c.Table = wal.TableMapping{}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransformChangeFilterMissingTOAST(t *testing.T) {
+	set := newTestSet(t, model.TableTransform{Filter: "region = 'eu'"})
+
+	// Without REPLICA IDENTITY FULL the old row only has the key, the row cannot be completed
+	change := &wal.RowChange{Op: wal.OpUpdate, Table: testTable,
+		Before: map[string]interface{}{"id": "1"},
+		After:  map[string]interface{}{"id": "1", "region": "eu"}}
+	if _, err := set.TransformChange(change); err == nil || !strings.Contains(err.Error(), "REPLICA IDENTITY FULL") {
+		t.Errorf("TransformChange error = %v, want REPLICA IDENTITY FULL error", err)
+	}
+}
+
+func TestTransformChangeUnfilteredTOAST(t *testing.T) {
+	set := newTestSet(t, model.TableTransform{Add: []model.DerivedColumn{{Name: "size", Expr: "length(body)", Type: "integer"}}})
+
+	// Without a filter the update leaves the unchanged column and what derives from it alone
+	change := &wal.RowChange{Op: wal.OpUpdate, Table: testTable,
+		Before: map[string]interface{}{"id": "1"},
+		After:  map[string]interface{}{"id": "1", "region": "eu"}}
+	got, err := set.TransformChange(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"id": "1", "region": "eu"}
+	if len(got) != 1 || got[0].Upsert || !reflect.DeepEqual(got[0].After, want) {
+		t.Errorf("TransformChange = %+v, want update of %v", got, want)
+	}
+}
+
+func TestBindingMatch(t *testing.T) {
+	tr, err := Compile(model.TableTransform{Filter: "region = 'eu' AND trim(body) <> ''"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tr.Bind([]string{"id", "body", "region"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		row  []*string
+		want bool
+	}{
+		{[]*string{str("1"), str("text"), str("eu")}, true},
+		{[]*string{str("1"), str("  "), str("eu")}, false},
+		{[]*string{str("1"), str("text"), str("us")}, false},
+		{[]*string{str("1"), nil, str("eu")}, false},
+	}
+	for _, tt := range tests {
+		got, err := b.Match(tt.row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Match(%v) = %v, want %v", tt.row, got, tt.want)
+		}
+		_, applied, err := b.Apply(tt.row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != got {
+			t.Errorf("Apply and Match disagree on %v", tt.row)
+		}
+	}
+}
+
+func TestTransformChangeSubset(t *testing.T) {
+	set, err := NewSet(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := set.AddSubset("public", "docs", "region = 'eu'"); err != nil {
+		t.Fatal(err)
+	}
+	if !set.FiltersChanges("public", "docs") || set.FiltersChanges("public", "other") {
+		t.Error("FiltersChanges does not report the subset table only")
+	}
+
+	insert := &wal.RowChange{Op: wal.OpInsert, Table: testTable, After: map[string]interface{}{"id": "1", "body": "x", "region": "us"}}
+	if got, err := set.TransformChange(insert); err != nil || len(got) != 0 {
+		t.Errorf("insert outside the subset = %+v, %v, want dropped", got, err)
+	}
+	update := &wal.RowChange{Op: wal.OpUpdate, Table: testTable,
+		Before: map[string]interface{}{"id": "1", "body": "x", "region": "us"},
+		After:  map[string]interface{}{"id": "1", "region": "eu"}}
+	got, err := set.TransformChange(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"id": "1", "body": "x", "region": "eu"}
+	if len(got) != 1 || !got[0].Upsert || !reflect.DeepEqual(got[0].After, want) {
+		t.Errorf("update into the subset = %+v, want upsert of %v", got, want)
+	}
+	other := &wal.RowChange{Op: wal.OpInsert, Table: wal.TableMapping{Schema: "public", TableName: "other", Columns: []string{"id"}}, After: map[string]interface{}{"id": "1"}}
+	if got, err := set.TransformChange(other); err != nil || len(got) != 1 || got[0] != other {
+		t.Errorf("change of a table without subset = %+v, %v, want it unchanged", got, err)
+	}
+
+	if err := set.AddSubset("public", "bad", "created_at > now() -"); err == nil {
+		t.Error("AddSubset accepted an invalid predicate")
+	}
+}
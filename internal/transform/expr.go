@@ -0,0 +1,852 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expr is a compiled expression over the columns of a source row
+// The language is a subset of PostgreSQL expressions: column references, literals, arithmetic,
+// ||, comparisons, AND/OR/NOT, IS [NOT] NULL, [NOT] IN, [NOT] LIKE/ILIKE, [NOT] BETWEEN,
+// CASE, CAST(x AS type), x::type and the functions listed in functions.go
+type Expr struct {
+	source  string
+	root    node
+	columns []string // Columns referenced by the expression
+}
+
+// Row provides the column values an expression is evaluated on
+// ok is false if the row has no value for the column
+type Row func(column string) (value Value, ok bool)
+
+// node is a node of an expression tree
+type node interface {
+	eval(row Row) (Value, error)
+}
+
+// ParseExpr compiles an expression
+func ParseExpr(source string) (*Expr, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	p := &parser{tokens: tokens, columns: make(map[string]bool)}
+	root, err := p.parseExpr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	return &Expr{source: source, root: root, columns: p.columnList}, nil
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Columns returns the columns the expression references
+func (e *Expr) Columns() []string {
+	return e.columns
+}
+
+// Eval evaluates the expression on a row
+func (e *Expr) Eval(row Row) (Value, error) {
+	v, err := e.root.eval(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %w", e.source, err)
+	}
+	return v, nil
+}
+
+// Match evaluates the expression as a predicate, NULL counts as false
+func (e *Expr) Match(row Row) (bool, error) {
+	v, err := e.Eval(row)
+	if err != nil {
+		return false, err
+	}
+	if v == nil {
+		return false, nil
+	}
+	b, err := toBool(v)
+	if err != nil {
+		return false, fmt.Errorf("predicate %q: %w", e.source, err)
+	}
+	return b, nil
+}
+
+// parser is a recursive descent parser for expressions
+type parser struct {
+	tokens     []token
+	pos        int
+	columns    map[string]bool
+	columnList []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the keyword or operator text
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokenIdent || t.kind == tokenOperator) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		if t.kind == tokenEOF {
+			return fmt.Errorf("expected %q at end of expression", text)
+		}
+		return fmt.Errorf("expected %q at position %d, got %q", text, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseExpr() (node, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.accept("not") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.kind == tokenOperator {
+		switch t.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			return &compareNode{op: t.text, left: left, right: right}, nil
+		}
+	}
+
+	if p.accept("is") {
+		negate := p.accept("not")
+		if err := p.expect("null"); err != nil {
+			return nil, err
+		}
+		return &isNullNode{operand: left, negate: negate}, nil
+	}
+
+	negate := false
+	if p.peek().kind == tokenIdent && p.peek().text == "not" {
+		// NOT belongs to the following IN, LIKE, ILIKE or BETWEEN
+		if p.pos+1 < len(p.tokens) {
+			switch p.tokens[p.pos+1].text {
+			case "in", "like", "ilike", "between":
+				p.next()
+				negate = true
+			}
+		}
+	}
+
+	switch {
+	case p.accept("in"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &inNode{operand: left, list: list, negate: negate}, nil
+	case p.accept("like") || p.accept("ilike"):
+		insensitive := p.tokens[p.pos-1].text == "ilike"
+		pattern, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		return &likeNode{operand: left, pattern: pattern, insensitive: insensitive, negate: negate}, nil
+	case p.accept("between"):
+		low, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("and"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		var n node = &logicalNode{
+			left:  &compareNode{op: ">=", left: left, right: low},
+			right: &compareNode{op: "<=", left: left, right: high},
+		}
+		if negate {
+			n = &notNode{operand: n}
+		}
+		return n, nil
+	}
+	if negate {
+		return nil, fmt.Errorf("unexpected NOT at position %d", p.tokens[p.pos-1].pos)
+	}
+	return left, nil
+}
+
+// parseList parses expressions separated by commas up to the closing parenthesis
+func (p *parser) parseList() ([]node, error) {
+	var list []node
+	if p.accept(")") {
+		return list, nil
+	}
+	for {
+		item, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+		if p.accept(")") {
+			return list, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseConcat() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || (t.text != "+" && t.text != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithNode{op: "-", left: &literalNode{value: int64(0)}, right: operand}, nil
+	}
+	if p.accept("+") {
+		return p.parseUnary()
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	operand, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("::") {
+		typ, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+		operand = &castNode{operand: operand, typ: typ}
+	}
+	return operand, nil
+}
+
+// parseTypeName parses a type name such as integer, double precision or varchar(20)
+func (p *parser) parseTypeName() (*castType, error) {
+	var words []string
+	for p.peek().kind == tokenIdent && !keywords[p.peek().text] {
+		words = append(words, p.next().text)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("expected type name at position %d", p.peek().pos)
+	}
+	name := strings.Join(words, " ")
+	var modifiers []string
+	if p.accept("(") {
+		for {
+			t := p.next()
+			if t.kind != tokenNumber {
+				return nil, fmt.Errorf("invalid modifier of type %s at position %d", name, t.pos)
+			}
+			modifiers = append(modifiers, t.text)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Modifiers may also follow a multi-word name, e.g. timestamp(3) with time zone
+	for p.peek().kind == tokenIdent && !keywords[p.peek().text] {
+		name += " " + p.next().text
+	}
+	return newCastType(name, modifiers)
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		v, err := parseNumber(t.text)
+		if err != nil {
+			return nil, err
+		}
+		return &literalNode{value: v}, nil
+
+	case tokenString:
+		return &literalNode{value: t.text}, nil
+
+	case tokenQuotedIdent:
+		return p.column(t.text), nil
+
+	case tokenOperator:
+		if t.text == "(" {
+			inner, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+
+	case tokenIdent:
+		switch t.text {
+		case "null":
+			return &literalNode{value: nil}, nil
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "case":
+			return p.parseCase()
+		case "cast":
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			operand, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("as"); err != nil {
+				return nil, err
+			}
+			typ, err := p.parseTypeName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return &castNode{operand: operand, typ: typ}, nil
+		}
+		if keywords[t.text] {
+			break
+		}
+		if p.accept("(") {
+			fn, ok := functions[t.text]
+			if !ok {
+				return nil, fmt.Errorf("unknown function %s", t.text)
+			}
+			args, err := p.parseList()
+			if err != nil {
+				return nil, err
+			}
+			if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+				return nil, fmt.Errorf("wrong number of arguments for %s: %d", t.text, len(args))
+			}
+			return &callNode{name: t.text, fn: fn, args: args}, nil
+		}
+		return p.column(t.text), nil
+
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+// parseCase parses the remainder of a CASE expression, simple or searched
+func (p *parser) parseCase() (node, error) {
+	n := &caseNode{}
+	if p.peek().text != "when" {
+		operand, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		n.operand = operand
+	}
+	for p.accept("when") {
+		cond, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		result, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		n.whens = append(n.whens, cond)
+		n.thens = append(n.thens, result)
+	}
+	if len(n.whens) == 0 {
+		return nil, fmt.Errorf("CASE requires at least one WHEN")
+	}
+	if p.accept("else") {
+		result, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		n.otherwise = result
+	}
+	if err := p.expect("end"); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// column returns a column reference and records the column
+func (p *parser) column(name string) node {
+	if !p.columns[name] {
+		p.columns[name] = true
+		p.columnList = append(p.columnList, name)
+	}
+	return &columnNode{name: name}
+}
+
+// literalNode is a constant
+type literalNode struct {
+	value Value
+}
+
+func (n *literalNode) eval(Row) (Value, error) {
+	return n.value, nil
+}
+
+// columnNode is a column reference
+type columnNode struct {
+	name string
+}
+
+func (n *columnNode) eval(row Row) (Value, error) {
+	v, ok := row(n.name)
+	if !ok {
+		return nil, fmt.Errorf("column %q does not exist", n.name)
+	}
+	return v, nil
+}
+
+// logicalNode is AND or OR with three-valued logic
+type logicalNode struct {
+	or          bool
+	left, right node
+}
+
+func (n *logicalNode) eval(row Row) (Value, error) {
+	left, err := evalBool(n.left, row)
+	if err != nil {
+		return nil, err
+	}
+	// Short circuit: FALSE AND x is FALSE, TRUE OR x is TRUE
+	if left != nil && *left == n.or {
+		return *left, nil
+	}
+	right, err := evalBool(n.right, row)
+	if err != nil {
+		return nil, err
+	}
+	if right != nil && *right == n.or {
+		return *right, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return !n.or, nil
+}
+
+// notNode negates a boolean
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(row Row) (Value, error) {
+	b, err := evalBool(n.operand, row)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return !*b, nil
+}
+
+// evalBool evaluates a node as a boolean, nil means NULL
+func evalBool(n node, row Row) (*bool, error) {
+	v, err := n.eval(row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	b, err := toBool(v)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// compareNode compares two values
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(row Row) (Value, error) {
+	left, err := n.left.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	c, err := compare(left, right)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "=":
+		return c == 0, nil
+	case "<>", "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// isNullNode tests for NULL
+type isNullNode struct {
+	operand node
+	negate  bool
+}
+
+func (n *isNullNode) eval(row Row) (Value, error) {
+	v, err := n.operand.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	return (v == nil) != n.negate, nil
+}
+
+// inNode tests membership in a list
+type inNode struct {
+	operand node
+	list    []node
+	negate  bool
+}
+
+func (n *inNode) eval(row Row) (Value, error) {
+	v, err := n.operand.eval(row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	sawNull := false
+	for _, item := range n.list {
+		candidate, err := item.eval(row)
+		if err != nil {
+			return nil, err
+		}
+		if candidate == nil {
+			sawNull = true
+			continue
+		}
+		c, err := compare(v, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if c == 0 {
+			return !n.negate, nil
+		}
+	}
+	if sawNull {
+		return nil, nil
+	}
+	return n.negate, nil
+}
+
+// likeNode matches a LIKE or ILIKE pattern
+type likeNode struct {
+	operand, pattern node
+	insensitive      bool
+	negate           bool
+}
+
+func (n *likeNode) eval(row Row) (Value, error) {
+	v, err := n.operand.eval(row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	pattern, err := n.pattern.eval(row)
+	if err != nil || pattern == nil {
+		return nil, err
+	}
+	s, p := toText(v), toText(pattern)
+	if n.insensitive {
+		s, p = strings.ToLower(s), strings.ToLower(p)
+	}
+	return matchLike(s, p) != n.negate, nil
+}
+
+// matchLike matches s against a LIKE pattern, % matches any run, _ any character, \ escapes
+func matchLike(s, pattern string) bool {
+	str, pat := []rune(s), []rune(pattern)
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		for j < len(pat) {
+			switch pat[j] {
+			case '%':
+				for j < len(pat) && pat[j] == '%' {
+					j++
+				}
+				if j == len(pat) {
+					return true
+				}
+				for k := i; k <= len(str); k++ {
+					if match(k, j) {
+						return true
+					}
+				}
+				return false
+			case '_':
+				if i >= len(str) {
+					return false
+				}
+			case '\\':
+				if j+1 < len(pat) {
+					j++
+				}
+				fallthrough
+			default:
+				if i >= len(str) || str[i] != pat[j] {
+					return false
+				}
+			}
+			i++
+			j++
+		}
+		return i == len(str)
+	}
+	return match(0, 0)
+}
+
+// arithNode is an arithmetic or concatenation operator
+type arithNode struct {
+	op          string
+	left, right node
+}
+
+func (n *arithNode) eval(row Row) (Value, error) {
+	left, err := n.left.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	if n.op == "||" {
+		return toText(left) + toText(right), nil
+	}
+	return arithmetic(n.op, left, right)
+}
+
+// castNode converts a value to a type
+type castNode struct {
+	operand node
+	typ     *castType
+}
+
+func (n *castNode) eval(row Row) (Value, error) {
+	v, err := n.operand.eval(row)
+	if err != nil {
+		return nil, err
+	}
+	return n.typ.convert(v)
+}
+
+// caseNode is a simple or searched CASE
+type caseNode struct {
+	operand   node // nil for a searched CASE
+	whens     []node
+	thens     []node
+	otherwise node
+}
+
+func (n *caseNode) eval(row Row) (Value, error) {
+	var operand Value
+	if n.operand != nil {
+		var err error
+		if operand, err = n.operand.eval(row); err != nil {
+			return nil, err
+		}
+	}
+	for i, when := range n.whens {
+		var matched bool
+		if n.operand == nil {
+			b, err := evalBool(when, row)
+			if err != nil {
+				return nil, err
+			}
+			matched = b != nil && *b
+		} else {
+			candidate, err := when.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			if operand != nil && candidate != nil {
+				c, err := compare(operand, candidate)
+				if err != nil {
+					return nil, err
+				}
+				matched = c == 0
+			}
+		}
+		if matched {
+			return n.thens[i].eval(row)
+		}
+	}
+	if n.otherwise == nil {
+		return nil, nil
+	}
+	return n.otherwise.eval(row)
+}
+
+// callNode is a function call
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *callNode) eval(row Row) (Value, error) {
+	args := make([]Value, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(row)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,368 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []token
+	}{
+		{"a = 1", []token{{tokenIdent, "a", 0}, {tokenOperator, "=", 2}, {tokenNumber, "1", 4}}},
+		{"Name <> 'It''s'", []token{{tokenIdent, "name", 0}, {tokenOperator, "<>", 5}, {tokenString, "It's", 8}}},
+		{`"Mixed Case" >= .5e-3`, []token{{tokenQuotedIdent, "Mixed Case", 0}, {tokenOperator, ">=", 13}, {tokenNumber, ".5e-3", 16}}},
+		{"x::varchar(10)", []token{{tokenIdent, "x", 0}, {tokenOperator, "::", 1}, {tokenIdent, "varchar", 3}, {tokenOperator, "(", 10}, {tokenNumber, "10", 11}, {tokenOperator, ")", 13}}},
+		{"a||b", []token{{tokenIdent, "a", 0}, {tokenOperator, "||", 1}, {tokenIdent, "b", 3}}},
+		{"col_1$x", []token{{tokenIdent, "col_1$x", 0}}},
+	}
+	for _, tt := range tests {
+		got, err := lex(tt.input)
+		if err != nil {
+			t.Errorf("lex(%q) error: %v", tt.input, err)
+			continue
+		}
+		want := append(tt.want, token{kind: tokenEOF, pos: len(tt.input)})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("lex(%q) = %v, want %v", tt.input, got, want)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	for _, input := range []string{"'open", `"open`, "a ; b", "a ? b"} {
+		if _, err := lex(input); err == nil {
+			t.Errorf("lex(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"a =",
+		"(a = 1",
+		"a = 1)",
+		"unknown_fn(a)",
+		"lower(a, b)",
+		"a NOT = 1",
+		"a IS 1",
+		"CAST(a integer)",
+		"CASE WHEN a THEN 1",
+		"a BETWEEN 1",
+		"x::",
+	} {
+		if _, err := ParseExpr(input); err == nil {
+			t.Errorf("ParseExpr(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	e, err := ParseExpr(`lower(a) = b OR "C" IS NULL OR a > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Columns(), []string{"a", "b", "C"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Columns() = %v, want %v", got, want)
+	}
+}
+
+// testRow returns a row of text column values, a nil pointer is NULL
+func testRow(values map[string]*string) Row {
+	return func(column string) (Value, bool) {
+		v, ok := values[column]
+		if !ok {
+			return nil, false
+		}
+		if v == nil {
+			return nil, true
+		}
+		return *v, true
+	}
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func TestEval(t *testing.T) {
+	row := testRow(map[string]*string{
+		"id":     str("42"),
+		"name":   str("  Alice "),
+		"email":  str("alice@example.com"),
+		"amount": str("12.50"),
+		"active": str("t"),
+		"region": str("eu"),
+		"note":   nil,
+		"Mixed":  str("x"),
+	})
+
+	tests := []struct {
+		expr string
+		want Value
+	}{
+		// Literals and arithmetic
+		{"1 + 2 * 3", int64(7)},
+		{"(1 + 2) * 3", int64(9)},
+		{"7 / 2", int64(3)},
+		{"7 % 3", int64(1)},
+		{"7.0 / 2", 3.5},
+		{"-id", int64(-42)},
+		{"id + 1", int64(43)},
+		{"amount * 2", 25.0},
+		{"'a' || 'b' || id", "ab42"},
+		{"note || 'x'", nil},
+		{"NULL", nil},
+
+		// Comparisons
+		{"id = 42", true},
+		{"id > 100", false},
+		{"id <> 42", false},
+		{"id != 41", true},
+		{"amount >= 12.5", true},
+		{"region = 'eu'", true},
+		{"region < 'fr'", true},
+		{"active = true", true},
+		{"note = 1", nil},
+		{`"Mixed" = 'x'`, true},
+
+		// Logic with NULL
+		{"note = 1 AND false", false},
+		{"note = 1 AND true", nil},
+		{"note = 1 OR true", true},
+		{"note = 1 OR false", nil},
+		{"NOT (id = 42)", false},
+		{"NOT (note = 1)", nil},
+		{"note IS NULL", true},
+		{"note IS NOT NULL", false},
+		{"id IS NOT NULL", true},
+
+		// IN, LIKE, BETWEEN
+		{"region IN ('us', 'eu')", true},
+		{"region NOT IN ('us', 'eu')", false},
+		{"region IN ('us', NULL)", nil},
+		{"id IN (1, 42)", true},
+		{"email LIKE '%@example.com'", true},
+		{"email LIKE 'alice_example%'", true},
+		{"email LIKE 'alice_example'", false},
+		{"email NOT LIKE 'bob%'", true},
+		{"email ILIKE 'ALICE%'", true},
+		{"id BETWEEN 40 AND 50", true},
+		{"id NOT BETWEEN 40 AND 50", false},
+
+		// CASE and casts
+		{"CASE WHEN id > 40 THEN 'big' ELSE 'small' END", "big"},
+		{"CASE region WHEN 'us' THEN 1 WHEN 'eu' THEN 2 END", int64(2)},
+		{"CASE WHEN id < 0 THEN 1 END", nil},
+		{"id::text", "42"},
+		{"CAST(amount AS numeric(10,1))", "12.5"},
+		{"amount::float8::integer", int64(13)},
+		{"'yes'::boolean", true},
+		{"'2024-03-01 10:00:00'::date", "2024-03-01"},
+		{"name::varchar(3)", "  A"},
+
+		// Functions
+		{"lower(email)", "alice@example.com"},
+		{"upper(region)", "EU"},
+		{"trim(name)", "Alice"},
+		{"ltrim(name)", "Alice "},
+		{"rtrim(name)", "  Alice"},
+		{"length(region)", int64(2)},
+		{"substr(email, 1, 5)", "alice"},
+		{"substring(email, 7)", "example.com"},
+		{"left(email, 5)", "alice"},
+		{"left(email, -12)", "alice"},
+		{"right(email, 3)", "com"},
+		{"replace(email, 'example', 'test')", "alice@test.com"},
+		{"concat(region, note, id)", "eu42"},
+		{"concat_ws('-', region, note, id)", "eu-42"},
+		{"coalesce(note, region)", "eu"},
+		{"nullif(region, 'eu')", nil},
+		{"nullif(region, 'us')", "eu"},
+		{"abs(-5)", int64(5)},
+		{"round(amount)", 13.0},
+		{"round(2.345, 2)", 2.35},
+		{"floor(amount)", 12.0},
+		{"ceil(amount)", 13.0},
+		{"md5('a')", "0cc175b9c0f1b6a831c399e269772661"},
+		{"lower(note)", nil},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) error: %v", tt.expr, err)
+			continue
+		}
+		got, err := e.Eval(row)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Eval(%q) = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	row := testRow(map[string]*string{"id": str("42"), "name": str("alice"), "amount": str("12.50")})
+	for _, expr := range []string{
+		"missing = 1",
+		"id / 0",
+		"name + 1",
+		"name::integer",
+		"amount::integer",
+		"'70000'::smallint",
+		"'maybe'::boolean",
+		"'2024-13-45'::date",
+	} {
+		e, err := ParseExpr(expr)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) error: %v", expr, err)
+			continue
+		}
+		if _, err := e.Eval(row); err == nil {
+			t.Errorf("Eval(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	row := testRow(map[string]*string{"region": str("eu"), "deleted_at": nil, "flag": str("maybe")})
+	tests := []struct {
+		expr    string
+		want    bool
+		wantErr bool
+	}{
+		{"region = 'eu' AND deleted_at IS NULL", true, false},
+		{"region = 'us'", false, false},
+		{"deleted_at > '2024-01-01'", false, false}, // NULL does not match
+		{"region", false, true},                     // Not a boolean
+		{"flag = 'maybe'", true, false},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q) error: %v", tt.expr, err)
+		}
+		got, err := e.Match(row)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Match(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestMatchLike(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"abc", "abc", true},
+		{"abc", "a%", true},
+		{"abc", "%c", true},
+		{"abc", "%b%", true},
+		{"abc", "a_c", true},
+		{"abc", "a_", false},
+		{"", "%", true},
+		{"a%c", `a\%c`, true},
+		{"abc", `a\%c`, false},
+		{"a_c", `a\_c`, true},
+		{"résumé", "r_sum_", true},
+	}
+	for _, tt := range tests {
+		if got := matchLike(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("matchLike(%q, %q) = %v, want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b Value
+		want int
+	}{
+		{int64(2), int64(10), -1},
+		{"2", int64(10), -1}, // Text compared with a number is parsed as a number
+		{"2", "10", 1},       // Text compared with text uses byte order
+		{2.5, int64(2), 1},   // Mixed numbers compare as floats
+		{"t", true, 0},       // Text compared with a boolean is parsed as a boolean
+		{false, true, -1},
+		{"abc", "abd", -1},
+	}
+	for _, tt := range tests {
+		got, err := compare(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("compare(%#v, %#v) error: %v", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("compare(%#v, %#v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if _, err := compare("abc", int64(1)); err == nil {
+		t.Error("compare of text that is not a number with a number succeeded, want error")
+	}
+}
+
+func TestTrimMatchesPostgreSQL(t *testing.T) {
+	// PostgreSQL's trim removes spaces only, not tabs or newlines
+	row := testRow(map[string]*string{"v": str(" \tvalue\n ")})
+	for expr, want := range map[string]string{
+		"trim(v)":  "\tvalue\n",
+		"btrim(v)": "\tvalue\n",
+		"ltrim(v)": "\tvalue\n ",
+		"rtrim(v)": " \tvalue\n",
+	} {
+		e, err := ParseExpr(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := e.Eval(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Eval(%q) = %q, want %q", expr, got, want)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   castKind
+		length int
+		scale  int
+	}{
+		{"integer", castInteger, 0, -1},
+		{"double precision", castFloat, 0, -1},
+		{"varchar(20)", castText, 20, -1},
+		{"character varying(5)", castText, 5, -1},
+		{"numeric(10,2)", castNumeric, 0, 2},
+		{"numeric(4)", castNumeric, 0, 0},
+		{"timestamp(3) with time zone", castOther, 0, -1},
+		{"uuid", castOther, 0, -1},
+	}
+	for _, tt := range tests {
+		typ, err := parseType(tt.name)
+		if err != nil {
+			t.Errorf("parseType(%q) error: %v", tt.name, err)
+			continue
+		}
+		if typ.kind != tt.kind || typ.length != tt.length || typ.scale != tt.scale {
+			t.Errorf("parseType(%q) = kind %d length %d scale %d, want kind %d length %d scale %d",
+				tt.name, typ.kind, typ.length, typ.scale, tt.kind, tt.length, tt.scale)
+		}
+	}
+	for _, name := range []string{"", "varchar(x)", "numeric(10,"} {
+		if _, err := parseType(name); err == nil {
+			t.Errorf("parseType(%q) succeeded, want error", name)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package transform
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// function is a built-in function of the expression language
+type function struct {
+	minArgs int
+	maxArgs int  // -1 means variadic
+	nullOK  bool // Called with NULL arguments; otherwise a NULL argument gives NULL
+	impl    func(args []Value) (Value, error)
+}
+
+// call calls the function, returning NULL for NULL arguments unless the function handles them
+func (f function) call(args []Value) (Value, error) {
+	if !f.nullOK {
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+		}
+	}
+	return f.impl(args)
+}
+
+// functions are the built-in functions by name
+// They behave like the PostgreSQL functions of the same name, e.g. trim removes spaces only
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"lower":     textFunction(strings.ToLower),
+		"upper":     textFunction(strings.ToUpper),
+		"trim":      textFunction(func(s string) string { return strings.Trim(s, " ") }),
+		"btrim":     textFunction(func(s string) string { return strings.Trim(s, " ") }),
+		"ltrim":     textFunction(func(s string) string { return strings.TrimLeft(s, " ") }),
+		"rtrim":     textFunction(func(s string) string { return strings.TrimRight(s, " ") }),
+		"md5":       textFunction(func(s string) string { sum := md5.Sum([]byte(s)); return hex.EncodeToString(sum[:]) }),
+		"length":    {minArgs: 1, maxArgs: 1, impl: func(args []Value) (Value, error) { return int64(utf8.RuneCountInString(toText(args[0]))), nil }},
+		"substr":    {minArgs: 2, maxArgs: 3, impl: substr},
+		"substring": {minArgs: 2, maxArgs: 3, impl: substr},
+		"left": {minArgs: 2, maxArgs: 2, impl: func(args []Value) (Value, error) {
+			s := []rune(toText(args[0]))
+			n, err := intArg(args[1])
+			if err != nil {
+				return nil, err
+			}
+			if n < 0 {
+				n = max(int64(len(s))+n, 0)
+			}
+			return string(s[:min(n, int64(len(s)))]), nil
+		}},
+		"right": {minArgs: 2, maxArgs: 2, impl: func(args []Value) (Value, error) {
+			s := []rune(toText(args[0]))
+			n, err := intArg(args[1])
+			if err != nil {
+				return nil, err
+			}
+			if n < 0 {
+				n = max(int64(len(s))+n, 0)
+			}
+			return string(s[int64(len(s))-min(n, int64(len(s))):]), nil
+		}},
+		"replace": {minArgs: 3, maxArgs: 3, impl: func(args []Value) (Value, error) {
+			return strings.ReplaceAll(toText(args[0]), toText(args[1]), toText(args[2])), nil
+		}},
+		"concat": {minArgs: 0, maxArgs: -1, nullOK: true, impl: func(args []Value) (Value, error) {
+			var sb strings.Builder
+			for _, arg := range args {
+				if arg != nil {
+					sb.WriteString(toText(arg))
+				}
+			}
+			return sb.String(), nil
+		}},
+		"concat_ws": {minArgs: 1, maxArgs: -1, nullOK: true, impl: func(args []Value) (Value, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			var parts []string
+			for _, arg := range args[1:] {
+				if arg != nil {
+					parts = append(parts, toText(arg))
+				}
+			}
+			return strings.Join(parts, toText(args[0])), nil
+		}},
+		"coalesce": {minArgs: 1, maxArgs: -1, nullOK: true, impl: func(args []Value) (Value, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		}},
+		"nullif": {minArgs: 2, maxArgs: 2, nullOK: true, impl: func(args []Value) (Value, error) {
+			if args[0] == nil || args[1] == nil {
+				return args[0], nil
+			}
+			c, err := compare(args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			if c == 0 {
+				return nil, nil
+			}
+			return args[0], nil
+		}},
+		"abs": {minArgs: 1, maxArgs: 1, impl: func(args []Value) (Value, error) {
+			n, err := toNumber(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if i, ok := n.(int64); ok {
+				if i < 0 {
+					return -i, nil
+				}
+				return i, nil
+			}
+			return math.Abs(n.(float64)), nil
+		}},
+		"round": {minArgs: 1, maxArgs: 2, impl: func(args []Value) (Value, error) {
+			n, err := toNumber(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if i, ok := n.(int64); ok && len(args) == 1 {
+				return i, nil
+			}
+			f, _ := toFloat(n)
+			places := int64(0)
+			if len(args) == 2 {
+				if places, err = intArg(args[1]); err != nil {
+					return nil, err
+				}
+			}
+			scale := math.Pow(10, float64(places))
+			return math.Round(f*scale) / scale, nil
+		}},
+		"floor": floatFunction(math.Floor),
+		"ceil":  floatFunction(math.Ceil),
+	}
+}
+
+// textFunction wraps a string function of one argument
+func textFunction(fn func(string) string) function {
+	return function{minArgs: 1, maxArgs: 1, impl: func(args []Value) (Value, error) {
+		return fn(toText(args[0])), nil
+	}}
+}
+
+// floatFunction wraps a float function of one argument
+func floatFunction(fn func(float64) float64) function {
+	return function{minArgs: 1, maxArgs: 1, impl: func(args []Value) (Value, error) {
+		n, err := toNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := n.(int64); ok {
+			return i, nil
+		}
+		return fn(n.(float64)), nil
+	}}
+}
+
+// substr returns the characters from a 1-based position, optionally limited to a count
+func substr(args []Value) (Value, error) {
+	s := []rune(toText(args[0]))
+	from, err := intArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	end := int64(len(s)) + 1
+	if len(args) == 3 {
+		count, err := intArg(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, fmt.Errorf("negative substring length not allowed")
+		}
+		end = from + count
+	}
+	from = max(from, 1)
+	end = min(end, int64(len(s))+1)
+	if end <= from {
+		return "", nil
+	}
+	return string(s[from-1 : end-1]), nil
+}
+
+// intArg converts an argument to an integer
+func intArg(v Value) (int64, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	if i, ok := n.(int64); ok {
+		return i, nil
+	}
+	return int64(math.Round(n.(float64))), nil
+}
@@ -0,0 +1,119 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind classifies a lexical token of an expression
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenQuotedIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+// token is a lexical token of an expression
+type token struct {
+	kind tokenKind
+	text string // Identifiers are folded to lower case unless quoted, strings are unescaped
+	pos  int
+}
+
+// keywords are the reserved words of the expression language
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "is": true, "null": true, "true": true, "false": true,
+	"in": true, "like": true, "ilike": true, "between": true, "case": true, "when": true,
+	"then": true, "else": true, "end": true, "cast": true, "as": true,
+}
+
+// operators lists the operators, longest first so that they are matched greedily
+var operators = []string{"<>", "!=", "<=", ">=", "||", "::", "=", "<", ">", "+", "-", "*", "/", "%", "(", ")", ","}
+
+// lex splits an expression into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '\'':
+			// String literal, a doubled quote is a literal quote
+			var sb strings.Builder
+			start := i
+			i++
+			for {
+				if i >= len(input) {
+					return nil, fmt.Errorf("unterminated string at position %d", start)
+				}
+				if input[i] == '\'' {
+					if i+1 < len(input) && input[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+
+		case c == '"':
+			// Quoted identifier, case is kept
+			end := strings.IndexByte(input[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenQuotedIdent, text: input[i+1 : i+1+end], pos: i})
+			i += end + 2
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(input) && input[i+1] >= '0' && input[i+1] <= '9':
+			start := i
+			for i < len(input) && (input[i] >= '0' && input[i] <= '9' || input[i] == '.') {
+				i++
+			}
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				i++
+				if i < len(input) && (input[i] == '+' || input[i] == '-') {
+					i++
+				}
+				for i < len(input) && input[i] >= '0' && input[i] <= '9' {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: input[start:i], pos: start})
+
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(input) && (input[i] == '_' || input[i] == '$' || unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: strings.ToLower(input[start:i]), pos: start})
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(input[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
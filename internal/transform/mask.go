@@ -0,0 +1,89 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pg/dts/internal/model"
+)
+
+// defaultRedaction replaces redacted values when the rule has no value
+const defaultRedaction = "***"
+
+// masker anonymizes the values of a column
+// Every method is deterministic, so equal values stay equal across tables. Only hash, tokenize
+// and email keep distinct values distinct, see unique.
+type masker struct {
+	method string
+	key    []byte
+	salt   []byte
+	value  *string
+}
+
+// newMasker compiles a masking rule, salt is prepended to the values hashed by the hash method
+func newMasker(rule model.MaskRule, key, salt string) (*masker, error) {
+	m := &masker{method: rule.Method, key: []byte(key), salt: []byte(salt), value: rule.Value}
+	switch rule.Method {
+	case model.MaskHash, model.MaskNull:
+	case model.MaskRedact:
+		if m.value == nil {
+			redaction := defaultRedaction
+			m.value = &redaction
+		}
+	case model.MaskTokenize, model.MaskEmail, model.MaskPhone:
+		if key == "" {
+			return nil, fmt.Errorf("masking method %s requires a masking key", rule.Method)
+		}
+	default:
+		return nil, fmt.Errorf("unknown masking method %q", rule.Method)
+	}
+	return m, nil
+}
+
+// mask returns the masked value, NULL stays NULL
+func (m *masker) mask(v Value) Value {
+	if v == nil {
+		return nil
+	}
+	s := toText(v)
+	switch m.method {
+	case model.MaskHash:
+		h := sha256.New()
+		h.Write(m.salt)
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	case model.MaskTokenize:
+		return hex.EncodeToString(m.mac(s))
+	case model.MaskRedact:
+		return *m.value
+	case model.MaskEmail:
+		return "user_" + hex.EncodeToString(m.mac(s)[:8]) + "@example.com"
+	case model.MaskPhone:
+		// 555-01xx numbers are reserved for fictional use in every area code
+		n := binary.BigEndian.Uint64(m.mac(s)[:8])
+		return fmt.Sprintf("+1-%03d-555-01%02d", 200+n%800, n/800%100)
+	default:
+		return nil
+	}
+}
+
+// unique reports whether distinct values stay distinct, which a masked key or unique column needs
+// redact and null collapse every value and phone has only 80,000 outputs
+func (m *masker) unique() bool {
+	switch m.method {
+	case model.MaskHash, model.MaskTokenize, model.MaskEmail:
+		return true
+	default:
+		return false
+	}
+}
+
+// mac returns the HMAC-SHA256 of s under the masking key
+func (m *masker) mac(s string) []byte {
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
@@ -0,0 +1,84 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/pg/dts/internal/model"
+)
+
+func TestHashSalt(t *testing.T) {
+	a, err := newMasker(model.MaskRule{Method: model.MaskHash}, "", "task-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newMasker(model.MaskRule{Method: model.MaskHash}, "", "task-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.mask("alice") != a.mask("alice") {
+		t.Error("hash is not deterministic")
+	}
+	if a.mask("alice") == b.mask("alice") {
+		t.Error("hash is not salted")
+	}
+}
+
+func TestCheckUniqueMasks(t *testing.T) {
+	set, err := NewSet(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = set.AddMasking(&model.MaskingConfig{Key: "secret", Tables: map[string]map[string]model.MaskRule{
+		"users": {
+			"id":    {Method: model.MaskTokenize},
+			"email": {Method: model.MaskEmail},
+			"phone": {Method: model.MaskPhone},
+			"name":  {Method: model.MaskRedact},
+			"note":  {Method: model.MaskNull},
+		},
+	}}, "task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := set.Table("public", "users")
+
+	tests := []struct {
+		unique []string
+		ok     bool
+	}{
+		{[]string{"id", "email"}, true},
+		{[]string{"id", "phone"}, false},
+		{[]string{"name"}, false},
+		{[]string{"note"}, false},
+		{[]string{"unmasked"}, true},
+	}
+	for _, tt := range tests {
+		if err := tr.CheckUniqueMasks(tt.unique); (err == nil) != tt.ok {
+			t.Errorf("CheckUniqueMasks(%v) = %v, want ok %v", tt.unique, err, tt.ok)
+		}
+	}
+}
+
+func TestMaskedExpressionColumns(t *testing.T) {
+	tests := []struct {
+		spec model.TableTransform
+		ok   bool
+	}{
+		{model.TableTransform{Add: []model.DerivedColumn{{Name: "domain", Expr: "lower(email)"}}}, false},
+		{model.TableTransform{Add: []model.DerivedColumn{{Name: "region", Expr: "upper(country)"}}}, true},
+		{model.TableTransform{Filter: "email LIKE '%@example.com'"}, false},
+		{model.TableTransform{Filter: "country = 'NL'"}, true},
+	}
+	for _, tt := range tests {
+		set, err := NewSet(map[string]model.TableTransform{"users": tt.spec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = set.AddMasking(&model.MaskingConfig{Tables: map[string]map[string]model.MaskRule{
+			"users": {"email": {Method: model.MaskHash}},
+		}}, "task")
+		if (err == nil) != tt.ok {
+			t.Errorf("AddMasking with %+v = %v, want ok %v", tt.spec, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package transform
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/pg/dts/internal/model"
+)
+
+// Table is a compiled transformation of one source table
+// Source columns are renamed, dropped, cast and masked, derived columns are appended and rows not
+// matching the filter are skipped. Everything refers to columns by their source names.
+type Table struct {
+	spec    model.TableTransform
+	rename  map[string]string
+	drop    map[string]bool
+	casts   map[string]*castType
+	masks   map[string]*masker
+	derived []derivedColumn
+	filter  *Expr
+}
+
+// derivedColumn is a compiled column added by a transformation
+type derivedColumn struct {
+	name  string
+	typ   *castType
+	value Value // Constant value, used when expr is nil
+	expr  *Expr
+}
+
+// Compile compiles the transformation of a table
+func Compile(spec model.TableTransform) (*Table, error) {
+	t := &Table{
+		spec:   spec,
+		rename: spec.Rename,
+		drop:   make(map[string]bool, len(spec.Drop)),
+		casts:  make(map[string]*castType, len(spec.Cast)),
+		masks:  make(map[string]*masker),
+	}
+	if t.rename == nil {
+		t.rename = map[string]string{}
+	}
+	for _, col := range spec.Drop {
+		t.drop[col] = true
+	}
+	for col, typeName := range spec.Cast {
+		typ, err := parseType(typeName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cast of column %s: %w", col, err)
+		}
+		t.casts[col] = typ
+	}
+
+	for _, add := range spec.Add {
+		if add.Name == "" {
+			return nil, fmt.Errorf("added column requires a name")
+		}
+		typeName := add.Type
+		if typeName == "" {
+			typeName = "text"
+		}
+		typ, err := parseType(typeName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type of column %s: %w", add.Name, err)
+		}
+		column := derivedColumn{name: add.Name, typ: typ}
+		switch {
+		case add.Expr != "" && add.Value != nil:
+			return nil, fmt.Errorf("column %s has both a value and an expression", add.Name)
+		case add.Expr != "":
+			if column.expr, err = ParseExpr(add.Expr); err != nil {
+				return nil, fmt.Errorf("invalid expression of column %s: %w", add.Name, err)
+			}
+		case add.Value != nil:
+			if column.value, err = typ.convert(*add.Value); err != nil {
+				return nil, fmt.Errorf("invalid value of column %s: %w", add.Name, err)
+			}
+		}
+		t.derived = append(t.derived, column)
+	}
+
+	if spec.Filter != "" {
+		filter, err := ParseExpr(spec.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		t.filter = filter
+	}
+	return t, nil
+}
+
+// parseType parses a type name as written in a cast
+func parseType(name string) (*castType, error) {
+	tokens, err := lex(name)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, columns: make(map[string]bool)}
+	typ, err := p.parseTypeName()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("invalid type name %q", name)
+	}
+	return typ, nil
+}
+
+// setMasks masks the values of source columns after they are cast, keyed by source column
+// Derived columns and the filter are evaluated on the unmasked values, so they may not use masked
+// columns, which they would copy or leak unmasked
+func (t *Table) setMasks(rules map[string]model.MaskRule, key, salt string) error {
+	for col, rule := range rules {
+		m, err := newMasker(rule, key, salt)
+		if err != nil {
+			return fmt.Errorf("invalid masking of column %s: %w", col, err)
+		}
+		for _, derived := range t.derived {
+			if derived.expr != nil && slices.Contains(derived.expr.Columns(), col) {
+				return fmt.Errorf("column %s is masked and cannot be used by added column %s", col, derived.name)
+			}
+		}
+		if t.filter != nil && slices.Contains(t.filter.Columns(), col) {
+			return fmt.Errorf("column %s is masked and cannot be used by the filter", col)
+		}
+		t.masks[col] = m
+	}
+	return nil
+}
+
+// Masked reports whether the values of a source column are masked
+func (t *Table) Masked(column string) bool {
+	return t.masks[column] != nil
+}
+
+// CheckUniqueMasks rejects masking methods that collapse distinct values on key or unique columns
+func (t *Table) CheckUniqueMasks(columns []string) error {
+	for _, col := range columns {
+		if m := t.masks[col]; m != nil && !m.unique() {
+			return fmt.Errorf("column %s is part of a primary key or unique constraint and cannot be masked with %s", col, m.method)
+		}
+	}
+	return nil
+}
+
+// Cast reports whether the values of a source column are cast to another type
+func (t *Table) Cast(column string) bool {
+	return t.casts[column] != nil
+}
+
+// Spec returns the declaration the table was compiled from
+func (t *Table) Spec() model.TableTransform {
+	return t.spec
+}
+
+// HasFilter reports whether rows are filtered
+func (t *Table) HasFilter() bool {
+	return t.filter != nil
+}
+
+// TargetName returns the target name of a source column, empty if the column is dropped
+func (t *Table) TargetName(column string) string {
+	if t.drop[column] {
+		return ""
+	}
+	if name, ok := t.rename[column]; ok {
+		return name
+	}
+	return column
+}
+
+// referenced returns the source columns named by the transformation
+func (t *Table) referenced() []string {
+	seen := make(map[string]bool)
+	var columns []string
+	add := func(col string) {
+		if !seen[col] {
+			seen[col] = true
+			columns = append(columns, col)
+		}
+	}
+	for col := range t.rename {
+		add(col)
+	}
+	for col := range t.drop {
+		add(col)
+	}
+	for col := range t.casts {
+		add(col)
+	}
+	for col := range t.masks {
+		add(col)
+	}
+	for _, d := range t.derived {
+		if d.expr != nil {
+			for _, col := range d.expr.Columns() {
+				add(col)
+			}
+		}
+	}
+	if t.filter != nil {
+		for _, col := range t.filter.Columns() {
+			add(col)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// Binding is a transformation bound to the column order of a source COPY stream
+type Binding struct {
+	table   *Table
+	source  []string
+	index   map[string]int
+	outputs []output
+	columns []string
+}
+
+// output produces one target column from a source column or a derived column
+type output struct {
+	source  int // Index of the source column, -1 for derived columns
+	cast    *castType
+	mask    *masker
+	derived *derivedColumn
+}
+
+// Bind binds the transformation to the columns of a source table
+// keep selects the target columns that are written, nil keeps all of them.
+// Returns an error if the transformation names a column the source does not have
+// or two target columns get the same name.
+func (t *Table) Bind(source []string, keep func(column string) bool) (*Binding, error) {
+	index := make(map[string]int, len(source))
+	for i, col := range source {
+		index[col] = i
+	}
+	for _, col := range t.referenced() {
+		if _, ok := index[col]; !ok {
+			return nil, fmt.Errorf("transformation references unknown column %s", col)
+		}
+	}
+
+	b := &Binding{table: t, source: source, index: index}
+	seen := make(map[string]bool)
+	addOutput := func(name string, out output) error {
+		if seen[name] {
+			return fmt.Errorf("transformation produces column %s twice", name)
+		}
+		seen[name] = true
+		if keep != nil && !keep(name) {
+			return nil
+		}
+		b.columns = append(b.columns, name)
+		b.outputs = append(b.outputs, out)
+		return nil
+	}
+	for i, col := range source {
+		name := t.TargetName(col)
+		if name == "" {
+			continue
+		}
+		if err := addOutput(name, output{source: i, cast: t.casts[col], mask: t.masks[col]}); err != nil {
+			return nil, err
+		}
+	}
+	for i := range t.derived {
+		if err := addOutput(t.derived[i].name, output{source: -1, derived: &t.derived[i]}); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Columns returns the target columns in output order
+func (b *Binding) Columns() []string {
+	return b.columns
+}
+
+// row returns the column values of a source row given in source column order
+func (b *Binding) row(values []*string) Row {
+	return func(column string) (Value, bool) {
+		i, ok := b.index[column]
+		if !ok || i >= len(values) {
+			return nil, false
+		}
+		if values[i] == nil {
+			return nil, true
+		}
+		return *values[i], true
+	}
+}
+
+// Match reports whether a source row given in source column order matches the filter
+// Rows always match when the table has no filter
+func (b *Binding) Match(values []*string) (bool, error) {
+	if b.table.filter == nil {
+		return true, nil
+	}
+	return b.table.filter.Match(b.row(values))
+}
+
+// Apply transforms a source row given in source column order, nil values are NULL
+// Returns false if the row does not match the filter
+func (b *Binding) Apply(values []*string) ([]*string, bool, error) {
+	row := b.row(values)
+	if b.table.filter != nil {
+		match, err := b.table.filter.Match(row)
+		if err != nil || !match {
+			return nil, false, err
+		}
+	}
+
+	result := make([]*string, len(b.outputs))
+	for i, out := range b.outputs {
+		var v Value
+		var err error
+		if out.derived != nil {
+			v, err = out.derived.eval(row)
+		} else {
+			v, _ = row(b.source[out.source])
+			if out.cast != nil {
+				v, err = out.cast.convert(v)
+			}
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if out.mask != nil {
+			v = out.mask.mask(v)
+		}
+		result[i] = Text(v)
+	}
+	return result, true, nil
+}
+
+// eval computes the value of a derived column
+func (d *derivedColumn) eval(row Row) (Value, error) {
+	if d.expr == nil {
+		return d.value, nil
+	}
+	v, err := d.expr.Eval(row)
+	if err != nil {
+		return nil, err
+	}
+	v, err = d.typ.convert(v)
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %w", d.name, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,386 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value is the value of an expression: nil (NULL), string, int64, float64 or bool
+// Column values are strings holding the PostgreSQL text representation of the value,
+// they are converted on demand when used as numbers or booleans
+type Value interface{}
+
+// Text returns the PostgreSQL text representation of a value, nil for NULL
+func Text(v Value) *string {
+	if v == nil {
+		return nil
+	}
+	s := toText(v)
+	return &s
+}
+
+// toText formats a non-NULL value as text
+func toText(v Value) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return formatFloat(x)
+	case bool:
+		if x {
+			return "t"
+		}
+		return "f"
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// formatFloat formats a float like PostgreSQL's float8 output
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseNumber parses a numeric literal or text, integers stay exact
+func parseNumber(s string) (Value, error) {
+	s = strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+// toNumber converts a non-NULL value to int64 or float64
+func toNumber(v Value) (Value, error) {
+	switch x := v.(type) {
+	case int64, float64:
+		return x, nil
+	case string:
+		return parseNumber(x)
+	default:
+		return nil, fmt.Errorf("%s is not a number", toText(v))
+	}
+}
+
+// toFloat converts a non-NULL value to float64
+func toFloat(v Value) (float64, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	if i, ok := n.(int64); ok {
+		return float64(i), nil
+	}
+	return n.(float64), nil
+}
+
+// toBool converts a non-NULL value to a boolean, accepting the spellings PostgreSQL accepts
+func toBool(v Value) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(x)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return true, nil
+		case "f", "false", "n", "no", "off", "0":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%s is not a boolean", toText(v))
+}
+
+// compare orders two non-NULL values
+// Numbers compare numerically, booleans as false < true, everything else as text in byte order
+func compare(a, b Value) (int, error) {
+	_, aNum := a.(int64)
+	_, aFloat := a.(float64)
+	_, bNum := b.(int64)
+	_, bFloat := b.(float64)
+	if aNum || aFloat || bNum || bFloat {
+		x, err := toNumber(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := toNumber(b)
+		if err != nil {
+			return 0, err
+		}
+		if xi, ok := x.(int64); ok {
+			if yi, ok := y.(int64); ok {
+				return cmpOrdered(xi, yi), nil
+			}
+		}
+		xf, _ := toFloat(x)
+		yf, _ := toFloat(y)
+		return cmpOrdered(xf, yf), nil
+	}
+
+	_, aBool := a.(bool)
+	_, bBool := b.(bool)
+	if aBool || bBool {
+		x, err := toBool(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := toBool(b)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case x == y:
+			return 0, nil
+		case !x:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+	return strings.Compare(toText(a), toText(b)), nil
+}
+
+func cmpOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// arithmetic applies + - * / % to two non-NULL values
+// Integer operands give integer results (division truncates), others floating point results
+func arithmetic(op string, a, b Value) (Value, error) {
+	x, err := toNumber(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toNumber(b)
+	if err != nil {
+		return nil, err
+	}
+
+	xi, xInt := x.(int64)
+	yi, yInt := y.(int64)
+	if xInt && yInt {
+		switch op {
+		case "+":
+			return xi + yi, nil
+		case "-":
+			return xi - yi, nil
+		case "*":
+			return xi * yi, nil
+		case "/", "%":
+			if yi == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if op == "/" {
+				return xi / yi, nil
+			}
+			return xi % yi, nil
+		}
+	}
+
+	xf, _ := toFloat(x)
+	yf, _ := toFloat(y)
+	switch op {
+	case "+":
+		return xf + yf, nil
+	case "-":
+		return xf - yf, nil
+	case "*":
+		return xf * yf, nil
+	case "/":
+		if yf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return xf / yf, nil
+	default:
+		if yf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(xf, yf), nil
+	}
+}
+
+// castKind is the conversion a cast performs
+type castKind int
+
+const (
+	castText    castKind = iota // Text types, optionally truncated to a length
+	castInteger                 // Integer types, range checked
+	castFloat                   // Floating point types
+	castNumeric                 // numeric, optionally rounded to a scale
+	castBool                    // boolean
+	castDate                    // date
+	castOther                   // Types parsed by the target, the text is passed through
+)
+
+// castType is the target type of a cast
+type castType struct {
+	name     string
+	kind     castKind
+	length   int   // Maximum length of text types, 0 means unlimited
+	scale    int   // Scale of numeric, -1 means unconstrained
+	min, max int64 // Range of integer types
+}
+
+// newCastType resolves a type name and its modifiers
+func newCastType(name string, modifiers []string) (*castType, error) {
+	t := &castType{name: name, scale: -1}
+	mods := make([]int, len(modifiers))
+	for i, m := range modifiers {
+		n, err := strconv.Atoi(m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modifier %s of type %s", m, name)
+		}
+		mods[i] = n
+	}
+
+	switch name {
+	case "text", "name":
+		t.kind = castText
+	case "varchar", "character varying", "char", "character", "bpchar":
+		t.kind = castText
+		if len(mods) > 0 {
+			t.length = mods[0]
+		}
+	case "smallint", "int2":
+		t.kind, t.min, t.max = castInteger, math.MinInt16, math.MaxInt16
+	case "integer", "int", "int4":
+		t.kind, t.min, t.max = castInteger, math.MinInt32, math.MaxInt32
+	case "bigint", "int8":
+		t.kind, t.min, t.max = castInteger, math.MinInt64, math.MaxInt64
+	case "real", "float4", "double precision", "float8", "float":
+		t.kind = castFloat
+	case "numeric", "decimal":
+		t.kind = castNumeric
+		if len(mods) > 1 {
+			t.scale = mods[1]
+		} else if len(mods) == 1 {
+			t.scale = 0
+		}
+	case "boolean", "bool":
+		t.kind = castBool
+	case "date":
+		t.kind = castDate
+	default:
+		t.kind = castOther
+	}
+	return t, nil
+}
+
+// dateLayouts are the accepted date and timestamp input formats
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05.999999-07",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05.999999-07:00",
+	time.RFC3339Nano,
+}
+
+// convert casts a value to the type
+func (t *castType) convert(v Value) (Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t.kind {
+	case castText:
+		s := toText(v)
+		if t.length > 0 && len([]rune(s)) > t.length {
+			s = string([]rune(s)[:t.length])
+		}
+		return s, nil
+
+	case castInteger:
+		if b, ok := v.(bool); ok {
+			if b {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		n, err := toNumber(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input for type %s: %w", t.name, err)
+		}
+		i, ok := n.(int64)
+		if !ok {
+			if _, isString := v.(string); isString {
+				return nil, fmt.Errorf("invalid input syntax for type %s: %q", t.name, toText(v))
+			}
+			// Floating point values round half away from zero
+			f := math.Round(n.(float64))
+			if f < math.MinInt64 || f >= math.MaxInt64 {
+				return nil, fmt.Errorf("%s out of range", t.name)
+			}
+			i = int64(f)
+		}
+		if i < t.min || i > t.max {
+			return nil, fmt.Errorf("%s out of range", t.name)
+		}
+		return i, nil
+
+	case castFloat:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input for type %s: %w", t.name, err)
+		}
+		return f, nil
+
+	case castNumeric:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input for type %s: %w", t.name, err)
+		}
+		if t.scale >= 0 {
+			return strconv.FormatFloat(f, 'f', t.scale, 64), nil
+		}
+		// Unconstrained numeric keeps the exact input text
+		if s, ok := v.(string); ok {
+			return strings.TrimSpace(s), nil
+		}
+		return toText(v), nil
+
+	case castBool:
+		b, err := toBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input for type %s: %w", t.name, err)
+		}
+		return b, nil
+
+	case castDate:
+		s := strings.TrimSpace(toText(v))
+		for _, layout := range dateLayouts {
+			if d, err := time.Parse(layout, s); err == nil {
+				return d.Format("2006-01-02"), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid input syntax for type date: %q", s)
+
+	default:
+		return toText(v), nil
+	}
+}
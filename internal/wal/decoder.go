@@ -70,6 +70,18 @@ func (d *Decoder) Decode(msg pglogrepl.Message) (Message, error) {
 			Timestamp:         v.CommitTime,
 		}, nil
 
+	case *pglogrepl.LogicalDecodingMessage:
+		return &LogicalDecodingMessage{
+			LSN:           v.LSN.String(),
+			Transactional: v.Transactional,
+			Prefix:        v.Prefix,
+			Content:       v.Content,
+		}, nil
+
+	case *pglogrepl.TypeMessage, *pglogrepl.OriginMessage:
+		// Type and origin messages carry no row changes, skip them
+		return nil, nil
+
 	default:
 		return nil, fmt.Errorf("unknown message type: %T", v)
 	}
@@ -100,10 +112,9 @@ func convertTuple(tuple *pglogrepl.TupleData) *Tuple {
 	}
 
 	for i, col := range tuple.Columns {
-		// Note: In newer versions of pglogrepl, TupleDataColumn may not have Kind field
-		// Use DataType to determine type
+		// Note: pglogrepl stores the pgoutput column kind ('n', 'u', 't', 'b') in DataType
 		result.Columns[i] = TupleColumn{
-			Kind:     0, // If Kind doesn't exist, use 0 or infer from DataType
+			Kind:     col.DataType,
 			DataType: int(col.DataType),
 			Length:   int(col.Length),
 			Data:     col.Data,
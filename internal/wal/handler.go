@@ -3,19 +3,46 @@ package wal
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
+// TableNameMapper maps a replicated table to its target schema and table name
+type TableNameMapper func(schema, tableName string) (string, string)
+
 // Handler handles WAL changes
 type Handler struct {
 	tableMapping map[int]TableMapping // relationID -> table mapping
+	sink         Sink                 // Receives changes, nil means changes are only decoded
+	mapper       TableNameMapper      // Maps source table name to target table name
+
+	limiter     ApplyLimiter        // Throttles the changes passed to the sink, nil means unlimited
+	transformer ChangeTransformer   // Reshapes changes before they reach the sink, nil means unchanged
+	markers     *MarkerLog          // Applied logical decoding messages, nil means they are ignored
+	pending     []Marker            // Transactional markers of the current transaction
+	prepared    map[string][]Marker // Transactional markers of prepared transactions by GID
+}
+
+// ApplyLimiter throttles the row changes passed to a sink
+type ApplyLimiter interface {
+	// WaitApply blocks until rows and bytes may be applied
+	WaitApply(ctx context.Context, rows, bytes int) error
+}
+
+// ChangeTransformer reshapes row changes before they are passed to a sink
+type ChangeTransformer interface {
+	// TransformChange returns the changes to pass on instead of change, none to drop it
+	TransformChange(change *RowChange) ([]*RowChange, error)
 }
 
 // TableMapping represents table mapping
 type TableMapping struct {
-	Schema     string
-	TableName  string
-	TargetName string // Target table name (with suffix)
-	Columns    []string
+	Schema       string
+	TableName    string
+	TargetSchema string // Target schema name
+	TargetName   string // Target table name
+	Columns      []string
+	ColumnTypes  []int    // Type OID of each column, in the order of Columns
+	KeyColumns   []string // Replica identity columns, used to locate rows on update/delete
 }
 
 // NewHandler creates a handler
@@ -25,12 +52,66 @@ func NewHandler() *Handler {
 	}
 }
 
+// NewHandlerWithSink creates a handler that passes changes to sink
+// mapper is used to resolve the target table name when a relation is first seen
+func NewHandlerWithSink(sink Sink, mapper TableNameMapper) *Handler {
+	h := NewHandler()
+	h.sink = sink
+	h.mapper = mapper
+	return h
+}
+
+// SetLimiter throttles the row changes passed to the sink
+func (h *Handler) SetLimiter(limiter ApplyLimiter) {
+	h.limiter = limiter
+}
+
+// SetTransformer reshapes the row changes passed to the sink
+func (h *Handler) SetTransformer(transformer ChangeTransformer) {
+	h.transformer = transformer
+}
+
+// SetMarkerLog records applied logical decoding messages in markers
+func (h *Handler) SetMarkerLog(markers *MarkerLog) {
+	h.markers = markers
+	h.prepared = make(map[string][]Marker)
+}
+
+// Markers returns the marker log, nil if markers are not recorded
+func (h *Handler) Markers() *MarkerLog {
+	return h.markers
+}
+
+// Delivered returns the end LSN of the last transaction delivered by a deferred sink and whether
+// committed transactions are still waiting for delivery; other sinks deliver on commit
+func (h *Handler) Delivered() (string, bool) {
+	if deferred, ok := h.sink.(DeferredSink); ok {
+		return deferred.Delivered()
+	}
+	return "", false
+}
+
+// Retryable reports whether a transaction that failed may be handled again from its first message
+func (h *Handler) Retryable() bool {
+	retryable, ok := h.sink.(RetryableSink)
+	return ok && retryable.Retryable()
+}
+
+// Close closes the sink
+func (h *Handler) Close() error {
+	if h.sink == nil {
+		return nil
+	}
+	return h.sink.Close()
+}
+
 // RegisterTable registers table mapping
-func (h *Handler) RegisterTable(relationID int, schema, tableName, targetName string) {
+func (h *Handler) RegisterTable(relationID int, schema, tableName, targetSchema, targetName string) {
 	h.tableMapping[relationID] = TableMapping{
-		Schema:     schema,
-		TableName:  tableName,
-		TargetName: targetName,
+		Schema:       schema,
+		TableName:    tableName,
+		TargetSchema: targetSchema,
+		TargetName:   targetName,
 	}
 }
 
@@ -40,19 +121,36 @@ func (h *Handler) Handle(ctx context.Context, msg Message) error {
 	case *RelationMessage:
 		// Relation message, record table mapping
 		cols := make([]string, len(v.Columns))
+		colTypes := make([]int, len(v.Columns))
+		var keyCols []string
 		for i, c := range v.Columns {
 			cols[i] = c.Name
+			colTypes[i] = c.DataTypeOID
+			// Flag bit 1 marks the column as part of the replica identity key
+			if c.Flags&1 != 0 {
+				keyCols = append(keyCols, c.Name)
+			}
 		}
 		// Register with schema.tableName as key, TargetName reserved, will be registered when injected by upper layer
 		if m, ok := h.tableMapping[v.RelationID]; ok {
 			m.Columns = cols
+			m.ColumnTypes = colTypes
+			m.KeyColumns = keyCols
 			h.tableMapping[v.RelationID] = m
 		} else {
+			// Default same name, upper layer can override with a name mapping
+			targetSchema, targetName := v.Namespace, v.RelationName
+			if h.mapper != nil {
+				targetSchema, targetName = h.mapper(v.Namespace, v.RelationName)
+			}
 			h.tableMapping[v.RelationID] = TableMapping{
-				Schema:     v.Namespace,
-				TableName:  v.RelationName,
-				TargetName: v.RelationName, // Default same name, upper layer can override with suffix
-				Columns:    cols,
+				Schema:       v.Namespace,
+				TableName:    v.RelationName,
+				TargetSchema: targetSchema,
+				TargetName:   targetName,
+				Columns:      cols,
+				ColumnTypes:  colTypes,
+				KeyColumns:   keyCols,
 			}
 		}
 		return nil
@@ -69,14 +167,30 @@ func (h *Handler) Handle(ctx context.Context, msg Message) error {
 	case *TruncateMessage:
 		return h.handleTruncate(ctx, v)
 
-	case *BeginMessage:
-		// Begin transaction, can initialize transaction context here
+	case *LogicalDecodingMessage:
+		h.handleMessage(v)
 		return nil
 
+	case *BeginMessage:
+		h.pending = h.pending[:0]
+		if h.sink == nil {
+			return nil
+		}
+		return h.sink.Begin(ctx, v)
+
 	case *CommitMessage:
-		// Commit transaction
+		if h.sink != nil {
+			if err := h.sink.Commit(ctx, v); err != nil {
+				return err
+			}
+		}
+		h.applyMarkers(h.pending)
+		h.pending = h.pending[:0]
 		return nil
 
+	case *BeginPrepareMessage, *PrepareMessage, *CommitPreparedMessage, *RollbackPreparedMessage:
+		return h.handleTwoPhase(ctx, msg)
+
 	default:
 		return fmt.Errorf("unknown message type: %s", msg.Type())
 	}
@@ -90,9 +204,7 @@ func (h *Handler) handleInsert(ctx context.Context, msg *InsertMessage) error {
 	}
 
 	values := tupleToMap(mapping.Columns, msg.Tuple)
-	_ = values
-	// Actual execution should call target database, left for upper layer integration (TargetRepository.ApplyInsert)
-	return nil
+	return h.emit(ctx, &RowChange{Op: OpInsert, Table: mapping, After: values})
 }
 
 // handleUpdate handles update
@@ -102,10 +214,14 @@ func (h *Handler) handleUpdate(ctx context.Context, msg *UpdateMessage) error {
 		return fmt.Errorf("unknown relation ID: %d", msg.RelationID)
 	}
 
-	oldVals := tupleToMap(mapping.Columns, msg.OldTuple)
 	newVals := tupleToMap(mapping.Columns, msg.NewTuple)
-	_, _ = oldVals, newVals
-	return nil
+	// Without an old tuple the key did not change, locate the row by the key columns of the new tuple
+	oldTuple := msg.OldTuple
+	if oldTuple == nil {
+		oldTuple = msg.NewTuple
+	}
+	oldVals := keyValues(mapping, tupleToMap(mapping.Columns, oldTuple))
+	return h.emit(ctx, &RowChange{Op: OpUpdate, Table: mapping, Before: oldVals, After: newVals})
 }
 
 // handleDelete handles delete
@@ -115,17 +231,159 @@ func (h *Handler) handleDelete(ctx context.Context, msg *DeleteMessage) error {
 		return fmt.Errorf("unknown relation ID: %d", msg.RelationID)
 	}
 
-	where := tupleToMap(mapping.Columns, msg.OldTuple)
-	_ = where
-	return nil
+	where := keyValues(mapping, tupleToMap(mapping.Columns, msg.OldTuple))
+	return h.emit(ctx, &RowChange{Op: OpDelete, Table: mapping, Before: where})
 }
 
 // handleTruncate handles truncate
 func (h *Handler) handleTruncate(ctx context.Context, msg *TruncateMessage) error {
-	// TODO: Handle truncate operation (need to find tables by RelationIDs and execute TRUNCATE)
+	for _, relationID := range msg.RelationIDs {
+		mapping, ok := h.tableMapping[relationID]
+		if !ok {
+			return fmt.Errorf("unknown relation ID: %d", relationID)
+		}
+		if err := h.emit(ctx, &RowChange{Op: OpTruncate, Table: mapping}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleTwoPhase passes a two-phase commit message to the sink
+// Markers of a prepared transaction are applied when it is committed
+func (h *Handler) handleTwoPhase(ctx context.Context, msg Message) error {
+	var sink PreparedSink
+	if h.sink != nil {
+		var ok bool
+		if sink, ok = h.sink.(PreparedSink); !ok {
+			return fmt.Errorf("sink does not support prepared transactions")
+		}
+	}
+
+	switch v := msg.(type) {
+	case *BeginPrepareMessage:
+		h.pending = h.pending[:0]
+		if sink != nil {
+			return sink.BeginPrepare(ctx, v)
+		}
+	case *PrepareMessage:
+		if sink != nil {
+			if err := sink.Prepare(ctx, v); err != nil {
+				return err
+			}
+		}
+		if h.markers != nil && len(h.pending) > 0 {
+			h.prepared[v.GID] = append([]Marker(nil), h.pending...)
+		}
+		h.pending = h.pending[:0]
+	case *CommitPreparedMessage:
+		if sink != nil {
+			if err := sink.CommitPrepared(ctx, v); err != nil {
+				return err
+			}
+		}
+		h.applyMarkers(h.prepared[v.GID])
+		delete(h.prepared, v.GID)
+	case *RollbackPreparedMessage:
+		if sink != nil {
+			if err := sink.RollbackPrepared(ctx, v); err != nil {
+				return err
+			}
+		}
+		delete(h.prepared, v.GID)
+	}
 	return nil
 }
 
+// handleMessage records a logical decoding message
+// Transactional messages are applied with their transaction, others immediately
+func (h *Handler) handleMessage(msg *LogicalDecodingMessage) {
+	if h.markers == nil {
+		return
+	}
+	marker := Marker{
+		LSN:           msg.LSN,
+		Prefix:        msg.Prefix,
+		Content:       string(msg.Content),
+		Transactional: msg.Transactional,
+	}
+	if msg.Transactional {
+		h.pending = append(h.pending, marker)
+		return
+	}
+	h.applyMarkers([]Marker{marker})
+}
+
+// applyMarkers records markers as applied
+func (h *Handler) applyMarkers(markers []Marker) {
+	if h.markers == nil {
+		return
+	}
+	now := time.Now()
+	for _, m := range markers {
+		m.AppliedAt = now
+		h.markers.Add(m)
+	}
+}
+
+// emit passes a row change to the sink
+func (h *Handler) emit(ctx context.Context, change *RowChange) error {
+	if h.sink == nil {
+		return nil
+	}
+	if h.transformer == nil {
+		return h.apply(ctx, change)
+	}
+	changes, err := h.transformer.TransformChange(change)
+	if err != nil {
+		return fmt.Errorf("failed to transform %s on %s.%s: %w", change.Op, change.Table.Schema, change.Table.TableName, err)
+	}
+	for _, c := range changes {
+		if err := h.apply(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply passes a row change to the sink once the limiter allows it
+func (h *Handler) apply(ctx context.Context, change *RowChange) error {
+	if h.limiter != nil {
+		if err := h.limiter.WaitApply(ctx, 1, changeSize(change)); err != nil {
+			return err
+		}
+	}
+	return h.sink.Change(ctx, change)
+}
+
+// changeSize returns the size of the column values of a row change in bytes
+func changeSize(change *RowChange) int {
+	size := 0
+	for _, values := range []map[string]interface{}{change.Before, change.After} {
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				size += len(s)
+			}
+		}
+	}
+	return size
+}
+
+// keyValues restricts values to the replica identity key columns
+// Returns values unchanged if the relation has no key columns (REPLICA IDENTITY FULL or NOTHING)
+func keyValues(mapping TableMapping, values map[string]interface{}) map[string]interface{} {
+	if len(mapping.KeyColumns) == 0 {
+		return values
+	}
+	result := make(map[string]interface{}, len(mapping.KeyColumns))
+	for _, col := range mapping.KeyColumns {
+		if v, ok := values[col]; ok {
+			result[col] = v
+		}
+	}
+	return result
+}
+
 // tupleToMap converts Tuple to a map of column name -> value
 func tupleToMap(columns []string, tuple *Tuple) map[string]interface{} {
 	result := make(map[string]interface{})
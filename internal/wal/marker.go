@@ -0,0 +1,70 @@
+package wal
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// MarkerPrefixFence is the logical decoding message prefix of DTS switchover fences
+const MarkerPrefixFence = "dts.fence"
+
+// markerLogSize is the number of markers kept per stream
+const markerLogSize = 1000
+
+// Marker represents a logical decoding message (pg_logical_emit_message) that has been applied
+// A transactional marker is applied once its transaction has been committed by the sink,
+// so every change committed on the source before it has been applied as well
+type Marker struct {
+	LSN           string    `json:"lsn"`
+	Prefix        string    `json:"prefix"`
+	Content       string    `json:"content"`
+	Transactional bool      `json:"transactional"`
+	AppliedAt     time.Time `json:"applied_at"`
+}
+
+// MarkerLog keeps the most recent markers of a stream
+type MarkerLog struct {
+	mu      sync.Mutex
+	markers []Marker
+}
+
+// NewMarkerLog creates a marker log
+func NewMarkerLog() *MarkerLog {
+	return &MarkerLog{}
+}
+
+// Add records an applied marker, dropping the oldest one when the log is full
+func (l *MarkerLog) Add(m Marker) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.markers) >= markerLogSize {
+		l.markers = append(l.markers[:0], l.markers[1:]...)
+	}
+	l.markers = append(l.markers, m)
+}
+
+// List returns the markers whose prefix starts with prefix, oldest first
+func (l *MarkerLog) List(prefix string) []Marker {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := make([]Marker, 0, len(l.markers))
+	for _, m := range l.markers {
+		if strings.HasPrefix(m.Prefix, prefix) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// Contains returns whether a marker with prefix and content has been applied
+func (l *MarkerLog) Contains(prefix, content string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range l.markers {
+		if m.Prefix == prefix && m.Content == content {
+			return true
+		}
+	}
+	return false
+}
@@ -91,6 +91,74 @@ func (m *CommitMessage) Type() string {
 	return "commit"
 }
 
+// LogicalDecodingMessage represents a message written with pg_logical_emit_message
+type LogicalDecodingMessage struct {
+	LSN           string
+	Transactional bool
+	Prefix        string
+	Content       []byte
+}
+
+func (m *LogicalDecodingMessage) Type() string {
+	return "message"
+}
+
+// BeginPrepareMessage represents the begin of a transaction prepared with PREPARE TRANSACTION
+type BeginPrepareMessage struct {
+	PrepareLSN string
+	EndLSN     string
+	Timestamp  time.Time
+	XID        int
+	GID        string // Global identifier of the prepared transaction
+}
+
+func (m *BeginPrepareMessage) Type() string {
+	return "begin_prepare"
+}
+
+// PrepareMessage represents the end of a prepared transaction's changes
+type PrepareMessage struct {
+	Flags      int
+	PrepareLSN string
+	EndLSN     string
+	Timestamp  time.Time
+	XID        int
+	GID        string
+}
+
+func (m *PrepareMessage) Type() string {
+	return "prepare"
+}
+
+// CommitPreparedMessage represents COMMIT PREPARED of a prepared transaction
+type CommitPreparedMessage struct {
+	Flags     int
+	CommitLSN string
+	EndLSN    string
+	Timestamp time.Time
+	XID       int
+	GID       string
+}
+
+func (m *CommitPreparedMessage) Type() string {
+	return "commit_prepared"
+}
+
+// RollbackPreparedMessage represents ROLLBACK PREPARED of a prepared transaction
+type RollbackPreparedMessage struct {
+	Flags             int
+	PrepareEndLSN     string
+	RollbackEndLSN    string
+	PrepareTimestamp  time.Time
+	RollbackTimestamp time.Time
+	XID               int
+	GID               string
+}
+
+func (m *RollbackPreparedMessage) Type() string {
+	return "rollback_prepared"
+}
+
 // Tuple represents a tuple
 type Tuple struct {
 	Columns []TupleColumn
@@ -0,0 +1,74 @@
+package wal
+
+import "context"
+
+// Row change operations
+const (
+	OpInsert   = "insert"
+	OpUpdate   = "update"
+	OpDelete   = "delete"
+	OpTruncate = "truncate"
+)
+
+// RowChange represents a decoded row change of a replicated table
+type RowChange struct {
+	Op     string                 // insert, update, delete, truncate
+	Table  TableMapping           // Source table and its mapped target table
+	Before map[string]interface{} // Row identity for update and delete, nil for insert and truncate
+	After  map[string]interface{} // New row for insert and update, nil for delete and truncate
+	Upsert bool                   // The updated row may be missing on the target and is then inserted
+}
+
+// Sink receives the changes of a replication stream
+// Changes arrive between Begin and Commit of their source transaction
+type Sink interface {
+	// Begin is called when a source transaction starts
+	Begin(ctx context.Context, msg *BeginMessage) error
+
+	// Change is called for every row change of the transaction
+	Change(ctx context.Context, change *RowChange) error
+
+	// Commit is called when a source transaction commits
+	Commit(ctx context.Context, msg *CommitMessage) error
+
+	// Close flushes pending changes and releases resources
+	Close() error
+}
+
+// PreparedSink is implemented by sinks that can stage prepared transactions
+// The changes of a prepared transaction arrive between BeginPrepare and Prepare, the transaction
+// is resolved later by CommitPrepared or RollbackPrepared, possibly after other transactions
+type PreparedSink interface {
+	Sink
+
+	// BeginPrepare is called when a prepared source transaction starts
+	BeginPrepare(ctx context.Context, msg *BeginPrepareMessage) error
+
+	// Prepare is called when the source transaction has been prepared
+	Prepare(ctx context.Context, msg *PrepareMessage) error
+
+	// CommitPrepared is called when the source commits a prepared transaction
+	CommitPrepared(ctx context.Context, msg *CommitPreparedMessage) error
+
+	// RollbackPrepared is called when the source rolls back a prepared transaction
+	RollbackPrepared(ctx context.Context, msg *RollbackPreparedMessage) error
+}
+
+// DeferredSink is implemented by sinks that deliver committed transactions after Commit returns
+// The stream only confirms changes to the source once they are delivered
+type DeferredSink interface {
+	Sink
+
+	// Delivered returns the end LSN of the last transaction delivered, empty if none, and whether
+	// committed transactions are still waiting for delivery
+	Delivered() (lsn string, pending bool)
+}
+
+// RetryableSink is implemented by sinks that discard a transaction that fails to apply
+// A failed transaction is then handled again from its first message.
+type RetryableSink interface {
+	Sink
+
+	// Retryable reports whether failed transactions may be handled again
+	Retryable() bool
+}
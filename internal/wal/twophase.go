@@ -0,0 +1,142 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// pgoutput two-phase message types (protocol version 3), not parsed by pglogrepl
+const (
+	twoPhaseBeginPrepare     byte = 'b'
+	twoPhasePrepare          byte = 'P'
+	twoPhaseCommitPrepared   byte = 'K'
+	twoPhaseRollbackPrepared byte = 'r'
+)
+
+// postgresEpoch is the origin of PostgreSQL timestamps
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DecodeData decodes a raw pgoutput message, including the two-phase commit messages
+// Returns nil for messages that carry nothing to apply
+func (d *Decoder) DecodeData(data []byte) (Message, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty logical replication message")
+	}
+
+	switch data[0] {
+	case twoPhaseBeginPrepare, twoPhasePrepare, twoPhaseCommitPrepared, twoPhaseRollbackPrepared:
+		return decodeTwoPhase(data)
+	}
+
+	msg, err := pglogrepl.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse logical message: %w", err)
+	}
+	return d.Decode(msg)
+}
+
+// decodeTwoPhase decodes a two-phase commit message
+func decodeTwoPhase(data []byte) (Message, error) {
+	r := &twoPhaseReader{buf: data[1:]}
+
+	var msg Message
+	switch data[0] {
+	case twoPhaseBeginPrepare:
+		msg = &BeginPrepareMessage{
+			PrepareLSN: r.lsn(),
+			EndLSN:     r.lsn(),
+			Timestamp:  r.time(),
+			XID:        r.xid(),
+			GID:        r.string(),
+		}
+	case twoPhasePrepare:
+		msg = &PrepareMessage{
+			Flags:      r.flags(),
+			PrepareLSN: r.lsn(),
+			EndLSN:     r.lsn(),
+			Timestamp:  r.time(),
+			XID:        r.xid(),
+			GID:        r.string(),
+		}
+	case twoPhaseCommitPrepared:
+		msg = &CommitPreparedMessage{
+			Flags:     r.flags(),
+			CommitLSN: r.lsn(),
+			EndLSN:    r.lsn(),
+			Timestamp: r.time(),
+			XID:       r.xid(),
+			GID:       r.string(),
+		}
+	case twoPhaseRollbackPrepared:
+		msg = &RollbackPreparedMessage{
+			Flags:             r.flags(),
+			PrepareEndLSN:     r.lsn(),
+			RollbackEndLSN:    r.lsn(),
+			PrepareTimestamp:  r.time(),
+			RollbackTimestamp: r.time(),
+			XID:               r.xid(),
+			GID:               r.string(),
+		}
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to decode %s message: %w", msg.Type(), r.err)
+	}
+	return msg, nil
+}
+
+// twoPhaseReader reads the fields of a two-phase message, recording the first error
+type twoPhaseReader struct {
+	buf []byte
+	err error
+}
+
+// take returns the next n bytes
+func (r *twoPhaseReader) take(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if len(r.buf) < n {
+		r.err = fmt.Errorf("message too short")
+		return make([]byte, n)
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *twoPhaseReader) flags() int {
+	return int(r.take(1)[0])
+}
+
+func (r *twoPhaseReader) lsn() string {
+	return pglogrepl.LSN(binary.BigEndian.Uint64(r.take(8))).String()
+}
+
+func (r *twoPhaseReader) time() time.Time {
+	micros := int64(binary.BigEndian.Uint64(r.take(8)))
+	return postgresEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+func (r *twoPhaseReader) xid() int {
+	return int(binary.BigEndian.Uint32(r.take(4)))
+}
+
+// string reads a null-terminated string
+func (r *twoPhaseReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.buf, 0)
+	if end < 0 {
+		r.err = fmt.Errorf("unterminated string")
+		return ""
+	}
+	s := string(r.buf[:end])
+	r.buf = r.buf[end+1:]
+	return s
+}